@@ -1,16 +1,22 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
 	"time"
 
-	"github.com/jeanhaley32/go-openai-client"
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/backends/mock"
 )
 
 func TestNewAgent(t *testing.T) {
-	backend := openai.NewMockBackend()
+	backend := mock.NewMockBackend()
 	agent := NewAgent("TestAgent", backend)
 
 	if agent == nil {
@@ -35,7 +41,7 @@ func TestNewAgent(t *testing.T) {
 }
 
 func TestAgent_LoadContext(t *testing.T) {
-	backend := openai.NewMockBackend()
+	backend := mock.NewMockBackend()
 	agent := NewAgent("TestAgent", backend)
 
 	// Create a temporary test file
@@ -67,8 +73,79 @@ func TestAgent_LoadContext(t *testing.T) {
 	}
 }
 
+func TestAgent_LoadContexts(t *testing.T) {
+	agent := NewAgent("TestAgent", mock.NewMockBackend())
+
+	standards := createTempFile(t, "Use gofmt.")
+	defer os.Remove(standards)
+	glossary := createTempFile(t, "Subtask: a step of a breakdown.")
+	defer os.Remove(glossary)
+
+	if err := agent.LoadContexts(standards, glossary); err != nil {
+		t.Fatalf("LoadContexts failed: %v", err)
+	}
+
+	expected := "# " + standards + "\n\nUse gofmt.\n\n---\n\n# " + glossary + "\n\nSubtask: a step of a breakdown."
+	if agent.context != expected {
+		t.Errorf("Expected context %q, got %q", expected, agent.context)
+	}
+
+	// A failing file aborts and names the file without touching the context
+	err := agent.LoadContexts(standards, "missing-context.txt")
+	if err == nil || !strings.Contains(err.Error(), "missing-context.txt") {
+		t.Errorf("Expected error naming the missing file, got %v", err)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected wrapped not-exist error, got %v", err)
+	}
+	if agent.context != expected {
+		t.Error("Context should be unchanged after a failed load")
+	}
+}
+
+func TestAgent_LoadContextFromURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/context.txt":
+			w.Write([]byte("Remote context"))
+		case "/huge.txt":
+			// Stream without a Content-Length header
+			w.Header().Set("Transfer-Encoding", "chunked")
+			chunk := strings.Repeat("x", 64*1024)
+			for written := 0; written <= maxContextBytes; written += len(chunk) {
+				w.Write([]byte(chunk))
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	agent := NewAgent("TestAgent", mock.NewMockBackend())
+
+	if err := agent.LoadContext(server.URL + "/context.txt"); err != nil {
+		t.Fatalf("LoadContext failed: %v", err)
+	}
+	if agent.context != "Remote context" {
+		t.Errorf("Expected remote context, got %q", agent.context)
+	}
+
+	err := agent.LoadContext(server.URL + "/missing.txt")
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected error with status code, got %v", err)
+	}
+
+	err = agent.LoadContext(server.URL + "/huge.txt")
+	if err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("Expected size limit error, got %v", err)
+	}
+	if agent.context != "Remote context" {
+		t.Error("Context should be unchanged after a failed load")
+	}
+}
+
 func TestAgent_SendMessage(t *testing.T) {
-	backend := openai.NewMockBackend()
+	backend := mock.NewMockBackend()
 	agent := NewAgent("TestAgent", backend)
 
 	tests := []struct {
@@ -149,24 +226,24 @@ func TestAgent_SendMessage(t *testing.T) {
 }
 
 func TestAgent_SendChatCompletion(t *testing.T) {
-	backend := openai.NewMockBackend()
+	backend := mock.NewMockBackend()
 	agent := NewAgent("TestAgent", backend)
 
 	tests := []struct {
 		name     string
-		messages []openai.Message
+		messages []ai.Message
 		wantErr  bool
 	}{
 		{
 			name: "single user message",
-			messages: []openai.Message{
+			messages: []ai.Message{
 				{Role: "user", Content: "Hello"},
 			},
 			wantErr: false,
 		},
 		{
 			name: "conversation flow",
-			messages: []openai.Message{
+			messages: []ai.Message{
 				{Role: "user", Content: "Hello"},
 				{Role: "assistant", Content: "Hi there!"},
 				{Role: "user", Content: "How are you?"},
@@ -175,12 +252,12 @@ func TestAgent_SendChatCompletion(t *testing.T) {
 		},
 		{
 			name:     "empty messages",
-			messages: []openai.Message{},
+			messages: []ai.Message{},
 			wantErr:  false, // Mock backend handles this
 		},
 		{
 			name: "system message included",
-			messages: []openai.Message{
+			messages: []ai.Message{
 				{Role: "system", Content: "Be helpful"},
 				{Role: "user", Content: "Hello"},
 			},
@@ -244,7 +321,7 @@ func TestAgent_SendChatCompletion(t *testing.T) {
 }
 
 func TestAgent_SendChatCompletion_WithContext(t *testing.T) {
-	backend := openai.NewMockBackend()
+	backend := mock.NewMockBackend()
 	agent := NewAgent("TestAgent", backend)
 
 	// Load context
@@ -257,7 +334,7 @@ func TestAgent_SendChatCompletion_WithContext(t *testing.T) {
 		t.Fatalf("Failed to load context: %v", err)
 	}
 
-	messages := []openai.Message{
+	messages := []ai.Message{
 		{Role: "user", Content: "Help me with Go"},
 	}
 
@@ -278,7 +355,7 @@ func TestAgent_SendChatCompletion_WithContext(t *testing.T) {
 }
 
 func TestAgent_PrintContext(t *testing.T) {
-	backend := openai.NewMockBackend()
+	backend := mock.NewMockBackend()
 	agent := NewAgent("TestAgent", backend)
 
 	// Load some context
@@ -297,7 +374,7 @@ func TestAgent_PrintContext(t *testing.T) {
 }
 
 func TestAgent_ContextIsolation(t *testing.T) {
-	backend := openai.NewMockBackend()
+	backend := mock.NewMockBackend()
 
 	// Create two agents
 	agent1 := NewAgent("Agent1", backend)
@@ -337,7 +414,7 @@ func TestAgent_ContextIsolation(t *testing.T) {
 }
 
 func TestAgent_MessageTimeout(t *testing.T) {
-	backend := openai.NewMockBackend()
+	backend := mock.NewMockBackend()
 	agent := NewAgent("TestAgent", backend)
 
 	// The mock backend has a 100ms delay, and our agent uses a 30-second timeout
@@ -359,13 +436,35 @@ func TestAgent_MessageTimeout(t *testing.T) {
 	}
 }
 
+func TestAgent_ConfigurableTimeout(t *testing.T) {
+	backend := mock.NewMockBackend()
+
+	// The mock backend takes 100ms, so a 10ms timeout should expire
+	agent := NewAgent("TestAgent", backend).WithTimeout(10 * time.Millisecond)
+	if _, err := agent.SendMessage("Hello"); err == nil {
+		t.Error("Expected SendMessage to time out")
+	}
+	if _, err := agent.SendChatCompletion([]ai.Message{{Role: "user", Content: "Hello"}}); err == nil {
+		t.Error("Expected SendChatCompletion to time out")
+	}
+
+	// The zero value falls back to the default
+	agent.Timeout = 0
+	if agent.requestTimeout() != defaultTimeout {
+		t.Errorf("Expected zero timeout to use default %v, got %v", defaultTimeout, agent.requestTimeout())
+	}
+	if _, err := agent.SendMessage("Hello"); err != nil {
+		t.Errorf("Expected default timeout to succeed, got %v", err)
+	}
+}
+
 func TestAgent_ConcurrentMessages(t *testing.T) {
-	backend := openai.NewMockBackend()
+	backend := mock.NewMockBackend()
 	agent := NewAgent("TestAgent", backend)
 
 	// Test that the agent can handle concurrent requests
 	const numRequests = 5
-	responses := make(chan *openai.Response, numRequests)
+	responses := make(chan *ai.Response, numRequests)
 	errors := make(chan error, numRequests)
 
 	for i := 0; i < numRequests; i++ {
@@ -423,7 +522,7 @@ func createTempFile(t *testing.T, content string) string {
 
 // Benchmark tests
 func BenchmarkAgent_SendMessage(b *testing.B) {
-	backend := openai.NewMockBackend()
+	backend := mock.NewMockBackend()
 	agent := NewAgent("BenchAgent", backend)
 
 	b.ResetTimer()
@@ -436,10 +535,10 @@ func BenchmarkAgent_SendMessage(b *testing.B) {
 }
 
 func BenchmarkAgent_SendChatCompletion(b *testing.B) {
-	backend := openai.NewMockBackend()
+	backend := mock.NewMockBackend()
 	agent := NewAgent("BenchAgent", backend)
 
-	messages := []openai.Message{
+	messages := []ai.Message{
 		{Role: "user", Content: "Benchmark test message"},
 	}
 
@@ -451,3 +550,183 @@ func BenchmarkAgent_SendChatCompletion(b *testing.B) {
 		}
 	}
 }
+
+func TestAgent_Logger(t *testing.T) {
+	var logs bytes.Buffer
+	agent := NewAgent("LoggedAgent", mock.NewMockBackend()).
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	if _, err := agent.SendChatCompletion([]ai.Message{{Role: "user", Content: "Hello"}}); err != nil {
+		t.Fatalf("SendChatCompletion failed: %v", err)
+	}
+
+	output := logs.String()
+	for _, want := range []string{`msg="chat completion sent"`, "agent=LoggedAgent", "model=mock-model-v1", "tokens=", "duration_ms="} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected log to contain %q, got: %s", want, output)
+		}
+	}
+}
+
+func TestAgent_SystemPromptAndContext(t *testing.T) {
+	user := ai.Message{Role: "user", Content: "Review this"}
+
+	tests := []struct {
+		name         string
+		systemPrompt string
+		context      string
+		want         []string
+	}{
+		{"neither", "", "", []string{"Review this"}},
+		{"prompt only", "You are a terse reviewer", "", []string{"You are a terse reviewer", "Review this"}},
+		{"context only", "", "Codebase summary", []string{"Codebase summary", "Review this"}},
+		{"both", "You are a terse reviewer", "Codebase summary", []string{"You are a terse reviewer", "Codebase summary", "Review this"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent := NewAgent("TestAgent", mock.NewMockBackend()).WithSystemPrompt(tt.systemPrompt)
+			agent.context = tt.context
+
+			messages := agent.withSystemMessages([]ai.Message{user})
+			if len(messages) != len(tt.want) {
+				t.Fatalf("Expected %d messages, got %+v", len(tt.want), messages)
+			}
+			for i, content := range tt.want {
+				if messages[i].Content != content {
+					t.Errorf("Expected message %d to be %q, got %q", i, content, messages[i].Content)
+				}
+				wantRole := "system"
+				if i == len(tt.want)-1 {
+					wantRole = "user"
+				}
+				if messages[i].Role != wantRole {
+					t.Errorf("Expected message %d to have role %s, got %s", i, wantRole, messages[i].Role)
+				}
+			}
+		})
+	}
+}
+
+// nonStreamingBackend hides the wrapped backend's streaming support
+type nonStreamingBackend struct {
+	ai.Backend
+}
+
+func TestAgent_SendMessageStream(t *testing.T) {
+	agent := NewAgent("TestAgent", mock.NewMockBackend())
+
+	var chunks []string
+	response, err := agent.SendMessageStream("Hello", func(chunk string) {
+		chunks = append(chunks, chunk)
+	})
+	if err != nil {
+		t.Fatalf("SendMessageStream failed: %v", err)
+	}
+
+	if len(chunks) < 2 {
+		t.Errorf("Expected several chunks, got %d", len(chunks))
+	}
+	if joined := strings.Join(chunks, ""); joined != response.Content {
+		t.Errorf("Expected chunks to add up to %q, got %q", response.Content, joined)
+	}
+	if response.Content == "" || response.Timestamp.IsZero() {
+		t.Errorf("Expected an aggregated response, got %+v", response)
+	}
+
+	// The model comes from the backend, as with SendMessage
+	sent, err := agent.SendMessage("Hello")
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	if response.Model == "" || response.Model != sent.Model {
+		t.Errorf("Expected model %q, got %q", sent.Model, response.Model)
+	}
+}
+
+func TestAgent_SendMessageStream_NonStreamingBackend(t *testing.T) {
+	agent := NewAgent("TestAgent", nonStreamingBackend{mock.NewMockBackend()})
+
+	var chunks []string
+	response, err := agent.SendMessageStream("Hello", func(chunk string) {
+		chunks = append(chunks, chunk)
+	})
+	if err != nil {
+		t.Fatalf("SendMessageStream failed: %v", err)
+	}
+
+	if len(chunks) != 1 || chunks[0] != response.Content {
+		t.Errorf("Expected the whole content in one chunk, got %q", chunks)
+	}
+	if !strings.Contains(response.Content, "legacy format") {
+		t.Errorf("Expected the legacy response, got %q", response.Content)
+	}
+}
+
+func TestAgent_SendMessageStream_Timeout(t *testing.T) {
+	agent := NewAgent("TestAgent", mock.NewMockBackend()).WithTimeout(10 * time.Millisecond)
+
+	if _, err := agent.SendMessageStream("Hello", nil); err == nil {
+		t.Error("Expected SendMessageStream to time out")
+	}
+}
+
+func TestAgent_FitContext(t *testing.T) {
+	agent := NewAgent("TestAgent", mock.NewMockBackend()).
+		WithSystemPrompt("You are helpful.").
+		WithContextWindow(400).
+		WithMaxTokens(100)
+
+	var messages []ai.Message
+	for i := 0; i < 20; i++ {
+		messages = append(messages, ai.Message{Role: "user", Content: strings.Repeat("word ", 30)})
+	}
+	messages = append(messages, ai.Message{Role: "user", Content: "latest question"})
+
+	fitted, err := agent.fitContext("mock-model-v1", messages)
+	if err != nil {
+		t.Fatalf("fitContext failed: %v", err)
+	}
+
+	if fitted[0].Role != "system" || fitted[0].Content != "You are helpful." {
+		t.Errorf("Expected the system prompt to be kept first, got %+v", fitted[0])
+	}
+	if last := fitted[len(fitted)-1]; last.Content != "latest question" {
+		t.Errorf("Expected the latest message to be kept, got %+v", last)
+	}
+	if len(fitted) >= len(messages)+1 {
+		t.Errorf("Expected messages to be trimmed, got %d", len(fitted))
+	}
+	if tokens, _ := ai.CountTokens("mock-model-v1", fitted); tokens > 300 {
+		t.Errorf("Expected the prompt to fit in 300 tokens, got %d", tokens)
+	}
+
+	if _, err := agent.SendChatCompletion(messages); err != nil {
+		t.Errorf("Expected a trimmed request to succeed, got %v", err)
+	}
+}
+
+func TestAgent_ContextTooLarge(t *testing.T) {
+	agent := NewAgent("TestAgent", mock.NewMockBackend()).WithContextWindow(200)
+	agent.context = strings.Repeat("reference material ", 200)
+
+	_, err := agent.SendChatCompletion([]ai.Message{{Role: "user", Content: "Hello"}})
+	if !errors.Is(err, ErrContextTooLarge) {
+		t.Fatalf("Expected ErrContextTooLarge, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "over the 50 left") {
+		t.Errorf("Expected the error to name the overflow, got %v", err)
+	}
+}
+
+func TestAgent_MaxTokens(t *testing.T) {
+	agent := NewAgent("TestAgent", mock.NewMockBackend())
+	if got := *agent.legacyRequest("Hello").MaxTokens; got != defaultMaxTokens {
+		t.Errorf("Expected default max tokens %d, got %d", defaultMaxTokens, got)
+	}
+
+	agent.WithMaxTokens(42)
+	if got := *agent.legacyRequest("Hello").MaxTokens; got != 42 {
+		t.Errorf("Expected max tokens 42, got %d", got)
+	}
+}
@@ -0,0 +1,120 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Defaults used by NewBackoff and RetryWithBackoff
+const (
+	DefaultBackoffBase = 500 * time.Millisecond
+	DefaultBackoffMax  = 30 * time.Second
+)
+
+// Backoff computes exponentially growing retry delays with jitter. The
+// first delay is Base, each later one is Multiplier times the last, capped
+// at Max. Jitter randomizes that fraction of each delay: 0 waits the exact
+// delay, 0.5 waits between half and all of it, and 1 ("full jitter") waits
+// anywhere from zero to the full delay.
+//
+// A Backoff is not safe for concurrent use; give each retry loop its own.
+type Backoff struct {
+	Base       time.Duration
+	Max        time.Duration // zero means no cap
+	Multiplier float64       // values of 1 or less are treated as 2
+	Jitter     float64       // clamped to [0, 1]
+
+	// Rand supplies the jitter. Nil uses the math/rand global source; set a
+	// seeded source for deterministic delays in tests.
+	Rand *rand.Rand
+
+	delay time.Duration
+}
+
+// NewBackoff returns a backoff doubling from base up to max, with full
+// jitter
+func NewBackoff(base, max time.Duration) *Backoff {
+	return &Backoff{Base: base, Max: max, Multiplier: 2, Jitter: 1}
+}
+
+// Next returns the delay before the next retry and advances the backoff
+func (b *Backoff) Next() time.Duration {
+	if b.delay == 0 {
+		b.delay = b.Base
+	}
+	delay := b.delay
+	if b.Max > 0 && delay > b.Max {
+		delay = b.Max
+	}
+
+	// Grow until capped, and never past the largest duration
+	multiplier := b.Multiplier
+	if multiplier <= 1 {
+		multiplier = 2
+	}
+	if b.Max <= 0 || b.delay < b.Max {
+		if next := float64(b.delay) * multiplier; next < math.MaxInt64 {
+			b.delay = time.Duration(next)
+		}
+	}
+
+	return b.jitter(delay)
+}
+
+// Reset starts the backoff over from Base
+func (b *Backoff) Reset() {
+	b.delay = 0
+}
+
+// jitter subtracts a random part of the Jitter fraction of delay
+func (b *Backoff) jitter(delay time.Duration) time.Duration {
+	fraction := min(max(b.Jitter, 0), 1)
+	spread := int64(float64(delay) * fraction)
+	if spread <= 0 {
+		return delay
+	}
+
+	var n int64
+	if b.Rand != nil {
+		n = b.Rand.Int63n(spread + 1)
+	} else {
+		n = rand.Int63n(spread + 1)
+	}
+	return delay - time.Duration(n)
+}
+
+// Retry calls fn until it succeeds or maxAttempts calls have been made,
+// waiting b.Next() between attempts. It stops early when ctx is cancelled.
+// When more than one attempt was made the returned error notes the count.
+func (b *Backoff) Retry(ctx context.Context, maxAttempts int, fn func() error) error {
+	for attempts := 1; ; attempts++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if attempts >= maxAttempts {
+			if attempts > 1 {
+				return fmt.Errorf("failed after %d attempts: %w", attempts, err)
+			}
+			return err
+		}
+
+		timer := time.NewTimer(b.Next())
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("failed after %d attempts: %w", attempts, ctx.Err())
+		}
+	}
+}
+
+// RetryWithBackoff calls fn up to maxAttempts times, waiting between
+// attempts with a backoff doubling from DefaultBackoffBase up to
+// DefaultBackoffMax with full jitter. It stops early when ctx is cancelled.
+func RetryWithBackoff(ctx context.Context, maxAttempts int, fn func() error) error {
+	return NewBackoff(DefaultBackoffBase, DefaultBackoffMax).Retry(ctx, maxAttempts, fn)
+}
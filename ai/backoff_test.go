@@ -0,0 +1,90 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestBackoff_Next(t *testing.T) {
+	b := &Backoff{Base: 100 * time.Millisecond, Max: time.Second, Multiplier: 3}
+
+	want := []time.Duration{100, 300, 900, 1000, 1000}
+	for i, w := range want {
+		if got := b.Next(); got != w*time.Millisecond {
+			t.Errorf("Delay %d: expected %s, got %s", i, w*time.Millisecond, got)
+		}
+	}
+
+	b.Reset()
+	if got := b.Next(); got != 100*time.Millisecond {
+		t.Errorf("Expected Reset to restart from Base, got %s", got)
+	}
+}
+
+func TestBackoff_Jitter(t *testing.T) {
+	newBackoff := func(jitter float64) *Backoff {
+		return &Backoff{Base: time.Second, Max: 8 * time.Second, Multiplier: 2, Jitter: jitter, Rand: rand.New(rand.NewSource(7))}
+	}
+
+	// The same seed gives the same delays
+	first, second := newBackoff(1), newBackoff(1)
+	for i := 0; i < 5; i++ {
+		a, b := first.Next(), second.Next()
+		if a != b {
+			t.Errorf("Delay %d: expected seeded backoffs to agree, got %s and %s", i, a, b)
+		}
+	}
+
+	// Full jitter stays within [0, delay]; half jitter within [delay/2, delay]
+	full, half := newBackoff(1), newBackoff(0.5)
+	for _, delay := range []time.Duration{1, 2, 4, 8, 8} {
+		delay *= time.Second
+		if got := full.Next(); got < 0 || got > delay {
+			t.Errorf("Expected full jitter within [0, %s], got %s", delay, got)
+		}
+		if got := half.Next(); got < delay/2 || got > delay {
+			t.Errorf("Expected half jitter within [%s, %s], got %s", delay/2, delay, got)
+		}
+	}
+}
+
+func TestBackoff_Retry(t *testing.T) {
+	b := &Backoff{Base: time.Millisecond}
+	calls := 0
+	err := b.Retry(context.Background(), 3, func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("flaky")
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("Expected success on the third attempt, got %v after %d calls", err, calls)
+	}
+
+	calls = 0
+	failure := errors.New("down")
+	err = b.Retry(context.Background(), 2, func() error {
+		calls++
+		return failure
+	})
+	if !errors.Is(err, failure) || calls != 2 {
+		t.Errorf("Expected to give up after 2 attempts, got %v after %d calls", err, calls)
+	}
+
+	// Cancellation stops the wait between attempts
+	ctx, cancel := context.WithCancel(context.Background())
+	slow := &Backoff{Base: time.Hour}
+	calls = 0
+	err = slow.Retry(ctx, 5, func() error {
+		calls++
+		cancel()
+		return failure
+	})
+	if !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Errorf("Expected cancellation after 1 attempt, got %v after %d calls", err, calls)
+	}
+}
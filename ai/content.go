@@ -0,0 +1,118 @@
+package ai
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// Content part types in the OpenAI multimodal format
+const (
+	ContentPartText     = "text"
+	ContentPartImageURL = "image_url"
+)
+
+// ContentPart is one piece of a multimodal message, either text or an image.
+//
+// Example:
+//
+//	[]ContentPart{
+//	  TextPart("What is in this picture?"),
+//	  ImagePart("https://example.com/cat.png"),
+//	}
+type ContentPart struct {
+	// Type is ContentPartText or ContentPartImageURL
+	Type string `json:"type"`
+
+	// Text is the content of a text part
+	Text string `json:"text,omitempty"`
+
+	// ImageURL locates the image of an image_url part
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+// ImageURL points at an image by URL or base64 data URL
+type ImageURL struct {
+	URL string `json:"url"`
+
+	// Detail is "low", "high", or "auto". OPTIONAL.
+	Detail string `json:"detail,omitempty"`
+}
+
+// TextPart returns a text content part
+func TextPart(text string) ContentPart {
+	return ContentPart{Type: ContentPartText, Text: text}
+}
+
+// ImagePart returns an image content part for a URL or data URL
+func ImagePart(url string) ContentPart {
+	return ContentPart{Type: ContentPartImageURL, ImageURL: &ImageURL{URL: url}}
+}
+
+// NewMultipartMessage builds a message from content parts, filling Content
+// with the text parts so code that only reads text still sees it
+func NewMultipartMessage(role string, parts ...ContentPart) Message {
+	return Message{Role: role, Content: partsText(parts), ContentParts: parts}
+}
+
+// HasImages reports whether the message carries any image parts
+func (m Message) HasImages() bool {
+	for _, part := range m.ContentParts {
+		if part.Type == ContentPartImageURL {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalJSON writes content as a string, or as the multimodal content array
+// when ContentParts is set
+func (m Message) MarshalJSON() ([]byte, error) {
+	type plain Message
+	if len(m.ContentParts) == 0 {
+		return json.Marshal(plain(m))
+	}
+	return json.Marshal(struct {
+		plain
+		Content []ContentPart `json:"content"`
+	}{plain(m), m.ContentParts})
+}
+
+// UnmarshalJSON accepts content as either a string or a multimodal content
+// array. For arrays, Content is filled with the text parts.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	type plain Message
+	var raw struct {
+		plain
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*m = Message(raw.plain)
+
+	content := bytes.TrimSpace(raw.Content)
+	switch {
+	case len(content) == 0 || bytes.Equal(content, []byte("null")):
+		return nil
+	case content[0] == '[':
+		if err := json.Unmarshal(content, &m.ContentParts); err != nil {
+			return err
+		}
+		m.Content = partsText(m.ContentParts)
+		return nil
+	default:
+		return json.Unmarshal(content, &m.Content)
+	}
+}
+
+// partsText joins the text parts of multimodal content with newlines
+func partsText(parts []ContentPart) string {
+	var texts []string
+	for _, part := range parts {
+		if part.Type == ContentPartText && part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
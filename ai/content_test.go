@@ -0,0 +1,58 @@
+package ai
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMessage_JSONContentShapes(t *testing.T) {
+	// Plain messages keep the string form
+	data, err := json.Marshal(Message{Role: "user", Content: "Hello"})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if string(data) != `{"role":"user","content":"Hello"}` {
+		t.Errorf("Expected string content, got %s", data)
+	}
+
+	// Multimodal messages use the OpenAI content array
+	msg := NewMultipartMessage("user", TextPart("What is this?"), ImagePart("https://example.com/cat.png"))
+	data, err = json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	want := `{"role":"user","content":[{"type":"text","text":"What is this?"},{"type":"image_url","image_url":{"url":"https://example.com/cat.png"}}]}`
+	if string(data) != want {
+		t.Errorf("Expected multimodal content\n%s\ngot\n%s", want, data)
+	}
+
+	// Both shapes decode, and arrays fill Content with their text
+	var decoded Message
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if decoded.Content != "What is this?" || !decoded.HasImages() || decoded.ContentParts[1].ImageURL.URL != "https://example.com/cat.png" {
+		t.Errorf("Expected multimodal message to round-trip, got %+v", decoded)
+	}
+
+	var plain Message
+	if err := json.Unmarshal([]byte(`{"role":"assistant","content":"Hi","tool_call_id":"call_1"}`), &plain); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if plain.Content != "Hi" || plain.ToolCallID != "call_1" || plain.ContentParts != nil {
+		t.Errorf("Expected plain message fields, got %+v", plain)
+	}
+
+	var toolCall Message
+	if err := json.Unmarshal([]byte(`{"role":"assistant","content":null,"tool_calls":[{"id":"call_1"}]}`), &toolCall); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if toolCall.Content != "" || len(toolCall.ToolCalls) != 1 {
+		t.Errorf("Expected null content to decode as empty, got %+v", toolCall)
+	}
+
+	if err := json.Unmarshal([]byte(`{"role":"user","content":42}`), &plain); err == nil || !strings.Contains(err.Error(), "cannot unmarshal") {
+		t.Errorf("Expected error for non-string content, got %v", err)
+	}
+}
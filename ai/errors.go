@@ -0,0 +1,100 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Errors callers can match with errors.Is. Backends return them wrapped, or
+// return an *APIError that matches them by status code, and the chat
+// controller passes them through. ErrInvalidRequest is defined alongside
+// request validation.
+var (
+	// ErrBackendUnavailable means the provider could not be reached or
+	// failed on its side with a 5xx status
+	ErrBackendUnavailable = errors.New("backend unavailable")
+
+	// ErrRateLimited means the provider rejected the request with a 429
+	// status
+	ErrRateLimited = errors.New("rate limited")
+
+	// ErrContextCanceled is context.Canceled, so requests abandoned by the
+	// caller can be matched alongside the other errors here
+	ErrContextCanceled = context.Canceled
+)
+
+// APIError is returned by backends when the provider answers with a non-200
+// status, so callers can act on the status code
+type APIError struct {
+	// Provider names the backend, e.g. "OpenAI"
+	Provider string
+	// StatusCode is the HTTP status returned by the provider
+	StatusCode int
+	// Message is the provider's error message, or the raw body
+	Message string
+}
+
+// Error implements the error interface
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s API error (%d): %s", e.Provider, e.StatusCode, e.Message)
+}
+
+// Is matches an APIError against ErrRateLimited, ErrBackendUnavailable, and
+// ErrInvalidRequest by its status code
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrBackendUnavailable:
+		return e.StatusCode >= 500
+	case ErrInvalidRequest:
+		return e.StatusCode == http.StatusBadRequest || e.StatusCode == http.StatusUnprocessableEntity
+	}
+	return false
+}
+
+// TransportError wraps a failure to reach a provider, such as a refused
+// connection, so it matches ErrBackendUnavailable. Cancellation and
+// deadlines are returned unchanged, since the provider was not at fault.
+func TransportError(err error) error {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrBackendUnavailable, err)
+}
+
+// IsRetryable reports whether an error is likely transient: rate limiting
+// (429), provider-side failures (5xx), and network timeouts. Invalid requests,
+// authentication failures, and context cancellation are not retryable.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, ErrInvalidRequest) {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// IsModelUnavailable reports whether an error means the requested model does
+// not exist or the API key has no access to it. Providers signal this with a
+// 404 or 403 whose message names the model, e.g. OpenAI's "The model `gpt-4`
+// does not exist or you do not have access to it".
+func IsModelUnavailable(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if apiErr.StatusCode != http.StatusNotFound && apiErr.StatusCode != http.StatusForbidden {
+		return false
+	}
+	return strings.Contains(strings.ToLower(apiErr.Message), "model")
+}
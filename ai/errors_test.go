@@ -0,0 +1,95 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&APIError{StatusCode: 429}, true},
+		{&APIError{StatusCode: 502}, true},
+		{&APIError{StatusCode: 400}, false},
+		{&APIError{StatusCode: 401}, false},
+		{ErrInvalidRequest, false},
+		{context.Canceled, false},
+		{errors.New("something else"), false},
+	}
+
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%v) = %v, expected %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestIsRetryable_Wrapped(t *testing.T) {
+	timeout := &net.DNSError{Err: "timeout", IsTimeout: true}
+	if !IsRetryable(fmt.Errorf("failed to send request: %w", timeout)) {
+		t.Error("Expected wrapped network timeout to be retryable")
+	}
+	if !IsRetryable(fmt.Errorf("wrapped: %w", &APIError{StatusCode: 503})) {
+		t.Error("Expected wrapped 503 to be retryable")
+	}
+}
+
+func TestIsModelUnavailable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&APIError{StatusCode: 404, Message: "The model `gpt-4` does not exist or you do not have access to it."}, true},
+		{&APIError{StatusCode: 404, Message: "model: claude-3-opus-20240229"}, true},
+		{fmt.Errorf("failed after 2 attempts: %w", &APIError{StatusCode: 403, Message: "Project does not have access to model gpt-4o"}), true},
+		{&APIError{StatusCode: 404, Message: "Not found"}, false},
+		{&APIError{StatusCode: 400, Message: "Unsupported parameter for this model"}, false},
+		{&APIError{StatusCode: 500, Message: "model overloaded"}, false},
+		{errors.New("model not found"), false},
+	}
+
+	for _, tt := range tests {
+		if got := IsModelUnavailable(tt.err); got != tt.want {
+			t.Errorf("IsModelUnavailable(%v) = %v, expected %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestAPIError_Is(t *testing.T) {
+	tests := []struct {
+		status int
+		target error
+		want   bool
+	}{
+		{429, ErrRateLimited, true},
+		{429, ErrBackendUnavailable, false},
+		{503, ErrBackendUnavailable, true},
+		{500, ErrRateLimited, false},
+		{400, ErrInvalidRequest, true},
+		{401, ErrInvalidRequest, false},
+	}
+
+	for _, tt := range tests {
+		err := fmt.Errorf("wrapped: %w", &APIError{StatusCode: tt.status})
+		if got := errors.Is(err, tt.target); got != tt.want {
+			t.Errorf("errors.Is(%d, %v) = %v, expected %v", tt.status, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestTransportError(t *testing.T) {
+	if err := TransportError(errors.New("connection refused")); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("Expected transport failure to match ErrBackendUnavailable, got %v", err)
+	}
+	if err := TransportError(context.Canceled); !errors.Is(err, ErrContextCanceled) || errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("Expected cancellation to be returned unchanged, got %v", err)
+	}
+	if TransportError(nil) != nil {
+		t.Error("Expected nil error to stay nil")
+	}
+}
@@ -0,0 +1,124 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// HealthFailure categorizes why a backend is unhealthy
+type HealthFailure string
+
+const (
+	// HealthFailureAuth means the provider rejected the credentials (401/403)
+	HealthFailureAuth HealthFailure = "auth"
+	// HealthFailureRateLimited means the provider is throttling requests (429)
+	HealthFailureRateLimited HealthFailure = "rate_limited"
+	// HealthFailureServer means the provider failed on its side (5xx)
+	HealthFailureServer HealthFailure = "server"
+	// HealthFailureNetwork means the endpoint could not be reached, e.g. DNS
+	// failures, refused connections, or timeouts
+	HealthFailureNetwork HealthFailure = "network"
+	// HealthFailureUnknown covers any other failure, such as an unexpected
+	// status code or a backend that only reports a bare availability bool
+	HealthFailureUnknown HealthFailure = "unknown"
+)
+
+// HealthStatus describes the outcome of a backend health check
+type HealthStatus struct {
+	// Available reports whether the backend can serve requests
+	Available bool `json:"available"`
+
+	// Latency is how long the check took
+	Latency time.Duration `json:"latency"`
+
+	// Endpoint is the URL that was probed, if any
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// StatusCode is the HTTP status of the probe, or zero if no response
+	// was received
+	StatusCode int `json:"status_code,omitempty"`
+
+	// Failure categorizes why the backend is unavailable. Empty when
+	// Available is true.
+	Failure HealthFailure `json:"failure,omitempty"`
+
+	// Detail is a human-readable description of the failure
+	Detail string `json:"detail,omitempty"`
+}
+
+// HealthChecker is implemented by backends that can explain their health
+// beyond IsAvailable's bool. It is optional; use CheckHealth to get a
+// HealthStatus from any backend.
+type HealthChecker interface {
+	Backend
+
+	// HealthCheck probes the backend and describes its health. An
+	// unhealthy backend is reported in the status; the error is reserved
+	// for checks that could not be run at all.
+	HealthCheck(ctx context.Context) (*HealthStatus, error)
+}
+
+// CheckHealth returns a backend's health, using HealthCheck when the
+// backend implements HealthChecker and otherwise timing IsAvailable
+func CheckHealth(ctx context.Context, backend Backend) (*HealthStatus, error) {
+	if checker, ok := backend.(HealthChecker); ok {
+		return checker.HealthCheck(ctx)
+	}
+
+	start := time.Now()
+	status := &HealthStatus{Available: backend.IsAvailable(ctx)}
+	status.Latency = time.Since(start)
+	if !status.Available {
+		status.Failure = HealthFailureUnknown
+		status.Detail = fmt.Sprintf("%s reported it is unavailable", backend.Name())
+	}
+	return status, nil
+}
+
+// ProbeHealth sends a prepared request, typically a cheap GET such as a
+// model listing, and turns the outcome into a HealthStatus. Only a 200
+// response counts as available.
+func ProbeHealth(client *http.Client, req *http.Request) *HealthStatus {
+	status := &HealthStatus{Endpoint: req.URL.String()}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	status.Latency = time.Since(start)
+	if err != nil {
+		status.Failure = HealthFailureNetwork
+		status.Detail = err.Error()
+		if errors.Is(err, context.Canceled) {
+			status.Failure = HealthFailureUnknown
+		}
+		return status
+	}
+	defer resp.Body.Close()
+
+	status.StatusCode = resp.StatusCode
+	status.Failure = classifyStatus(resp.StatusCode)
+	status.Available = status.Failure == ""
+	if !status.Available {
+		status.Detail = resp.Status
+	}
+	return status
+}
+
+// classifyStatus maps a probe's HTTP status to a failure category, or ""
+// for success
+func classifyStatus(code int) HealthFailure {
+	switch {
+	case code == http.StatusOK:
+		return ""
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return HealthFailureAuth
+	case code == http.StatusTooManyRequests:
+		return HealthFailureRateLimited
+	case code >= 500:
+		return HealthFailureServer
+	default:
+		return HealthFailureUnknown
+	}
+}
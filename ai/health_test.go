@@ -0,0 +1,68 @@
+package ai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// staticBackend reports a fixed availability and nothing else
+type staticBackend struct {
+	Backend
+	available bool
+}
+
+func (b staticBackend) Name() string                         { return "static" }
+func (b staticBackend) IsAvailable(ctx context.Context) bool { return b.available }
+
+func TestProbeHealth(t *testing.T) {
+	tests := []struct {
+		status  int
+		failure HealthFailure
+	}{
+		{http.StatusOK, ""},
+		{http.StatusUnauthorized, HealthFailureAuth},
+		{http.StatusForbidden, HealthFailureAuth},
+		{http.StatusTooManyRequests, HealthFailureRateLimited},
+		{http.StatusServiceUnavailable, HealthFailureServer},
+		{http.StatusNotFound, HealthFailureUnknown},
+	}
+
+	for _, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.status)
+		}))
+
+		req, _ := http.NewRequest("GET", server.URL+"/models", nil)
+		status := ProbeHealth(server.Client(), req)
+		server.Close()
+
+		if status.Available != (test.failure == "") || status.Failure != test.failure || status.StatusCode != test.status {
+			t.Errorf("Status %d: expected failure %q, got %+v", test.status, test.failure, status)
+		}
+		if status.Endpoint != server.URL+"/models" {
+			t.Errorf("Expected the probed endpoint to be reported, got %q", status.Endpoint)
+		}
+	}
+
+	// A server that is gone is a network failure
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	if status := ProbeHealth(http.DefaultClient, req); status.Failure != HealthFailureNetwork || status.Detail == "" {
+		t.Errorf("Expected a network failure with detail, got %+v", status)
+	}
+}
+
+func TestCheckHealth_FallsBackToIsAvailable(t *testing.T) {
+	status, err := CheckHealth(context.Background(), staticBackend{available: true})
+	if err != nil || !status.Available || status.Failure != "" {
+		t.Errorf("Expected an available status, got %+v (%v)", status, err)
+	}
+
+	status, err = CheckHealth(context.Background(), staticBackend{available: false})
+	if err != nil || status.Available || status.Failure != HealthFailureUnknown {
+		t.Errorf("Expected an unknown failure, got %+v (%v)", status, err)
+	}
+}
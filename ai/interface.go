@@ -0,0 +1,373 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Message represents a single message in a conversation following OpenAI Chat Completions format.
+// Both fields are REQUIRED for proper operation.
+type Message struct {
+	// Role specifies who sent the message. REQUIRED.
+	// Valid values:
+	//   - "system": Instructions/context for the AI (usually first message)
+	//   - "user": Human user input
+	//   - "assistant": AI model responses
+	//   - "tool": The result of a tool call, identified by ToolCallID
+	Role string `json:"role"`
+
+	// Content contains the actual message text. REQUIRED.
+	// Cannot be empty string for most AI providers.
+	Content string `json:"content"`
+
+	// ContentParts holds multimodal content such as text mixed with images.
+	// OPTIONAL. When set it is serialized as the OpenAI content array in
+	// place of Content, and Content mirrors its text parts. Build it with
+	// NewMultipartMessage to keep the two in sync.
+	ContentParts []ContentPart `json:"-"`
+
+	// ToolCalls lists the tools an assistant message asks to invoke. OPTIONAL.
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+
+	// ToolCallID links a "tool" message to the call it answers. OPTIONAL.
+	ToolCallID string `json:"tool_call_id,omitempty"`
+}
+
+// Tool describes a tool the model may call, following the OpenAI tools format.
+//
+// Example:
+//
+//	Tool{
+//	  Type: "function",
+//	  Function: FunctionDefinition{
+//	    Name:        "get_weather",
+//	    Description: "Get the weather for a city",
+//	    Parameters:  json.RawMessage(`{"type":"object","properties":{"city":{"type":"string"}}}`),
+//	  },
+//	}
+type Tool struct {
+	// Type is the tool type. Only "function" is currently defined.
+	Type string `json:"type"`
+
+	// Function describes the callable function
+	Function FunctionDefinition `json:"function"`
+}
+
+// FunctionDefinition describes a function's name and JSON Schema parameters
+type FunctionDefinition struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+// ToolCall is a request from the model to invoke a tool
+type ToolCall struct {
+	// ID identifies the call so its result can be matched via Message.ToolCallID
+	ID string `json:"id"`
+
+	// Type is the tool type, usually "function"
+	Type string `json:"type"`
+
+	// Function holds the function name and its JSON-encoded arguments
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall names the function to call and carries its arguments as a JSON string
+type FunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// ChatCompletionRequest represents a request following OpenAI Chat Completions API standard.
+// Model and Messages are REQUIRED. All other fields are OPTIONAL with sensible defaults.
+//
+// Example usage:
+//
+//	req := ChatCompletionRequest{
+//	  Model: "gpt-4",                    // REQUIRED
+//	  Messages: []Message{               // REQUIRED - must have at least 1
+//	    {Role: "user", Content: "Hello"},
+//	  },
+//	  MaxTokens: &[]int{150}[0],        // OPTIONAL - nil means no limit
+//	  Temperature: &[]float64{0.7}[0],  // OPTIONAL - nil uses provider default
+//	}
+type ChatCompletionRequest struct {
+	// Model specifies which AI model to use. REQUIRED.
+	// Examples: "gpt-4", "gpt-3.5-turbo", "claude-3-sonnet", "mock-model-v1"
+	Model string `json:"model"`
+
+	// Messages contains the conversation history. REQUIRED.
+	// Must have at least one message. Order matters - messages are processed sequentially.
+	// Typically starts with a "system" message, followed by alternating "user"/"assistant".
+	Messages []Message `json:"messages"`
+
+	// MaxTokens limits the response length. OPTIONAL.
+	// If nil, no limit is applied (uses provider default).
+	// If set, response will be truncated at this token count.
+	MaxTokens *int `json:"max_tokens,omitempty"`
+
+	// Temperature controls response randomness. OPTIONAL.
+	// Range: 0.0 (deterministic) to 2.0 (very random)
+	// If nil, uses provider default (usually 0.7-1.0)
+	// Lower values = more focused, higher values = more creative
+	Temperature *float64 `json:"temperature,omitempty"`
+
+	// TopP controls nucleus sampling. OPTIONAL.
+	// Range: 0.0 to 1.0. Alternative to temperature.
+	// If nil, uses provider default (usually 1.0)
+	// Lower values = more focused responses
+	TopP *float64 `json:"top_p,omitempty"`
+
+	// Stop lists sequences that end the response when generated. OPTIONAL.
+	// At most MaxStopSequences; the stop sequence itself is not included
+	// in the response.
+	Stop []string `json:"stop,omitempty"`
+
+	// PresencePenalty penalizes tokens that already appear in the text,
+	// encouraging new topics. OPTIONAL.
+	// Range: -2.0 to 2.0. If nil, uses provider default (0).
+	PresencePenalty *float64 `json:"presence_penalty,omitempty"`
+
+	// FrequencyPenalty penalizes tokens by how often they already appear,
+	// discouraging repetition. OPTIONAL.
+	// Range: -2.0 to 2.0. If nil, uses provider default (0).
+	FrequencyPenalty *float64 `json:"frequency_penalty,omitempty"`
+
+	// Seed asks the provider to sample deterministically, so repeated
+	// requests with the same seed and parameters return the same response
+	// as far as the provider can guarantee. OPTIONAL. Compare
+	// SystemFingerprint across responses to detect backend changes that
+	// break determinism.
+	Seed *int `json:"seed,omitempty"`
+
+	// Stream enables real-time response streaming. OPTIONAL.
+	// Default: false (returns complete response)
+	// Note: Streaming support depends on backend implementation
+	Stream bool `json:"stream,omitempty"`
+
+	// Tools lists the tools the model may call. OPTIONAL.
+	// If empty, the model answers with plain text.
+	Tools []Tool `json:"tools,omitempty"`
+}
+
+// Usage represents token usage information from the AI provider.
+// All fields are provided by the backend and are read-only.
+type Usage struct {
+	// PromptTokens is the number of tokens in the input messages
+	PromptTokens int `json:"prompt_tokens"`
+
+	// CompletionTokens is the number of tokens in the AI's response
+	CompletionTokens int `json:"completion_tokens"`
+
+	// TotalTokens is the sum of prompt and completion tokens
+	TotalTokens int `json:"total_tokens"`
+}
+
+// Choice represents a single completion choice from the AI.
+// Most providers return exactly one choice, but the format supports multiple alternatives.
+type Choice struct {
+	// Index is the position of this choice in the choices array (usually 0)
+	Index int `json:"index"`
+
+	// Message contains the AI's response
+	Message Message `json:"message"`
+
+	// FinishReason indicates why the response ended. Common values:
+	//   - "stop": Natural completion
+	//   - "length": Hit max_tokens limit
+	//   - "content_filter": Content was filtered
+	//   - "tool_calls": AI wants to call one or more tools
+	//   - "function_call": AI wants to call a function (legacy)
+	FinishReason string `json:"finish_reason"`
+}
+
+// ChatCompletionResponse represents a response following OpenAI Chat Completions API standard.
+// All fields are populated by the backend implementation.
+//
+// Example response structure:
+//
+//	{
+//	  "id": "chatcmpl-abc123",
+//	  "object": "chat.completion",
+//	  "created": 1677858242,
+//	  "model": "gpt-3.5-turbo",
+//	  "choices": [{
+//	    "index": 0,
+//	    "message": {"role": "assistant", "content": "Hello!"},
+//	    "finish_reason": "stop"
+//	  }],
+//	  "usage": {"prompt_tokens": 13, "completion_tokens": 7, "total_tokens": 20}
+//	}
+type ChatCompletionResponse struct {
+	// ID is a unique identifier for this completion
+	ID string `json:"id"`
+
+	// Object type identifier, always "chat.completion" for this endpoint
+	Object string `json:"object"`
+
+	// Created is the Unix timestamp when the completion was created
+	Created int64 `json:"created"`
+
+	// Model is the name of the model used to generate the response
+	Model string `json:"model"`
+
+	// Choices contains the AI's response(s). Usually contains exactly one choice.
+	Choices []Choice `json:"choices"`
+
+	// Usage provides token consumption information for billing/monitoring
+	Usage Usage `json:"usage"`
+
+	// SystemFingerprint identifies the backend configuration that served
+	// the request, if the provider reports one. A change means seeded
+	// requests may no longer be reproducible.
+	SystemFingerprint string `json:"system_fingerprint,omitempty"`
+
+	// ProviderMetadata carries extra data the provider returned alongside the
+	// completion, such as request IDs, system fingerprints, and rate-limit
+	// headers. Keys are backend-specific; useful when filing support tickets.
+	ProviderMetadata map[string]string `json:"provider_metadata,omitempty"`
+}
+
+// Legacy types for backward compatibility and internal use.
+// These are provided for existing code that hasn't migrated to ChatCompletion* types.
+// New code should use ChatCompletionRequest and ChatCompletionResponse instead.
+
+// Request is an alias for ChatCompletionRequest for backward compatibility
+type Request = ChatCompletionRequest
+
+// Response represents a simplified response format used by legacy SendMessage method.
+// Unlike ChatCompletionResponse, this flattens the response into simple fields.
+type Response struct {
+	// Content contains the AI's response text
+	Content string `json:"content"`
+
+	// TokensUsed is the total number of tokens consumed (prompt + completion)
+	TokensUsed int `json:"tokens_used"`
+
+	// Model is the name of the model that generated the response
+	Model string `json:"model"`
+
+	// Timestamp indicates when the response was generated
+	Timestamp time.Time `json:"timestamp"`
+
+	// Error contains any error that occurred during processing
+	Error error `json:"error"`
+}
+
+// Backend defines the interface that all AI backends must implement.
+// This interface supports both modern OpenAI Chat Completions format and legacy methods.
+//
+// Implementation requirements:
+//   - All methods must be safe for concurrent use
+//   - Context cancellation must be respected
+//   - Errors should be wrapped with descriptive messages
+//
+// Example implementation pattern:
+//
+//	type MyBackend struct {
+//	  apiKey string
+//	  baseURL string
+//	}
+//
+//	func (b *MyBackend) ChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+//	  // Validate required fields
+//	  if req.Model == "" { return nil, errors.New("model is required") }
+//	  if len(req.Messages) == 0 { return nil, errors.New("messages is required") }
+//	  // ... implement API call
+//	}
+type Backend interface {
+	// Name returns a human-readable identifier for this backend.
+	// Used for logging and debugging. Should be unique within your application.
+	// Examples: "OpenAI", "Claude", "LocalLLaMA", "MockAI"
+	Name() string
+
+	// ChatCompletion sends a chat completion request following OpenAI Chat Completions standard.
+	// This is the PREFERRED method for new implementations.
+	//
+	// Requirements:
+	//   - req.Model and req.Messages are required
+	//   - Must respect context cancellation
+	//   - Should handle optional parameters gracefully (nil pointers)
+	//   - Must return proper Usage information for token tracking
+	//
+	// Returns:
+	//   - ChatCompletionResponse with at least one Choice
+	//   - Error if request fails or is invalid
+	ChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error)
+
+	// SendMessage sends a request using the legacy simplified format.
+	// This method exists for backward compatibility. New code should use ChatCompletion.
+	//
+	// Implementation can typically convert Request to ChatCompletionRequest internally,
+	// call ChatCompletion, then flatten the response to the legacy Response format.
+	SendMessage(ctx context.Context, req Request) (*Response, error)
+
+	// IsAvailable performs a health check to determine if the backend is ready to serve requests.
+	// Should be fast (< 1 second) and not consume API quotas if possible.
+	//
+	// Returns:
+	//   - true: Backend is healthy and ready
+	//   - false: Backend is unavailable (network issues, API down, etc.)
+	//
+	// Used by load balancers and circuit breakers for failover decisions.
+	IsAvailable(ctx context.Context) bool
+
+	// Configure sets backend-specific configuration options.
+	// Called once during backend initialization with provider-specific settings.
+	//
+	// Common configuration keys:
+	//   - "api_key": Authentication token
+	//   - "base_url": Custom API endpoint
+	//   - "timeout": Request timeout duration
+	//   - "max_retries": Number of retry attempts
+	//
+	// Returns error if configuration is invalid or cannot be applied.
+	Configure(config map[string]interface{}) error
+}
+
+// StreamChunk is one piece of a streamed chat completion. Content arrives
+// as a series of Delta strings; the final chunk carries FinishReason and,
+// when the backend reports it, Usage.
+type StreamChunk struct {
+	// Delta is the next piece of assistant content
+	Delta string `json:"delta,omitempty"`
+
+	// ToolCalls holds any tool calls, delivered complete in a single chunk
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+
+	// FinishReason is set on the final chunk
+	FinishReason string `json:"finish_reason,omitempty"`
+
+	// Usage is set on the final chunk when the backend reports token counts
+	Usage *Usage `json:"usage,omitempty"`
+
+	// ProviderMetadata is set on the final chunk, as on ChatCompletionResponse
+	ProviderMetadata map[string]string `json:"provider_metadata,omitempty"`
+
+	// ID, Model and SystemFingerprint are set on the final chunk when the
+	// backend reports them, as on ChatCompletionResponse
+	ID                string `json:"id,omitempty"`
+	Model             string `json:"model,omitempty"`
+	SystemFingerprint string `json:"system_fingerprint,omitempty"`
+
+	// Err reports a failure that ended the stream early, such as context
+	// cancellation. It is always the last chunk sent.
+	Err error `json:"-"`
+}
+
+// StreamingBackend is implemented by backends that can stream responses
+// token by token. It is optional; callers should fall back to ChatCompletion
+// for backends that do not implement it.
+type StreamingBackend interface {
+	Backend
+
+	// ChatCompletionStream starts a chat completion and returns a channel of
+	// chunks that is closed when the response is complete.
+	//
+	// Requirements:
+	//   - Must stop and close the channel when ctx is cancelled, sending a
+	//     final chunk with Err set
+	//   - Errors before streaming starts are returned directly
+	ChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (<-chan StreamChunk, error)
+}
@@ -0,0 +1,137 @@
+package ai
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// Per-message overhead added by the OpenAI chat format: every message is
+// wrapped in role and separator tokens, and the reply is primed with a few more
+const (
+	tokensPerMessage = 3
+	tokensPerReply   = 3
+)
+
+// tokensPerImage is the cost of a low-detail image. High-detail images are
+// tiled and cost more, so image-heavy prompts are undercounted.
+const tokensPerImage = 85
+
+// encodingFamilies maps model name prefixes to BPE encodings. Order matters:
+// more specific prefixes must come before the ones they extend, so "gpt-4o"
+// is matched before "gpt-4".
+var encodingFamilies = []struct {
+	prefix   string
+	encoding string
+}{
+	{"gpt-4o", tiktoken.MODEL_O200K_BASE},
+	{"chatgpt-4o", tiktoken.MODEL_O200K_BASE},
+	{"gpt-4.1", tiktoken.MODEL_O200K_BASE},
+	{"gpt-4.5", tiktoken.MODEL_O200K_BASE},
+	{"gpt-5", tiktoken.MODEL_O200K_BASE},
+	{"o1", tiktoken.MODEL_O200K_BASE},
+	{"o3", tiktoken.MODEL_O200K_BASE},
+	{"o4", tiktoken.MODEL_O200K_BASE},
+	{"gpt-4", tiktoken.MODEL_CL100K_BASE},
+	{"gpt-3.5", tiktoken.MODEL_CL100K_BASE},
+}
+
+var (
+	encodingsMutex sync.Mutex
+	encodings      = make(map[string]*tiktoken.Tiktoken)
+)
+
+func init() {
+	// Use the embedded vocabularies so counting never touches the network
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+}
+
+// CountTokens returns the number of prompt tokens a message history occupies
+// for the given model.
+//
+// OpenAI models are counted exactly with the model family's BPE tokenizer
+// (o200k_base for gpt-4o and the o-series, cl100k_base for gpt-4 and
+// gpt-3.5), plus the fixed per-message overhead of the chat format. Other
+// models, including Claude, have no public tokenizer, so they fall back to
+// the four-characters-per-token heuristic. The heuristic is cheap and usually
+// within 20-30% for English prose, but it undercounts code, non-Latin scripts
+// and other dense text, so budgets built on it should leave headroom.
+//
+// If the tokenizer fails to load, the heuristic count is returned along with
+// the error, so callers that only need an estimate can ignore it.
+func CountTokens(model string, messages []Message) (int, error) {
+	name := encodingForModel(model)
+	if name == "" {
+		return heuristicTokens(messages), nil
+	}
+
+	encoding, err := loadEncoding(name)
+	if err != nil {
+		return heuristicTokens(messages), fmt.Errorf("failed to load %s tokenizer: %w", name, err)
+	}
+
+	tokens := tokensPerReply
+	for _, msg := range messages {
+		tokens += tokensPerMessage
+		tokens += len(encoding.EncodeOrdinary(msg.Role))
+		tokens += len(encoding.EncodeOrdinary(msg.Content))
+		for _, call := range msg.ToolCalls {
+			tokens += len(encoding.EncodeOrdinary(call.Function.Name))
+			tokens += len(encoding.EncodeOrdinary(call.Function.Arguments))
+		}
+		tokens += imageTokens(msg)
+	}
+	return tokens, nil
+}
+
+// encodingForModel returns the BPE encoding for a model's family, or "" when
+// the model has no known tokenizer
+func encodingForModel(model string) string {
+	model = strings.ToLower(model)
+	for _, family := range encodingFamilies {
+		if strings.HasPrefix(model, family.prefix) {
+			return family.encoding
+		}
+	}
+	return ""
+}
+
+// loadEncoding returns a cached tokenizer, building it on first use
+func loadEncoding(name string) (*tiktoken.Tiktoken, error) {
+	encodingsMutex.Lock()
+	defer encodingsMutex.Unlock()
+
+	if encoding, ok := encodings[name]; ok {
+		return encoding, nil
+	}
+
+	encoding, err := tiktoken.GetEncoding(name)
+	if err != nil {
+		return nil, err
+	}
+	encodings[name] = encoding
+	return encoding, nil
+}
+
+// heuristicTokens estimates tokens at roughly four characters per token
+func heuristicTokens(messages []Message) int {
+	tokens := 0
+	for _, msg := range messages {
+		tokens += len(msg.Content)/4 + imageTokens(msg)
+	}
+	return tokens
+}
+
+// imageTokens estimates the tokens taken by a message's images
+func imageTokens(msg Message) int {
+	tokens := 0
+	for _, part := range msg.ContentParts {
+		if part.Type == ContentPartImageURL {
+			tokens += tokensPerImage
+		}
+	}
+	return tokens
+}
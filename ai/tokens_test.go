@@ -0,0 +1,48 @@
+package ai
+
+import "testing"
+
+func TestCountTokens(t *testing.T) {
+	messages := []Message{{Role: "user", Content: "hello world"}}
+
+	// Reply priming (3) + message overhead (3) + "user" (1) + "hello world" (2)
+	for _, model := range []string{"gpt-4", "gpt-3.5-turbo", "gpt-4o-mini", "o3"} {
+		got, err := CountTokens(model, messages)
+		if err != nil {
+			t.Fatalf("CountTokens(%s) failed: %v", model, err)
+		}
+		if got != 9 {
+			t.Errorf("Expected 9 tokens for %s, got %d", model, got)
+		}
+	}
+
+	// Unknown models fall back to four characters per token
+	long := []Message{{Role: "user", Content: "The quick brown fox jumps over the lazy dog"}}
+	got, err := CountTokens("claude-3-haiku-20240307", long)
+	if err != nil {
+		t.Fatalf("CountTokens failed for fallback model: %v", err)
+	}
+	if got != 10 {
+		t.Errorf("Expected heuristic count of 10, got %d", got)
+	}
+}
+
+func TestEncodingForModel(t *testing.T) {
+	tests := map[string]string{
+		"gpt-4o":                 "o200k_base",
+		"gpt-4o-2024-05-13":      "o200k_base",
+		"GPT-4.1-mini":           "o200k_base",
+		"o1-preview":             "o200k_base",
+		"gpt-4":                  "cl100k_base",
+		"gpt-4-turbo":            "cl100k_base",
+		"gpt-3.5-turbo-0125":     "cl100k_base",
+		"claude-3-opus-20240229": "",
+		"mock-model":             "",
+	}
+
+	for model, want := range tests {
+		if got := encodingForModel(model); got != want {
+			t.Errorf("Expected %q for %s, got %q", want, model, got)
+		}
+	}
+}
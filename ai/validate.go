@@ -0,0 +1,142 @@
+package ai
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ErrInvalidRequest is wrapped by every error returned from
+// ValidateChatCompletionRequest, so callers can tell validation failures
+// apart from backend errors with errors.Is
+var ErrInvalidRequest = errors.New("invalid request")
+
+// MaxStopSequences is the most stop sequences a request may carry, matching
+// OpenAI's limit
+const MaxStopSequences = 4
+
+// MaxPenalty bounds presence and frequency penalties, which must lie
+// between -MaxPenalty and MaxPenalty
+const MaxPenalty = 2.0
+
+// validRoles lists the message roles accepted by ValidateMessage
+var validRoles = map[string]bool{
+	"system":    true,
+	"user":      true,
+	"assistant": true,
+	"tool":      true,
+}
+
+// textOnlyModels lists models known not to accept image input. Dated
+// snapshots of these models match by prefix.
+var textOnlyModels = []string{
+	"gpt-3.5-turbo",
+	"gpt-4-0314",
+	"gpt-4-0613",
+	"gpt-4-32k",
+	"o1-mini",
+	"o3-mini",
+}
+
+// isTextOnlyModel reports whether a model is known to reject images. Plain
+// "gpt-4" is text-only, while gpt-4 variants such as gpt-4-turbo are not.
+func isTextOnlyModel(model string) bool {
+	if model == "gpt-4" {
+		return true
+	}
+	for _, prefix := range textOnlyModels {
+		if strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateChatCompletionRequest checks that a request has a model, at least
+// one message, no more than MaxStopSequences non-empty stop sequences,
+// penalties within range, and that every message is valid. Images are rejected for
+// models known to be text-only. The error describes the first problem found.
+func ValidateChatCompletionRequest(req ChatCompletionRequest) error {
+	if req.Model == "" {
+		return fmt.Errorf("%w: model is required", ErrInvalidRequest)
+	}
+	if len(req.Messages) == 0 {
+		return fmt.Errorf("%w: messages are required", ErrInvalidRequest)
+	}
+	if len(req.Stop) > MaxStopSequences {
+		return fmt.Errorf("%w: at most %d stop sequences are allowed, got %d", ErrInvalidRequest, MaxStopSequences, len(req.Stop))
+	}
+	for i, stop := range req.Stop {
+		if stop == "" {
+			return fmt.Errorf("%w: stop sequence %d is empty", ErrInvalidRequest, i)
+		}
+	}
+	if err := validatePenalty("presence_penalty", req.PresencePenalty); err != nil {
+		return err
+	}
+	if err := validatePenalty("frequency_penalty", req.FrequencyPenalty); err != nil {
+		return err
+	}
+
+	for i, msg := range req.Messages {
+		if err := ValidateMessage(msg); err != nil {
+			return fmt.Errorf("message %d: %w", i, err)
+		}
+		if msg.HasImages() && isTextOnlyModel(req.Model) {
+			return fmt.Errorf("message %d: %w: model %s does not accept images", i, ErrInvalidRequest, req.Model)
+		}
+	}
+
+	return nil
+}
+
+// validatePenalty checks that an optional penalty lies within
+// -MaxPenalty..MaxPenalty
+func validatePenalty(name string, penalty *float64) error {
+	if penalty != nil && (*penalty < -MaxPenalty || *penalty > MaxPenalty || math.IsNaN(*penalty)) {
+		return fmt.Errorf("%w: %s must be between %.1f and %.1f, got %v", ErrInvalidRequest, name, -MaxPenalty, MaxPenalty, *penalty)
+	}
+	return nil
+}
+
+// ValidateMessage checks that a message has a known role and non-empty
+// content. Assistant messages that only carry tool calls may omit content,
+// and tool messages must name the call they answer. Multimodal content must
+// be well-formed, and only user messages may carry images.
+func ValidateMessage(msg Message) error {
+	if !validRoles[msg.Role] {
+		return fmt.Errorf("%w: invalid role %q", ErrInvalidRequest, msg.Role)
+	}
+	if msg.Role == "tool" && msg.ToolCallID == "" {
+		return fmt.Errorf("%w: tool message is missing tool_call_id", ErrInvalidRequest)
+	}
+	if msg.Content == "" && len(msg.ContentParts) == 0 && !(msg.Role == "assistant" && len(msg.ToolCalls) > 0) {
+		return fmt.Errorf("%w: %s message has empty content", ErrInvalidRequest, msg.Role)
+	}
+
+	for i, part := range msg.ContentParts {
+		switch part.Type {
+		case ContentPartText:
+			if part.Text == "" {
+				return fmt.Errorf("%w: content part %d has empty text", ErrInvalidRequest, i)
+			}
+		case ContentPartImageURL:
+			if part.ImageURL == nil || part.ImageURL.URL == "" {
+				return fmt.Errorf("%w: content part %d is missing an image URL", ErrInvalidRequest, i)
+			}
+			if msg.Role != "user" {
+				return fmt.Errorf("%w: %s message cannot carry images", ErrInvalidRequest, msg.Role)
+			}
+		default:
+			return fmt.Errorf("%w: content part %d has unknown type %q", ErrInvalidRequest, i, part.Type)
+		}
+	}
+	return nil
+}
+
+// IsValidChatCompletionRequest reports whether ValidateChatCompletionRequest
+// accepts the request
+func IsValidChatCompletionRequest(req ChatCompletionRequest) bool {
+	return ValidateChatCompletionRequest(req) == nil
+}
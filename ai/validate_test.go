@@ -0,0 +1,133 @@
+package ai
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateChatCompletionRequest(t *testing.T) {
+	user := Message{Role: "user", Content: "Hello"}
+
+	tests := []struct {
+		name    string
+		req     ChatCompletionRequest
+		wantErr string
+	}{
+		{
+			name: "valid request",
+			req:  ChatCompletionRequest{Model: "gpt-4", Messages: []Message{{Role: "system", Content: "Be brief."}, user}},
+		},
+		{
+			name: "assistant tool call without content",
+			req: ChatCompletionRequest{Model: "gpt-4", Messages: []Message{
+				user,
+				{Role: "assistant", ToolCalls: []ToolCall{{ID: "call_1", Type: "function"}}},
+				{Role: "tool", ToolCallID: "call_1", Content: "sunny"},
+			}},
+		},
+		{
+			name:    "missing model",
+			req:     ChatCompletionRequest{Messages: []Message{user}},
+			wantErr: "model is required",
+		},
+		{
+			name:    "empty messages",
+			req:     ChatCompletionRequest{Model: "gpt-4"},
+			wantErr: "messages are required",
+		},
+		{
+			name:    "invalid role",
+			req:     ChatCompletionRequest{Model: "gpt-4", Messages: []Message{user, {Role: "robot", Content: "beep"}}},
+			wantErr: `message 1: invalid request: invalid role "robot"`,
+		},
+		{
+			name: "stop sequences",
+			req:  ChatCompletionRequest{Model: "gpt-4", Messages: []Message{user}, Stop: []string{"\n\n", "END"}},
+		},
+		{
+			name:    "too many stop sequences",
+			req:     ChatCompletionRequest{Model: "gpt-4", Messages: []Message{user}, Stop: []string{"a", "b", "c", "d", "e"}},
+			wantErr: "at most 4 stop sequences are allowed, got 5",
+		},
+		{
+			name:    "empty stop sequence",
+			req:     ChatCompletionRequest{Model: "gpt-4", Messages: []Message{user}, Stop: []string{"END", ""}},
+			wantErr: "stop sequence 1 is empty",
+		},
+		{
+			name: "penalties at the limits",
+			req:  ChatCompletionRequest{Model: "gpt-4", Messages: []Message{user}, PresencePenalty: float(-2), FrequencyPenalty: float(2)},
+		},
+		{
+			name:    "presence penalty too high",
+			req:     ChatCompletionRequest{Model: "gpt-4", Messages: []Message{user}, PresencePenalty: float(2.5)},
+			wantErr: "presence_penalty must be between -2.0 and 2.0, got 2.5",
+		},
+		{
+			name:    "frequency penalty too low",
+			req:     ChatCompletionRequest{Model: "gpt-4", Messages: []Message{user}, FrequencyPenalty: float(-2.1)},
+			wantErr: "frequency_penalty must be between -2.0 and 2.0, got -2.1",
+		},
+		{
+			name:    "empty content",
+			req:     ChatCompletionRequest{Model: "gpt-4", Messages: []Message{{Role: "user"}}},
+			wantErr: "user message has empty content",
+		},
+		{
+			name:    "tool message without call ID",
+			req:     ChatCompletionRequest{Model: "gpt-4", Messages: []Message{user, {Role: "tool", Content: "sunny"}}},
+			wantErr: "missing tool_call_id",
+		},
+		{
+			name: "image for a vision model",
+			req:  ChatCompletionRequest{Model: "gpt-4o", Messages: []Message{NewMultipartMessage("user", TextPart("What is this?"), ImagePart("https://example.com/cat.png"))}},
+		},
+		{
+			name:    "image for a text-only model",
+			req:     ChatCompletionRequest{Model: "gpt-3.5-turbo", Messages: []Message{NewMultipartMessage("user", ImagePart("https://example.com/cat.png"))}},
+			wantErr: "model gpt-3.5-turbo does not accept images",
+		},
+		{
+			name:    "image in an assistant message",
+			req:     ChatCompletionRequest{Model: "gpt-4o", Messages: []Message{user, NewMultipartMessage("assistant", ImagePart("https://example.com/cat.png"))}},
+			wantErr: "assistant message cannot carry images",
+		},
+		{
+			name:    "unknown content part",
+			req:     ChatCompletionRequest{Model: "gpt-4o", Messages: []Message{NewMultipartMessage("user", ContentPart{Type: "audio"})}},
+			wantErr: `unknown type "audio"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateChatCompletionRequest(tt.req)
+
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Expected valid request, got: %v", err)
+				}
+				if !IsValidChatCompletionRequest(tt.req) {
+					t.Error("IsValidChatCompletionRequest should agree with ValidateChatCompletionRequest")
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+			if !errors.Is(err, ErrInvalidRequest) {
+				t.Errorf("Expected error to wrap ErrInvalidRequest, got %v", err)
+			}
+			if IsValidChatCompletionRequest(tt.req) {
+				t.Error("IsValidChatCompletionRequest should agree with ValidateChatCompletionRequest")
+			}
+		})
+	}
+}
+
+// float returns a pointer to v, for optional request parameters
+func float(v float64) *float64 {
+	return &v
+}
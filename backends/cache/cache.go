@@ -0,0 +1,255 @@
+// Package cache provides a backend decorator that remembers completions for
+// deterministic requests, so repeating an identical temperature-0 prompt
+// does not pay for a second call. It composes with the other wrapping
+// backends, such as logging and fallback.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// DefaultMaxEntries bounds the cache until SetMaxEntries is called
+const DefaultMaxEntries = 256
+
+// Backend wraps another backend and caches its chat completions. Only
+// requests with an explicit temperature of zero are cached, since any other
+// temperature asks for varied replies. Streaming requests and requests made
+// with a context from WithoutCache always reach the wrapped backend.
+type Backend struct {
+	inner ai.Backend
+	ttl   time.Duration
+	now   func() time.Time
+
+	mutex      sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	order      *list.List // most recently used at the front
+	hits       int
+	misses     int
+}
+
+// entry is a cached response and when it stops being served
+type entry struct {
+	key      string
+	response *ai.ChatCompletionResponse
+	expires  time.Time
+}
+
+// Stats reports how the cache has been used
+type Stats struct {
+	Hits    int `json:"hits"`
+	Misses  int `json:"misses"`
+	Entries int `json:"entries"`
+}
+
+// NewCachingBackend wraps inner so identical deterministic requests made
+// within ttl are answered from memory. A ttl of zero or less keeps entries
+// until they are evicted for space.
+func NewCachingBackend(inner ai.Backend, ttl time.Duration) *Backend {
+	return &Backend{
+		inner:      inner,
+		ttl:        ttl,
+		now:        time.Now,
+		maxEntries: DefaultMaxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+type noCacheKey struct{}
+
+// WithoutCache returns a context whose requests bypass the cache, neither
+// reading nor storing a response
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+// SetMaxEntries bounds the number of cached responses, evicting the least
+// recently used ones beyond it. Values below 1 are treated as 1.
+func (b *Backend) SetMaxEntries(n int) {
+	if n < 1 {
+		n = 1
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.maxEntries = n
+	b.evictLocked()
+}
+
+// Stats returns the hit and miss counts and the number of cached responses
+func (b *Backend) Stats() Stats {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return Stats{Hits: b.hits, Misses: b.misses, Entries: b.order.Len()}
+}
+
+// Clear drops every cached response
+func (b *Backend) Clear() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.entries = make(map[string]*list.Element)
+	b.order.Init()
+}
+
+// Name returns the wrapped backend's name
+func (b *Backend) Name() string {
+	return b.inner.Name()
+}
+
+// ChatCompletion returns a cached response for a repeated deterministic
+// request, and otherwise forwards the request and caches a successful reply
+func (b *Backend) ChatCompletion(ctx context.Context, req ai.ChatCompletionRequest) (*ai.ChatCompletionResponse, error) {
+	if !cacheable(ctx, req) {
+		return b.inner.ChatCompletion(ctx, req)
+	}
+
+	key, err := requestKey(req)
+	if err != nil {
+		return b.inner.ChatCompletion(ctx, req)
+	}
+
+	if response, ok := b.lookup(key); ok {
+		return response, nil
+	}
+
+	response, err := b.inner.ChatCompletion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	b.store(key, response)
+	return response, nil
+}
+
+// SendMessage forwards the legacy request uncached
+func (b *Backend) SendMessage(ctx context.Context, req ai.Request) (*ai.Response, error) {
+	return b.inner.SendMessage(ctx, req)
+}
+
+// IsAvailable forwards the availability check
+func (b *Backend) IsAvailable(ctx context.Context) bool {
+	return b.inner.IsAvailable(ctx)
+}
+
+// HealthCheck forwards the detailed health check
+func (b *Backend) HealthCheck(ctx context.Context) (*ai.HealthStatus, error) {
+	return ai.CheckHealth(ctx, b.inner)
+}
+
+// Configure forwards the configuration to the wrapped backend
+func (b *Backend) Configure(config map[string]interface{}) error {
+	return b.inner.Configure(config)
+}
+
+// cacheable reports whether a request's reply may be served from or stored
+// in the cache
+func cacheable(ctx context.Context, req ai.ChatCompletionRequest) bool {
+	if skip, _ := ctx.Value(noCacheKey{}).(bool); skip {
+		return false
+	}
+	return !req.Stream && req.Temperature != nil && *req.Temperature == 0
+}
+
+// requestKey hashes everything in a request that can change the reply
+func requestKey(req ai.ChatCompletionRequest) (string, error) {
+	data, err := json.Marshal(struct {
+		Model     string       `json:"model"`
+		Messages  []ai.Message `json:"messages"`
+		MaxTokens *int         `json:"max_tokens"`
+		TopP      *float64     `json:"top_p"`
+		Stop      []string     `json:"stop"`
+		Tools     []ai.Tool    `json:"tools"`
+		Presence  *float64     `json:"presence_penalty"`
+		Frequency *float64     `json:"frequency_penalty"`
+		Seed      *int         `json:"seed"`
+	}{req.Model, req.Messages, req.MaxTokens, req.TopP, req.Stop, req.Tools, req.PresencePenalty, req.FrequencyPenalty, req.Seed})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// lookup returns a copy of an unexpired cached response and records the
+// hit or miss
+func (b *Backend) lookup(key string) (*ai.ChatCompletionResponse, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	element, ok := b.entries[key]
+	if ok {
+		cached := element.Value.(*entry)
+		if cached.expires.IsZero() || b.now().Before(cached.expires) {
+			b.order.MoveToFront(element)
+			b.hits++
+			return cloneResponse(cached.response), true
+		}
+		b.removeLocked(element)
+	}
+
+	b.misses++
+	return nil, false
+}
+
+// store caches a copy of response under key, evicting the least recently
+// used entries if the cache is full
+func (b *Backend) store(key string, response *ai.ChatCompletionResponse) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	cached := &entry{key: key, response: cloneResponse(response)}
+	if b.ttl > 0 {
+		cached.expires = b.now().Add(b.ttl)
+	}
+
+	if element, ok := b.entries[key]; ok {
+		element.Value = cached
+		b.order.MoveToFront(element)
+		return
+	}
+	b.entries[key] = b.order.PushFront(cached)
+	b.evictLocked()
+}
+
+// evictLocked drops the least recently used entries beyond maxEntries
+func (b *Backend) evictLocked() {
+	for b.order.Len() > b.maxEntries {
+		b.removeLocked(b.order.Back())
+	}
+}
+
+// removeLocked drops a single entry
+func (b *Backend) removeLocked(element *list.Element) {
+	b.order.Remove(element)
+	delete(b.entries, element.Value.(*entry).key)
+}
+
+// cloneResponse copies a response so callers cannot change a cached one
+func cloneResponse(response *ai.ChatCompletionResponse) *ai.ChatCompletionResponse {
+	clone := *response
+	clone.Choices = make([]ai.Choice, len(response.Choices))
+	for i, choice := range response.Choices {
+		choice.Message.ToolCalls = append([]ai.ToolCall(nil), choice.Message.ToolCalls...)
+		choice.Message.ContentParts = append([]ai.ContentPart(nil), choice.Message.ContentParts...)
+		clone.Choices[i] = choice
+	}
+	if response.ProviderMetadata != nil {
+		clone.ProviderMetadata = make(map[string]string, len(response.ProviderMetadata))
+		for key, value := range response.ProviderMetadata {
+			clone.ProviderMetadata[key] = value
+		}
+	}
+	return &clone
+}
@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// countingBackend numbers its replies so repeats are visible, or fails
+// with err
+type countingBackend struct {
+	calls int
+	err   error
+}
+
+func (c *countingBackend) Name() string { return "counting" }
+
+func (c *countingBackend) ChatCompletion(ctx context.Context, req ai.ChatCompletionRequest) (*ai.ChatCompletionResponse, error) {
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &ai.ChatCompletionResponse{
+		Model: req.Model,
+		Choices: []ai.Choice{{
+			Message:      ai.Message{Role: "assistant", Content: fmt.Sprintf("reply %d", c.calls)},
+			FinishReason: "stop",
+		}},
+	}, nil
+}
+
+func (c *countingBackend) SendMessage(ctx context.Context, req ai.Request) (*ai.Response, error) {
+	return &ai.Response{Content: "legacy reply"}, nil
+}
+
+func (c *countingBackend) IsAvailable(ctx context.Context) bool { return true }
+
+func (c *countingBackend) Configure(config map[string]interface{}) error { return nil }
+
+// deterministic returns a temperature-0 request for prompt
+func deterministic(prompt string) ai.ChatCompletionRequest {
+	temperature := 0.0
+	return ai.ChatCompletionRequest{
+		Model:       "gpt-4",
+		Messages:    []ai.Message{{Role: "user", Content: prompt}},
+		Temperature: &temperature,
+	}
+}
+
+func TestCache_RepeatedRequestIsServedFromCache(t *testing.T) {
+	inner := &countingBackend{}
+	b := NewCachingBackend(inner, time.Minute)
+
+	first, err := b.ChatCompletion(context.Background(), deterministic("hello"))
+	if err != nil {
+		t.Fatalf("ChatCompletion failed: %v", err)
+	}
+	first.Choices[0].Message.Content = "changed by caller"
+
+	second, err := b.ChatCompletion(context.Background(), deterministic("hello"))
+	if err != nil {
+		t.Fatalf("ChatCompletion failed: %v", err)
+	}
+
+	if inner.calls != 1 {
+		t.Errorf("Expected the inner backend to be called once, got %d", inner.calls)
+	}
+	if second.Choices[0].Message.Content != "reply 1" {
+		t.Errorf("Expected the cached reply, got %q", second.Choices[0].Message.Content)
+	}
+	if stats := b.Stats(); stats.Hits != 1 || stats.Misses != 1 || stats.Entries != 1 {
+		t.Errorf("Expected 1 hit, 1 miss and 1 entry, got %+v", stats)
+	}
+
+	// A different history is a different key
+	b.ChatCompletion(context.Background(), deterministic("goodbye"))
+	if inner.calls != 2 {
+		t.Errorf("Expected a new prompt to reach the inner backend, got %d calls", inner.calls)
+	}
+}
+
+func TestCache_SkipsNonDeterministicRequests(t *testing.T) {
+	inner := &countingBackend{}
+	b := NewCachingBackend(inner, time.Minute)
+
+	warm := deterministic("hello")
+	warm.Temperature = new(float64)
+	*warm.Temperature = 0.7
+	unset := deterministic("hello")
+	unset.Temperature = nil
+	stream := deterministic("hello")
+	stream.Stream = true
+
+	for _, req := range []ai.ChatCompletionRequest{warm, warm, unset, stream} {
+		b.ChatCompletion(context.Background(), req)
+	}
+	b.ChatCompletion(WithoutCache(context.Background()), deterministic("hello"))
+	b.ChatCompletion(WithoutCache(context.Background()), deterministic("hello"))
+
+	if inner.calls != 6 {
+		t.Errorf("Expected every request to reach the inner backend, got %d calls", inner.calls)
+	}
+	if stats := b.Stats(); stats.Entries != 0 {
+		t.Errorf("Expected nothing cached, got %+v", stats)
+	}
+}
+
+func TestCache_ExpiryAndEviction(t *testing.T) {
+	inner := &countingBackend{}
+	b := NewCachingBackend(inner, time.Minute)
+	now := time.Now()
+	b.now = func() time.Time { return now }
+
+	b.ChatCompletion(context.Background(), deterministic("hello"))
+	now = now.Add(2 * time.Minute)
+	b.ChatCompletion(context.Background(), deterministic("hello"))
+	if inner.calls != 2 {
+		t.Errorf("Expected an expired entry to be refetched, got %d calls", inner.calls)
+	}
+
+	b.SetMaxEntries(2)
+	b.ChatCompletion(context.Background(), deterministic("a"))
+	b.ChatCompletion(context.Background(), deterministic("hello")) // hello is now most recent
+	b.ChatCompletion(context.Background(), deterministic("b"))     // evicts a
+	if stats := b.Stats(); stats.Entries != 2 {
+		t.Errorf("Expected 2 entries, got %+v", stats)
+	}
+
+	calls := inner.calls
+	b.ChatCompletion(context.Background(), deterministic("hello"))
+	if inner.calls != calls {
+		t.Error("Expected the recently used entry to survive eviction")
+	}
+	b.ChatCompletion(context.Background(), deterministic("a"))
+	if inner.calls != calls+1 {
+		t.Error("Expected the least recently used entry to be evicted")
+	}
+}
+
+func TestCache_ErrorsAreNotCached(t *testing.T) {
+	inner := &countingBackend{err: errors.New("overloaded")}
+	b := NewCachingBackend(inner, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		if _, err := b.ChatCompletion(context.Background(), deterministic("hello")); err == nil {
+			t.Error("Expected the inner error to be returned")
+		}
+	}
+	if inner.calls != 2 {
+		t.Errorf("Expected failed requests to be retried, got %d calls", inner.calls)
+	}
+}
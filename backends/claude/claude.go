@@ -0,0 +1,360 @@
+// Package claude provides a backend for Anthropic's Claude models using the
+// Messages API.
+package claude
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// apiVersion is the Anthropic API version sent with every request
+const apiVersion = "2023-06-01"
+
+// defaultMaxTokens is used when a request does not set MaxTokens, since the
+// Messages API requires it
+const defaultMaxTokens = 1024
+
+// ClaudeBackend implements the Backend interface for Anthropic's API
+type ClaudeBackend struct {
+	apiKey     string
+	baseURL    string
+	httpClient *http.Client
+	model      string
+}
+
+// Config holds configuration for the Claude backend
+type Config struct {
+	APIKey     string        `json:"api_key"`
+	BaseURL    string        `json:"base_url"`
+	Model      string        `json:"model"`
+	Timeout    time.Duration `json:"timeout"`
+	MaxRetries int           `json:"max_retries"`
+}
+
+// NewClaudeBackend creates a new Claude backend instance
+func NewClaudeBackend(config Config) *ClaudeBackend {
+	if config.BaseURL == "" {
+		config.BaseURL = "https://api.anthropic.com/v1"
+	}
+	if config.Model == "" {
+		config.Model = "claude-3-sonnet-20240229"
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+
+	return &ClaudeBackend{
+		apiKey:  config.APIKey,
+		baseURL: strings.TrimRight(config.BaseURL, "/"),
+		model:   config.Model,
+		httpClient: &http.Client{
+			Timeout: config.Timeout,
+		},
+	}
+}
+
+// Name returns the name of this backend
+func (c *ClaudeBackend) Name() string {
+	return "Claude"
+}
+
+// message is a single turn in Anthropic's Messages API format. Content is
+// a string for plain text or a []contentBlock for multimodal turns.
+type message struct {
+	Role    string `json:"role"`
+	Content any    `json:"content"`
+}
+
+// contentBlock is a text or image block of a multimodal turn
+type contentBlock struct {
+	Type   string       `json:"type"`
+	Text   string       `json:"text,omitempty"`
+	Source *imageSource `json:"source,omitempty"`
+}
+
+// imageSource locates an image block's data, either by URL or inline as
+// base64
+type imageSource struct {
+	Type      string `json:"type"`
+	URL       string `json:"url,omitempty"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+}
+
+// messagesRequest is the body of a Messages API request
+type messagesRequest struct {
+	Model         string    `json:"model"`
+	MaxTokens     int       `json:"max_tokens"`
+	System        string    `json:"system,omitempty"`
+	Messages      []message `json:"messages"`
+	Temperature   *float64  `json:"temperature,omitempty"`
+	TopP          *float64  `json:"top_p,omitempty"`
+	StopSequences []string  `json:"stop_sequences,omitempty"`
+}
+
+// messagesResponse is the body of a Messages API response
+type messagesResponse struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	StopReason string `json:"stop_reason"`
+	Usage      struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+// ChatCompletion sends a chat completion request to Anthropic's Messages API
+func (c *ClaudeBackend) ChatCompletion(ctx context.Context, req ai.ChatCompletionRequest) (*ai.ChatCompletionResponse, error) {
+	if len(req.Messages) == 0 {
+		return nil, fmt.Errorf("messages are required")
+	}
+
+	requestBody, err := json.Marshal(c.translateRequest(req))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/messages", c.baseURL)
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	c.setHeaders(httpReq)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", ai.TransportError(err))
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errorResponse struct {
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+
+		if err := json.Unmarshal(responseBody, &errorResponse); err == nil && errorResponse.Error.Message != "" {
+			return nil, &ai.APIError{Provider: "Claude", StatusCode: resp.StatusCode, Message: errorResponse.Error.Message}
+		}
+
+		return nil, &ai.APIError{Provider: "Claude", StatusCode: resp.StatusCode, Message: string(responseBody)}
+	}
+
+	var claudeResponse messagesResponse
+	if err := json.Unmarshal(responseBody, &claudeResponse); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	response := translateResponse(claudeResponse)
+	if requestID := resp.Header.Get("request-id"); requestID != "" {
+		response.ProviderMetadata = map[string]string{"request_id": requestID}
+	}
+
+	return response, nil
+}
+
+// translateRequest converts our request into Messages API format. System
+// messages are hoisted into the top-level system prompt since the Messages
+// API only accepts user and assistant turns. Presence and frequency
+// penalties and seeds have no Messages API equivalent and are dropped.
+func (c *ClaudeBackend) translateRequest(req ai.ChatCompletionRequest) messagesRequest {
+	model := req.Model
+	if model == "" {
+		model = c.model
+	}
+
+	maxTokens := defaultMaxTokens
+	if req.MaxTokens != nil && *req.MaxTokens > 0 {
+		maxTokens = *req.MaxTokens
+	}
+
+	var system []string
+	messages := make([]message, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		if msg.Role == "system" {
+			system = append(system, msg.Content)
+			continue
+		}
+		messages = append(messages, message{Role: msg.Role, Content: translateContent(msg)})
+	}
+
+	return messagesRequest{
+		Model:         model,
+		MaxTokens:     maxTokens,
+		System:        strings.Join(system, "\n\n"),
+		Messages:      messages,
+		Temperature:   req.Temperature,
+		TopP:          req.TopP,
+		StopSequences: req.Stop,
+	}
+}
+
+// translateContent converts a message's content into Messages API form,
+// turning image_url parts into image blocks. Base64 data URLs are sent
+// inline; other URLs are passed by reference.
+func translateContent(msg ai.Message) any {
+	if len(msg.ContentParts) == 0 {
+		return msg.Content
+	}
+
+	blocks := make([]contentBlock, 0, len(msg.ContentParts))
+	for _, part := range msg.ContentParts {
+		switch part.Type {
+		case ai.ContentPartText:
+			blocks = append(blocks, contentBlock{Type: "text", Text: part.Text})
+		case ai.ContentPartImageURL:
+			if part.ImageURL == nil {
+				continue
+			}
+			blocks = append(blocks, contentBlock{Type: "image", Source: imageSourceFor(part.ImageURL.URL)})
+		}
+	}
+	return blocks
+}
+
+// imageSourceFor builds an image source from a URL, decoding the media type
+// and payload of data URLs such as "data:image/png;base64,iVBOR..."
+func imageSourceFor(url string) *imageSource {
+	if header, data, ok := strings.Cut(strings.TrimPrefix(url, "data:"), ","); ok && strings.HasPrefix(url, "data:") {
+		mediaType, _, _ := strings.Cut(header, ";")
+		return &imageSource{Type: "base64", MediaType: mediaType, Data: data}
+	}
+	return &imageSource{Type: "url", URL: url}
+}
+
+// finishReasons maps Anthropic stop reasons to OpenAI-style finish reasons
+var finishReasons = map[string]string{
+	"end_turn":      "stop",
+	"stop_sequence": "stop",
+	"max_tokens":    "length",
+	"tool_use":      "tool_calls",
+}
+
+// finishReason converts an Anthropic stop reason, passing unknown reasons
+// through unchanged
+func finishReason(stopReason string) string {
+	if reason, ok := finishReasons[stopReason]; ok {
+		return reason
+	}
+	return stopReason
+}
+
+// translateResponse converts a Messages API response into our format. The
+// Messages API has no total token count, so Usage sums input and output.
+func translateResponse(resp messagesResponse) *ai.ChatCompletionResponse {
+	var text strings.Builder
+	for _, block := range resp.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+
+	return &ai.ChatCompletionResponse{
+		ID:      resp.ID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   resp.Model,
+		Choices: []ai.Choice{
+			{
+				Index: 0,
+				Message: ai.Message{
+					Role:    "assistant",
+					Content: text.String(),
+				},
+				FinishReason: finishReason(resp.StopReason),
+			},
+		},
+		Usage: ai.Usage{
+			PromptTokens:     resp.Usage.InputTokens,
+			CompletionTokens: resp.Usage.OutputTokens,
+			TotalTokens:      resp.Usage.InputTokens + resp.Usage.OutputTokens,
+		},
+	}
+}
+
+// SendMessage implements the legacy interface by converting to ChatCompletion
+func (c *ClaudeBackend) SendMessage(ctx context.Context, req ai.Request) (*ai.Response, error) {
+	chatResp, err := c.ChatCompletion(ctx, req)
+	if err != nil {
+		return &ai.Response{
+			Error: err,
+		}, err
+	}
+
+	return &ai.Response{
+		Content:    chatResp.Choices[0].Message.Content,
+		TokensUsed: chatResp.Usage.TotalTokens,
+		Model:      chatResp.Model,
+		Timestamp:  time.Unix(chatResp.Created, 0),
+	}, nil
+}
+
+// IsAvailable checks if the Anthropic API is reachable with our key
+func (c *ClaudeBackend) IsAvailable(ctx context.Context) bool {
+	status, err := c.HealthCheck(ctx)
+	return err == nil && status.Available
+}
+
+// HealthCheck probes the models endpoint, which is cheap and requires a
+// valid API key, and reports latency and any categorized failure
+func (c *ClaudeBackend) HealthCheck(ctx context.Context) (*ai.HealthStatus, error) {
+	url := fmt.Sprintf("%s/models", c.baseURL)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create health check request: %w", err)
+	}
+	c.setHeaders(req)
+
+	return ai.ProbeHealth(c.httpClient, req), nil
+}
+
+// Configure updates the backend configuration
+func (c *ClaudeBackend) Configure(config map[string]interface{}) error {
+	if apiKey, ok := config["api_key"].(string); ok && apiKey != "" {
+		c.apiKey = apiKey
+	}
+
+	if baseURL, ok := config["base_url"].(string); ok && baseURL != "" {
+		c.baseURL = strings.TrimRight(baseURL, "/")
+	}
+
+	if model, ok := config["model"].(string); ok && model != "" {
+		c.model = model
+	}
+
+	if timeout, ok := config["timeout"].(time.Duration); ok && timeout > 0 {
+		c.httpClient.Timeout = timeout
+	}
+
+	if c.apiKey == "" {
+		return fmt.Errorf("api_key is required")
+	}
+
+	return nil
+}
+
+// setHeaders adds the authentication and version headers Anthropic requires
+func (c *ClaudeBackend) setHeaders(req *http.Request) {
+	req.Header.Set("x-api-key", c.apiKey)
+	req.Header.Set("anthropic-version", apiVersion)
+}
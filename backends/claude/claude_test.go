@@ -0,0 +1,202 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// newTestServer serves a canned Messages API reply and captures the request
+func newTestServer(t *testing.T, status int, reply string, captured *messagesRequest, headers *http.Header) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/messages" {
+			t.Errorf("Expected request to /messages, got %s", r.URL.Path)
+		}
+		if headers != nil {
+			*headers = r.Header.Clone()
+		}
+		if captured != nil {
+			if err := json.NewDecoder(r.Body).Decode(captured); err != nil {
+				t.Errorf("Failed to decode request body: %v", err)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("request-id", "req_018EeWyXxfu5pfWkrYcMdjWG")
+		w.WriteHeader(status)
+		w.Write([]byte(reply))
+	}))
+}
+
+const okReply = `{
+	"id": "msg_01",
+	"type": "message",
+	"role": "assistant",
+	"model": "claude-3-sonnet-20240229",
+	"content": [{"type": "text", "text": "Hello"}, {"type": "text", "text": " there"}],
+	"stop_reason": "end_turn",
+	"usage": {"input_tokens": 12, "output_tokens": 3}
+}`
+
+func TestChatCompletion_TranslatesRequest(t *testing.T) {
+	var captured messagesRequest
+	var headers http.Header
+	server := newTestServer(t, http.StatusOK, okReply, &captured, &headers)
+	defer server.Close()
+
+	backend := NewClaudeBackend(Config{APIKey: "sk-ant-test", BaseURL: server.URL})
+	temperature := 0.2
+	_, err := backend.ChatCompletion(context.Background(), ai.ChatCompletionRequest{
+		Model: "claude-3-haiku-20240307",
+		Messages: []ai.Message{
+			{Role: "system", Content: "You are terse."},
+			{Role: "user", Content: "Hi"},
+			{Role: "assistant", Content: "Hello"},
+			{Role: "system", Content: "Answer in English."},
+			{Role: "user", Content: "How are you?"},
+		},
+		Temperature: &temperature,
+		Stop:        []string{"END"},
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletion failed: %v", err)
+	}
+
+	if captured.Model != "claude-3-haiku-20240307" {
+		t.Errorf("Expected model to be passed through, got %q", captured.Model)
+	}
+	if captured.MaxTokens != defaultMaxTokens {
+		t.Errorf("Expected default max_tokens %d, got %d", defaultMaxTokens, captured.MaxTokens)
+	}
+	if captured.System != "You are terse.\n\nAnswer in English." {
+		t.Errorf("Expected system messages hoisted into system prompt, got %q", captured.System)
+	}
+	if len(captured.Messages) != 3 {
+		t.Fatalf("Expected 3 non-system messages, got %+v", captured.Messages)
+	}
+	for _, msg := range captured.Messages {
+		if msg.Role == "system" {
+			t.Errorf("System message should not remain in messages: %+v", msg)
+		}
+	}
+	if captured.Temperature == nil || *captured.Temperature != temperature {
+		t.Errorf("Expected temperature %v, got %v", temperature, captured.Temperature)
+	}
+	if !reflect.DeepEqual(captured.StopSequences, []string{"END"}) {
+		t.Errorf("Expected stop sequences [END], got %v", captured.StopSequences)
+	}
+
+	if headers.Get("x-api-key") != "sk-ant-test" || headers.Get("anthropic-version") != apiVersion {
+		t.Errorf("Expected auth and version headers, got %v", headers)
+	}
+}
+
+func TestChatCompletion_TranslatesResponse(t *testing.T) {
+	server := newTestServer(t, http.StatusOK, okReply, nil, nil)
+	defer server.Close()
+
+	backend := NewClaudeBackend(Config{APIKey: "test", BaseURL: server.URL})
+	maxTokens := 50
+	response, err := backend.ChatCompletion(context.Background(), ai.ChatCompletionRequest{
+		Messages:  []ai.Message{{Role: "user", Content: "Hi"}},
+		MaxTokens: &maxTokens,
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletion failed: %v", err)
+	}
+
+	if len(response.Choices) != 1 || response.Choices[0].Message.Content != "Hello there" {
+		t.Errorf("Expected text blocks joined into one message, got %+v", response.Choices)
+	}
+	if response.Choices[0].FinishReason != "stop" {
+		t.Errorf("Expected end_turn mapped to stop, got %q", response.Choices[0].FinishReason)
+	}
+	if response.Usage != (ai.Usage{PromptTokens: 12, CompletionTokens: 3, TotalTokens: 15}) {
+		t.Errorf("Expected synthesized usage, got %+v", response.Usage)
+	}
+	if response.ProviderMetadata["request_id"] != "req_018EeWyXxfu5pfWkrYcMdjWG" {
+		t.Errorf("Expected request ID in provider metadata, got %v", response.ProviderMetadata)
+	}
+}
+
+func TestFinishReason(t *testing.T) {
+	for stopReason, want := range map[string]string{
+		"end_turn":      "stop",
+		"stop_sequence": "stop",
+		"max_tokens":    "length",
+		"tool_use":      "tool_calls",
+		"refusal":       "refusal",
+	} {
+		if got := finishReason(stopReason); got != want {
+			t.Errorf("finishReason(%q) = %q, expected %q", stopReason, got, want)
+		}
+	}
+}
+
+func TestTranslateContent(t *testing.T) {
+	if got := translateContent(ai.Message{Role: "user", Content: "Hi"}); got != "Hi" {
+		t.Errorf("Expected plain text to stay a string, got %#v", got)
+	}
+
+	msg := ai.NewMultipartMessage("user",
+		ai.TextPart("Compare these"),
+		ai.ImagePart("https://example.com/cat.png"),
+		ai.ImagePart("data:image/png;base64,iVBORw0KGgo="),
+	)
+	blocks, ok := translateContent(msg).([]contentBlock)
+	if !ok || len(blocks) != 3 {
+		t.Fatalf("Expected three content blocks, got %#v", translateContent(msg))
+	}
+	if blocks[0].Type != "text" || blocks[0].Text != "Compare these" {
+		t.Errorf("Expected text block, got %+v", blocks[0])
+	}
+	if blocks[1].Type != "image" || *blocks[1].Source != (imageSource{Type: "url", URL: "https://example.com/cat.png"}) {
+		t.Errorf("Expected URL image block, got %+v", blocks[1].Source)
+	}
+	if *blocks[2].Source != (imageSource{Type: "base64", MediaType: "image/png", Data: "iVBORw0KGgo="}) {
+		t.Errorf("Expected inline base64 image block, got %+v", blocks[2].Source)
+	}
+}
+
+func TestChatCompletion_APIError(t *testing.T) {
+	server := newTestServer(t, http.StatusBadRequest,
+		`{"type": "error", "error": {"type": "invalid_request_error", "message": "max_tokens: field required"}}`, nil, nil)
+	defer server.Close()
+
+	backend := NewClaudeBackend(Config{APIKey: "test", BaseURL: server.URL})
+	_, err := backend.ChatCompletion(context.Background(), ai.ChatCompletionRequest{
+		Messages: []ai.Message{{Role: "user", Content: "Hi"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "max_tokens: field required") {
+		t.Errorf("Expected API error message, got %v", err)
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header.Clone()
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	backend := NewClaudeBackend(Config{APIKey: "sk-ant-test", BaseURL: server.URL})
+	status, err := backend.HealthCheck(context.Background())
+	if err != nil {
+		t.Fatalf("HealthCheck failed: %v", err)
+	}
+	if status.Available || status.Failure != ai.HealthFailureRateLimited || status.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Expected a rate limit failure, got %+v", status)
+	}
+	if headers.Get("x-api-key") != "sk-ant-test" {
+		t.Errorf("Expected the probe to be authenticated, got %v", headers)
+	}
+}
@@ -0,0 +1,177 @@
+// Package fallback provides a backend that sends requests to a primary
+// backend and retries them on a secondary one when the primary is failing,
+// so a provider outage degrades service instead of failing the user.
+package fallback
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// Backend delegates to a primary backend and falls back to a secondary one
+// when the primary returns a retryable error or reports itself unavailable.
+// Streaming requests fall back the same way, before any chunk is sent.
+type Backend struct {
+	primary   ai.Backend
+	secondary ai.Backend
+	logger    *slog.Logger
+
+	mutex  sync.Mutex
+	active ai.Backend
+}
+
+// NewFallbackBackend creates a backend that prefers primary and falls back to
+// secondary. Each fallback is logged to logger at warn level; a nil logger
+// discards them.
+func NewFallbackBackend(primary, secondary ai.Backend, logger *slog.Logger) *Backend {
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
+	return &Backend{
+		primary:   primary,
+		secondary: secondary,
+		logger:    logger,
+		active:    primary,
+	}
+}
+
+// Name returns the name of the backend that handled the most recent request
+func (b *Backend) Name() string {
+	return b.Active().Name()
+}
+
+// Active returns the backend that handled the most recent request, or the
+// primary if no request has been made yet
+func (b *Backend) Active() ai.Backend {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.active
+}
+
+// ChatCompletion sends the request to the primary backend, falling back to
+// the secondary if the primary is failing
+func (b *Backend) ChatCompletion(ctx context.Context, req ai.ChatCompletionRequest) (*ai.ChatCompletionResponse, error) {
+	response, err := b.primary.ChatCompletion(ctx, req)
+	if !b.shouldFallBack(ctx, err) {
+		b.handled(b.primary)
+		return response, err
+	}
+
+	b.fallingBack(ctx, err)
+	response, err = b.secondary.ChatCompletion(ctx, req)
+	b.handled(b.secondary)
+	return response, err
+}
+
+// ChatCompletionStream streams the request from the primary backend, falling
+// back to the secondary if the primary fails to start the stream. A backend
+// that cannot stream has its response delivered as a single chunk.
+func (b *Backend) ChatCompletionStream(ctx context.Context, req ai.ChatCompletionRequest) (<-chan ai.StreamChunk, error) {
+	chunks, err := stream(ctx, b.primary, req)
+	if !b.shouldFallBack(ctx, err) {
+		b.handled(b.primary)
+		return chunks, err
+	}
+
+	b.fallingBack(ctx, err)
+	chunks, err = stream(ctx, b.secondary, req)
+	b.handled(b.secondary)
+	return chunks, err
+}
+
+// SendMessage sends the legacy request to the primary backend, falling back
+// to the secondary if the primary is failing
+func (b *Backend) SendMessage(ctx context.Context, req ai.Request) (*ai.Response, error) {
+	response, err := b.primary.SendMessage(ctx, req)
+	if !b.shouldFallBack(ctx, err) {
+		b.handled(b.primary)
+		return response, err
+	}
+
+	b.fallingBack(ctx, err)
+	response, err = b.secondary.SendMessage(ctx, req)
+	b.handled(b.secondary)
+	return response, err
+}
+
+// IsAvailable reports whether either backend is available
+func (b *Backend) IsAvailable(ctx context.Context) bool {
+	return b.primary.IsAvailable(ctx) || b.secondary.IsAvailable(ctx)
+}
+
+// HealthCheck forwards the detailed health check to the active backend
+func (b *Backend) HealthCheck(ctx context.Context) (*ai.HealthStatus, error) {
+	return ai.CheckHealth(ctx, b.Active())
+}
+
+// Configure passes the configuration to both backends
+func (b *Backend) Configure(config map[string]interface{}) error {
+	if err := b.primary.Configure(config); err != nil {
+		return fmt.Errorf("failed to configure %s: %w", b.primary.Name(), err)
+	}
+	if err := b.secondary.Configure(config); err != nil {
+		return fmt.Errorf("failed to configure %s: %w", b.secondary.Name(), err)
+	}
+	return nil
+}
+
+// shouldFallBack reports whether a primary failure should be retried on the
+// secondary. Cancelled requests are never retried.
+func (b *Backend) shouldFallBack(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	return ai.IsRetryable(err) || !b.primary.IsAvailable(ctx)
+}
+
+// handled records the backend that served a request
+func (b *Backend) handled(backend ai.Backend) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.active = backend
+}
+
+// fallingBack logs a primary failure that is being retried on the secondary
+func (b *Backend) fallingBack(ctx context.Context, err error) {
+	b.logger.LogAttrs(ctx, slog.LevelWarn, "falling back to secondary backend",
+		slog.String("primary", b.primary.Name()),
+		slog.String("secondary", b.secondary.Name()),
+		slog.String("error", err.Error()),
+	)
+}
+
+// stream starts a streaming request on backend, adapting a backend that
+// cannot stream into a single-chunk stream
+func stream(ctx context.Context, backend ai.Backend, req ai.ChatCompletionRequest) (<-chan ai.StreamChunk, error) {
+	if streaming, ok := backend.(ai.StreamingBackend); ok {
+		return streaming.ChatCompletionStream(ctx, req)
+	}
+
+	response, err := backend.ChatCompletion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Choices) == 0 {
+		return nil, fmt.Errorf("no response choices returned")
+	}
+
+	chunks := make(chan ai.StreamChunk, 1)
+	usage := response.Usage
+	chunks <- ai.StreamChunk{
+		Delta:             response.Choices[0].Message.Content,
+		ToolCalls:         response.Choices[0].Message.ToolCalls,
+		FinishReason:      response.Choices[0].FinishReason,
+		Usage:             &usage,
+		ProviderMetadata:  response.ProviderMetadata,
+		ID:                response.ID,
+		Model:             response.Model,
+		SystemFingerprint: response.SystemFingerprint,
+	}
+	close(chunks)
+	return chunks, nil
+}
@@ -0,0 +1,203 @@
+package fallback
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// fakeBackend answers instantly with its name as the model, or fails with err
+type fakeBackend struct {
+	name        string
+	err         error
+	unavailable bool
+	calls       int
+}
+
+func (f *fakeBackend) Name() string { return f.name }
+
+func (f *fakeBackend) ChatCompletion(ctx context.Context, req ai.ChatCompletionRequest) (*ai.ChatCompletionResponse, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &ai.ChatCompletionResponse{
+		Model:   f.name,
+		Choices: []ai.Choice{{Message: ai.Message{Role: "assistant", Content: f.name}}},
+	}, nil
+}
+
+func (f *fakeBackend) SendMessage(ctx context.Context, req ai.Request) (*ai.Response, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &ai.Response{Model: f.name}, nil
+}
+
+func (f *fakeBackend) IsAvailable(ctx context.Context) bool { return !f.unavailable }
+
+func (f *fakeBackend) Configure(config map[string]interface{}) error { return nil }
+
+func newTestBackend(primary, secondary *fakeBackend) (*Backend, *bytes.Buffer) {
+	var logs bytes.Buffer
+	b := NewFallbackBackend(primary, secondary, slog.New(slog.NewTextHandler(&logs, nil)))
+	return b, &logs
+}
+
+func TestFallback_PrimaryHealthy(t *testing.T) {
+	primary, secondary := &fakeBackend{name: "primary"}, &fakeBackend{name: "secondary"}
+	b, logs := newTestBackend(primary, secondary)
+
+	response, err := b.ChatCompletion(context.Background(), ai.ChatCompletionRequest{})
+	if err != nil {
+		t.Fatalf("ChatCompletion failed: %v", err)
+	}
+	if response.Model != "primary" || secondary.calls != 0 {
+		t.Errorf("Expected primary to serve alone, got %s with %d secondary calls", response.Model, secondary.calls)
+	}
+	if b.Name() != "primary" {
+		t.Errorf("Expected active backend primary, got %s", b.Name())
+	}
+	if logs.Len() > 0 {
+		t.Errorf("Expected nothing logged without a fallback, got: %s", logs.String())
+	}
+}
+
+func TestFallback_RetryableError(t *testing.T) {
+	primary := &fakeBackend{name: "primary", err: &ai.APIError{Provider: "primary", StatusCode: 503, Message: "down"}}
+	secondary := &fakeBackend{name: "secondary"}
+	b, logs := newTestBackend(primary, secondary)
+
+	response, err := b.ChatCompletion(context.Background(), ai.ChatCompletionRequest{})
+	if err != nil {
+		t.Fatalf("ChatCompletion failed: %v", err)
+	}
+	if response.Model != "secondary" {
+		t.Errorf("Expected secondary to serve, got %s", response.Model)
+	}
+	if b.Name() != "secondary" {
+		t.Errorf("Expected active backend secondary, got %s", b.Name())
+	}
+	if !strings.Contains(logs.String(), "falling back to secondary backend") || !strings.Contains(logs.String(), "primary=primary") {
+		t.Errorf("Expected fallback to be logged, got: %s", logs.String())
+	}
+
+	legacy, err := b.SendMessage(context.Background(), ai.Request{})
+	if err != nil || legacy.Model != "secondary" {
+		t.Errorf("Expected legacy request to fall back, got %+v, %v", legacy, err)
+	}
+}
+
+func TestFallback_UnavailablePrimary(t *testing.T) {
+	primary := &fakeBackend{name: "primary", err: errors.New("connection refused"), unavailable: true}
+	secondary := &fakeBackend{name: "secondary"}
+	b, _ := newTestBackend(primary, secondary)
+
+	response, err := b.ChatCompletion(context.Background(), ai.ChatCompletionRequest{})
+	if err != nil || response.Model != "secondary" {
+		t.Errorf("Expected fallback for unavailable primary, got %+v, %v", response, err)
+	}
+}
+
+func TestFallback_PermanentError(t *testing.T) {
+	primary := &fakeBackend{name: "primary", err: &ai.APIError{Provider: "primary", StatusCode: 400, Message: "bad request"}}
+	secondary := &fakeBackend{name: "secondary"}
+	b, _ := newTestBackend(primary, secondary)
+
+	if _, err := b.ChatCompletion(context.Background(), ai.ChatCompletionRequest{}); err == nil {
+		t.Error("Expected permanent error to be returned")
+	}
+	if secondary.calls != 0 {
+		t.Errorf("Expected no fallback for a permanent error, got %d secondary calls", secondary.calls)
+	}
+}
+
+func TestFallback_CancelledContext(t *testing.T) {
+	primary := &fakeBackend{name: "primary", err: context.Canceled, unavailable: true}
+	secondary := &fakeBackend{name: "secondary"}
+	b, _ := newTestBackend(primary, secondary)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := b.ChatCompletion(ctx, ai.ChatCompletionRequest{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected cancellation error, got %v", err)
+	}
+	if secondary.calls != 0 {
+		t.Errorf("Expected no fallback after cancellation, got %d secondary calls", secondary.calls)
+	}
+}
+
+// streamingBackend is a fakeBackend that streams its name as one chunk and
+// reports a detailed health status
+type streamingBackend struct {
+	*fakeBackend
+	streams int
+}
+
+func (s *streamingBackend) ChatCompletionStream(ctx context.Context, req ai.ChatCompletionRequest) (<-chan ai.StreamChunk, error) {
+	s.streams++
+	if s.err != nil {
+		return nil, s.err
+	}
+	chunks := make(chan ai.StreamChunk, 1)
+	chunks <- ai.StreamChunk{Delta: s.name, FinishReason: "stop"}
+	close(chunks)
+	return chunks, nil
+}
+
+func (s *streamingBackend) HealthCheck(ctx context.Context) (*ai.HealthStatus, error) {
+	return &ai.HealthStatus{Available: true, Endpoint: s.name}, nil
+}
+
+func readStream(t *testing.T, chunks <-chan ai.StreamChunk) string {
+	t.Helper()
+	var content strings.Builder
+	for chunk := range chunks {
+		content.WriteString(chunk.Delta)
+	}
+	return content.String()
+}
+
+func TestFallback_Stream(t *testing.T) {
+	primary := &streamingBackend{fakeBackend: &fakeBackend{name: "primary"}}
+	secondary := &fakeBackend{name: "secondary"}
+	b := NewFallbackBackend(primary, secondary, nil)
+
+	chunks, err := b.ChatCompletionStream(context.Background(), ai.ChatCompletionRequest{})
+	if err != nil {
+		t.Fatalf("ChatCompletionStream failed: %v", err)
+	}
+	if got := readStream(t, chunks); got != "primary" || primary.streams != 1 {
+		t.Errorf("Expected the primary to stream, got %q after %d streams", got, primary.streams)
+	}
+
+	// A failing primary falls back to a secondary that cannot stream
+	primary.err = &ai.APIError{Provider: "primary", StatusCode: 503, Message: "down"}
+	chunks, err = b.ChatCompletionStream(context.Background(), ai.ChatCompletionRequest{})
+	if err != nil {
+		t.Fatalf("ChatCompletionStream failed: %v", err)
+	}
+	if readStream(t, chunks) != "secondary" || secondary.calls != 1 || b.Name() != "secondary" {
+		t.Errorf("Expected the secondary to serve the stream, got %d calls with %s active", secondary.calls, b.Name())
+	}
+}
+
+func TestFallback_HealthCheck(t *testing.T) {
+	primary := &streamingBackend{fakeBackend: &fakeBackend{name: "primary"}}
+	b := NewFallbackBackend(primary, &fakeBackend{name: "secondary"}, nil)
+
+	status, err := b.HealthCheck(context.Background())
+	if err != nil {
+		t.Fatalf("HealthCheck failed: %v", err)
+	}
+	if status.Endpoint != "primary" {
+		t.Errorf("Expected the active backend's health status, got %+v", status)
+	}
+}
@@ -0,0 +1,202 @@
+// Package logging provides a backend decorator that logs every request and
+// response passing through another backend, for debugging without changing
+// the backend itself. It composes with the other wrapping backends, such as
+// router and fallback.
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// Backend wraps another backend and logs each call made through it. By
+// default only message counts and lengths are logged; message bodies are
+// included only after SetLogBodies.
+type Backend struct {
+	inner  ai.Backend
+	logger *slog.Logger
+
+	mutex      sync.Mutex
+	level      slog.Level
+	errorLevel slog.Level
+	maxBody    int
+}
+
+// NewLoggingBackend wraps inner so every call is logged to logger. A nil
+// logger uses slog.Default().
+func NewLoggingBackend(inner ai.Backend, logger *slog.Logger) *Backend {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &Backend{
+		inner:      inner,
+		logger:     logger,
+		level:      slog.LevelDebug,
+		errorLevel: slog.LevelError,
+	}
+}
+
+// SetLevels sets the level successful calls and failed calls are logged at.
+// The defaults are debug and error.
+func (b *Backend) SetLevels(success, failure slog.Level) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.level = success
+	b.errorLevel = failure
+}
+
+// SetLogBodies includes the last request message and the response content
+// in the log, each truncated to maxLen bytes. Zero or less logs only
+// lengths, which is the default.
+func (b *Backend) SetLogBodies(maxLen int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.maxBody = maxLen
+}
+
+// Name returns the wrapped backend's name
+func (b *Backend) Name() string {
+	return b.inner.Name()
+}
+
+// ChatCompletion forwards the request and logs its outcome
+func (b *Backend) ChatCompletion(ctx context.Context, req ai.ChatCompletionRequest) (*ai.ChatCompletionResponse, error) {
+	start := time.Now()
+	response, err := b.inner.ChatCompletion(ctx, req)
+	latency := time.Since(start)
+
+	attrs := []slog.Attr{
+		slog.String("backend", b.inner.Name()),
+		slog.String("model", req.Model),
+		slog.Int("messages", len(req.Messages)),
+		slog.Int("request_chars", requestLength(req.Messages)),
+		slog.Duration("latency", latency),
+	}
+	if len(req.Messages) > 0 {
+		attrs = b.appendBody(attrs, "request", req.Messages[len(req.Messages)-1].Content)
+	}
+
+	if err == nil && response != nil {
+		attrs = append(attrs,
+			slog.Int("prompt_tokens", response.Usage.PromptTokens),
+			slog.Int("completion_tokens", response.Usage.CompletionTokens),
+			slog.Int("total_tokens", response.Usage.TotalTokens),
+		)
+		if len(response.Choices) > 0 {
+			choice := response.Choices[0]
+			attrs = append(attrs,
+				slog.String("finish_reason", choice.FinishReason),
+				slog.Int("response_chars", len(choice.Message.Content)),
+			)
+			attrs = b.appendBody(attrs, "response", choice.Message.Content)
+		}
+	}
+
+	b.log(ctx, "chat completion", err, attrs)
+	return response, err
+}
+
+// SendMessage forwards the legacy request and logs its outcome
+func (b *Backend) SendMessage(ctx context.Context, req ai.Request) (*ai.Response, error) {
+	start := time.Now()
+	response, err := b.inner.SendMessage(ctx, req)
+	latency := time.Since(start)
+
+	attrs := []slog.Attr{
+		slog.String("backend", b.inner.Name()),
+		slog.String("model", req.Model),
+		slog.Int("messages", len(req.Messages)),
+		slog.Int("request_chars", requestLength(req.Messages)),
+		slog.Duration("latency", latency),
+	}
+	if len(req.Messages) > 0 {
+		attrs = b.appendBody(attrs, "request", req.Messages[len(req.Messages)-1].Content)
+	}
+
+	if err == nil && response != nil {
+		attrs = append(attrs,
+			slog.Int("total_tokens", response.TokensUsed),
+			slog.Int("response_chars", len(response.Content)),
+		)
+		attrs = b.appendBody(attrs, "response", response.Content)
+	}
+
+	b.log(ctx, "send message", err, attrs)
+	return response, err
+}
+
+// IsAvailable forwards the health check and logs the result
+func (b *Backend) IsAvailable(ctx context.Context) bool {
+	available := b.inner.IsAvailable(ctx)
+	b.log(ctx, "availability check", nil, []slog.Attr{
+		slog.String("backend", b.inner.Name()),
+		slog.Bool("available", available),
+	})
+	return available
+}
+
+// HealthCheck forwards the detailed health check and logs the result
+func (b *Backend) HealthCheck(ctx context.Context) (*ai.HealthStatus, error) {
+	status, err := ai.CheckHealth(ctx, b.inner)
+	attrs := []slog.Attr{slog.String("backend", b.inner.Name())}
+	if status != nil {
+		attrs = append(attrs,
+			slog.Bool("available", status.Available),
+			slog.Duration("latency", status.Latency),
+			slog.String("failure", string(status.Failure)),
+		)
+	}
+	b.log(ctx, "health check", err, attrs)
+	return status, err
+}
+
+// Configure forwards the configuration to the wrapped backend
+func (b *Backend) Configure(config map[string]interface{}) error {
+	return b.inner.Configure(config)
+}
+
+// log writes a record at the success or failure level
+func (b *Backend) log(ctx context.Context, msg string, err error, attrs []slog.Attr) {
+	b.mutex.Lock()
+	level := b.level
+	if err != nil {
+		level = b.errorLevel
+	}
+	b.mutex.Unlock()
+
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	b.logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// appendBody adds a truncated body attribute when bodies are enabled
+func (b *Backend) appendBody(attrs []slog.Attr, key, body string) []slog.Attr {
+	b.mutex.Lock()
+	maxBody := b.maxBody
+	b.mutex.Unlock()
+
+	if maxBody <= 0 {
+		return attrs
+	}
+	if len(body) > maxBody {
+		body = body[:maxBody] + "..."
+	}
+	return append(attrs, slog.String(key, body))
+}
+
+// requestLength returns the total content length of the messages
+func requestLength(messages []ai.Message) int {
+	total := 0
+	for _, msg := range messages {
+		total += len(msg.Content)
+	}
+	return total
+}
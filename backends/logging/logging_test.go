@@ -0,0 +1,108 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// fakeBackend answers instantly with a fixed reply, or fails with err
+type fakeBackend struct {
+	err error
+}
+
+func (f *fakeBackend) Name() string { return "fake" }
+
+func (f *fakeBackend) ChatCompletion(ctx context.Context, req ai.ChatCompletionRequest) (*ai.ChatCompletionResponse, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &ai.ChatCompletionResponse{
+		Model: req.Model,
+		Choices: []ai.Choice{{
+			Message:      ai.Message{Role: "assistant", Content: "the secret answer is 42"},
+			FinishReason: "stop",
+		}},
+		Usage: ai.Usage{PromptTokens: 7, CompletionTokens: 5, TotalTokens: 12},
+	}, nil
+}
+
+func (f *fakeBackend) SendMessage(ctx context.Context, req ai.Request) (*ai.Response, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &ai.Response{Content: "legacy reply", TokensUsed: 3}, nil
+}
+
+func (f *fakeBackend) IsAvailable(ctx context.Context) bool { return true }
+
+func (f *fakeBackend) Configure(config map[string]interface{}) error { return nil }
+
+func newTestBackend(inner ai.Backend) (*Backend, *bytes.Buffer) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	return NewLoggingBackend(inner, logger), &logs
+}
+
+var request = ai.ChatCompletionRequest{
+	Model:    "gpt-4",
+	Messages: []ai.Message{{Role: "user", Content: "tell me the secret"}},
+}
+
+func TestLogging_ChatCompletion(t *testing.T) {
+	b, logs := newTestBackend(&fakeBackend{})
+
+	if _, err := b.ChatCompletion(context.Background(), request); err != nil {
+		t.Fatalf("ChatCompletion failed: %v", err)
+	}
+
+	output := logs.String()
+	for _, want := range []string{
+		"level=DEBUG", "backend=fake", "model=gpt-4", "messages=1",
+		"request_chars=18", "prompt_tokens=7", "total_tokens=12", "latency=",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected log to contain %q, got: %s", want, output)
+		}
+	}
+
+	if strings.Contains(output, "secret") {
+		t.Errorf("Expected bodies to be omitted by default, got: %s", output)
+	}
+}
+
+func TestLogging_Bodies(t *testing.T) {
+	b, logs := newTestBackend(&fakeBackend{})
+	b.SetLogBodies(10)
+
+	if _, err := b.ChatCompletion(context.Background(), request); err != nil {
+		t.Fatalf("ChatCompletion failed: %v", err)
+	}
+
+	output := logs.String()
+	if !strings.Contains(output, `request="tell me th..."`) {
+		t.Errorf("Expected truncated request body, got: %s", output)
+	}
+	if !strings.Contains(output, `response="the secret..."`) {
+		t.Errorf("Expected truncated response body, got: %s", output)
+	}
+}
+
+func TestLogging_Errors(t *testing.T) {
+	b, logs := newTestBackend(&fakeBackend{err: errors.New("boom")})
+	b.SetLevels(slog.LevelInfo, slog.LevelWarn)
+
+	if _, err := b.SendMessage(context.Background(), request); err == nil {
+		t.Fatal("Expected error to be passed through")
+	}
+
+	output := logs.String()
+	if !strings.Contains(output, "level=WARN") || !strings.Contains(output, "error=boom") {
+		t.Errorf("Expected failure at the configured level, got: %s", output)
+	}
+}
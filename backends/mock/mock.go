@@ -0,0 +1,454 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// MockBackend is a simple mock implementation of the Backend interface
+type MockBackend struct {
+	name   string
+	config map[string]interface{}
+
+	mu sync.Mutex
+	// responses holds scripted replies returned before falling back to echo
+	responses []string
+
+	// latency is the simulated processing time of each call
+	latency time.Duration
+	// failureRate is the fraction of calls that fail, drawn from rng
+	failureRate float64
+	rng         *rand.Rand
+	// injected is returned by the next call, then cleared
+	injected error
+	// plain drops the format markers from echoed replies
+	plain bool
+}
+
+// defaultLatency is the simulated processing time unless SetLatency is used
+const defaultLatency = 100 * time.Millisecond
+
+// NewMockBackend creates a new mock backend instance
+func NewMockBackend() *MockBackend {
+	return &MockBackend{
+		name:    "MockAI",
+		config:  make(map[string]interface{}),
+		latency: defaultLatency,
+		rng:     rand.New(rand.NewSource(1)),
+	}
+}
+
+// SetLatency sets the simulated processing time of each call
+func (m *MockBackend) SetLatency(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.latency = d
+}
+
+// SetFailureRate makes a fraction p of calls fail with a retryable
+// 503 APIError. Failures are drawn from a seeded source, so a given seed
+// always fails the same calls; see SetSeed.
+func (m *MockBackend) SetFailureRate(p float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.failureRate = p
+}
+
+// SetSeed reseeds the source used to pick failing calls
+func (m *MockBackend) SetSeed(seed int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.rng = rand.New(rand.NewSource(seed))
+}
+
+// SetDecorate controls whether echoed replies carry the "OpenAI format" and
+// "legacy format" markers. They are on by default; turning them off makes
+// the mock echo the last message as is, which reads better in demos.
+func (m *MockBackend) SetDecorate(decorate bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.plain = !decorate
+}
+
+// decorated reports whether echoed replies carry the format markers
+func (m *MockBackend) decorated() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return !m.plain
+}
+
+// InjectError makes the next call return err
+func (m *MockBackend) InjectError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.injected = err
+}
+
+// simulateCall waits for the configured latency and then reports any
+// injected or randomly chosen failure
+func (m *MockBackend) simulateCall(ctx context.Context) error {
+	m.mu.Lock()
+	latency := m.latency
+	m.mu.Unlock()
+
+	select {
+	case <-time.After(latency):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.injected; err != nil {
+		m.injected = nil
+		return err
+	}
+
+	if m.failureRate > 0 && m.rng.Float64() < m.failureRate {
+		return &ai.APIError{Provider: m.name, StatusCode: 503, Message: "simulated failure"}
+	}
+
+	return nil
+}
+
+// ToolCallDirective is the prefix of a user message that makes the mock
+// simulate a tool call, e.g. `call:get_weather {"city":"Paris"}`. The named
+// tool is called whether or not it was advertised in the request, so tests
+// can also exercise a model calling tools it should not.
+const ToolCallDirective = "call:"
+
+// parseToolCallDirective turns a user message starting with ToolCallDirective
+// into a tool call
+func parseToolCallDirective(msg ai.Message) (ai.ToolCall, bool) {
+	if msg.Role != "user" || !strings.HasPrefix(msg.Content, ToolCallDirective) {
+		return ai.ToolCall{}, false
+	}
+
+	name, args, _ := strings.Cut(strings.TrimPrefix(msg.Content, ToolCallDirective), " ")
+	if name == "" {
+		return ai.ToolCall{}, false
+	}
+	args = strings.TrimSpace(args)
+	if args == "" {
+		args = "{}"
+	}
+
+	return ai.ToolCall{
+		ID:   fmt.Sprintf("call_mock_%d", time.Now().UnixNano()),
+		Type: "function",
+		Function: ai.FunctionCall{
+			Name:      name,
+			Arguments: args,
+		},
+	}, true
+}
+
+// QueueResponse adds a scripted reply. Queued replies are returned in order
+// by subsequent ChatCompletion calls, taking precedence over the echo and
+// tool call directive behavior; once the queue is empty the mock echoes again.
+func (m *MockBackend) QueueResponse(content string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.responses = append(m.responses, content)
+}
+
+// SetResponses replaces the queue of scripted replies. Passing nil clears it.
+func (m *MockBackend) SetResponses(responses []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.responses = append([]string(nil), responses...)
+}
+
+// nextResponse pops the next scripted reply, if any
+func (m *MockBackend) nextResponse() (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.responses) == 0 {
+		return "", false
+	}
+
+	next := m.responses[0]
+	m.responses = m.responses[1:]
+	return next, true
+}
+
+// Name returns the name of this backend
+func (m *MockBackend) Name() string {
+	return m.name
+}
+
+// ChatCompletion implements OpenAI Chat Completions API standard
+func (m *MockBackend) ChatCompletion(ctx context.Context, req ai.ChatCompletionRequest) (*ai.ChatCompletionResponse, error) {
+	// Simulate processing time and any configured failures
+	if err := m.simulateCall(ctx); err != nil {
+		return nil, err
+	}
+
+	// Create a mock response based on the last message
+	var responseContent string
+	switch {
+	case !m.decorated():
+		responseContent = plainEcho(req.Messages)
+	case len(req.Messages) > 0:
+		lastMessage := req.Messages[len(req.Messages)-1]
+		responseContent = fmt.Sprintf("Mock AI (OpenAI format) received: '%s'%s. This is a simulated response using Chat Completions API!", lastMessage.Content, describeImages(lastMessage))
+	default:
+		responseContent = "Mock AI: Hello! I'm responding via the OpenAI Chat Completions format."
+	}
+
+	message := ai.Message{
+		Role:    "assistant",
+		Content: responseContent,
+	}
+	finishReason := "stop"
+
+	// Scripted replies win; otherwise simulate a tool call when asked to
+	if scripted, ok := m.nextResponse(); ok {
+		message.Content = scripted
+		responseContent = scripted
+	} else if len(req.Messages) > 0 {
+		if call, ok := parseToolCallDirective(req.Messages[len(req.Messages)-1]); ok {
+			message.Content = ""
+			message.ToolCalls = []ai.ToolCall{call}
+			finishReason = "tool_calls"
+			responseContent = call.Function.Name + call.Function.Arguments
+		} else if req.Seed != nil {
+			message.Content = seededResponse(*req.Seed, req.Messages)
+			responseContent = message.Content
+		}
+	}
+	if len(message.ToolCalls) == 0 {
+		message.Content = truncateAtStop(message.Content, req.Stop)
+		responseContent = message.Content
+	}
+
+	return newResponse(req, message, finishReason, responseContent), nil
+}
+
+// describeImages notes how many images a multimodal message carries, so
+// tests can see that image parts reached the backend
+func describeImages(msg ai.Message) string {
+	images := 0
+	for _, part := range msg.ContentParts {
+		if part.Type == ai.ContentPartImageURL {
+			images++
+		}
+	}
+	if images == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" with %d image(s)", images)
+}
+
+// mockFingerprint is the system fingerprint reported by every mock response
+const mockFingerprint = "fp_mock"
+
+// mockModel is the model the mock reports when a request names none, as a
+// real backend reports its configured model
+const mockModel = "mock-model-v1"
+
+// seededResponses are the canned replies a seeded request picks from
+var seededResponses = []string{
+	"Mock AI: The answer depends on the details, so start with the simplest case.",
+	"Mock AI: Break the problem into smaller steps and tackle them one at a time.",
+	"Mock AI: Here is a short summary of what you asked for.",
+	"Mock AI: That is a good question with more than one reasonable answer.",
+	"Mock AI: Let's look at this from a different angle.",
+}
+
+// seededResponse picks one of seededResponses from the seed and the last
+// message, so the same seed and prompt always get the same reply
+func seededResponse(seed int, messages []ai.Message) string {
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "%d:%s", seed, messages[len(messages)-1].Content)
+	return seededResponses[hash.Sum64()%uint64(len(seededResponses))]
+}
+
+// truncateAtStop cuts text at the earliest of the stop sequences, as a
+// provider stops generating once one appears
+func truncateAtStop(text string, stop []string) string {
+	end := len(text)
+	for _, sequence := range stop {
+		if sequence == "" {
+			continue
+		}
+		if i := strings.Index(text, sequence); i >= 0 && i < end {
+			end = i
+		}
+	}
+	return text[:end]
+}
+
+// plainEcho returns the undecorated echo of the last message
+func plainEcho(messages []ai.Message) string {
+	if len(messages) == 0 || messages[len(messages)-1].Content == "" {
+		return "Hello! I'm a mock backend."
+	}
+	return messages[len(messages)-1].Content
+}
+
+// newResponse wraps a reply in a completion response, estimating usage from
+// the request and the reply text
+func newResponse(req ai.ChatCompletionRequest, message ai.Message, finishReason, responseContent string) *ai.ChatCompletionResponse {
+	// Calculate token usage
+	promptTokens := 0
+	for _, msg := range req.Messages {
+		promptTokens += len(msg.Content) / 4 // Rough estimate
+	}
+	completionTokens := len(responseContent) / 4
+	totalTokens := promptTokens + completionTokens
+
+	id := fmt.Sprintf("chatcmpl-mock-%d", time.Now().Unix())
+	model := req.Model
+	if model == "" {
+		model = mockModel
+	}
+
+	return &ai.ChatCompletionResponse{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Choices: []ai.Choice{
+			{
+				Index:        0,
+				Message:      message,
+				FinishReason: finishReason,
+			},
+		},
+		Usage: ai.Usage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			TotalTokens:      totalTokens,
+		},
+		ProviderMetadata:  map[string]string{"request_id": id, "system_fingerprint": mockFingerprint},
+		SystemFingerprint: mockFingerprint,
+	}
+}
+
+// streamWordDelay is the pause between words when streaming
+const streamWordDelay = 5 * time.Millisecond
+
+// ChatCompletionStream simulates a streamed response by emitting the same
+// text ChatCompletion would return, one word at a time
+func (m *MockBackend) ChatCompletionStream(ctx context.Context, req ai.ChatCompletionRequest) (<-chan ai.StreamChunk, error) {
+	response, err := m.ChatCompletion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return streamResponse(ctx, response), nil
+}
+
+// streamResponse emits a completed response one word at a time
+func streamResponse(ctx context.Context, response *ai.ChatCompletionResponse) <-chan ai.StreamChunk {
+	chunks := make(chan ai.StreamChunk)
+	go func() {
+		defer close(chunks)
+
+		choice := response.Choices[0]
+		for _, word := range strings.SplitAfter(choice.Message.Content, " ") {
+			if word == "" {
+				continue
+			}
+
+			select {
+			case <-time.After(streamWordDelay):
+			case <-ctx.Done():
+				chunks <- ai.StreamChunk{Err: ctx.Err()}
+				return
+			}
+
+			select {
+			case chunks <- ai.StreamChunk{Delta: word}:
+			case <-ctx.Done():
+				chunks <- ai.StreamChunk{Err: ctx.Err()}
+				return
+			}
+		}
+
+		usage := response.Usage
+		chunks <- ai.StreamChunk{
+			ToolCalls:         choice.Message.ToolCalls,
+			FinishReason:      choice.FinishReason,
+			Usage:             &usage,
+			ProviderMetadata:  response.ProviderMetadata,
+			ID:                response.ID,
+			Model:             response.Model,
+			SystemFingerprint: response.SystemFingerprint,
+		}
+	}()
+
+	return chunks
+}
+
+// SendMessage simulates sending a message to an AI and returns a mock response (legacy method)
+func (m *MockBackend) SendMessage(ctx context.Context, req ai.Request) (*ai.Response, error) {
+	// Simulate processing time and any configured failures
+	if err := m.simulateCall(ctx); err != nil {
+		return nil, err
+	}
+
+	// Create a simple mock response based on the last message
+	var responseContent string
+	switch {
+	case !m.decorated():
+		responseContent = plainEcho(req.Messages)
+	case len(req.Messages) > 0:
+		lastMessage := req.Messages[len(req.Messages)-1]
+		responseContent = fmt.Sprintf("Mock AI (legacy format) received: '%s'. This is a simulated response!", lastMessage.Content)
+	default:
+		responseContent = "Mock AI: Hello! I'm a mock backend for testing."
+	}
+	if req.Seed != nil && len(req.Messages) > 0 {
+		responseContent = seededResponse(*req.Seed, req.Messages)
+	}
+	responseContent = truncateAtStop(responseContent, req.Stop)
+
+	return &ai.Response{
+		Content:    responseContent,
+		TokensUsed: len(responseContent) / 4, // Rough token estimate
+		Model:      mockModel,
+		Timestamp:  time.Now(),
+		Error:      nil,
+	}, nil
+}
+
+// IsAvailable always returns true for the mock backend
+func (m *MockBackend) IsAvailable(ctx context.Context) bool {
+	return true
+}
+
+// Configure sets configuration for the mock backend
+func (m *MockBackend) Configure(config map[string]interface{}) error {
+	for key, value := range config {
+		m.config[key] = value
+	}
+
+	// Check if name is being configured
+	if name, ok := config["name"].(string); ok {
+		m.name = name
+	}
+	if decorate, ok := config["decorate"].(bool); ok {
+		m.SetDecorate(decorate)
+	}
+
+	return nil
+}
@@ -0,0 +1,206 @@
+package mock
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+func complete(t *testing.T, m *MockBackend, content string) string {
+	t.Helper()
+
+	resp, err := m.ChatCompletion(context.Background(), ai.ChatCompletionRequest{
+		Model:    "mock-model-v1",
+		Messages: []ai.Message{{Role: "user", Content: content}},
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletion failed: %v", err)
+	}
+	return resp.Choices[0].Message.Content
+}
+
+func TestMockBackend_ScriptedResponses(t *testing.T) {
+	m := NewMockBackend()
+	m.SetResponses([]string{"first", "second"})
+	m.QueueResponse("third")
+
+	for _, want := range []string{"first", "second", "third"} {
+		if got := complete(t, m, "call:get_weather {}"); got != want {
+			t.Errorf("Expected scripted reply %q, got %q", want, got)
+		}
+	}
+
+	if got := complete(t, m, "hello"); !strings.Contains(got, "received: 'hello'") {
+		t.Errorf("Expected echo once the queue is empty, got %q", got)
+	}
+
+	m.QueueResponse("discarded")
+	m.SetResponses(nil)
+	if got := complete(t, m, "hello"); got == "discarded" {
+		t.Error("Expected SetResponses(nil) to clear the queue")
+	}
+}
+
+func TestMockBackend_Latency(t *testing.T) {
+	m := NewMockBackend()
+	m.SetLatency(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := m.ChatCompletion(ctx, ai.ChatCompletionRequest{Model: "mock-model-v1"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected cancellation to cut latency short, took %v", elapsed)
+	}
+}
+
+func TestMockBackend_InjectError(t *testing.T) {
+	m := NewMockBackend()
+	m.SetLatency(0)
+	injected := errors.New("boom")
+	m.InjectError(injected)
+
+	if _, err := m.SendMessage(context.Background(), ai.Request{}); !errors.Is(err, injected) {
+		t.Errorf("Expected injected error, got %v", err)
+	}
+	if _, err := m.SendMessage(context.Background(), ai.Request{}); err != nil {
+		t.Errorf("Expected injected error to apply only once, got %v", err)
+	}
+}
+
+func TestMockBackend_FailureRate(t *testing.T) {
+	run := func(seed int64) []bool {
+		m := NewMockBackend()
+		m.SetLatency(0)
+		m.SetFailureRate(0.5)
+		m.SetSeed(seed)
+
+		failed := make([]bool, 40)
+		for i := range failed {
+			_, err := m.ChatCompletion(context.Background(), ai.ChatCompletionRequest{Model: "mock-model-v1"})
+			if err != nil {
+				if !ai.IsRetryable(err) {
+					t.Errorf("Expected simulated failure to be retryable, got %v", err)
+				}
+				failed[i] = true
+			}
+		}
+		return failed
+	}
+
+	first, second := run(42), run(42)
+	if !reflect.DeepEqual(first, second) {
+		t.Error("Expected the same seed to fail the same calls")
+	}
+
+	failures := 0
+	for _, f := range first {
+		if f {
+			failures++
+		}
+	}
+	if failures == 0 || failures == len(first) {
+		t.Errorf("Expected some but not all calls to fail, got %d of %d", failures, len(first))
+	}
+}
+
+func TestMockBackend_SetDecorate(t *testing.T) {
+	m := NewMockBackend()
+	m.SetLatency(0)
+
+	if got := complete(t, m, "hello"); !strings.Contains(got, "OpenAI format") {
+		t.Errorf("Expected format markers by default, got %q", got)
+	}
+
+	m.SetDecorate(false)
+	if got := complete(t, m, "hello"); got != "hello" {
+		t.Errorf("Expected a plain echo, got %q", got)
+	}
+
+	legacy, err := m.SendMessage(context.Background(), ai.Request{Messages: []ai.Message{{Role: "user", Content: "hi"}}})
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	if legacy.Content != "hi" {
+		t.Errorf("Expected a plain legacy echo, got %q", legacy.Content)
+	}
+
+	if err := m.Configure(map[string]interface{}{"decorate": true}); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	if got := complete(t, m, "hello"); !strings.Contains(got, "OpenAI format") {
+		t.Errorf("Expected Configure to turn the markers back on, got %q", got)
+	}
+}
+
+func TestMockBackend_Stop(t *testing.T) {
+	m := NewMockBackend()
+	m.SetLatency(0)
+	m.SetResponses([]string{"first\n\nsecond END third", "no delimiter here"})
+
+	for _, want := range []string{"first", "no delimiter here"} {
+		resp, err := m.ChatCompletion(context.Background(), ai.ChatCompletionRequest{
+			Model:    "mock-model-v1",
+			Messages: []ai.Message{{Role: "user", Content: "hi"}},
+			Stop:     []string{"END", "\n\n"},
+		})
+		if err != nil {
+			t.Fatalf("ChatCompletion failed: %v", err)
+		}
+		if got := resp.Choices[0].Message.Content; got != want {
+			t.Errorf("Expected %q, got %q", want, got)
+		}
+	}
+}
+
+func TestMockBackend_Seed(t *testing.T) {
+	request := func(seed *int, content string) ai.ChatCompletionRequest {
+		return ai.ChatCompletionRequest{
+			Model:    "mock-model-v1",
+			Messages: []ai.Message{{Role: "user", Content: content}},
+			Seed:     seed,
+		}
+	}
+	reply := func(req ai.ChatCompletionRequest) *ai.ChatCompletionResponse {
+		t.Helper()
+		m := NewMockBackend()
+		m.SetLatency(0)
+		resp, err := m.ChatCompletion(context.Background(), req)
+		if err != nil {
+			t.Fatalf("ChatCompletion failed: %v", err)
+		}
+		return resp
+	}
+
+	seed := 42
+	first := reply(request(&seed, "hello"))
+	second := reply(request(&seed, "hello"))
+	if first.Choices[0].Message.Content != second.Choices[0].Message.Content {
+		t.Errorf("Expected the same reply for the same seed, got %q and %q",
+			first.Choices[0].Message.Content, second.Choices[0].Message.Content)
+	}
+	if first.SystemFingerprint != mockFingerprint {
+		t.Errorf("Expected system fingerprint %q, got %q", mockFingerprint, first.SystemFingerprint)
+	}
+
+	replies := make(map[string]bool)
+	for seed := range 20 {
+		replies[reply(request(&seed, "hello")).Choices[0].Message.Content] = true
+	}
+	if len(replies) < 2 {
+		t.Errorf("Expected different seeds to pick different replies, got %v", replies)
+	}
+
+	if got := reply(request(nil, "hello")).Choices[0].Message.Content; !strings.Contains(got, "received: 'hello'") {
+		t.Errorf("Expected the usual echo without a seed, got %q", got)
+	}
+}
@@ -0,0 +1,97 @@
+package mock
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// rule maps a substring of the user's message to a canned reply
+type rule struct {
+	substring string
+	response  string
+}
+
+// RuleBackend wraps a MockBackend with keyword rules, so demos and tests can
+// get specific replies to specific inputs. Latency, injected errors, and
+// failure rates of the wrapped mock still apply; messages that match no rule
+// get the wrapped mock's usual reply.
+type RuleBackend struct {
+	*MockBackend
+
+	rulesMu sync.Mutex
+	rules   []rule
+}
+
+// NewRuleBackend wraps inner with keyword rules. A nil inner uses a new
+// MockBackend.
+func NewRuleBackend(inner *MockBackend) *RuleBackend {
+	if inner == nil {
+		inner = NewMockBackend()
+	}
+	return &RuleBackend{MockBackend: inner}
+}
+
+// AddRule replies with response whenever the latest user message contains
+// substring. Rules are checked in the order they were added and the first
+// match wins.
+func (r *RuleBackend) AddRule(substring, response string) {
+	r.rulesMu.Lock()
+	defer r.rulesMu.Unlock()
+
+	r.rules = append(r.rules, rule{substring: substring, response: response})
+}
+
+// match returns the reply of the first rule matching the latest user message
+func (r *RuleBackend) match(messages []ai.Message) (string, bool) {
+	var latest string
+	found := false
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			latest = messages[i].Content
+			found = true
+			break
+		}
+	}
+	if !found {
+		return "", false
+	}
+
+	r.rulesMu.Lock()
+	defer r.rulesMu.Unlock()
+
+	for _, rule := range r.rules {
+		if strings.Contains(latest, rule.substring) {
+			return rule.response, true
+		}
+	}
+	return "", false
+}
+
+// ChatCompletion replies from the first matching rule, falling back to the
+// wrapped mock
+func (r *RuleBackend) ChatCompletion(ctx context.Context, req ai.ChatCompletionRequest) (*ai.ChatCompletionResponse, error) {
+	response, ok := r.match(req.Messages)
+	if !ok {
+		return r.MockBackend.ChatCompletion(ctx, req)
+	}
+
+	if err := r.simulateCall(ctx); err != nil {
+		return nil, err
+	}
+
+	message := ai.Message{Role: "assistant", Content: response}
+	return newResponse(req, message, "stop", response), nil
+}
+
+// ChatCompletionStream streams the reply ChatCompletion would return
+func (r *RuleBackend) ChatCompletionStream(ctx context.Context, req ai.ChatCompletionRequest) (<-chan ai.StreamChunk, error) {
+	response, err := r.ChatCompletion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return streamResponse(ctx, response), nil
+}
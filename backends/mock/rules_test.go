@@ -0,0 +1,122 @@
+package mock
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+func newTestRuleBackend() *RuleBackend {
+	inner := NewMockBackend()
+	inner.SetLatency(0)
+	return NewRuleBackend(inner)
+}
+
+func ask(t *testing.T, r *RuleBackend, messages ...ai.Message) string {
+	t.Helper()
+
+	resp, err := r.ChatCompletion(context.Background(), ai.ChatCompletionRequest{
+		Model:    "mock-model-v1",
+		Messages: messages,
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletion failed: %v", err)
+	}
+	return resp.Choices[0].Message.Content
+}
+
+func TestRuleBackend_OverlappingRules(t *testing.T) {
+	r := newTestRuleBackend()
+	r.AddRule("meaning of life", "42")
+	r.AddRule("life", "it goes on")
+	r.AddRule("meaning", "look it up")
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"What is the meaning of life?", "42"},
+		{"Such is life", "it goes on"},
+		{"The meaning of words", "look it up"},
+	}
+
+	for _, test := range tests {
+		if got := ask(t, r, ai.Message{Role: "user", Content: test.input}); got != test.want {
+			t.Errorf("Expected %q for %q, got %q", test.want, test.input, got)
+		}
+	}
+
+	if got := ask(t, r, ai.Message{Role: "user", Content: "hello"}); !strings.Contains(got, "received: 'hello'") {
+		t.Errorf("Expected echo when no rule matches, got %q", got)
+	}
+}
+
+func TestRuleBackend_MatchesLatestUserMessage(t *testing.T) {
+	r := newTestRuleBackend()
+	r.AddRule("weather", "sunny")
+
+	got := ask(t, r,
+		ai.Message{Role: "user", Content: "hello"},
+		ai.Message{Role: "assistant", Content: "what about the weather?"},
+		ai.Message{Role: "user", Content: "nothing"},
+	)
+	if got == "sunny" {
+		t.Errorf("Expected only the latest user message to be matched, got %q", got)
+	}
+
+	got = ask(t, r,
+		ai.Message{Role: "user", Content: "how is the weather"},
+		ai.Message{Role: "tool", Content: "result", ToolCallID: "call_1"},
+	)
+	if got != "sunny" {
+		t.Errorf("Expected the latest user message to match, got %q", got)
+	}
+}
+
+func TestRuleBackend_RespectsMockBehavior(t *testing.T) {
+	r := newTestRuleBackend()
+	r.AddRule("ping", "pong")
+
+	injected := &ai.APIError{StatusCode: 400, Message: "bad"}
+	r.InjectError(injected)
+	_, err := r.ChatCompletion(context.Background(), ai.ChatCompletionRequest{
+		Messages: []ai.Message{{Role: "user", Content: "ping"}},
+	})
+	if !errors.Is(err, injected) {
+		t.Errorf("Expected injected error, got %v", err)
+	}
+
+	r.SetLatency(time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = r.ChatCompletion(ctx, ai.ChatCompletionRequest{
+		Messages: []ai.Message{{Role: "user", Content: "ping"}},
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context deadline to be respected, got %v", err)
+	}
+}
+
+func TestRuleBackend_Stream(t *testing.T) {
+	r := newTestRuleBackend()
+	r.AddRule("ping", "pong pong")
+
+	chunks, err := r.ChatCompletionStream(context.Background(), ai.ChatCompletionRequest{
+		Messages: []ai.Message{{Role: "user", Content: "ping"}},
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletionStream failed: %v", err)
+	}
+
+	var content strings.Builder
+	for chunk := range chunks {
+		content.WriteString(chunk.Delta)
+	}
+	if content.String() != "pong pong" {
+		t.Errorf("Expected streamed rule reply, got %q", content.String())
+	}
+}
@@ -0,0 +1,85 @@
+package openai
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// AzureConfig holds configuration for an Azure OpenAI deployment. Azure
+// routes requests by deployment rather than by model, versions its API with
+// a query parameter, and authenticates with an api-key header.
+type AzureConfig struct {
+	APIKey string `json:"api_key"`
+
+	// ResourceName is the Azure OpenAI resource, used to build the default
+	// endpoint https://{resource}.openai.azure.com
+	ResourceName string `json:"resource_name"`
+
+	// Endpoint overrides the endpoint derived from ResourceName, e.g. for a
+	// custom domain or a proxy
+	Endpoint string `json:"endpoint"`
+
+	Deployment string        `json:"deployment"`
+	APIVersion string        `json:"api_version"`
+	Model      string        `json:"model"`
+	Timeout    time.Duration `json:"timeout"`
+	MaxRetries int           `json:"max_retries"`
+}
+
+// azureTarget routes a Client's requests to an Azure OpenAI deployment
+type azureTarget struct {
+	deployment string
+	apiVersion string
+}
+
+// NewAzureClient creates a client for an Azure OpenAI deployment. It shares
+// the OpenAI request and response handling and only changes how requests
+// are addressed and authenticated.
+func NewAzureClient(config AzureConfig) *Client {
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.openai.azure.com", config.ResourceName)
+	}
+
+	client := NewClient(Config{
+		APIKey:     config.APIKey,
+		BaseURL:    strings.TrimRight(endpoint, "/"),
+		Model:      config.Model,
+		Timeout:    config.Timeout,
+		MaxRetries: config.MaxRetries,
+	})
+	client.azure = &azureTarget{
+		deployment: config.Deployment,
+		apiVersion: config.APIVersion,
+	}
+	return client
+}
+
+// chatURL returns the chat completions endpoint
+func (c *Client) chatURL() string {
+	if c.azure == nil {
+		return fmt.Sprintf("%s/chat/completions", c.baseURL)
+	}
+	return fmt.Sprintf("%s/openai/deployments/%s/chat/completions?api-version=%s",
+		c.baseURL, url.PathEscape(c.azure.deployment), url.QueryEscape(c.azure.apiVersion))
+}
+
+// modelsURL returns the model listing endpoint
+func (c *Client) modelsURL() string {
+	if c.azure == nil {
+		return fmt.Sprintf("%s/models", c.baseURL)
+	}
+	return fmt.Sprintf("%s/openai/models?api-version=%s", c.baseURL, url.QueryEscape(c.azure.apiVersion))
+}
+
+// setAuth adds the credentials header expected by the target API
+func (c *Client) setAuth(req *http.Request) {
+	if c.azure == nil {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
+		return
+	}
+	req.Header.Set("api-key", c.apiKey)
+}
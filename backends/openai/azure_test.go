@@ -0,0 +1,74 @@
+package openai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+func TestAzureClient_Requests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("api-key") != "azure-key" || r.Header.Get("Authorization") != "" {
+			t.Errorf("Expected api-key authentication, got %v", r.Header)
+		}
+		if got := r.URL.Query().Get("api-version"); got != "2024-06-01" {
+			t.Errorf("Expected api-version 2024-06-01, got %q", got)
+		}
+
+		switch r.URL.Path {
+		case "/openai/deployments/my-gpt4o/chat/completions":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{
+				"id": "chatcmpl-1",
+				"object": "chat.completion",
+				"model": "gpt-4o",
+				"choices": [{"index": 0, "message": {"role": "assistant", "content": "hi"}, "finish_reason": "stop"}],
+				"usage": {"prompt_tokens": 3, "completion_tokens": 1, "total_tokens": 4}
+			}`))
+		case "/openai/models":
+			w.Write([]byte(`{"data": []}`))
+		default:
+			t.Errorf("Unexpected request path %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewAzureClient(AzureConfig{
+		APIKey:     "azure-key",
+		Endpoint:   server.URL + "/",
+		Deployment: "my-gpt4o",
+		APIVersion: "2024-06-01",
+		Model:      "gpt-4o",
+	})
+	if client.Name() != "Azure OpenAI" {
+		t.Errorf("Expected name Azure OpenAI, got %s", client.Name())
+	}
+
+	response, err := client.ChatCompletion(context.Background(), ai.ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []ai.Message{{Role: "user", Content: "hello"}},
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletion failed: %v", err)
+	}
+	if response.Choices[0].Message.Content != "hi" {
+		t.Errorf("Expected reply hi, got %q", response.Choices[0].Message.Content)
+	}
+
+	if !client.IsAvailable(context.Background()) {
+		t.Error("Expected the deployment to be available")
+	}
+}
+
+func TestNewAzureClient_ResourceEndpoint(t *testing.T) {
+	client := NewAzureClient(AzureConfig{ResourceName: "contoso", Deployment: "chat", APIVersion: "2024-06-01"})
+
+	want := "https://contoso.openai.azure.com/openai/deployments/chat/chat/completions?api-version=2024-06-01"
+	if got := client.chatURL(); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,333 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// Client implements the Backend interface for OpenAI's API
+type Client struct {
+	apiKey     string
+	baseURL    string
+	httpClient *http.Client
+	model      string
+
+	// azure is set for clients created by NewAzureClient
+	azure *azureTarget
+}
+
+// Config holds configuration for the OpenAI client
+type Config struct {
+	APIKey     string        `json:"api_key"`
+	BaseURL    string        `json:"base_url"`
+	Model      string        `json:"model"`
+	Timeout    time.Duration `json:"timeout"`
+	MaxRetries int           `json:"max_retries"`
+}
+
+// NewClient creates a new OpenAI client instance
+func NewClient(config Config) *Client {
+	if config.BaseURL == "" {
+		config.BaseURL = "https://api.openai.com/v1"
+	}
+	if config.Model == "" {
+		config.Model = "gpt-4"
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+
+	return &Client{
+		apiKey:  config.APIKey,
+		baseURL: config.BaseURL,
+		model:   config.Model,
+		httpClient: &http.Client{
+			Timeout: config.Timeout,
+		},
+	}
+}
+
+// Name returns the name of this backend
+func (c *Client) Name() string {
+	if c.azure != nil {
+		return "Azure OpenAI"
+	}
+	return "OpenAI"
+}
+
+// ChatCompletion sends a chat completion request to OpenAI's API
+func (c *Client) ChatCompletion(ctx context.Context, req ai.ChatCompletionRequest) (*ai.ChatCompletionResponse, error) {
+	// Validate required fields
+	if req.Model == "" {
+		return nil, fmt.Errorf("model is required")
+	}
+	if len(req.Messages) == 0 {
+		return nil, fmt.Errorf("messages are required")
+	}
+
+	// Convert our request to OpenAI's format (they're the same, but we want to be explicit)
+	openAIRequest := struct {
+		Model            string       `json:"model"`
+		Messages         []ai.Message `json:"messages"`
+		MaxTokens        *int         `json:"max_tokens,omitempty"`
+		Temperature      *float64     `json:"temperature,omitempty"`
+		TopP             *float64     `json:"top_p,omitempty"`
+		Stop             []string     `json:"stop,omitempty"`
+		Stream           bool         `json:"stream,omitempty"`
+		PresencePenalty  *float64     `json:"presence_penalty,omitempty"`
+		FrequencyPenalty *float64     `json:"frequency_penalty,omitempty"`
+		Seed             *int         `json:"seed,omitempty"`
+		Tools            []ai.Tool    `json:"tools,omitempty"`
+	}{
+		Model:            req.Model,
+		Messages:         req.Messages,
+		MaxTokens:        req.MaxTokens,
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		Stop:             req.Stop,
+		Stream:           req.Stream,
+		Tools:            req.Tools,
+		PresencePenalty:  req.PresencePenalty,
+		FrequencyPenalty: req.FrequencyPenalty,
+		Seed:             req.Seed,
+	}
+
+	// Marshal request to JSON
+	requestBody, err := json.Marshal(openAIRequest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	// Create HTTP request
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.chatURL(), bytes.NewBuffer(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Set headers
+	httpReq.Header.Set("Content-Type", "application/json")
+	c.setAuth(httpReq)
+
+	// Send request
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", ai.TransportError(err))
+	}
+	defer resp.Body.Close()
+
+	// Read response body
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	// Check for HTTP errors
+	if resp.StatusCode != http.StatusOK {
+		var errorResponse struct {
+			Error struct {
+				Message string `json:"message"`
+				Type    string `json:"type"`
+				Code    string `json:"code"`
+			} `json:"error"`
+		}
+
+		if err := json.Unmarshal(responseBody, &errorResponse); err == nil {
+			return nil, &ai.APIError{Provider: c.Name(), StatusCode: resp.StatusCode, Message: errorResponse.Error.Message}
+		}
+
+		return nil, &ai.APIError{Provider: c.Name(), StatusCode: resp.StatusCode, Message: string(responseBody)}
+	}
+
+	// Parse response
+	var openAIResponse ai.ChatCompletionResponse
+	if err := json.Unmarshal(responseBody, &openAIResponse); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	openAIResponse.ProviderMetadata = providerMetadata(resp.Header, responseBody)
+
+	return &openAIResponse, nil
+}
+
+// metadataHeaders maps the response headers worth keeping to metadata keys
+var metadataHeaders = map[string]string{
+	"X-Request-Id":                   "request_id",
+	"Openai-Version":                 "openai_version",
+	"Openai-Processing-Ms":           "processing_ms",
+	"X-Ratelimit-Remaining-Requests": "ratelimit_remaining_requests",
+	"X-Ratelimit-Remaining-Tokens":   "ratelimit_remaining_tokens",
+}
+
+// providerMetadata collects the request ID, rate-limit headers, the model
+// version, and the system fingerprint, which is also decoded into
+// ai.ChatCompletionResponse
+func providerMetadata(header http.Header, body []byte) map[string]string {
+	metadata := make(map[string]string)
+	for name, key := range metadataHeaders {
+		if value := header.Get(name); value != "" {
+			metadata[key] = value
+		}
+	}
+
+	var extra struct {
+		SystemFingerprint string `json:"system_fingerprint"`
+		Model             string `json:"model"`
+	}
+	if err := json.Unmarshal(body, &extra); err == nil {
+		if extra.SystemFingerprint != "" {
+			metadata["system_fingerprint"] = extra.SystemFingerprint
+		}
+		if extra.Model != "" {
+			metadata["model_version"] = extra.Model
+		}
+	}
+
+	if len(metadata) == 0 {
+		return nil
+	}
+	return metadata
+}
+
+// SendMessage implements the legacy interface by converting to ChatCompletion
+func (c *Client) SendMessage(ctx context.Context, req ai.Request) (*ai.Response, error) {
+	// Convert legacy request to ChatCompletion format
+	chatReq := ai.ChatCompletionRequest{
+		Model:            req.Model,
+		Messages:         req.Messages,
+		MaxTokens:        req.MaxTokens,
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		Stop:             req.Stop,
+		Stream:           req.Stream,
+		Tools:            req.Tools,
+		PresencePenalty:  req.PresencePenalty,
+		FrequencyPenalty: req.FrequencyPenalty,
+		Seed:             req.Seed,
+	}
+
+	// Use default model if none specified
+	if chatReq.Model == "" {
+		chatReq.Model = c.model
+	}
+
+	// Call ChatCompletion
+	chatResp, err := c.ChatCompletion(ctx, chatReq)
+	if err != nil {
+		return &ai.Response{
+			Error: err,
+		}, err
+	}
+
+	// Convert to legacy response format
+	if len(chatResp.Choices) == 0 {
+		return &ai.Response{
+			Error: fmt.Errorf("no response choices returned"),
+		}, fmt.Errorf("no response choices returned")
+	}
+
+	return &ai.Response{
+		Content:    chatResp.Choices[0].Message.Content,
+		TokensUsed: chatResp.Usage.TotalTokens,
+		Model:      chatResp.Model,
+		Timestamp:  time.Unix(chatResp.Created, 0),
+		Error:      nil,
+	}, nil
+}
+
+// IsAvailable checks if the OpenAI API is reachable
+func (c *Client) IsAvailable(ctx context.Context) bool {
+	status, err := c.HealthCheck(ctx)
+	return err == nil && status.Available
+}
+
+// HealthCheck probes the models endpoint, which is cheap and requires a
+// valid API key, and reports latency and any categorized failure
+func (c *Client) HealthCheck(ctx context.Context) (*ai.HealthStatus, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.modelsURL(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create health check request: %w", err)
+	}
+	c.setAuth(req)
+
+	return ai.ProbeHealth(c.httpClient, req), nil
+}
+
+// Configure updates the client configuration
+func (c *Client) Configure(config map[string]interface{}) error {
+	if apiKey, ok := config["api_key"].(string); ok && apiKey != "" {
+		c.apiKey = apiKey
+	}
+
+	if baseURL, ok := config["base_url"].(string); ok && baseURL != "" {
+		c.baseURL = baseURL
+	}
+
+	if model, ok := config["model"].(string); ok && model != "" {
+		c.model = model
+	}
+
+	if timeout, ok := config["timeout"].(time.Duration); ok && timeout > 0 {
+		c.httpClient.Timeout = timeout
+	}
+
+	// Validate that we have required configuration
+	if c.apiKey == "" {
+		return fmt.Errorf("api_key is required")
+	}
+
+	return nil
+}
+
+// GetModels retrieves available models from OpenAI
+func (c *Client) GetModels(ctx context.Context) ([]Model, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.modelsURL(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	c.setAuth(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", ai.TransportError(err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API error: %d", resp.StatusCode)
+	}
+
+	var response struct {
+		Data []Model `json:"data"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return response.Data, nil
+}
+
+// Model represents an OpenAI model
+type Model struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// GetDefaultModel returns the default model for this client
+func (c *Client) GetDefaultModel() string {
+	return c.model
+}
+
+// SetDefaultModel sets the default model for this client
+func (c *Client) SetDefaultModel(model string) {
+	c.model = model
+}
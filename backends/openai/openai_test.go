@@ -0,0 +1,107 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+func TestChatCompletion_ProviderMetadata(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Request-Id", "req_abc123")
+		w.Header().Set("X-Ratelimit-Remaining-Requests", "499")
+		w.Write([]byte(`{
+			"id": "chatcmpl-1",
+			"object": "chat.completion",
+			"model": "gpt-4-0613",
+			"system_fingerprint": "fp_44709d6fcb",
+			"choices": [{"index": 0, "message": {"role": "assistant", "content": "hi"}, "finish_reason": "stop"}],
+			"usage": {"prompt_tokens": 3, "completion_tokens": 1, "total_tokens": 4}
+		}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(Config{APIKey: "test", BaseURL: server.URL})
+	response, err := client.ChatCompletion(context.Background(), ai.ChatCompletionRequest{
+		Model:    "gpt-4",
+		Messages: []ai.Message{{Role: "user", Content: "hello"}},
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletion failed: %v", err)
+	}
+
+	if response.SystemFingerprint != "fp_44709d6fcb" {
+		t.Errorf("Expected system fingerprint fp_44709d6fcb, got %q", response.SystemFingerprint)
+	}
+	for key, want := range map[string]string{
+		"request_id":                   "req_abc123",
+		"system_fingerprint":           "fp_44709d6fcb",
+		"model_version":                "gpt-4-0613",
+		"ratelimit_remaining_requests": "499",
+	} {
+		if got := response.ProviderMetadata[key]; got != want {
+			t.Errorf("Expected metadata %s=%q, got %q", key, want, got)
+		}
+	}
+}
+
+func TestChatCompletion_RequestParameters(t *testing.T) {
+	seed := 7
+	var body struct {
+		Stop []string `json:"stop"`
+		Seed *int     `json:"seed"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"index": 0, "message": {"role": "assistant", "content": "hi"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(Config{APIKey: "test", BaseURL: server.URL})
+	_, err := client.ChatCompletion(context.Background(), ai.ChatCompletionRequest{
+		Model:    "gpt-4",
+		Messages: []ai.Message{{Role: "user", Content: "hello"}},
+		Stop:     []string{"\n\n", "END"},
+		Seed:     &seed,
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletion failed: %v", err)
+	}
+	if !reflect.DeepEqual(body.Stop, []string{"\n\n", "END"}) {
+		t.Errorf("Expected stop sequences to be sent, got %v", body.Stop)
+	}
+	if body.Seed == nil || *body.Seed != seed {
+		t.Errorf("Expected seed %d to be sent, got %v", seed, body.Seed)
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models" || r.Header.Get("Authorization") != "Bearer sk-bad" {
+			t.Errorf("Expected an authenticated probe of /models, got %s %v", r.URL.Path, r.Header)
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	client := NewClient(Config{APIKey: "sk-bad", BaseURL: server.URL})
+	status, err := client.HealthCheck(context.Background())
+	if err != nil {
+		t.Fatalf("HealthCheck failed: %v", err)
+	}
+	if status.Available || status.Failure != ai.HealthFailureAuth || status.Endpoint != server.URL+"/models" {
+		t.Errorf("Expected an auth failure at the models endpoint, got %+v", status)
+	}
+	if client.IsAvailable(context.Background()) {
+		t.Error("Expected IsAvailable to agree with HealthCheck")
+	}
+}
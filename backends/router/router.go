@@ -0,0 +1,329 @@
+// Package router provides a backend that spreads requests across several
+// backends according to a selection policy, turning the backend layer into a
+// simple load balancer for multi-provider setups.
+package router
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// Policy decides which candidate backend serves a request
+type Policy string
+
+const (
+	// Cheapest picks the candidate whose model has the lowest price
+	Cheapest Policy = "cheapest"
+	// Fastest picks the candidate with the lowest rolling average latency,
+	// counting failed requests as failurePenalty. Candidates that have not
+	// served a request yet are tried first.
+	Fastest Policy = "fastest"
+	// RoundRobin cycles through the candidates in order
+	RoundRobin Policy = "round-robin"
+	// Weighted picks randomly in proportion to each candidate's Weight
+	Weighted Policy = "weighted"
+)
+
+// latencyWindow is the number of recent requests used for rolling latency
+const latencyWindow = 20
+
+// failurePenalty is the latency a failed request counts as when Fastest
+// compares candidates, so a failing backend loses to any working one
+const failurePenalty = time.Minute
+
+// Candidate is a backend the router can select along with its selection inputs
+type Candidate struct {
+	Backend ai.Backend
+	// Model is the model the backend serves. It replaces the request's
+	// model when set, and Cheapest prices it from the router's pricing
+	// table.
+	Model string
+	// CostPer1K is the blended price per 1K tokens, used by Cheapest when
+	// Model has no pricing entry
+	CostPer1K float64
+	// Weight is the relative share of traffic, used by Weighted
+	Weight int
+}
+
+// CandidateStats describes the observed behavior of a candidate backend
+type CandidateStats struct {
+	Name           string        `json:"name"`
+	Requests       int           `json:"requests"`
+	Errors         int           `json:"errors"`
+	AverageLatency time.Duration `json:"average_latency"`
+}
+
+// candidate tracks the live state of a Candidate. latencies holds recent
+// successful requests, reported by Stats, and scores recent requests of
+// any outcome, compared by Fastest.
+type candidate struct {
+	Candidate
+	latencies []time.Duration
+	scores    []time.Duration
+	requests  int
+	errors    int
+}
+
+// costPer1K returns the candidate's blended price per 1K tokens
+func (c *candidate) costPer1K(pricing map[string]float64) float64 {
+	if price, ok := pricing[c.Model]; ok {
+		return price
+	}
+	return c.CostPer1K
+}
+
+// averageLatency returns the rolling average latency and whether any
+// samples exist
+func (c *candidate) averageLatency() (time.Duration, bool) {
+	return average(c.latencies)
+}
+
+// average returns the mean of samples and whether there are any
+func average(samples []time.Duration) (time.Duration, bool) {
+	if len(samples) == 0 {
+		return 0, false
+	}
+
+	var total time.Duration
+	for _, sample := range samples {
+		total += sample
+	}
+	return total / time.Duration(len(samples)), true
+}
+
+// Backend routes each request to one of its candidates based on a Policy
+type Backend struct {
+	mutex      sync.Mutex
+	policy     Policy
+	pricing    map[string]float64
+	candidates []*candidate
+	next       int
+	rand       *rand.Rand
+	now        func() time.Time
+}
+
+// NewRouterBackend creates a router over the given candidates. pricing maps
+// model names to blended USD prices per 1K tokens for Cheapest; candidates
+// whose model it does not list use their CostPer1K.
+func NewRouterBackend(policy Policy, pricing map[string]float64, candidates ...Candidate) (*Backend, error) {
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("at least one candidate backend is required")
+	}
+	if err := validatePolicy(policy); err != nil {
+		return nil, err
+	}
+
+	b := &Backend{
+		policy:  policy,
+		pricing: pricing,
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		now:     time.Now,
+	}
+	for _, c := range candidates {
+		if c.Backend == nil {
+			return nil, fmt.Errorf("candidate backend cannot be nil")
+		}
+		b.candidates = append(b.candidates, &candidate{Candidate: c})
+	}
+
+	return b, nil
+}
+
+// Policy returns the active selection policy
+func (b *Backend) Policy() Policy {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.policy
+}
+
+// SetPolicy changes the selection policy at runtime
+func (b *Backend) SetPolicy(policy Policy) error {
+	if err := validatePolicy(policy); err != nil {
+		return err
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.policy = policy
+	return nil
+}
+
+// Stats returns per-candidate request counts and rolling latency
+func (b *Backend) Stats() []CandidateStats {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	stats := make([]CandidateStats, 0, len(b.candidates))
+	for _, c := range b.candidates {
+		latency, _ := c.averageLatency()
+		stats = append(stats, CandidateStats{
+			Name:           c.Backend.Name(),
+			Requests:       c.requests,
+			Errors:         c.errors,
+			AverageLatency: latency,
+		})
+	}
+	return stats
+}
+
+// Name returns the router's name along with its candidates
+func (b *Backend) Name() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	names := make([]string, 0, len(b.candidates))
+	for _, c := range b.candidates {
+		names = append(names, c.Backend.Name())
+	}
+	return fmt.Sprintf("Router(%s: %s)", b.policy, strings.Join(names, ", "))
+}
+
+// ChatCompletion sends the request to the backend chosen by the policy,
+// asking for the candidate's model when it has one
+func (b *Backend) ChatCompletion(ctx context.Context, req ai.ChatCompletionRequest) (*ai.ChatCompletionResponse, error) {
+	c := b.selectCandidate()
+	if c.Model != "" {
+		req.Model = c.Model
+	}
+
+	start := b.now()
+	response, err := c.Backend.ChatCompletion(ctx, req)
+	b.observe(c, b.now().Sub(start), err)
+
+	return response, err
+}
+
+// SendMessage sends the legacy request to the backend chosen by the policy,
+// asking for the candidate's model when it has one
+func (b *Backend) SendMessage(ctx context.Context, req ai.Request) (*ai.Response, error) {
+	c := b.selectCandidate()
+	if c.Model != "" {
+		req.Model = c.Model
+	}
+
+	start := b.now()
+	response, err := c.Backend.SendMessage(ctx, req)
+	b.observe(c, b.now().Sub(start), err)
+
+	return response, err
+}
+
+// IsAvailable reports whether any candidate is available
+func (b *Backend) IsAvailable(ctx context.Context) bool {
+	b.mutex.Lock()
+	candidates := make([]*candidate, len(b.candidates))
+	copy(candidates, b.candidates)
+	b.mutex.Unlock()
+
+	for _, c := range candidates {
+		if c.Backend.IsAvailable(ctx) {
+			return true
+		}
+	}
+	return false
+}
+
+// Configure accepts a "policy" key to change the selection policy
+func (b *Backend) Configure(config map[string]interface{}) error {
+	if policy, ok := config["policy"].(string); ok {
+		return b.SetPolicy(Policy(policy))
+	}
+	return nil
+}
+
+// selectCandidate applies the policy to pick the next candidate
+func (b *Backend) selectCandidate() *candidate {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.policy {
+	case Cheapest:
+		best, bestCost := b.candidates[0], b.candidates[0].costPer1K(b.pricing)
+		for _, c := range b.candidates[1:] {
+			if cost := c.costPer1K(b.pricing); cost < bestCost {
+				best, bestCost = c, cost
+			}
+		}
+		return best
+
+	case Fastest:
+		var best *candidate
+		var bestLatency time.Duration
+		for _, c := range b.candidates {
+			latency, ok := average(c.scores)
+			if !ok {
+				// Untried backends go first so every candidate gets measured
+				return c
+			}
+			if best == nil || latency < bestLatency {
+				best, bestLatency = c, latency
+			}
+		}
+		return best
+
+	case Weighted:
+		total := 0
+		for _, c := range b.candidates {
+			total += max(c.Weight, 0)
+		}
+		if total == 0 {
+			return b.candidates[0]
+		}
+
+		pick := b.rand.Intn(total)
+		for _, c := range b.candidates {
+			pick -= max(c.Weight, 0)
+			if pick < 0 {
+				return c
+			}
+		}
+		return b.candidates[len(b.candidates)-1]
+
+	default: // RoundRobin
+		c := b.candidates[b.next%len(b.candidates)]
+		b.next++
+		return c
+	}
+}
+
+// observe records the outcome of a request against a candidate
+func (b *Backend) observe(c *candidate, latency time.Duration, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	c.requests++
+	if err != nil {
+		c.errors++
+		c.scores = appendSample(c.scores, max(latency, failurePenalty))
+		return
+	}
+
+	c.latencies = appendSample(c.latencies, latency)
+	c.scores = appendSample(c.scores, latency)
+}
+
+// appendSample adds a sample to a rolling window of latencyWindow samples
+func appendSample(samples []time.Duration, sample time.Duration) []time.Duration {
+	samples = append(samples, sample)
+	if len(samples) > latencyWindow {
+		samples = samples[1:]
+	}
+	return samples
+}
+
+// validatePolicy rejects unknown policies
+func validatePolicy(policy Policy) error {
+	switch policy {
+	case Cheapest, Fastest, RoundRobin, Weighted:
+		return nil
+	default:
+		return fmt.Errorf("unknown selection policy %q (available: %s, %s, %s, %s)",
+			policy, Cheapest, Fastest, RoundRobin, Weighted)
+	}
+}
@@ -0,0 +1,258 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// testPricing prices models the way a pricing table would, blended per 1K
+// tokens
+var testPricing = map[string]float64{
+	"gpt-4":                   0.045,
+	"gpt-4o":                  0.01,
+	"claude-3-haiku-20240307": 0.00075,
+}
+
+// fakeClock is advanced by fake backends to simulate latency without sleeping
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+// fakeBackend answers instantly but advances the fake clock by its latency
+type fakeBackend struct {
+	name    string
+	latency time.Duration
+	clock   *fakeClock
+	calls   int
+	model   string
+	err     error
+}
+
+func (f *fakeBackend) Name() string { return f.name }
+
+func (f *fakeBackend) ChatCompletion(ctx context.Context, req ai.ChatCompletionRequest) (*ai.ChatCompletionResponse, error) {
+	f.calls++
+	f.model = req.Model
+	f.clock.now = f.clock.now.Add(f.latency)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &ai.ChatCompletionResponse{Model: f.name}, nil
+}
+
+func (f *fakeBackend) SendMessage(ctx context.Context, req ai.Request) (*ai.Response, error) {
+	f.calls++
+	f.clock.now = f.clock.now.Add(f.latency)
+	return &ai.Response{Model: f.name}, f.err
+}
+
+func (f *fakeBackend) IsAvailable(ctx context.Context) bool { return f.err == nil }
+
+func (f *fakeBackend) Configure(config map[string]interface{}) error { return nil }
+
+func newFakes(clock *fakeClock) (slow, fast, cheap *fakeBackend) {
+	return &fakeBackend{name: "slow", latency: 300 * time.Millisecond, clock: clock},
+		&fakeBackend{name: "fast", latency: 50 * time.Millisecond, clock: clock},
+		&fakeBackend{name: "cheap", latency: 200 * time.Millisecond, clock: clock}
+}
+
+func newTestRouter(t *testing.T, policy Policy, clock *fakeClock, candidates ...Candidate) *Backend {
+	t.Helper()
+	b, err := NewRouterBackend(policy, testPricing, candidates...)
+	if err != nil {
+		t.Fatalf("NewRouterBackend failed: %v", err)
+	}
+	b.now = clock.Now
+	b.rand = rand.New(rand.NewSource(1))
+	return b
+}
+
+func send(t *testing.T, b *Backend, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if _, err := b.ChatCompletion(context.Background(), ai.ChatCompletionRequest{Model: "m"}); err != nil {
+			t.Fatalf("ChatCompletion failed: %v", err)
+		}
+	}
+}
+
+func TestRouter_Cheapest(t *testing.T) {
+	clock := &fakeClock{}
+	slow, fast, cheap := newFakes(clock)
+	b := newTestRouter(t, Cheapest, clock,
+		Candidate{Backend: slow, CostPer1K: 0.03},
+		Candidate{Backend: cheap, CostPer1K: 0.001},
+		Candidate{Backend: fast, CostPer1K: 0.01},
+	)
+
+	send(t, b, 5)
+	if cheap.calls != 5 || slow.calls != 0 || fast.calls != 0 {
+		t.Errorf("Expected all calls on cheapest backend, got slow=%d fast=%d cheap=%d",
+			slow.calls, fast.calls, cheap.calls)
+	}
+}
+
+func TestRouter_CheapestUsesModelPricing(t *testing.T) {
+	clock := &fakeClock{}
+	slow, fast, cheap := newFakes(clock)
+	b := newTestRouter(t, Cheapest, clock,
+		Candidate{Backend: slow, Model: "gpt-4", CostPer1K: 0.0001},
+		Candidate{Backend: cheap, Model: "claude-3-haiku-20240307", CostPer1K: 1},
+		Candidate{Backend: fast, Model: "gpt-4o"},
+	)
+
+	send(t, b, 3)
+	if cheap.calls != 3 {
+		t.Errorf("Expected the model priced lowest to win, got slow=%d fast=%d cheap=%d",
+			slow.calls, fast.calls, cheap.calls)
+	}
+}
+
+func TestRouter_Fastest(t *testing.T) {
+	clock := &fakeClock{}
+	slow, fast, cheap := newFakes(clock)
+	b := newTestRouter(t, Fastest, clock,
+		Candidate{Backend: slow},
+		Candidate{Backend: fast},
+		Candidate{Backend: cheap},
+	)
+
+	// The first three requests measure each backend once
+	send(t, b, 3)
+	if slow.calls != 1 || fast.calls != 1 || cheap.calls != 1 {
+		t.Fatalf("Expected each backend to be probed once, got slow=%d fast=%d cheap=%d",
+			slow.calls, fast.calls, cheap.calls)
+	}
+
+	send(t, b, 5)
+	if fast.calls != 6 {
+		t.Errorf("Expected remaining calls on fastest backend, got fast=%d", fast.calls)
+	}
+
+	// When the fast backend degrades, traffic moves to the next fastest
+	fast.latency = time.Second
+	send(t, b, 30)
+	if cheap.calls < 20 {
+		t.Errorf("Expected traffic to shift after latency increase, got cheap=%d fast=%d", cheap.calls, fast.calls)
+	}
+
+	for _, stats := range b.Stats() {
+		if stats.Name == "slow" && stats.AverageLatency != 300*time.Millisecond {
+			t.Errorf("Expected slow average latency 300ms, got %v", stats.AverageLatency)
+		}
+	}
+}
+
+func TestRouter_RoundRobin(t *testing.T) {
+	clock := &fakeClock{}
+	slow, fast, cheap := newFakes(clock)
+	b := newTestRouter(t, RoundRobin, clock,
+		Candidate{Backend: slow},
+		Candidate{Backend: fast},
+		Candidate{Backend: cheap},
+	)
+
+	send(t, b, 9)
+	if slow.calls != 3 || fast.calls != 3 || cheap.calls != 3 {
+		t.Errorf("Expected even distribution, got slow=%d fast=%d cheap=%d",
+			slow.calls, fast.calls, cheap.calls)
+	}
+}
+
+func TestRouter_Weighted(t *testing.T) {
+	clock := &fakeClock{}
+	slow, fast, cheap := newFakes(clock)
+	b := newTestRouter(t, Weighted, clock,
+		Candidate{Backend: slow, Weight: 0},
+		Candidate{Backend: fast, Weight: 3},
+		Candidate{Backend: cheap, Weight: 1},
+	)
+
+	send(t, b, 1000)
+	if slow.calls != 0 {
+		t.Errorf("Zero-weight backend should never be selected, got %d calls", slow.calls)
+	}
+	if fast.calls < 650 || fast.calls > 850 {
+		t.Errorf("Expected roughly 75%% of traffic on weight-3 backend, got %d/1000", fast.calls)
+	}
+}
+
+func TestRouter_PolicyManagement(t *testing.T) {
+	clock := &fakeClock{}
+	slow, _, _ := newFakes(clock)
+
+	if _, err := NewRouterBackend(RoundRobin, nil); err == nil {
+		t.Error("Expected error when no candidates are given")
+	}
+	if _, err := NewRouterBackend("random", nil, Candidate{Backend: slow}); err == nil {
+		t.Error("Expected error for unknown policy")
+	}
+
+	b := newTestRouter(t, RoundRobin, clock, Candidate{Backend: slow})
+	if err := b.Configure(map[string]interface{}{"policy": "fastest"}); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	if b.Policy() != Fastest {
+		t.Errorf("Expected policy fastest, got %s", b.Policy())
+	}
+	if err := b.SetPolicy("bogus"); err == nil {
+		t.Error("Expected error when setting unknown policy")
+	}
+}
+
+func TestRouter_ErrorsAreCounted(t *testing.T) {
+	clock := &fakeClock{}
+	slow, _, _ := newFakes(clock)
+	slow.err = errors.New("boom")
+	b := newTestRouter(t, RoundRobin, clock, Candidate{Backend: slow})
+
+	if _, err := b.ChatCompletion(context.Background(), ai.ChatCompletionRequest{}); err == nil {
+		t.Fatal("Expected backend error to propagate")
+	}
+
+	stats := b.Stats()[0]
+	if stats.Requests != 1 || stats.Errors != 1 || stats.AverageLatency != 0 {
+		t.Errorf("Failed requests should count as errors without latency samples, got %+v", stats)
+	}
+}
+
+func TestRouter_FastestAvoidsFailingBackend(t *testing.T) {
+	clock := &fakeClock{}
+	slow, fast, _ := newFakes(clock)
+	fast.err = errors.New("boom")
+	b := newTestRouter(t, Fastest, clock,
+		Candidate{Backend: fast},
+		Candidate{Backend: slow},
+	)
+
+	for i := 0; i < 5; i++ {
+		b.ChatCompletion(context.Background(), ai.ChatCompletionRequest{Model: "m"})
+	}
+	if fast.calls != 1 || slow.calls != 4 {
+		t.Errorf("Expected the failing backend to be tried once, got fast=%d slow=%d", fast.calls, slow.calls)
+	}
+}
+
+func TestRouter_CandidateModel(t *testing.T) {
+	clock := &fakeClock{}
+	slow, fast, _ := newFakes(clock)
+	b := newTestRouter(t, RoundRobin, clock,
+		Candidate{Backend: slow, Model: "claude-3-haiku-20240307"},
+		Candidate{Backend: fast},
+	)
+
+	send(t, b, 2)
+	if slow.model != "claude-3-haiku-20240307" {
+		t.Errorf("Expected the candidate's model to replace the request's, got %q", slow.model)
+	}
+	if fast.model != "m" {
+		t.Errorf("Expected a candidate without a model to get the request's, got %q", fast.model)
+	}
+}
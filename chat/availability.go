@@ -0,0 +1,77 @@
+package chat
+
+import (
+	"context"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// DefaultAvailabilityTTL is how long a health check is reused when
+// ControllerConfig.AvailabilityTTL is unset
+const DefaultAvailabilityTTL = 5 * time.Second
+
+// HealthCheckOption changes how a backend health check is made
+type HealthCheckOption string
+
+// ForceCheck probes the backend even if a recent result is cached
+const ForceCheck HealthCheckOption = "force"
+
+// healthEntry is a cached health check
+type healthEntry struct {
+	status  *ai.HealthStatus
+	checked time.Time
+}
+
+// IsBackendAvailable checks if the current backend is available. A result
+// from the last AvailabilityTTL is reused unless ForceCheck is passed.
+func (c *Controller) IsBackendAvailable(ctx context.Context, opts ...HealthCheckOption) bool {
+	status, err := c.CheckBackendHealth(ctx, opts...)
+	return err == nil && status.Available
+}
+
+// CheckBackendHealth describes the current backend's health, including
+// latency and a categorized failure reason when it is unavailable. A result
+// from the last AvailabilityTTL is reused unless ForceCheck is passed.
+func (c *Controller) CheckBackendHealth(ctx context.Context, opts ...HealthCheckOption) (*ai.HealthStatus, error) {
+	force := false
+	for _, opt := range opts {
+		if opt == ForceCheck {
+			force = true
+		}
+	}
+
+	c.healthMutex.Lock()
+	epoch := c.healthEpoch
+	if cached := c.health; !force && cached != nil && time.Since(cached.checked) < c.healthTTL {
+		status := *cached.status
+		c.healthMutex.Unlock()
+		return &status, nil
+	}
+	c.healthMutex.Unlock()
+
+	status, err := ai.CheckHealth(ctx, c.GetBackend())
+	if err != nil {
+		return nil, err
+	}
+
+	c.healthMutex.Lock()
+	defer c.healthMutex.Unlock()
+
+	// A check that raced with SetBackend describes the old backend
+	if c.healthTTL > 0 && epoch == c.healthEpoch {
+		cached := *status
+		c.health = &healthEntry{status: &cached, checked: time.Now()}
+	}
+	return status, nil
+}
+
+// invalidateHealth drops the cached health check, so the next check probes
+// the new backend
+func (c *Controller) invalidateHealth() {
+	c.healthMutex.Lock()
+	defer c.healthMutex.Unlock()
+
+	c.health = nil
+	c.healthEpoch++
+}
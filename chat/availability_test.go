@@ -0,0 +1,60 @@
+package chat
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/backends/mock"
+)
+
+// probeCounter counts availability checks on the mock backend
+type probeCounter struct {
+	*mock.MockBackend
+	probes atomic.Int32
+}
+
+func (p *probeCounter) IsAvailable(ctx context.Context) bool {
+	p.probes.Add(1)
+	return true
+}
+
+func TestController_AvailabilityCache(t *testing.T) {
+	backend := &probeCounter{MockBackend: mock.NewMockBackend()}
+	controller := NewController(backend, &ControllerConfig{AvailabilityTTL: time.Minute})
+	ctx := context.Background()
+
+	if !controller.IsBackendAvailable(ctx) {
+		t.Fatal("Expected the backend to be available")
+	}
+	controller.IsBackendAvailable(ctx)
+	controller.CheckBackendHealth(ctx)
+	if got := backend.probes.Load(); got != 1 {
+		t.Errorf("Expected checks within the TTL to reuse the first result, got %d probes", got)
+	}
+
+	controller.IsBackendAvailable(ctx, ForceCheck)
+	if got := backend.probes.Load(); got != 2 {
+		t.Errorf("Expected ForceCheck to probe the backend, got %d probes", got)
+	}
+
+	// Switching backends discards the cached result
+	next := &probeCounter{MockBackend: mock.NewMockBackend()}
+	controller.SetBackend(next)
+	controller.IsBackendAvailable(ctx)
+	if got := next.probes.Load(); got != 1 {
+		t.Errorf("Expected the new backend to be probed, got %d probes", got)
+	}
+}
+
+func TestController_AvailabilityCacheDisabled(t *testing.T) {
+	backend := &probeCounter{MockBackend: mock.NewMockBackend()}
+	controller := NewController(backend, &ControllerConfig{AvailabilityTTL: -1})
+
+	controller.IsBackendAvailable(context.Background())
+	controller.IsBackendAvailable(context.Background())
+	if got := backend.probes.Load(); got != 2 {
+		t.Errorf("Expected every check to probe with caching disabled, got %d probes", got)
+	}
+}
@@ -0,0 +1,144 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// SubtasksMetadataKey is the metadata key BreakTask stores subtasks under,
+// as a JSON array of strings, when ControllerConfig.StoreSubtasks is set
+const SubtasksMetadataKey = "subtasks"
+
+// breakTaskInstructions is the system prompt used to split a goal into
+// subtasks
+const breakTaskInstructions = "Break the user's goal into a short sequence of concrete, actionable subtasks. " +
+	"Reply with a numbered list, one subtask per line, in the order they should be done, and nothing else."
+
+// listMarker matches the number or bullet at the start of a list item, such
+// as "1.", "2)", "(3)", "Step 4:", "-", "*" or "•"
+var listMarker = regexp.MustCompile(`^(?i:(?:step\s+)?\d+[.):]|\(\d+\)|[-*•+])\s+`)
+
+// BreakTask asks the backend to split goal into subtasks and returns them
+// in order. The conversation so far is sent as context, but neither the
+// prompt nor the reply is added to it; the request counts toward its usage.
+// When ControllerConfig.StoreSubtasks is set the subtasks are also saved in
+// the conversation's metadata under SubtasksMetadataKey.
+func (c *Controller) BreakTask(ctx context.Context, id ConversationID, goal string) ([]string, error) {
+	goal = strings.TrimSpace(goal)
+	if goal == "" {
+		return nil, fmt.Errorf("%w: goal cannot be empty", ai.ErrInvalidRequest)
+	}
+
+	reply, err := c.askAbout(ctx, id, breakTaskInstructions, "Goal: "+goal)
+	if err != nil {
+		return nil, fmt.Errorf("failed to break down task: %w", err)
+	}
+
+	subtasks := parseSubtasks(reply)
+	if len(subtasks) == 0 {
+		return nil, fmt.Errorf("failed to break down task: %w", ErrEmptyResponse)
+	}
+
+	if c.storeSubtasks {
+		data, err := json.Marshal(subtasks)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode subtasks: %w", err)
+		}
+		if err := c.SetMetadata(id, SubtasksMetadataKey, string(data)); err != nil {
+			return nil, fmt.Errorf("failed to store subtasks: %w", err)
+		}
+	}
+	return subtasks, nil
+}
+
+// askAbout sends a one-off request made of instructions, the conversation's
+// transcript as context, and prompt, and returns the reply. The request
+// counts toward the conversation's usage but is not added to its messages.
+func (c *Controller) askAbout(ctx context.Context, id ConversationID, instructions, prompt string) (string, error) {
+	c.ensureLoaded(id)
+	c.mutex.RLock()
+	conversation, exists := c.conversations[id]
+	if !exists {
+		c.mutex.RUnlock()
+		return "", fmt.Errorf("conversation %s %w", id, ErrConversationNotFound)
+	}
+	history := c.preprocessMessages(copyMessages(conversation.Messages))
+	model := c.defaultModel
+	c.mutex.RUnlock()
+
+	if past := transcript(history); past != "" {
+		prompt = "Conversation so far:\n" + past + "\n\n" + prompt
+	}
+	request := ai.ChatCompletionRequest{
+		Model: model,
+		Messages: []ai.Message{
+			{Role: "system", Content: instructions},
+			{Role: "user", Content: prompt},
+		},
+	}
+
+	var response *ai.ChatCompletionResponse
+	err := c.withRetry(ctx, func() error {
+		var err error
+		response, err = c.backend.ChatCompletion(ctx, request)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(response.Choices) == 0 {
+		return "", fmt.Errorf("no response choices returned")
+	}
+
+	servedModel := model
+	if response.Model != "" {
+		servedModel = response.Model
+	}
+	cost, priced := estimateCost(c.pricing, servedModel, response.Usage)
+
+	c.mutex.Lock()
+	if conversation, exists := c.conversations[id]; exists {
+		conversation.Usage.PromptTokens += response.Usage.PromptTokens
+		conversation.Usage.CompletionTokens += response.Usage.CompletionTokens
+		conversation.Usage.TotalTokens += response.Usage.TotalTokens
+		conversation.EstimatedCostUSD += cost
+		if !priced && response.Usage.TotalTokens > 0 {
+			conversation.PricingUnavailable = true
+		}
+		c.changedLocked(conversation)
+	}
+	c.mutex.Unlock()
+
+	c.recordUsage(id, servedModel, response.Usage, cost)
+	return response.Choices[0].Message.Content, nil
+}
+
+// parseSubtasks extracts subtasks from a model reply. Numbered or bulleted
+// items are used when there are any, so a preamble such as "Here are the
+// steps:" is dropped. Otherwise every non-empty line is taken as a subtask.
+func parseSubtasks(reply string) []string {
+	var items, lines []string
+	for line := range strings.Lines(reply) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "```") {
+			continue
+		}
+		lines = append(lines, line)
+
+		if marker := listMarker.FindString(line); marker != "" {
+			if item := strings.TrimSpace(line[len(marker):]); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+
+	if len(items) > 0 {
+		return items
+	}
+	return lines
+}
@@ -0,0 +1,116 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+func TestParseSubtasks(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+		want  []string
+	}{
+		{
+			name:  "numbered",
+			reply: "1. Gather requirements\n2) Write the code\n(3) Test it",
+			want:  []string{"Gather requirements", "Write the code", "Test it"},
+		},
+		{
+			name:  "bulleted with preamble",
+			reply: "Here are the steps:\n\n- Draft\n* Review\n• Publish\n",
+			want:  []string{"Draft", "Review", "Publish"},
+		},
+		{
+			name:  "step labels",
+			reply: "Step 1: Plan\nstep 2: Build",
+			want:  []string{"Plan", "Build"},
+		},
+		{
+			name:  "unmarked lines",
+			reply: "```\n  Plan the trip \n\nBook flights\n```",
+			want:  []string{"Plan the trip", "Book flights"},
+		},
+		{
+			name:  "empty",
+			reply: " \n\n",
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseSubtasks(tt.reply); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestController_BreakTask(t *testing.T) {
+	backend := newRecordingBackend()
+	controller := NewController(backend, &ControllerConfig{StoreSubtasks: true})
+	conv := controller.CreateConversation("system")
+	sendN(t, controller, conv.ID, 1)
+
+	backend.QueueResponse("Sure!\n1. Outline the chapters\n2. Write a draft\n3. Edit")
+	subtasks, err := controller.BreakTask(context.Background(), conv.ID, "write a book")
+	if err != nil {
+		t.Fatalf("BreakTask failed: %v", err)
+	}
+	want := []string{"Outline the chapters", "Write a draft", "Edit"}
+	if !reflect.DeepEqual(subtasks, want) {
+		t.Errorf("Expected %q, got %q", want, subtasks)
+	}
+
+	// The goal is sent with the conversation as context
+	request := backend.lastRequest()
+	if len(request.Messages) != 2 || request.Messages[0].Content != breakTaskInstructions {
+		t.Fatalf("Expected instructions and prompt, got %+v", request.Messages)
+	}
+	if prompt := request.Messages[1].Content; !strings.Contains(prompt, "user: ping") || !strings.HasSuffix(prompt, "Goal: write a book") {
+		t.Errorf("Expected transcript and goal in prompt, got %q", prompt)
+	}
+
+	// Nothing is added to the conversation, but the subtasks are stored
+	got, _ := controller.GetConversation(conv.ID)
+	if len(got.Messages) != 3 {
+		t.Errorf("Expected the conversation to be unchanged, got %d messages", len(got.Messages))
+	}
+	if stored := got.Metadata[SubtasksMetadataKey]; stored != `["Outline the chapters","Write a draft","Edit"]` {
+		t.Errorf("Expected subtasks in metadata, got %q", stored)
+	}
+}
+
+func TestController_BreakTask_Errors(t *testing.T) {
+	backend := newRecordingBackend()
+	controller := NewController(backend, nil)
+	conv := controller.CreateConversation("")
+
+	if _, err := controller.BreakTask(context.Background(), conv.ID, "  "); !errors.Is(err, ai.ErrInvalidRequest) {
+		t.Errorf("Expected ErrInvalidRequest for an empty goal, got %v", err)
+	}
+	if _, err := controller.BreakTask(context.Background(), "missing", "goal"); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Expected ErrConversationNotFound, got %v", err)
+	}
+
+	backend.QueueResponse("\n")
+	if _, err := controller.BreakTask(context.Background(), conv.ID, "goal"); !errors.Is(err, ErrEmptyResponse) {
+		t.Errorf("Expected ErrEmptyResponse for a blank reply, got %v", err)
+	}
+
+	// Subtasks are only stored when configured
+	backend.QueueResponse("- one")
+	if _, err := controller.BreakTask(context.Background(), conv.ID, "goal"); err != nil {
+		t.Fatalf("BreakTask failed: %v", err)
+	}
+	metadata, _ := controller.GetMetadata(conv.ID)
+	if _, ok := metadata[SubtasksMetadataKey]; ok {
+		t.Errorf("Expected no stored subtasks, got %v", metadata)
+	}
+}
@@ -0,0 +1,67 @@
+package chat
+
+import (
+	"log/slog"
+	"sync/atomic"
+)
+
+// EvictionFunc is called with the summary of a conversation evicted to stay
+// within MaxConversations
+type EvictionFunc func(evicted ConversationSummary)
+
+// touchLocked marks a conversation as just used. Must be called with the
+// controller lock held, for reading or writing.
+func (c *Controller) touchLocked(id ConversationID) {
+	if used := c.lastUsed[id]; used != nil {
+		used.Store(c.useClock.Add(1))
+	}
+}
+
+// trackLocked starts tracking use of a newly stored conversation. Must be
+// called with the controller lock held.
+func (c *Controller) trackLocked(id ConversationID) {
+	used := new(atomic.Uint64)
+	used.Store(c.useClock.Add(1))
+	c.lastUsed[id] = used
+}
+
+// enforceCapacity evicts least recently used conversations until no more
+// than MaxConversations remain. Conversations with a request in flight are
+// never evicted, so the cap may be exceeded briefly. The eviction callback
+// runs after the controller lock is released.
+func (c *Controller) enforceCapacity() {
+	if c.maxConversations <= 0 {
+		return
+	}
+
+	var evicted []ConversationSummary
+
+	c.mutex.Lock()
+	for len(c.conversations) > c.maxConversations {
+		var oldest ConversationID
+		var oldestUse uint64
+		for id := range c.conversations {
+			if c.inFlight[id] > 0 {
+				continue
+			}
+			if used := c.lastUsed[id].Load(); oldest == "" || used < oldestUse {
+				oldest, oldestUse = id, used
+			}
+		}
+		if oldest == "" {
+			break
+		}
+
+		evicted = append(evicted, *c.summarizeLocked(c.conversations[oldest]))
+		c.unloadLocked(oldest)
+		c.stats.evictions.Add(1)
+	}
+	c.mutex.Unlock()
+
+	for _, summary := range evicted {
+		c.logger.Info("conversation evicted", slog.String("conversation_id", string(summary.ID)))
+		if c.onEvict != nil {
+			c.onEvict(summary)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/backends/mock"
+)
+
+func TestController_MaxConversationsEvictsLRU(t *testing.T) {
+	var evicted []ConversationID
+	controller := NewController(mock.NewMockBackend(), &ControllerConfig{
+		MaxConversations: 2,
+		OnEvict: func(summary ConversationSummary) {
+			evicted = append(evicted, summary.ID)
+		},
+	})
+
+	first := controller.CreateConversation("")
+	second := controller.CreateConversation("")
+
+	// Reading the first conversation makes the second the least recently used
+	controller.GetConversation(first.ID)
+	third := controller.CreateConversation("")
+
+	if len(evicted) != 1 || evicted[0] != second.ID {
+		t.Fatalf("Expected %s to be evicted, got %v", second.ID, evicted)
+	}
+	if _, err := controller.GetConversation(second.ID); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Expected evicted conversation to be gone, got %v", err)
+	}
+
+	// Sending counts as a use too
+	backend := controller.GetBackend().(*mock.MockBackend)
+	backend.SetLatency(0)
+	if _, err := controller.SendMessage(context.Background(), ChatRequest{
+		ConversationID: first.ID,
+		Message:        "Hello",
+	}); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	controller.CreateConversation("")
+
+	if len(evicted) != 2 || evicted[1] != third.ID {
+		t.Errorf("Expected %s to be evicted next, got %v", third.ID, evicted)
+	}
+
+	stats := controller.GetStats()
+	if stats.TotalConversations != 2 || stats.EvictedConversations != 2 {
+		t.Errorf("Expected 2 conversations and 2 evictions, got %d and %d", stats.TotalConversations, stats.EvictedConversations)
+	}
+}
+
+func TestController_MaxConversationsConcurrent(t *testing.T) {
+	backend := mock.NewMockBackend()
+	backend.SetLatency(0)
+
+	var mutex sync.Mutex
+	evictions := 0
+	controller := NewController(backend, &ControllerConfig{
+		MaxConversations: 5,
+		OnEvict: func(ConversationSummary) {
+			mutex.Lock()
+			evictions++
+			mutex.Unlock()
+		},
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conv := controller.CreateConversation("")
+			controller.SendMessage(context.Background(), ChatRequest{ConversationID: conv.ID, Message: "Hello"})
+			controller.GetConversation(conv.ID)
+		}()
+	}
+	wg.Wait()
+	controller.CreateConversation("")
+
+	stats := controller.GetStats()
+	if stats.TotalConversations > 5 {
+		t.Errorf("Expected at most 5 conversations, got %d", stats.TotalConversations)
+	}
+	if stats.EvictedConversations != evictions || evictions != 21-stats.TotalConversations {
+		t.Errorf("Expected evictions to be counted consistently, got %d in stats and %d callbacks", stats.EvictedConversations, evictions)
+	}
+}
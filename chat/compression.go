@@ -0,0 +1,127 @@
+package chat
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// SummaryPrefix marks messages that hold a summary of compressed history so
+// they can be recognized and are not summarized again
+const SummaryPrefix = "[Summary of earlier conversation] "
+
+// CompressionRecord describes one lossy compression of a conversation's
+// history, kept so users can audit what was condensed and when
+type CompressionRecord struct {
+	At               time.Time `json:"at"`
+	MessagesReplaced int       `json:"messages_replaced"`
+	TokensReplaced   int       `json:"tokens_replaced"`
+	SummaryTokens    int       `json:"summary_tokens"`
+}
+
+// String describes the compression for timelines such as the CLI history
+func (r CompressionRecord) String() string {
+	return fmt.Sprintf("summarized %d messages (~%d tokens) at %s",
+		r.MessagesReplaced, r.TokensReplaced, r.At.Format("2006-01-02 15:04:05"))
+}
+
+// IsSummary reports whether a message holds a compression summary
+func IsSummary(msg ai.Message) bool {
+	return strings.HasPrefix(msg.Content, SummaryPrefix)
+}
+
+// CompressMessages replaces the oldest count non-system messages of a
+// conversation with a single summary message and records the compression.
+// Leading system messages are preserved and the summary is inserted right
+// after them.
+func (c *Controller) CompressMessages(id ConversationID, count int, summary string) (*CompressionRecord, error) {
+	if count <= 0 {
+		return nil, fmt.Errorf("%w: count must be greater than 0", ai.ErrInvalidRequest)
+	}
+	if strings.TrimSpace(summary) == "" {
+		return nil, fmt.Errorf("%w: summary cannot be empty", ai.ErrInvalidRequest)
+	}
+
+	c.ensureLoaded(id)
+	var notifications []thresholdNotification
+	defer func() { notifyThresholds(notifications) }()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	conversation, exists := c.conversations[id]
+	if !exists {
+		return nil, fmt.Errorf("conversation %s %w", id, ErrConversationNotFound)
+	}
+
+	record, err := c.compressLocked(conversation, count, summary)
+	if err != nil {
+		return nil, err
+	}
+	notifications = c.checkThresholds(conversation)
+	return record, nil
+}
+
+// compressionStart returns the index of the first message after the leading
+// system prompt(s), where compression begins
+func compressionStart(messages []ai.Message) int {
+	start := 0
+	for start < len(messages) && messages[start].Role == "system" && !IsSummary(messages[start]) {
+		start++
+	}
+	return start
+}
+
+// compressLocked does the work of CompressMessages. Must be called with the
+// controller lock held.
+func (c *Controller) compressLocked(conversation *Conversation, count int, summary string) (*CompressionRecord, error) {
+	start := compressionStart(conversation.Messages)
+
+	if start+count > len(conversation.Messages) {
+		return nil, fmt.Errorf("%w: cannot compress %d messages, conversation has %d after the system prompt",
+			ai.ErrInvalidRequest, count, len(conversation.Messages)-start)
+	}
+
+	replaced := conversation.Messages[start : start+count]
+	summaryMessage := ai.Message{
+		Role:    "system",
+		Content: SummaryPrefix + strings.TrimSpace(summary),
+	}
+
+	record := CompressionRecord{
+		At:               time.Now(),
+		MessagesReplaced: count,
+		TokensReplaced:   c.tokenCounter(replaced),
+		SummaryTokens:    c.tokenCounter([]ai.Message{summaryMessage}),
+	}
+
+	messages := make([]ai.Message, 0, len(conversation.Messages)-count+1)
+	messages = append(messages, conversation.Messages[:start]...)
+	messages = append(messages, summaryMessage)
+	messages = append(messages, conversation.Messages[start+count:]...)
+
+	conversation.Messages = messages
+	conversation.Compressions = append(conversation.Compressions, record)
+	conversation.UpdatedAt = record.At
+	c.changedLocked(conversation)
+
+	return &record, nil
+}
+
+// GetCompressionHistory returns the compression timeline of a conversation,
+// oldest first
+func (c *Controller) GetCompressionHistory(id ConversationID) ([]CompressionRecord, error) {
+	c.ensureLoaded(id)
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	conversation, exists := c.conversations[id]
+	if !exists {
+		return nil, fmt.Errorf("conversation %s %w", id, ErrConversationNotFound)
+	}
+
+	history := make([]CompressionRecord, len(conversation.Compressions))
+	copy(history, conversation.Compressions)
+	return history, nil
+}
@@ -0,0 +1,74 @@
+package chat
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// PromptCompressor shrinks the outbound message history before it is sent to
+// the backend. It works on a copy of the history, so the stored conversation
+// is never modified. Unlike CompressMessages, which summarizes old turns,
+// compressors run on every request and should be lossless or close to it.
+// Compression runs before MaxContextTokens trimming, with the controller
+// lock held, so Compress must not call back into the controller.
+type PromptCompressor interface {
+	Compress(messages []ai.Message) ([]ai.Message, error)
+}
+
+// PromptCompressorFunc adapts a function to the PromptCompressor interface
+type PromptCompressorFunc func(messages []ai.Message) ([]ai.Message, error)
+
+// Compress calls f(messages)
+func (f PromptCompressorFunc) Compress(messages []ai.Message) ([]ai.Message, error) {
+	return f(messages)
+}
+
+var (
+	// inlineSpace matches runs of spaces and tabs after the first character
+	inlineSpace = regexp.MustCompile(`(\S)[ \t]{2,}`)
+	// blankLines matches three or more line breaks with optional whitespace
+	blankLines = regexp.MustCompile(`\n[ \t]*(\n[ \t]*){2,}`)
+)
+
+// WhitespaceCompressor removes redundant whitespace and repeated paragraphs
+// from message content. Leading indentation is kept so code stays readable.
+type WhitespaceCompressor struct{}
+
+// Compress implements PromptCompressor
+func (WhitespaceCompressor) Compress(messages []ai.Message) ([]ai.Message, error) {
+	compressed := make([]ai.Message, len(messages))
+	for i, msg := range messages {
+		msg.Content = compressContent(msg.Content)
+		compressed[i] = msg
+	}
+	return compressed, nil
+}
+
+// compressContent normalizes whitespace and drops paragraphs that repeat an
+// earlier paragraph of the same content verbatim
+func compressContent(content string) string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		line = strings.TrimRight(line, " \t")
+		lines[i] = inlineSpace.ReplaceAllString(line, "$1 ")
+	}
+	content = blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+
+	paragraphs := strings.Split(content, "\n\n")
+	seen := make(map[string]bool, len(paragraphs))
+	kept := paragraphs[:0]
+	for _, paragraph := range paragraphs {
+		key := strings.TrimSpace(paragraph)
+		if key != "" && seen[key] {
+			continue
+		}
+		seen[key] = true
+		kept = append(kept, paragraph)
+	}
+
+	return strings.TrimSpace(strings.Join(kept, "\n\n"))
+}
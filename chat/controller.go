@@ -0,0 +1,1212 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// ConversationID represents a unique identifier for a conversation
+type ConversationID string
+
+// ErrConversationNotFound is wrapped by errors for unknown conversation IDs
+var ErrConversationNotFound = errors.New("not found")
+
+// Conversation represents an active chat session with message history
+type Conversation struct {
+	ID           ConversationID      `json:"id"`
+	Title        string              `json:"title,omitempty"`
+	Tags         []string            `json:"tags,omitempty"`
+	Messages     []ai.Message        `json:"messages"`
+	CreatedAt    time.Time           `json:"created_at"`
+	UpdatedAt    time.Time           `json:"updated_at"`
+	Metadata     map[string]string   `json:"metadata"`
+	Compressions []CompressionRecord `json:"compressions,omitempty"`
+
+	// Usage accumulates the token usage reported by the backend
+	Usage ai.Usage `json:"usage"`
+	// EstimatedCostUSD accumulates the priced cost of every request
+	EstimatedCostUSD float64 `json:"estimated_cost_usd"`
+	// PricingUnavailable is set when a request used a model with no price,
+	// so EstimatedCostUSD undercounts
+	PricingUnavailable bool `json:"pricing_unavailable,omitempty"`
+	// LastModel is the model that served the most recent request
+	LastModel string `json:"last_model,omitempty"`
+}
+
+// ChatRequest represents a request to send a message in a conversation
+type ChatRequest struct {
+	ConversationID ConversationID `json:"conversation_id,omitempty"`
+	Message        string         `json:"message"`
+	SystemPrompt   string         `json:"system_prompt,omitempty"`
+	Model          string         `json:"model,omitempty"`
+	MaxTokens      *int           `json:"max_tokens,omitempty"`
+	Temperature    *float64       `json:"temperature,omitempty"`
+	// Stop lists sequences that end the response, at most
+	// ai.MaxStopSequences
+	Stop []string `json:"stop,omitempty"`
+	// PresencePenalty and FrequencyPenalty are passed to the backend when
+	// set, each between -2.0 and 2.0
+	PresencePenalty  *float64 `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float64 `json:"frequency_penalty,omitempty"`
+	// Seed asks the backend for reproducible sampling when set
+	Seed *int `json:"seed,omitempty"`
+	// ImageURLs attaches images to the message for vision models. Each is
+	// an http(s) URL or a base64 data URL.
+	ImageURLs []string `json:"image_urls,omitempty"`
+}
+
+// ChatResponse represents the response from the chat controller
+type ChatResponse struct {
+	ConversationID ConversationID             `json:"conversation_id"`
+	Message        ai.Message                 `json:"message"`
+	Response       *ai.ChatCompletionResponse `json:"response"`
+	Error          string                     `json:"error,omitempty"`
+
+	// FinishReason is why the backend stopped generating, e.g. "stop",
+	// "length", or "content_filter"
+	FinishReason string `json:"finish_reason,omitempty"`
+
+	// EmptyResponse flags a stored reply with no content and no tool
+	// calls, which often means the response was filtered
+	EmptyResponse bool `json:"empty_response,omitempty"`
+
+	// LikelyTruncated flags a response that heuristics suggest was cut
+	// off, even if the backend reported a normal finish reason
+	LikelyTruncated bool `json:"likely_truncated,omitempty"`
+
+	// RejectedToolCalls lists tool calls the model made to tools this
+	// conversation may not use. Each was answered with a tool-error message.
+	RejectedToolCalls []ai.ToolCall `json:"rejected_tool_calls,omitempty"`
+	// ProviderMetadata passes through extra data from the backend, such as
+	// request IDs, for debugging and support tickets
+	ProviderMetadata map[string]string `json:"provider_metadata,omitempty"`
+	// TrimmedMessages is the number of old messages dropped from the
+	// conversation to fit within MaxContextTokens before sending
+	TrimmedMessages int `json:"trimmed_messages,omitempty"`
+	// SummarizedMessages is the number of old messages replaced by a
+	// summary after the response because AutoSummarizeAtTokens was reached
+	SummarizedMessages int `json:"summarized_messages,omitempty"`
+	// SummarizeError reports a failed automatic summarization. The
+	// response itself is unaffected.
+	SummarizeError string `json:"summarize_error,omitempty"`
+	// SystemFingerprint identifies the backend configuration that served
+	// the request, when the provider reports one
+	SystemFingerprint string `json:"system_fingerprint,omitempty"`
+	// Model is the model that served the request
+	Model string `json:"model,omitempty"`
+	// FallbackFrom is the model originally requested when it was
+	// unavailable and one of FallbackModels served the request instead
+	FallbackFrom string `json:"fallback_from,omitempty"`
+}
+
+// Controller manages chat conversations and AI backend interactions
+type Controller struct {
+	backend       ai.Backend
+	conversations map[ConversationID]*Conversation
+	store         ConversationStore
+	writer        *storeWriter
+	mutex         sync.RWMutex
+	defaultModel  string
+	maxTokens     int
+	temperature   float64
+
+	safeMode          bool
+	usageRecorder     UsageRecorder
+	compressor        PromptCompressor
+	labelTrimmer      *RoleLabelTrimmer
+	preprocessors     []MessageHook
+	postprocessors    []MessageHook
+	storeProcessed    bool
+	idempotencyTTL    time.Duration
+	idempotencyKeys   map[string]idempotencyEntry
+	tools             map[string]ai.Tool
+	toolAllowlists    map[ConversationID]map[string]bool
+	lastTurns         map[ConversationID]ChatRequest
+	contextWindow     int
+	maxContextTokens  int
+	maxRetries        int
+	pricing           map[string]ModelPrice
+	fallbackModels    []string
+	contextLimits     map[string]int
+	retryBaseDelay    time.Duration
+	autoSummarizeAt   int
+	autoSummarizeKeep int
+	logger            *slog.Logger
+	observer          RequestObserver
+	tokenCounter      TokenCounter
+	thresholds        []tokenThreshold
+	firedThresholds   map[ConversationID]map[int]bool
+	conversationTTL   time.Duration
+	pruneInterval     time.Duration
+	// inFlight counts requests in progress per conversation, which pruning
+	// must not delete
+	inFlight map[ConversationID]int
+
+	maxConversations int
+	onEvict          EvictionFunc
+	// lastUsed orders conversations for LRU eviction. Entries are updated
+	// atomically so reads under the shared lock can count as a use.
+	lastUsed map[ConversationID]*atomic.Uint64
+	useClock atomic.Uint64
+
+	// stats are running totals read by GetStats, and tallies what they
+	// include for each conversation
+	stats   statsCounters
+	tallies map[ConversationID]conversationTally
+
+	idGenerator    func() ConversationID
+	emptyResponses EmptyResponsePolicy
+
+	// storeSubtasks saves task breakdowns as conversation metadata
+	storeSubtasks bool
+
+	// taskGraphMode is where RunTaskGraph sends subtasks
+	taskGraphMode TaskGraphConversations
+
+	// healthMutex guards the cached result of the last health check, so
+	// checks do not hold the controller lock while probing the backend
+	healthMutex sync.Mutex
+	health      *healthEntry
+	healthTTL   time.Duration
+	healthEpoch uint64
+
+	// lifecycleMutex guards the background pruner started by Start
+	lifecycleMutex sync.Mutex
+	stopPruning    chan struct{}
+	pruneDone      chan struct{}
+}
+
+// ControllerConfig holds configuration for the chat controller
+type ControllerConfig struct {
+	DefaultModel string  `json:"default_model"`
+	MaxTokens    int     `json:"max_tokens"`
+	Temperature  float64 `json:"temperature"`
+
+	// SafeMode requires a confirmation token for destructive operations
+	// such as DeleteConversation and ClearConversation.
+	SafeMode bool `json:"safe_mode,omitempty"`
+
+	// UsageRecorder, when set, receives a record per completed request.
+	UsageRecorder UsageRecorder `json:"-"`
+
+	// Compressor, when set, shrinks the outbound history before each send.
+	// The stored conversation is left untouched.
+	Compressor PromptCompressor `json:"-"`
+
+	// RoleLabelTrimmer, when set, strips echoed role labels such as
+	// "Assistant:" from responses before they are stored.
+	RoleLabelTrimmer *RoleLabelTrimmer `json:"-"`
+
+	// MessagePreprocessors rewrite every outbound message, in order, before
+	// it is sent to the backend, such as to redact emails or API keys. They
+	// run on a copy, so the stored conversation keeps the original text
+	// unless StoreProcessedMessages is set.
+	MessagePreprocessors []MessageHook `json:"-"`
+
+	// ResponsePostprocessors rewrite the assistant message, in order,
+	// before it is returned. Streamed deltas are delivered unprocessed;
+	// the final response carries the processed message.
+	ResponsePostprocessors []MessageHook `json:"-"`
+
+	// StoreProcessedMessages stores the processed user and assistant
+	// messages in the conversation instead of the originals
+	StoreProcessedMessages bool `json:"store_processed_messages,omitempty"`
+
+	// IdempotencyTTL is how long CreateConversationIdempotent remembers a
+	// key. Defaults to DefaultIdempotencyTTL when zero.
+	IdempotencyTTL time.Duration `json:"idempotency_ttl,omitempty"`
+
+	// ContextWindow is the model's context size in tokens. Zero disables
+	// context utilization tracking and token threshold callbacks.
+	ContextWindow int `json:"context_window,omitempty"`
+
+	// TokenCounter estimates the token size of a message history.
+	// Defaults to ai.CountTokens for DefaultModel when nil.
+	TokenCounter TokenCounter `json:"-"`
+
+	// MaxContextTokens caps the estimated token size of the history sent
+	// with each request, measured after compression. When exceeded, the
+	// oldest non-system messages are dropped from the conversation until it
+	// fits. Zero disables trimming.
+	MaxContextTokens int `json:"max_context_tokens,omitempty"`
+
+	// ModelPricing prices token usage per model for cost estimates.
+	// Defaults to DefaultModelPricing when nil.
+	ModelPricing map[string]ModelPrice `json:"model_pricing,omitempty"`
+
+	// FallbackModels are tried in order when the backend reports the
+	// requested model does not exist or is not accessible. Other failures
+	// never trigger a fallback.
+	FallbackModels []string `json:"fallback_models,omitempty"`
+
+	// ModelContextLimits maps models to their context size in tokens for
+	// GetContextUsage. Defaults to DefaultModelContextLimits when nil.
+	ModelContextLimits map[string]int `json:"model_context_limits,omitempty"`
+
+	// MaxRetries is how many times a request is retried after a transient
+	// backend failure such as a timeout, 429, or 5xx. Zero disables retries.
+	MaxRetries int `json:"max_retries,omitempty"`
+
+	// RetryBaseDelay is the backoff before the first retry, doubling after
+	// each attempt. Defaults to DefaultRetryBaseDelay when zero.
+	RetryBaseDelay time.Duration `json:"retry_base_delay,omitempty"`
+
+	// AutoSummarizeAtTokens, when set, runs SummarizeAndCompress after a
+	// response once the history's estimated size reaches it. Zero disables
+	// automatic summarization.
+	AutoSummarizeAtTokens int `json:"auto_summarize_at_tokens,omitempty"`
+
+	// AutoSummarizeKeepRecent is the number of recent turns automatic
+	// summarization keeps verbatim. Defaults to
+	// DefaultAutoSummarizeKeepRecent when zero.
+	AutoSummarizeKeepRecent int `json:"auto_summarize_keep_recent,omitempty"`
+
+	// Logger receives structured logs of sends, retries, backend switches,
+	// and errors. Defaults to discarding everything when nil.
+	Logger *slog.Logger `json:"-"`
+
+	// Observer, when set, is told the outcome of every send, for example
+	// to update metrics.
+	Observer RequestObserver `json:"-"`
+
+	// ConversationTTL is how long a conversation may go without updates
+	// before PruneExpired deletes it, including from the Store, which also
+	// drops expired conversations when they are loaded at startup. Zero
+	// keeps conversations forever.
+	ConversationTTL time.Duration `json:"conversation_ttl,omitempty"`
+
+	// PruneInterval is how often the pruner started by Start runs.
+	// Defaults to DefaultPruneInterval, or ConversationTTL if shorter.
+	PruneInterval time.Duration `json:"prune_interval,omitempty"`
+
+	// MaxConversations caps the number of stored conversations. Once it is
+	// exceeded the least recently used conversations are evicted from
+	// memory; with a Store they are kept there and loaded again when next
+	// used. Zero means no limit.
+	MaxConversations int `json:"max_conversations,omitempty"`
+
+	// OnEvict, when set, is called with the summary of every conversation
+	// evicted to stay within MaxConversations.
+	OnEvict EvictionFunc `json:"-"`
+
+	// AvailabilityTTL is how long a backend health check is reused by
+	// IsBackendAvailable and CheckBackendHealth. Zero uses
+	// DefaultAvailabilityTTL; a negative value checks every time.
+	AvailabilityTTL time.Duration `json:"availability_ttl,omitempty"`
+
+	// Store receives every change to a conversation, and conversations
+	// already in it are loaded when the controller is created. Writes
+	// happen in the background; Flush waits for them. Nil keeps
+	// conversations in memory only.
+	Store ConversationStore `json:"-"`
+
+	// IDGenerator, when set, generates the IDs of new conversations, for
+	// example a prefix plus a ULID so IDs sort by creation time. IDs must be
+	// unique; a generator returning an empty or already used ID falls back
+	// to the default format for that conversation. It is called with the
+	// controller lock held, so it must not call back into the controller.
+	IDGenerator func() ConversationID `json:"-"`
+
+	// EmptyResponses decides what SendMessage and SendMessageStream do
+	// when the backend replies with no content and no tool calls. Defaults
+	// to EmptyResponseStore when empty. A streamed reply is retried without
+	// streaming.
+	EmptyResponses EmptyResponsePolicy `json:"empty_responses,omitempty"`
+
+	// StoreSubtasks makes BreakTask and BreakTaskGraph save what they
+	// return in the conversation's metadata, under SubtasksMetadataKey and
+	// TaskGraphMetadataKey
+	StoreSubtasks bool `json:"store_subtasks,omitempty"`
+
+	// TaskGraphConversations decides whether RunTaskGraph sends each
+	// subtask to a conversation of its own or all of them to one. Defaults
+	// to TaskGraphSeparate when empty.
+	TaskGraphConversations TaskGraphConversations `json:"task_graph_conversations,omitempty"`
+}
+
+// NewController creates a new chat controller with the specified backend
+func NewController(backend ai.Backend, config *ControllerConfig) *Controller {
+	if config == nil {
+		config = &ControllerConfig{
+			DefaultModel: "gpt-4",
+			MaxTokens:    500,
+			Temperature:  0.7,
+		}
+	}
+
+	defaultModel := config.DefaultModel
+	if defaultModel == "" {
+		defaultModel = "gpt-4"
+	}
+
+	tokenCounter := config.TokenCounter
+	if tokenCounter == nil {
+		tokenCounter = func(messages []ai.Message) int {
+			// On a tokenizer failure the heuristic count is still returned
+			tokens, _ := ai.CountTokens(defaultModel, messages)
+			return tokens
+		}
+	}
+
+	pricing := config.ModelPricing
+	if pricing == nil {
+		pricing = DefaultModelPricing
+	}
+
+	contextLimits := config.ModelContextLimits
+	if contextLimits == nil {
+		contextLimits = DefaultModelContextLimits
+	}
+
+	retryBaseDelay := config.RetryBaseDelay
+	if retryBaseDelay <= 0 {
+		retryBaseDelay = DefaultRetryBaseDelay
+	}
+
+	autoSummarizeKeep := config.AutoSummarizeKeepRecent
+	if autoSummarizeKeep <= 0 {
+		autoSummarizeKeep = DefaultAutoSummarizeKeepRecent
+	}
+
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
+	idempotencyTTL := config.IdempotencyTTL
+	if idempotencyTTL <= 0 {
+		idempotencyTTL = DefaultIdempotencyTTL
+	}
+
+	healthTTL := config.AvailabilityTTL
+	if healthTTL == 0 {
+		healthTTL = DefaultAvailabilityTTL
+	}
+
+	pruneInterval := config.PruneInterval
+	if pruneInterval <= 0 {
+		pruneInterval = DefaultPruneInterval
+		if config.ConversationTTL > 0 && config.ConversationTTL < pruneInterval {
+			pruneInterval = config.ConversationTTL
+		}
+	}
+
+	c := &Controller{
+		backend:           backend,
+		conversations:     make(map[ConversationID]*Conversation),
+		store:             config.Store,
+		defaultModel:      defaultModel,
+		maxTokens:         config.MaxTokens,
+		temperature:       config.Temperature,
+		safeMode:          config.SafeMode,
+		usageRecorder:     config.UsageRecorder,
+		compressor:        config.Compressor,
+		labelTrimmer:      config.RoleLabelTrimmer,
+		preprocessors:     slices.Clone(config.MessagePreprocessors),
+		postprocessors:    slices.Clone(config.ResponsePostprocessors),
+		storeProcessed:    config.StoreProcessedMessages,
+		idempotencyTTL:    idempotencyTTL,
+		idempotencyKeys:   make(map[string]idempotencyEntry),
+		tools:             make(map[string]ai.Tool),
+		toolAllowlists:    make(map[ConversationID]map[string]bool),
+		lastTurns:         make(map[ConversationID]ChatRequest),
+		contextWindow:     config.ContextWindow,
+		maxContextTokens:  config.MaxContextTokens,
+		maxRetries:        config.MaxRetries,
+		pricing:           pricing,
+		fallbackModels:    slices.Clone(config.FallbackModels),
+		contextLimits:     contextLimits,
+		retryBaseDelay:    retryBaseDelay,
+		autoSummarizeAt:   config.AutoSummarizeAtTokens,
+		autoSummarizeKeep: autoSummarizeKeep,
+		logger:            logger,
+		observer:          config.Observer,
+		tokenCounter:      tokenCounter,
+		firedThresholds:   make(map[ConversationID]map[int]bool),
+		conversationTTL:   config.ConversationTTL,
+		pruneInterval:     pruneInterval,
+		inFlight:          make(map[ConversationID]int),
+		maxConversations:  config.MaxConversations,
+		onEvict:           config.OnEvict,
+		healthTTL:         healthTTL,
+		lastUsed:          make(map[ConversationID]*atomic.Uint64),
+		tallies:           make(map[ConversationID]conversationTally),
+		idGenerator:       config.IDGenerator,
+		emptyResponses:    config.EmptyResponses,
+		storeSubtasks:     config.StoreSubtasks,
+		taskGraphMode:     config.TaskGraphConversations,
+	}
+	c.stats.backendName.Store(backend.Name())
+	if c.store != nil {
+		c.writer = newStoreWriter(c.store, logger)
+	}
+	c.loadStore()
+	return c
+}
+
+// CreateConversation creates a new conversation with optional system
+// prompt. Like GetConversation, it returns a deep copy.
+func (c *Controller) CreateConversation(systemPrompt string) *Conversation {
+	defer c.enforceCapacity()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return copyConversation(c.createConversationLocked(systemPrompt))
+}
+
+// newConversation creates a conversation and, like lookupConversation,
+// returns the stored conversation itself
+func (c *Controller) newConversation(systemPrompt string) *Conversation {
+	defer c.enforceCapacity()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.createConversationLocked(systemPrompt)
+}
+
+// createConversationLocked creates and registers a conversation. Must be
+// called with the controller lock held.
+func (c *Controller) createConversationLocked(systemPrompt string) *Conversation {
+	id := c.newIDLocked()
+	conversation := &Conversation{
+		ID:        id,
+		Messages:  make([]ai.Message, 0),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Metadata:  make(map[string]string),
+	}
+
+	if systemPrompt != "" {
+		conversation.Messages = append(conversation.Messages, ai.Message{
+			Role:    "system",
+			Content: systemPrompt,
+		})
+	}
+
+	c.conversations[id] = conversation
+	c.trackLocked(id)
+	c.changedLocked(conversation)
+	return conversation
+}
+
+// newIDLocked generates an unused conversation ID. Must be called with the
+// controller lock held.
+func (c *Controller) newIDLocked() ConversationID {
+	if c.idGenerator != nil {
+		id := c.idGenerator()
+		if _, taken := c.conversations[id]; id != "" && !taken {
+			return id
+		}
+		c.logger.Warn("ID generator returned an unusable conversation ID", slog.String("conversation_id", string(id)))
+	}
+	return ConversationID(fmt.Sprintf("conv_%d_%d", time.Now().UnixNano(), len(c.conversations)))
+}
+
+// RegisterConversation registers an externally constructed conversation, such
+// as one loaded from disk, so it can be used like any other. The ID must be
+// set and not already in use. Missing timestamps default to now. The
+// controller keeps a deep copy, so later changes to conversation do not
+// affect it.
+func (c *Controller) RegisterConversation(conversation *Conversation) error {
+	if conversation == nil || conversation.ID == "" {
+		return fmt.Errorf("%w: conversation ID is required", ai.ErrInvalidRequest)
+	}
+
+	c.ensureLoaded(conversation.ID)
+	defer c.enforceCapacity()
+	var notifications []thresholdNotification
+	defer func() { notifyThresholds(notifications) }()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, exists := c.conversations[conversation.ID]; exists {
+		return fmt.Errorf("conversation %s already exists", conversation.ID)
+	}
+
+	notifications = c.registerLocked(copyConversation(conversation))
+	return nil
+}
+
+// registerLocked fills in defaults, adds a conversation and writes it to
+// the store, returning the threshold callbacks to run once the lock is
+// released. Must be called with the controller lock held.
+func (c *Controller) registerLocked(conversation *Conversation) []thresholdNotification {
+	notifications := c.installLocked(conversation)
+	c.persistLocked(conversation)
+	return notifications
+}
+
+// installLocked fills in defaults and adds a conversation without writing
+// it to the store, as for one loaded from it, and returns the threshold
+// callbacks to run once the lock is released. Must be called with the
+// controller lock held.
+func (c *Controller) installLocked(conversation *Conversation) []thresholdNotification {
+	now := time.Now()
+	if conversation.CreatedAt.IsZero() {
+		conversation.CreatedAt = now
+	}
+	if conversation.UpdatedAt.IsZero() {
+		conversation.UpdatedAt = conversation.CreatedAt
+	}
+	if conversation.Messages == nil {
+		conversation.Messages = make([]ai.Message, 0)
+	}
+	if conversation.Metadata == nil {
+		conversation.Metadata = make(map[string]string)
+	}
+
+	conversation.Tags = normalizeTags(conversation.Tags)
+	c.autoTitleLocked(conversation)
+
+	c.conversations[conversation.ID] = conversation
+	c.trackLocked(conversation.ID)
+	c.tallyLocked(conversation)
+	return c.checkThresholds(conversation)
+}
+
+// GetConversation returns a snapshot of a conversation. The result is a deep
+// copy, so callers may read or modify it freely without affecting the
+// controller or racing with requests in flight.
+func (c *Controller) GetConversation(id ConversationID) (*Conversation, error) {
+	c.ensureLoaded(id)
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	conversation, exists := c.conversations[id]
+	if !exists {
+		return nil, fmt.Errorf("conversation %s %w", id, ErrConversationNotFound)
+	}
+
+	c.touchLocked(id)
+	return copyConversation(conversation), nil
+}
+
+// lookupConversation returns the stored conversation itself. Its fields must
+// only be touched with the controller lock held.
+func (c *Controller) lookupConversation(id ConversationID) (*Conversation, error) {
+	c.ensureLoaded(id)
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	conversation, exists := c.conversations[id]
+	if !exists {
+		return nil, fmt.Errorf("conversation %s %w", id, ErrConversationNotFound)
+	}
+
+	return conversation, nil
+}
+
+// ListConversations returns snapshots of all conversations, oldest first.
+// Like GetConversation, each is a deep copy.
+func (c *Controller) ListConversations() []*Conversation {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.listLocked()
+}
+
+// listLocked returns copies of all conversations, oldest first. Must be
+// called with the controller lock held.
+func (c *Controller) listLocked() []*Conversation {
+	conversations := make([]*Conversation, 0, len(c.conversations))
+	for _, conv := range c.conversations {
+		conversations = append(conversations, copyConversation(conv))
+	}
+
+	sortConversations(conversations)
+	return conversations
+}
+
+// sortConversations orders conversations oldest first, by ID when they were
+// created at the same time
+func sortConversations(conversations []*Conversation) {
+	sort.Slice(conversations, func(i, j int) bool {
+		if conversations[i].CreatedAt.Equal(conversations[j].CreatedAt) {
+			return conversations[i].ID < conversations[j].ID
+		}
+		return conversations[i].CreatedAt.Before(conversations[j].CreatedAt)
+	})
+}
+
+// DeleteConversation removes a conversation. In safe mode the Confirm token
+// must be passed.
+func (c *Controller) DeleteConversation(id ConversationID, confirm ...ConfirmationToken) error {
+	if err := c.requireConfirmation(confirm); err != nil {
+		return err
+	}
+
+	c.ensureLoaded(id)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, exists := c.conversations[id]; !exists {
+		return fmt.Errorf("conversation %s %w", id, ErrConversationNotFound)
+	}
+
+	c.deleteLocked(id)
+	return nil
+}
+
+// deleteLocked removes a conversation and its per-conversation state,
+// including from the store. Must be called with the controller lock held.
+func (c *Controller) deleteLocked(id ConversationID) {
+	c.unloadLocked(id)
+	c.forgetLocked(id)
+}
+
+// unloadLocked removes a conversation and its per-conversation state from
+// memory, leaving any stored copy in place. Must be called with the
+// controller lock held.
+func (c *Controller) unloadLocked(id ConversationID) {
+	delete(c.conversations, id)
+	c.untallyLocked(id)
+	delete(c.firedThresholds, id)
+	delete(c.toolAllowlists, id)
+	delete(c.lastTurns, id)
+	delete(c.lastUsed, id)
+}
+
+// SendMessage sends a message and gets a response from the AI backend
+func (c *Controller) SendMessage(ctx context.Context, request ChatRequest) (*ChatResponse, error) {
+	start := time.Now()
+
+	pending, err := c.prepareRequest(request)
+	defer c.releaseRequest(pending)
+	if err != nil {
+		c.logFailure(request.ConversationID, request.Model, start, err)
+		if pending == nil {
+			return nil, err
+		}
+		return pending.failure(err), err
+	}
+
+	return c.send(ctx, pending, start)
+}
+
+// send delivers a prepared request to the backend, retrying transient
+// failures, and records the reply in the conversation
+func (c *Controller) send(ctx context.Context, pending *pendingRequest, start time.Time) (*ChatResponse, error) {
+	// Send request to AI backend, retrying transient failures
+	var response *ai.ChatCompletionResponse
+	err := c.withModelFallback(ctx, pending, func(request ai.ChatCompletionRequest) error {
+		var err error
+		response, err = c.backend.ChatCompletion(ctx, request)
+		return err
+	})
+	if err != nil {
+		c.logFailure(pending.conversation.ID, pending.request.Model, start, err)
+		return pending.failure(err), err
+	}
+
+	// Extract assistant message from response
+	if len(response.Choices) == 0 {
+		err := fmt.Errorf("no response choices returned")
+		c.logFailure(pending.conversation.ID, pending.request.Model, start, err)
+		return pending.failure(err), err
+	}
+
+	response, err = c.handleEmptyResponse(ctx, pending, response)
+	if err != nil {
+		c.logFailure(pending.conversation.ID, pending.request.Model, start, err)
+		return pending.failure(err), err
+	}
+
+	chatResponse := c.recordResponse(pending, response)
+	c.logSent(chatResponse, start)
+	c.autoSummarize(ctx, chatResponse)
+	return chatResponse, nil
+}
+
+// pendingRequest is a request that has been added to a conversation and is
+// waiting on the backend
+type pendingRequest struct {
+	conversation *Conversation
+	userMessage  ai.Message
+	request      ai.ChatCompletionRequest
+	// trimmed is the number of messages dropped to fit MaxContextTokens
+	trimmed int
+	// fallbackFrom is the requested model when a fallback model was used
+	fallbackFrom string
+	// active is set while the request counts as in flight
+	active bool
+}
+
+// failure builds the ChatResponse returned alongside err
+func (p *pendingRequest) failure(err error) *ChatResponse {
+	return &ChatResponse{
+		ConversationID:  p.conversation.ID,
+		Message:         p.userMessage,
+		Error:           err.Error(),
+		TrimmedMessages: p.trimmed,
+	}
+}
+
+// prepareRequest appends the user message to the target conversation,
+// creating one if needed, and builds the backend request from its history.
+// The request is built and validated before the conversation is changed, so
+// a request that cannot be sent leaves no trace. A pendingRequest is
+// returned alongside any error that occurs after the conversation was
+// resolved.
+func (c *Controller) prepareRequest(request ChatRequest) (*pendingRequest, error) {
+	// Get or create conversation
+	var conversation *Conversation
+	var err error
+
+	userMessage := newUserMessage(request)
+
+	if request.ConversationID != "" {
+		conversation, err = c.lookupConversation(request.ConversationID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get conversation: %w", err)
+		}
+	}
+
+	// Reject bad input before anything is created, stored or sent
+	if err := c.validateInput(request, userMessage); err != nil {
+		if conversation == nil {
+			return nil, err
+		}
+		return &pendingRequest{conversation: conversation, userMessage: userMessage}, err
+	}
+	if c.storeProcessed {
+		userMessage = applyHooks(c.preprocessors, userMessage)
+	}
+	if conversation == nil {
+		conversation = c.newConversation(request.SystemPrompt)
+	}
+
+	// Build the request and update the conversation atomically
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.conversations[conversation.ID] != conversation {
+		// Deleted or pruned since it was looked up
+		return nil, fmt.Errorf("failed to get conversation: conversation %s %w", conversation.ID, ErrConversationNotFound)
+	}
+
+	pending := &pendingRequest{conversation: conversation, userMessage: userMessage}
+	history := append(slices.Clone(conversation.Messages), userMessage)
+	// The backend gets a copy, so sending never holds the lock
+	history, outbound, trimmed, err := c.trimToBudgetLocked(history)
+	if err != nil {
+		return pending, err
+	}
+	pending.request, err = c.buildRequestLocked(request, outbound, c.toolsForLocked(conversation.ID))
+	if err != nil {
+		return pending, err
+	}
+	pending.trimmed = trimmed
+
+	c.lastTurns[conversation.ID] = turnSettings(request)
+	c.touchLocked(conversation.ID)
+	conversation.Messages = history
+	conversation.UpdatedAt = time.Now()
+	c.autoTitleLocked(conversation)
+	c.changedLocked(conversation)
+	c.beginRequestLocked(pending)
+	return pending, nil
+}
+
+// newUserMessage builds the message a request sends, switching to
+// multimodal content when images are attached
+func newUserMessage(request ChatRequest) ai.Message {
+	if len(request.ImageURLs) == 0 {
+		return ai.Message{Role: "user", Content: request.Message}
+	}
+
+	var parts []ai.ContentPart
+	if request.Message != "" {
+		parts = append(parts, ai.TextPart(request.Message))
+	}
+	for _, url := range request.ImageURLs {
+		parts = append(parts, ai.ImagePart(url))
+	}
+	return ai.NewMultipartMessage("user", parts...)
+}
+
+// validateInput checks a request's message and model parameters on their
+// own, so a request that could never be sent is rejected before a
+// conversation is created for it
+func (c *Controller) validateInput(request ChatRequest, userMessage ai.Message) error {
+	if err := ai.ValidateMessage(userMessage); err != nil {
+		return err
+	}
+
+	messages := []ai.Message{userMessage}
+	if request.ConversationID == "" && request.SystemPrompt != "" {
+		messages = []ai.Message{{Role: "system", Content: request.SystemPrompt}, userMessage}
+	}
+
+	c.mutex.RLock()
+	outbound := c.newRequestLocked(request, messages, nil)
+	c.mutex.RUnlock()
+	return ai.ValidateChatCompletionRequest(outbound)
+}
+
+// outboundLocked preprocesses and compresses a copy of a history into the
+// messages sent to the backend, leaving the stored history unchanged. Blank
+// assistant replies are dropped. Must be called with the controller lock
+// held.
+func (c *Controller) outboundLocked(messages []ai.Message) ([]ai.Message, error) {
+	messages = withoutEmptyReplies(c.preprocessMessages(copyMessages(messages)))
+	if c.compressor != nil {
+		var err error
+		messages, err = c.compressor.Compress(messages)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compress prompt: %w", err)
+		}
+	}
+	return messages, nil
+}
+
+// buildRequestLocked builds the backend request for an outbound history and
+// validates it, so nothing that would be rejected is sent or stored. Must be
+// called with the controller lock held.
+func (c *Controller) buildRequestLocked(request ChatRequest, outbound []ai.Message, tools []ai.Tool) (ai.ChatCompletionRequest, error) {
+	built := c.newRequestLocked(request, outbound, tools)
+	return built, ai.ValidateChatCompletionRequest(built)
+}
+
+// newRequestLocked builds a backend request for messages, applying the
+// request's model parameters over the controller defaults. Must be called
+// with the controller lock held.
+func (c *Controller) newRequestLocked(request ChatRequest, messages []ai.Message, tools []ai.Tool) ai.ChatCompletionRequest {
+	model := request.Model
+	if model == "" {
+		model = c.defaultModel
+	}
+
+	// Request-level overrides win; defaults are copied so the outbound
+	// request never aliases controller state
+	maxTokens := request.MaxTokens
+	if maxTokens == nil {
+		maxTokens = &c.maxTokens
+	}
+	temperature := request.Temperature
+	if temperature == nil {
+		temperature = &c.temperature
+	}
+
+	return ai.ChatCompletionRequest{
+		Model:            model,
+		Messages:         messages,
+		MaxTokens:        copyOptional(maxTokens),
+		Temperature:      copyOptional(temperature),
+		Stop:             slices.Clone(request.Stop),
+		Tools:            tools,
+		PresencePenalty:  copyOptional(request.PresencePenalty),
+		FrequencyPenalty: copyOptional(request.FrequencyPenalty),
+		Seed:             copyOptional(request.Seed),
+	}
+}
+
+// copyOptional returns a copy of an optional parameter, so the outbound
+// request never aliases the caller's value
+func copyOptional[T any](value *T) *T {
+	if value == nil {
+		return nil
+	}
+	copied := *value
+	return &copied
+}
+
+// recordResponse appends the assistant message from a backend response to
+// the conversation, updates usage accounting, and builds the ChatResponse.
+// The response must have at least one choice.
+func (c *Controller) recordResponse(pending *pendingRequest, response *ai.ChatCompletionResponse) *ChatResponse {
+	conversation := pending.conversation
+
+	assistantMessage := response.Choices[0].Message
+	if c.labelTrimmer != nil {
+		assistantMessage.Content = c.labelTrimmer.Trim(assistantMessage.Content)
+	}
+	processedMessage := applyHooks(c.postprocessors, assistantMessage)
+	if c.storeProcessed {
+		assistantMessage = processedMessage
+	}
+
+	servedModel := pending.request.Model
+	if response.Model != "" {
+		servedModel = response.Model
+	}
+	cost, priced := estimateCost(c.pricing, servedModel, response.Usage)
+
+	// Add assistant response to conversation
+	c.mutex.Lock()
+	rejectedCalls, toolErrors := c.rejectDisallowedToolCallsLocked(conversation.ID, assistantMessage.ToolCalls)
+	conversation.Messages = append(conversation.Messages, assistantMessage)
+	conversation.Messages = append(conversation.Messages, toolErrors...)
+	conversation.UpdatedAt = time.Now()
+	conversation.Usage.PromptTokens += response.Usage.PromptTokens
+	conversation.Usage.CompletionTokens += response.Usage.CompletionTokens
+	conversation.Usage.TotalTokens += response.Usage.TotalTokens
+	conversation.EstimatedCostUSD += cost
+	if !priced && response.Usage.TotalTokens > 0 {
+		conversation.PricingUnavailable = true
+	}
+	conversation.LastModel = servedModel
+	c.changedLocked(conversation)
+	notifications := c.checkThresholds(conversation)
+	c.mutex.Unlock()
+
+	notifyThresholds(notifications)
+	c.recordUsage(conversation.ID, servedModel, response.Usage, cost)
+
+	return &ChatResponse{
+		ConversationID:    conversation.ID,
+		Message:           processedMessage,
+		Response:          response,
+		FinishReason:      response.Choices[0].FinishReason,
+		EmptyResponse:     isEmptyResponse(response),
+		LikelyTruncated:   LikelyTruncated(assistantMessage.Content, response.Choices[0].FinishReason),
+		RejectedToolCalls: rejectedCalls,
+		ProviderMetadata:  response.ProviderMetadata,
+		SystemFingerprint: response.SystemFingerprint,
+		TrimmedMessages:   pending.trimmed,
+		Model:             servedModel,
+		FallbackFrom:      pending.fallbackFrom,
+	}
+}
+
+// ClearConversation removes all messages from a conversation except system
+// messages. In safe mode the Confirm token must be passed.
+func (c *Controller) ClearConversation(id ConversationID, confirm ...ConfirmationToken) error {
+	if err := c.requireConfirmation(confirm); err != nil {
+		return err
+	}
+
+	c.ensureLoaded(id)
+	var notifications []thresholdNotification
+	defer func() { notifyThresholds(notifications) }()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	conversation, exists := c.conversations[id]
+	if !exists {
+		return fmt.Errorf("conversation %s %w", id, ErrConversationNotFound)
+	}
+
+	// Keep only system messages
+	systemMessages := make([]ai.Message, 0)
+	for _, msg := range conversation.Messages {
+		if msg.Role == "system" {
+			systemMessages = append(systemMessages, msg)
+		}
+	}
+
+	conversation.Messages = systemMessages
+	conversation.UpdatedAt = time.Now()
+	c.changedLocked(conversation)
+	notifications = c.checkThresholds(conversation)
+
+	return nil
+}
+
+// TruncateConversation keeps the first keep messages of a conversation and
+// discards the rest. In safe mode the Confirm token must be passed.
+func (c *Controller) TruncateConversation(id ConversationID, keep int, confirm ...ConfirmationToken) error {
+	if keep < 0 {
+		return fmt.Errorf("%w: keep cannot be negative, got %d", ai.ErrInvalidRequest, keep)
+	}
+	if err := c.requireConfirmation(confirm); err != nil {
+		return err
+	}
+
+	c.ensureLoaded(id)
+	var notifications []thresholdNotification
+	defer func() { notifyThresholds(notifications) }()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	conversation, exists := c.conversations[id]
+	if !exists {
+		return fmt.Errorf("conversation %s %w", id, ErrConversationNotFound)
+	}
+	if keep >= len(conversation.Messages) {
+		return nil
+	}
+
+	conversation.Messages = conversation.Messages[:keep:keep]
+	conversation.UpdatedAt = time.Now()
+	c.changedLocked(conversation)
+	notifications = c.checkThresholds(conversation)
+
+	return nil
+}
+
+// GetConversationSummary returns a summary of the conversation
+func (c *Controller) GetConversationSummary(id ConversationID) (*ConversationSummary, error) {
+	c.ensureLoaded(id)
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	conversation, exists := c.conversations[id]
+	if !exists {
+		return nil, fmt.Errorf("conversation %s %w", id, ErrConversationNotFound)
+	}
+
+	return c.summarizeLocked(conversation), nil
+}
+
+// summarizeLocked builds the summary of a conversation. Must be called with
+// the controller lock held.
+func (c *Controller) summarizeLocked(conversation *Conversation) *ConversationSummary {
+	var userMessages, assistantMessages, systemMessages int
+
+	for _, msg := range conversation.Messages {
+		switch msg.Role {
+		case "user":
+			userMessages++
+		case "assistant":
+			assistantMessages++
+		case "system":
+			systemMessages++
+		}
+	}
+	totalTokens := c.tokenCounter(conversation.Messages)
+
+	return &ConversationSummary{
+		ID:                   conversation.ID,
+		Title:                conversation.Title,
+		Tags:                 slices.Clone(conversation.Tags),
+		MessageCount:         len(conversation.Messages),
+		UserMessages:         userMessages,
+		AssistantMessages:    assistantMessages,
+		SystemMessages:       systemMessages,
+		EstimatedTokens:      totalTokens,
+		CreatedAt:            conversation.CreatedAt,
+		UpdatedAt:            conversation.UpdatedAt,
+		LastUserMessage:      getLastMessageByRole(conversation.Messages, "user"),
+		LastAssistantMessage: getLastMessageByRole(conversation.Messages, "assistant"),
+		Usage:                conversation.Usage,
+		EstimatedCostUSD:     conversation.EstimatedCostUSD,
+		PricingUnavailable:   conversation.PricingUnavailable,
+		LastModel:            conversation.LastModel,
+	}
+}
+
+// ConversationSummary provides overview information about a conversation
+type ConversationSummary struct {
+	ID                   ConversationID `json:"id"`
+	Title                string         `json:"title,omitempty"`
+	Tags                 []string       `json:"tags,omitempty"`
+	MessageCount         int            `json:"message_count"`
+	UserMessages         int            `json:"user_messages"`
+	AssistantMessages    int            `json:"assistant_messages"`
+	SystemMessages       int            `json:"system_messages"`
+	EstimatedTokens      int            `json:"estimated_tokens"`
+	CreatedAt            time.Time      `json:"created_at"`
+	UpdatedAt            time.Time      `json:"updated_at"`
+	LastUserMessage      string         `json:"last_user_message"`
+	LastAssistantMessage string         `json:"last_assistant_message"`
+	Usage                ai.Usage       `json:"usage"`
+	EstimatedCostUSD     float64        `json:"estimated_cost_usd"`
+	PricingUnavailable   bool           `json:"pricing_unavailable,omitempty"`
+	LastModel            string         `json:"last_model,omitempty"`
+}
+
+// SetBackend allows changing the AI backend at runtime
+func (c *Controller) SetBackend(backend ai.Backend) {
+	c.mutex.Lock()
+	previous := c.backend
+	c.backend = backend
+	c.stats.backendName.Store(backend.Name())
+	c.mutex.Unlock()
+
+	c.invalidateHealth()
+
+	c.logger.Info("backend switched",
+		slog.String("from", previous.Name()),
+		slog.String("to", backend.Name()),
+	)
+}
+
+// SetTemperature changes the temperature of requests that do not set
+// their own
+func (c *Controller) SetTemperature(temperature float64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.temperature = temperature
+}
+
+// SetMaxTokens changes the response token limit of requests that do not
+// set their own
+func (c *Controller) SetMaxTokens(maxTokens int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.maxTokens = maxTokens
+}
+
+// GetBackend returns the current AI backend
+func (c *Controller) GetBackend() ai.Backend {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.backend
+}
+
+// recordUsage forwards a completed request's token usage to the usage recorder
+func (c *Controller) recordUsage(id ConversationID, model string, usage ai.Usage, cost float64) {
+	if c.usageRecorder == nil {
+		return
+	}
+
+	c.usageRecorder.RecordUsage(UsageRecord{
+		Timestamp:        time.Now(),
+		ConversationID:   id,
+		Model:            model,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+		EstimatedCostUSD: cost,
+	})
+}
+
+// copyConversation returns a deep copy of a conversation. Must be called
+// with the controller lock held.
+func copyConversation(conversation *Conversation) *Conversation {
+	copied := *conversation
+	copied.Messages = copyMessages(conversation.Messages)
+	copied.Metadata = make(map[string]string, len(conversation.Metadata))
+	for key, value := range conversation.Metadata {
+		copied.Metadata[key] = value
+	}
+	copied.Tags = slices.Clone(conversation.Tags)
+	if conversation.Compressions != nil {
+		copied.Compressions = append([]CompressionRecord(nil), conversation.Compressions...)
+	}
+	return &copied
+}
+
+// copyMessages returns a deep copy of messages, including their tool calls
+// and content parts
+func copyMessages(messages []ai.Message) []ai.Message {
+	copied := make([]ai.Message, len(messages))
+	for i, msg := range messages {
+		if msg.ToolCalls != nil {
+			msg.ToolCalls = append([]ai.ToolCall(nil), msg.ToolCalls...)
+		}
+		if msg.ContentParts != nil {
+			msg.ContentParts = append([]ai.ContentPart(nil), msg.ContentParts...)
+		}
+		copied[i] = msg
+	}
+	return copied
+}
+
+// Helper function to get the last message of a specific role
+func getLastMessageByRole(messages []ai.Message, role string) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == role {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
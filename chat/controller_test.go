@@ -0,0 +1,1035 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/backends/mock"
+)
+
+// messageCounter counts ten tokens per message so tests can reason about
+// usage in whole messages
+func messageCounter(messages []ai.Message) int {
+	return len(messages) * 10
+}
+
+func sendN(t *testing.T, controller *Controller, id ConversationID, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if _, err := controller.SendMessage(context.Background(), ChatRequest{
+			ConversationID: id,
+			Message:        "ping",
+		}); err != nil {
+			t.Fatalf("SendMessage failed: %v", err)
+		}
+	}
+}
+
+func TestController_OnTokenThreshold(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), &ControllerConfig{
+		DefaultModel:  "gpt-4",
+		MaxTokens:     100,
+		ContextWindow: 100,
+		TokenCounter:  messageCounter,
+	})
+
+	var mu sync.Mutex
+	fired := map[float64][]int{}
+	for _, pct := range []float64{0.8, 0.5} {
+		pct := pct
+		controller.OnTokenThreshold(pct, func(id ConversationID, used, limit int) {
+			mu.Lock()
+			defer mu.Unlock()
+			if limit != 100 {
+				t.Errorf("Expected limit 100, got %d", limit)
+			}
+			fired[pct] = append(fired[pct], used)
+		})
+	}
+
+	conv := controller.CreateConversation("system")
+
+	// system + 2 exchanges = 50 tokens
+	sendN(t, controller, conv.ID, 2)
+	if len(fired[0.5]) != 1 || fired[0.5][0] != 50 {
+		t.Fatalf("Expected 50%% threshold to fire once at 50 tokens, got %v", fired[0.5])
+	}
+	if len(fired[0.8]) != 0 {
+		t.Fatalf("80%% threshold fired early: %v", fired[0.8])
+	}
+
+	// system + 4 exchanges = 90 tokens, 50% must not fire again
+	sendN(t, controller, conv.ID, 2)
+	if len(fired[0.5]) != 1 {
+		t.Errorf("50%% threshold should fire only once, got %v", fired[0.5])
+	}
+	if len(fired[0.8]) != 1 || fired[0.8][0] != 90 {
+		t.Errorf("Expected 80%% threshold to fire once at 90 tokens, got %v", fired[0.8])
+	}
+
+	utilization, err := controller.ContextUtilization(conv.ID)
+	if err != nil {
+		t.Fatalf("ContextUtilization failed: %v", err)
+	}
+	if utilization != 0.9 {
+		t.Errorf("Expected utilization 0.9, got %v", utilization)
+	}
+
+	// Clearing drops usage below both thresholds and re-arms them
+	if err := controller.ClearConversation(conv.ID); err != nil {
+		t.Fatalf("ClearConversation failed: %v", err)
+	}
+	sendN(t, controller, conv.ID, 2)
+	if len(fired[0.5]) != 2 {
+		t.Errorf("Expected 50%% threshold to fire again after clear, got %v", fired[0.5])
+	}
+}
+
+func TestController_OnTokenThreshold_PerConversation(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), &ControllerConfig{
+		DefaultModel:  "gpt-4",
+		MaxTokens:     100,
+		ContextWindow: 30,
+		TokenCounter:  messageCounter,
+	})
+
+	var ids []ConversationID
+	controller.OnTokenThreshold(1.0, func(id ConversationID, used, limit int) {
+		ids = append(ids, id)
+	})
+
+	first := controller.CreateConversation("system")
+	second := controller.CreateConversation("system")
+	sendN(t, controller, first.ID, 1)
+	sendN(t, controller, second.ID, 1)
+
+	if len(ids) != 2 || ids[0] != first.ID || ids[1] != second.ID {
+		t.Errorf("Expected threshold to fire once per conversation, got %v", ids)
+	}
+}
+
+func TestController_OnTokenThreshold_KeepsFiredState(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), &ControllerConfig{
+		DefaultModel:  "gpt-4",
+		MaxTokens:     100,
+		ContextWindow: 100,
+		TokenCounter:  messageCounter,
+	})
+
+	var fired []float64
+	record := func(pct float64) ThresholdFunc {
+		return func(id ConversationID, used, limit int) {
+			fired = append(fired, pct)
+		}
+	}
+
+	if err := controller.OnTokenThreshold(0.5, record(0.5)); err != nil {
+		t.Fatalf("OnTokenThreshold failed: %v", err)
+	}
+	conv := controller.CreateConversation("system")
+	sendN(t, controller, conv.ID, 2)
+
+	// Registering a lower threshold must not re-arm the 50% one
+	if err := controller.OnTokenThreshold(0.3, record(0.3)); err != nil {
+		t.Fatalf("OnTokenThreshold failed: %v", err)
+	}
+	sendN(t, controller, conv.ID, 1)
+	if len(fired) != 2 || fired[0] != 0.5 || fired[1] != 0.3 {
+		t.Errorf("Expected 50%% once and then 30%% once, got %v", fired)
+	}
+
+	for _, pct := range []float64{0, -0.5, 1.5} {
+		if err := controller.OnTokenThreshold(pct, record(pct)); !errors.Is(err, ai.ErrInvalidRequest) {
+			t.Errorf("Expected threshold %v to be rejected, got %v", pct, err)
+		}
+	}
+}
+
+func TestController_OnTokenThreshold_OtherChanges(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), &ControllerConfig{
+		DefaultModel:  "gpt-4",
+		MaxTokens:     100,
+		ContextWindow: 100,
+		TokenCounter:  messageCounter,
+	})
+
+	var ids []ConversationID
+	controller.OnTokenThreshold(0.3, func(id ConversationID, used, limit int) {
+		ids = append(ids, id)
+	})
+
+	// A system prompt added to a 20 token conversation crosses 30%
+	conv := controller.CreateConversation("")
+	sendN(t, controller, conv.ID, 1)
+	if err := controller.SetSystemPrompt(conv.ID, "system"); err != nil {
+		t.Fatalf("SetSystemPrompt failed: %v", err)
+	}
+
+	// A fork starts above the threshold
+	fork, err := controller.ForkConversation(conv.ID)
+	if err != nil {
+		t.Fatalf("ForkConversation failed: %v", err)
+	}
+
+	// So does a registered conversation
+	registered := &Conversation{ID: "registered", Messages: []ai.Message{
+		{Role: "user", Content: "one"},
+		{Role: "assistant", Content: "two"},
+		{Role: "user", Content: "three"},
+	}}
+	if err := controller.RegisterConversation(registered); err != nil {
+		t.Fatalf("RegisterConversation failed: %v", err)
+	}
+
+	want := []ConversationID{conv.ID, fork.ID, registered.ID}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("Expected notifications for %v, got %v", want, ids)
+	}
+}
+
+func TestController_ContextUtilization_NoWindow(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), nil)
+	conv := controller.CreateConversation("system")
+
+	if _, err := controller.ContextUtilization(conv.ID); err == nil {
+		t.Error("Expected error when context window is not configured")
+	}
+
+	if _, err := controller.ContextUtilization("missing"); err == nil {
+		t.Error("Expected error for unknown conversation")
+	}
+}
+
+func TestController_GetContextUsage(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), &ControllerConfig{
+		DefaultModel:       "gpt-4",
+		TokenCounter:       messageCounter,
+		ModelContextLimits: map[string]int{"gpt-4": 100, "gpt-4o": 1000},
+	})
+	conv := controller.CreateConversation("system")
+
+	used, limit, err := controller.GetContextUsage(conv.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if used != 10 || limit != 100 {
+		t.Errorf("Expected 10 of 100 tokens from the default model, got %d of %d", used, limit)
+	}
+
+	// The model that served the last reply decides the limit
+	if _, err := controller.SendMessage(context.Background(), ChatRequest{
+		ConversationID: conv.ID,
+		Message:        "Hello",
+		Model:          "gpt-4o",
+	}); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	used, limit, _ = controller.GetContextUsage(conv.ID)
+	if used != 30 || limit != 1000 {
+		t.Errorf("Expected 30 of 1000 tokens after a gpt-4o reply, got %d of %d", used, limit)
+	}
+
+	if _, _, err := controller.GetContextUsage("missing"); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Expected ErrConversationNotFound, got %v", err)
+	}
+
+	// A configured context window overrides the table, and unknown models
+	// report no limit
+	windowed := NewController(mock.NewMockBackend(), &ControllerConfig{DefaultModel: "gpt-4", ContextWindow: 50})
+	if _, limit, _ := windowed.GetContextUsage(windowed.CreateConversation("").ID); limit != 50 {
+		t.Errorf("Expected ContextWindow to take precedence, got %d", limit)
+	}
+	unknown := NewController(mock.NewMockBackend(), &ControllerConfig{DefaultModel: "unknown-model"})
+	if _, limit, _ := unknown.GetContextUsage(unknown.CreateConversation("").ID); limit != 0 {
+		t.Errorf("Expected no limit for an unknown model, got %d", limit)
+	}
+}
+
+func TestController_SafeMode(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), &ControllerConfig{
+		DefaultModel: "gpt-4",
+		MaxTokens:    100,
+		SafeMode:     true,
+	})
+
+	conv := controller.CreateConversation("system")
+	sendN(t, controller, conv.ID, 1)
+
+	if err := controller.ClearConversation(conv.ID); !errors.Is(err, ErrConfirmationRequired) {
+		t.Errorf("Expected ErrConfirmationRequired from ClearConversation, got %v", err)
+	}
+	if err := controller.DeleteConversation(conv.ID); !errors.Is(err, ErrConfirmationRequired) {
+		t.Errorf("Expected ErrConfirmationRequired from DeleteConversation, got %v", err)
+	}
+	if err := controller.TruncateConversation(conv.ID, 1); !errors.Is(err, ErrConfirmationRequired) {
+		t.Errorf("Expected ErrConfirmationRequired from TruncateConversation, got %v", err)
+	}
+	if _, err := controller.DeleteAll(); !errors.Is(err, ErrConfirmationRequired) {
+		t.Errorf("Expected ErrConfirmationRequired from DeleteAll, got %v", err)
+	}
+
+	// Nothing should have been destroyed
+	stored, err := controller.GetConversation(conv.ID)
+	if err != nil {
+		t.Fatalf("Conversation should still exist: %v", err)
+	}
+	if len(stored.Messages) != 3 {
+		t.Errorf("Expected 3 messages to survive, got %d", len(stored.Messages))
+	}
+
+	if err := controller.TruncateConversation(conv.ID, 2, Confirm); err != nil {
+		t.Errorf("TruncateConversation with confirmation failed: %v", err)
+	}
+	if truncated, _ := controller.GetConversation(conv.ID); len(truncated.Messages) != 2 {
+		t.Errorf("Expected 2 messages after truncating, got %d", len(truncated.Messages))
+	}
+	if err := controller.ClearConversation(conv.ID, Confirm); err != nil {
+		t.Errorf("ClearConversation with confirmation failed: %v", err)
+	}
+	if err := controller.DeleteConversation(conv.ID, Confirm); err != nil {
+		t.Errorf("DeleteConversation with confirmation failed: %v", err)
+	}
+
+	controller.CreateConversation("")
+	controller.CreateConversation("")
+	deleted, err := controller.DeleteAll(Confirm)
+	if err != nil {
+		t.Fatalf("DeleteAll with confirmation failed: %v", err)
+	}
+	if deleted != 2 || len(controller.ListConversations()) != 0 {
+		t.Errorf("Expected DeleteAll to remove 2 conversations, removed %d", deleted)
+	}
+}
+
+func TestController_SafeModeDisabled(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), nil)
+	conv := controller.CreateConversation("system")
+
+	if err := controller.TruncateConversation(conv.ID, 0); err != nil {
+		t.Errorf("TruncateConversation should not require confirmation by default: %v", err)
+	}
+	if err := controller.ClearConversation(conv.ID); err != nil {
+		t.Errorf("ClearConversation should not require confirmation by default: %v", err)
+	}
+	if err := controller.DeleteConversation(conv.ID); err != nil {
+		t.Errorf("DeleteConversation should not require confirmation by default: %v", err)
+	}
+}
+
+func TestController_TruncateConversation(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), nil)
+	conv := controller.CreateConversation("system")
+	sendN(t, controller, conv.ID, 2)
+
+	if err := controller.TruncateConversation(conv.ID, -1); !errors.Is(err, ai.ErrInvalidRequest) {
+		t.Errorf("Expected ErrInvalidRequest for a negative keep, got %v", err)
+	}
+	if err := controller.TruncateConversation(conv.ID, 10); err != nil {
+		t.Errorf("TruncateConversation beyond the end failed: %v", err)
+	}
+	if stored, _ := controller.GetConversation(conv.ID); len(stored.Messages) != 5 {
+		t.Errorf("Expected all 5 messages to be kept, got %d", len(stored.Messages))
+	}
+
+	if err := controller.TruncateConversation(conv.ID, 3); err != nil {
+		t.Fatalf("TruncateConversation failed: %v", err)
+	}
+	stored, _ := controller.GetConversation(conv.ID)
+	if len(stored.Messages) != 3 || stored.Messages[2].Role != "assistant" {
+		t.Errorf("Expected the first exchange to be kept, got %+v", stored.Messages)
+	}
+
+	if err := controller.TruncateConversation("missing", 0); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Expected ErrConversationNotFound, got %v", err)
+	}
+}
+
+func TestController_CompressMessages(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), &ControllerConfig{
+		DefaultModel: "gpt-4",
+		MaxTokens:    100,
+		TokenCounter: messageCounter,
+	})
+
+	conv := controller.CreateConversation("system")
+	sendN(t, controller, conv.ID, 3)
+
+	record, err := controller.CompressMessages(conv.ID, 4, "The user pinged twice.")
+	if err != nil {
+		t.Fatalf("CompressMessages failed: %v", err)
+	}
+	if record.MessagesReplaced != 4 || record.TokensReplaced != 40 {
+		t.Errorf("Expected 4 messages (~40 tokens) replaced, got %+v", record)
+	}
+
+	stored, _ := controller.GetConversation(conv.ID)
+	if len(stored.Messages) != 4 {
+		t.Fatalf("Expected system + summary + last exchange, got %d messages", len(stored.Messages))
+	}
+	if stored.Messages[0].Content != "system" {
+		t.Errorf("System prompt should be preserved, got %q", stored.Messages[0].Content)
+	}
+	if !IsSummary(stored.Messages[1]) {
+		t.Errorf("Expected summary message after system prompt, got %q", stored.Messages[1].Content)
+	}
+
+	// Records persist with the conversation
+	data, err := json.Marshal(stored)
+	if err != nil {
+		t.Fatalf("Failed to marshal conversation: %v", err)
+	}
+	var restored Conversation
+	if err := json.Unmarshal(data, &restored); err != nil {
+		t.Fatalf("Failed to unmarshal conversation: %v", err)
+	}
+	if len(restored.Compressions) != 1 || restored.Compressions[0].MessagesReplaced != 4 {
+		t.Errorf("Compression record should round-trip through JSON, got %+v", restored.Compressions)
+	}
+
+	history, err := controller.GetCompressionHistory(conv.ID)
+	if err != nil || len(history) != 1 {
+		t.Fatalf("Expected one compression record, got %v (err %v)", history, err)
+	}
+	if !strings.Contains(history[0].String(), "summarized 4 messages (~40 tokens)") {
+		t.Errorf("Unexpected record description: %s", history[0])
+	}
+
+	if _, err := controller.CompressMessages(conv.ID, 10, "too many"); err == nil {
+		t.Error("Expected error when compressing more messages than exist")
+	}
+	if _, err := controller.CompressMessages(conv.ID, 1, "  "); err == nil {
+		t.Error("Expected error for empty summary")
+	}
+}
+
+// recordingBackend wraps the mock backend and keeps the requests it receives
+type recordingBackend struct {
+	*mock.MockBackend
+	mutex    sync.Mutex
+	requests []ai.ChatCompletionRequest
+}
+
+func newRecordingBackend() *recordingBackend {
+	return &recordingBackend{MockBackend: mock.NewMockBackend()}
+}
+
+func (r *recordingBackend) ChatCompletion(ctx context.Context, req ai.ChatCompletionRequest) (*ai.ChatCompletionResponse, error) {
+	r.mutex.Lock()
+	r.requests = append(r.requests, req)
+	r.mutex.Unlock()
+	return r.MockBackend.ChatCompletion(ctx, req)
+}
+
+func (r *recordingBackend) lastRequest() ai.ChatCompletionRequest {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.requests[len(r.requests)-1]
+}
+
+func TestController_PromptCompressor(t *testing.T) {
+	backend := newRecordingBackend()
+	controller := NewController(backend, &ControllerConfig{
+		DefaultModel: "gpt-4",
+		MaxTokens:    100,
+		Compressor:   WhitespaceCompressor{},
+	})
+
+	paragraph := "Please   review    this   function   carefully.   \n\tIt  handles\t\tall   the   input   parsing.   "
+	message := strings.Join([]string{paragraph, paragraph, "\n\n\n\n", paragraph, "Thanks!"}, "\n\n")
+
+	conv := controller.CreateConversation("system")
+	if _, err := controller.SendMessage(context.Background(), ChatRequest{
+		ConversationID: conv.ID,
+		Message:        message,
+	}); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+
+	original := []ai.Message{{Role: "user", Content: message}}
+	sent := backend.lastRequest().Messages
+	sentUser := sent[len(sent)-1]
+
+	before := EstimateTokens(original)
+	after := EstimateTokens([]ai.Message{sentUser})
+	if after >= before/2 {
+		t.Errorf("Expected compression to at least halve tokens, went from %d to %d", before, after)
+	}
+
+	want := "Please review this function carefully.\n\tIt handles all the input parsing.\n\nThanks!"
+	if sentUser.Content != want {
+		t.Errorf("Unexpected compressed content:\n%q\nwant:\n%q", sentUser.Content, want)
+	}
+
+	// The stored conversation keeps the original text
+	stored, _ := controller.GetConversation(conv.ID)
+	if stored.Messages[1].Content != message {
+		t.Error("Compressor must not modify the stored conversation")
+	}
+}
+
+func TestController_PromptCompressorError(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), &ControllerConfig{
+		DefaultModel: "gpt-4",
+		MaxTokens:    100,
+		Compressor: PromptCompressorFunc(func(messages []ai.Message) ([]ai.Message, error) {
+			return nil, errors.New("compressor unavailable")
+		}),
+	})
+
+	conv := controller.CreateConversation("system")
+	_, err := controller.SendMessage(context.Background(), ChatRequest{ConversationID: conv.ID, Message: "hi"})
+	if err == nil || !strings.Contains(err.Error(), "compressor unavailable") {
+		t.Errorf("Expected compressor error to be returned, got %v", err)
+	}
+}
+
+func TestController_CreateConversationIdempotent(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), nil)
+
+	first, created, err := controller.CreateConversationIdempotent("retry-key", "system")
+	if err != nil || !created {
+		t.Fatalf("Expected first call to create a conversation, got created=%v err=%v", created, err)
+	}
+
+	second, created, err := controller.CreateConversationIdempotent("retry-key", "system")
+	if err != nil || created {
+		t.Fatalf("Expected retry to reuse the conversation, got created=%v err=%v", created, err)
+	}
+	if second.ID != first.ID {
+		t.Errorf("Expected same conversation ID %s, got %s", first.ID, second.ID)
+	}
+
+	other, _, _ := controller.CreateConversationIdempotent("other-key", "system")
+	if other.ID == first.ID {
+		t.Error("Different keys should create different conversations")
+	}
+
+	if len(controller.ListConversations()) != 2 {
+		t.Errorf("Expected 2 conversations, got %d", len(controller.ListConversations()))
+	}
+
+	if _, _, err := controller.CreateConversationIdempotent("", "system"); err == nil {
+		t.Error("Expected error for empty key")
+	}
+
+	// A deleted conversation frees its key
+	controller.DeleteConversation(first.ID)
+	recreated, created, _ := controller.CreateConversationIdempotent("retry-key", "system")
+	if !created || recreated.ID == first.ID {
+		t.Error("Expected a new conversation once the original was deleted")
+	}
+}
+
+func TestController_CreateConversationIdempotent_Concurrent(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), nil)
+
+	var wg sync.WaitGroup
+	ids := make([]ConversationID, 20)
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conv, _, err := controller.CreateConversationIdempotent("shared", "")
+			if err != nil {
+				t.Errorf("CreateConversationIdempotent failed: %v", err)
+				return
+			}
+			ids[i] = conv.ID
+		}(i)
+	}
+	wg.Wait()
+
+	for _, id := range ids {
+		if id != ids[0] {
+			t.Fatalf("Concurrent calls with one key produced different IDs: %v", ids)
+		}
+	}
+}
+
+func TestController_CreateConversationIdempotent_TTL(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), &ControllerConfig{
+		DefaultModel:   "gpt-4",
+		IdempotencyTTL: time.Millisecond,
+	})
+
+	first, _, _ := controller.CreateConversationIdempotent("key", "")
+	time.Sleep(5 * time.Millisecond)
+	second, created, _ := controller.CreateConversationIdempotent("key", "")
+
+	if !created || second.ID == first.ID {
+		t.Error("Expected key to expire after the TTL")
+	}
+}
+
+func TestController_MaxContextTokens(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), &ControllerConfig{
+		DefaultModel:     "gpt-4",
+		MaxTokens:        100,
+		TokenCounter:     messageCounter,
+		MaxContextTokens: 40,
+	})
+	conv := controller.CreateConversation("You are a test assistant.")
+
+	// system + 2 exchanges = 5 messages; the third send has to make room
+	sendN(t, controller, conv.ID, 2)
+	response, err := controller.SendMessage(context.Background(), ChatRequest{
+		ConversationID: conv.ID,
+		Message:        "third",
+	})
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+
+	if response.TrimmedMessages != 2 {
+		t.Errorf("Expected 2 trimmed messages, got %d", response.TrimmedMessages)
+	}
+
+	got, _ := controller.GetConversation(conv.ID)
+	if got.Messages[0].Role != "system" {
+		t.Errorf("System prompt should be preserved, got %+v", got.Messages[0])
+	}
+	if len(got.Messages) != 5 || got.Messages[3].Content != "third" {
+		t.Errorf("Expected system, last exchange, and new exchange, got %+v", got.Messages)
+	}
+}
+
+func TestController_MaxContextTokens_DropsToolResultsWithCall(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), &ControllerConfig{
+		TokenCounter:     messageCounter,
+		MaxContextTokens: 30,
+	})
+	conv := controller.CreateConversation("system")
+
+	controller.mutex.Lock()
+	history := append(conv.Messages,
+		ai.Message{Role: "assistant", ToolCalls: []ai.ToolCall{{ID: "call_1"}}},
+		ai.Message{Role: "tool", ToolCallID: "call_1", Content: "result"},
+		ai.Message{Role: "assistant", Content: "answer"},
+		ai.Message{Role: "user", Content: "next"},
+	)
+	kept, _, trimmed, err := controller.trimToBudgetLocked(history)
+	controller.mutex.Unlock()
+
+	if err != nil {
+		t.Fatalf("trimToBudgetLocked failed: %v", err)
+	}
+	if trimmed != 2 {
+		t.Errorf("Expected the call and its result to be trimmed together, got %d", trimmed)
+	}
+	for _, msg := range kept {
+		if msg.Role == "tool" {
+			t.Errorf("Orphaned tool result left behind: %+v", kept)
+		}
+	}
+}
+
+func TestController_MaxContextTokens_CompressesFirst(t *testing.T) {
+	// Counts bytes of content, so compression shrinks the estimate
+	byteCounter := func(messages []ai.Message) int {
+		total := 0
+		for _, msg := range messages {
+			total += len(msg.Content)
+		}
+		return total
+	}
+	backend := newRecordingBackend()
+	controller := NewController(backend, &ControllerConfig{
+		TokenCounter:     byteCounter,
+		MaxContextTokens: 40,
+		Compressor:       WhitespaceCompressor{},
+	})
+	conv := controller.CreateConversation("")
+
+	padded := "spaced" + strings.Repeat(" ", 30) + "out"
+	backend.QueueResponse("ok")
+	if _, err := controller.SendMessage(context.Background(), ChatRequest{ConversationID: conv.ID, Message: padded}); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	backend.QueueResponse("ok")
+	response, err := controller.SendMessage(context.Background(), ChatRequest{ConversationID: conv.ID, Message: "next"})
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+
+	// Uncompressed the history is over budget, compressed it fits
+	if response.TrimmedMessages != 0 {
+		t.Errorf("Expected compression to avoid trimming, got %d trimmed", response.TrimmedMessages)
+	}
+	if got, _ := controller.GetConversation(conv.ID); len(got.Messages) != 4 || got.Messages[0].Content != padded {
+		t.Errorf("Expected the full history to be kept, got %+v", got.Messages)
+	}
+	if sent := backend.lastRequest().Messages; len(sent) != 3 || sent[0].Content != "spaced out" {
+		t.Errorf("Expected the compressed history to be sent, got %+v", sent)
+	}
+}
+
+func TestController_MaxContextTokens_Concurrent(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), &ControllerConfig{
+		TokenCounter:     messageCounter,
+		MaxContextTokens: 60,
+	})
+	conv := controller.CreateConversation("system")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := controller.SendMessage(context.Background(), ChatRequest{
+				ConversationID: conv.ID,
+				Message:        "ping",
+			}); err != nil {
+				t.Errorf("SendMessage failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	got, _ := controller.GetConversation(conv.ID)
+	if got.Messages[0].Role != "system" {
+		t.Errorf("System prompt should be preserved, got %+v", got.Messages[0])
+	}
+}
+
+func TestController_SendMessageValidatesRequest(t *testing.T) {
+	backend := newRecordingBackend()
+	controller := NewController(backend, nil)
+	conv := controller.CreateConversation("")
+
+	response, err := controller.SendMessage(context.Background(), ChatRequest{ConversationID: conv.ID})
+	if !errors.Is(err, ai.ErrInvalidRequest) {
+		t.Fatalf("Expected validation error, got %v", err)
+	}
+	if response == nil || response.Error == "" {
+		t.Errorf("Expected response describing the error, got %+v", response)
+	}
+	if len(backend.requests) != 0 {
+		t.Error("Invalid requests should not reach the backend")
+	}
+
+	got, _ := controller.GetConversation(conv.ID)
+	if len(got.Messages) != 0 {
+		t.Errorf("Invalid message should not be stored, got %+v", got.Messages)
+	}
+}
+
+func TestController_StopSequences(t *testing.T) {
+	backend := mock.NewMockBackend()
+	backend.SetLatency(0)
+	backend.QueueResponse("step one\nEND\nstep two")
+	controller := NewController(backend, nil)
+	conv := controller.CreateConversation("")
+
+	response, err := controller.SendMessage(context.Background(), ChatRequest{
+		ConversationID: conv.ID,
+		Message:        "List the steps",
+		Stop:           []string{"END"},
+	})
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	if response.Message.Content != "step one\n" {
+		t.Errorf("Expected reply cut at the stop sequence, got %q", response.Message.Content)
+	}
+
+	_, err = controller.SendMessage(context.Background(), ChatRequest{
+		ConversationID: conv.ID,
+		Message:        "Again",
+		Stop:           []string{"1", "2", "3", "4", "5"},
+	})
+	if !errors.Is(err, ai.ErrInvalidRequest) {
+		t.Errorf("Expected ErrInvalidRequest for five stop sequences, got %v", err)
+	}
+}
+
+func TestController_GetConversationReturnsCopy(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), nil)
+	conv := controller.CreateConversation("system")
+	sendN(t, controller, conv.ID, 1)
+
+	snapshot, err := controller.GetConversation(conv.ID)
+	if err != nil {
+		t.Fatalf("GetConversation failed: %v", err)
+	}
+	snapshot.Messages[0].Content = "tampered"
+	snapshot.Messages = append(snapshot.Messages, ai.Message{Role: "user", Content: "injected"})
+	snapshot.Metadata["tampered"] = "yes"
+
+	listed := controller.ListConversations()
+	listed[0].Messages[1].Content = "tampered"
+
+	stored, _ := controller.GetConversation(conv.ID)
+	if len(stored.Messages) != 3 {
+		t.Errorf("Expected 3 stored messages, got %d", len(stored.Messages))
+	}
+	if stored.Messages[0].Content != "system" || stored.Messages[1].Content != "ping" {
+		t.Errorf("Stored messages should be unaffected, got %+v", stored.Messages)
+	}
+	if _, ok := stored.Metadata["tampered"]; ok {
+		t.Error("Stored metadata should be unaffected")
+	}
+}
+
+func TestController_RegisterConversationKeepsCopy(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), nil)
+	conv := &Conversation{
+		ID:       "loaded",
+		Messages: []ai.Message{{Role: "user", Content: "hello"}},
+	}
+	if err := controller.RegisterConversation(conv); err != nil {
+		t.Fatalf("RegisterConversation failed: %v", err)
+	}
+
+	conv.Messages[0].Content = "tampered"
+	conv.Title = "tampered"
+
+	stored, _ := controller.GetConversation("loaded")
+	if stored.Messages[0].Content != "hello" || stored.Title == "tampered" {
+		t.Errorf("Stored conversation should be unaffected, got %+v", stored)
+	}
+}
+
+func TestController_GetConversationConcurrentWithSend(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), nil)
+	conv := controller.CreateConversation("system")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := controller.SendMessage(context.Background(), ChatRequest{
+				ConversationID: conv.ID,
+				Message:        "ping",
+			}); err != nil {
+				t.Errorf("SendMessage failed: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				snapshot, err := controller.GetConversation(conv.ID)
+				if err != nil {
+					t.Errorf("GetConversation failed: %v", err)
+					return
+				}
+				snapshot.Messages = append(snapshot.Messages[:1], ai.Message{Role: "user", Content: "local"})
+				time.Sleep(time.Millisecond)
+			}
+		}()
+	}
+	wg.Wait()
+
+	stored, _ := controller.GetConversation(conv.ID)
+	if len(stored.Messages) != 9 {
+		t.Errorf("Expected 9 stored messages, got %d", len(stored.Messages))
+	}
+}
+
+func TestController_Logger(t *testing.T) {
+	var logs bytes.Buffer
+	controller := NewController(mock.NewMockBackend(), &ControllerConfig{
+		Logger: slog.New(slog.NewTextHandler(&logs, nil)),
+	})
+	conv := controller.CreateConversation("")
+	sendN(t, controller, conv.ID, 1)
+
+	output := logs.String()
+	for _, want := range []string{
+		`msg="message sent"`, "conversation_id=" + string(conv.ID), "model=gpt-4", "tokens=", "duration_ms=",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected log to contain %q, got: %s", want, output)
+		}
+	}
+
+	if _, err := controller.SendMessage(context.Background(), ChatRequest{ConversationID: "missing", Message: "hi"}); err == nil {
+		t.Fatal("Expected error for unknown conversation")
+	}
+	if !strings.Contains(logs.String(), `msg="message failed"`) {
+		t.Errorf("Expected failure to be logged, got: %s", logs.String())
+	}
+
+	backend := mock.NewMockBackend()
+	backend.Configure(map[string]interface{}{"name": "OtherAI"})
+	controller.SetBackend(backend)
+	if !strings.Contains(logs.String(), `msg="backend switched" from=MockAI to=OtherAI`) {
+		t.Errorf("Expected backend switch to be logged, got: %s", logs.String())
+	}
+}
+
+func TestController_SendMessageWithImages(t *testing.T) {
+	backend := newRecordingBackend()
+	controller := NewController(backend, &ControllerConfig{DefaultModel: "gpt-4o", MaxTokens: 100})
+	conv := controller.CreateConversation("")
+
+	response, err := controller.SendMessage(context.Background(), ChatRequest{
+		ConversationID: conv.ID,
+		Message:        "What is in this picture?",
+		ImageURLs:      []string{"https://example.com/cat.png"},
+	})
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	if !strings.Contains(response.Message.Content, "with 1 image(s)") {
+		t.Errorf("Expected the image to reach the backend, got %q", response.Message.Content)
+	}
+
+	stored, _ := controller.GetConversation(conv.ID)
+	user := stored.Messages[0]
+	if user.Content != "What is in this picture?" || !user.HasImages() {
+		t.Errorf("Expected a multimodal user message, got %+v", user)
+	}
+
+	// Text-only models reject images before anything is sent
+	sent := len(backend.requests)
+	_, err = controller.SendMessage(context.Background(), ChatRequest{
+		ConversationID: conv.ID,
+		Message:        "And this one?",
+		Model:          "gpt-3.5-turbo",
+		ImageURLs:      []string{"https://example.com/dog.png"},
+	})
+	if !errors.Is(err, ai.ErrInvalidRequest) || !strings.Contains(err.Error(), "does not accept images") {
+		t.Errorf("Expected a text-only model to reject images, got %v", err)
+	}
+	if len(backend.requests) != sent {
+		t.Errorf("Expected no request to reach the backend")
+	}
+}
+
+func TestController_InvalidRequestLeavesNoTrace(t *testing.T) {
+	backend := newRecordingBackend()
+	controller := NewController(backend, nil)
+	conv := controller.CreateConversation("")
+
+	presence := 5.0
+	_, err := controller.SendMessage(context.Background(), ChatRequest{
+		ConversationID:  conv.ID,
+		Message:         "hello",
+		PresencePenalty: &presence,
+	})
+	if !errors.Is(err, ai.ErrInvalidRequest) {
+		t.Fatalf("Expected an out of range penalty to be rejected, got %v", err)
+	}
+	if got, _ := controller.GetConversation(conv.ID); len(got.Messages) != 0 {
+		t.Errorf("Expected the rejected message not to be stored, got %+v", got.Messages)
+	}
+
+	// Requests for a new conversation do not create one when rejected
+	for _, request := range []ChatRequest{
+		{Message: ""},
+		{Message: "hello", PresencePenalty: &presence},
+		{Message: "hello", Stop: []string{""}},
+	} {
+		if _, err := controller.SendMessage(context.Background(), request); !errors.Is(err, ai.ErrInvalidRequest) {
+			t.Errorf("Expected %+v to be rejected, got %v", request, err)
+		}
+	}
+	if conversations := controller.ListConversations(); len(conversations) != 1 {
+		t.Errorf("Expected no new conversations, got %d", len(conversations))
+	}
+	if len(backend.requests) != 0 {
+		t.Error("Invalid requests should not reach the backend")
+	}
+}
+
+func TestController_RejectedImageIsNotStored(t *testing.T) {
+	backend := newRecordingBackend()
+	controller := NewController(backend, nil)
+	conv := controller.CreateConversation("")
+
+	// The default gpt-4 model is text-only
+	_, err := controller.SendMessage(context.Background(), ChatRequest{
+		ConversationID: conv.ID,
+		Message:        "What is this?",
+		ImageURLs:      []string{"https://example.com/cat.png"},
+	})
+	if !errors.Is(err, ai.ErrInvalidRequest) {
+		t.Fatalf("Expected the image to be rejected, got %v", err)
+	}
+	if got, _ := controller.GetConversation(conv.ID); len(got.Messages) != 0 {
+		t.Errorf("Expected the rejected message not to be stored, got %+v", got.Messages)
+	}
+
+	// The conversation stays usable
+	if _, err := controller.SendMessage(context.Background(), ChatRequest{
+		ConversationID: conv.ID,
+		Message:        "Just text then",
+	}); err != nil {
+		t.Fatalf("Expected a plain message to be sent after the rejection, got %v", err)
+	}
+	if got, _ := controller.GetConversation(conv.ID); len(got.Messages) != 2 || got.Messages[0].HasImages() {
+		t.Errorf("Expected only the plain exchange, got %+v", got.Messages)
+	}
+}
+
+func TestController_RequestOverridesReachBackend(t *testing.T) {
+	backend := newRecordingBackend()
+	backend.SetLatency(0)
+	controller := NewController(backend, &ControllerConfig{
+		DefaultModel: "gpt-4",
+		MaxTokens:    500,
+		Temperature:  0.7,
+	})
+	conv := controller.CreateConversation("")
+
+	maxTokens := 42
+	temperature := 0.0
+	presence := 1.5
+	seed := 3
+	response, err := controller.SendMessage(context.Background(), ChatRequest{
+		ConversationID:  conv.ID,
+		Message:         "Be precise",
+		MaxTokens:       &maxTokens,
+		Temperature:     &temperature,
+		PresencePenalty: &presence,
+		Seed:            &seed,
+	})
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	if response.SystemFingerprint != "fp_mock" {
+		t.Errorf("Expected the backend's system fingerprint, got %q", response.SystemFingerprint)
+	}
+
+	sent := backend.lastRequest()
+	if sent.Seed == nil || *sent.Seed != 3 {
+		t.Errorf("Expected seed 3, got %v", sent.Seed)
+	}
+	if sent.PresencePenalty == nil || *sent.PresencePenalty != 1.5 || sent.FrequencyPenalty != nil {
+		t.Errorf("Expected presence penalty 1.5 and no frequency penalty, got %v and %v", sent.PresencePenalty, sent.FrequencyPenalty)
+	}
+	if sent.MaxTokens == nil || *sent.MaxTokens != 42 {
+		t.Errorf("Expected max_tokens override of 42, got %v", sent.MaxTokens)
+	}
+	if sent.Temperature == nil || *sent.Temperature != 0 {
+		t.Errorf("Expected temperature override of 0, got %v", sent.Temperature)
+	}
+
+	if _, err := controller.SendMessage(context.Background(), ChatRequest{
+		ConversationID: conv.ID,
+		Message:        "Use the defaults",
+	}); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+
+	sent = backend.lastRequest()
+	if sent.PresencePenalty != nil || sent.Seed != nil {
+		t.Errorf("Expected penalties and seed to stay unset by default, got %v and %v", sent.PresencePenalty, sent.Seed)
+	}
+	if sent.MaxTokens == nil || *sent.MaxTokens != 500 {
+		t.Errorf("Expected default max_tokens of 500, got %v", sent.MaxTokens)
+	}
+	if sent.Temperature == nil || *sent.Temperature != 0.7 {
+		t.Errorf("Expected default temperature of 0.7, got %v", sent.Temperature)
+	}
+}
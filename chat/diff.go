@@ -0,0 +1,76 @@
+package chat
+
+import (
+	"fmt"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// DiffStatus describes how a message differs between two conversations
+type DiffStatus string
+
+const (
+	// DiffEqual means both conversations have the same message at an index
+	DiffEqual DiffStatus = "equal"
+	// DiffAdded means only the second conversation has a message at an index
+	DiffAdded DiffStatus = "added"
+	// DiffRemoved means only the first conversation has a message at an index
+	DiffRemoved DiffStatus = "removed"
+	// DiffChanged means the conversations have different messages at an index
+	DiffChanged DiffStatus = "changed"
+)
+
+// DiffEntry compares the messages two conversations hold at one index. A
+// is nil for added entries and B is nil for removed ones.
+type DiffEntry struct {
+	Index  int         `json:"index"`
+	Status DiffStatus  `json:"status"`
+	A      *ai.Message `json:"a,omitempty"`
+	B      *ai.Message `json:"b,omitempty"`
+}
+
+// DiffConversations aligns the messages of two conversations by index and
+// reports whether each pair is equal, changed, or present in only one of
+// them. Messages are compared by role and content, so it is most useful for
+// comparing a fork with the conversation it was branched from.
+func (c *Controller) DiffConversations(a, b ConversationID) ([]DiffEntry, error) {
+	c.ensureLoaded(a)
+	c.ensureLoaded(b)
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	first, exists := c.conversations[a]
+	if !exists {
+		return nil, fmt.Errorf("conversation %s %w", a, ErrConversationNotFound)
+	}
+	second, exists := c.conversations[b]
+	if !exists {
+		return nil, fmt.Errorf("conversation %s %w", b, ErrConversationNotFound)
+	}
+
+	return diffMessages(copyMessages(first.Messages), copyMessages(second.Messages)), nil
+}
+
+// diffMessages compares two message lists index by index
+func diffMessages(a, b []ai.Message) []DiffEntry {
+	entries := make([]DiffEntry, 0, max(len(a), len(b)))
+	for i := 0; i < len(a) || i < len(b); i++ {
+		entry := DiffEntry{Index: i}
+		switch {
+		case i >= len(a):
+			entry.Status = DiffAdded
+			entry.B = &b[i]
+		case i >= len(b):
+			entry.Status = DiffRemoved
+			entry.A = &a[i]
+		default:
+			entry.A, entry.B = &a[i], &b[i]
+			entry.Status = DiffChanged
+			if a[i].Role == b[i].Role && a[i].Content == b[i].Content {
+				entry.Status = DiffEqual
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
@@ -0,0 +1,80 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/backends/mock"
+)
+
+func TestDiffConversations(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), nil)
+	parent := controller.CreateConversation("You are helpful.")
+	if _, err := controller.SendMessage(context.Background(), ChatRequest{ConversationID: parent.ID, Message: "Plan a trip"}); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+
+	fork, err := controller.ForkConversation(parent.ID)
+	if err != nil {
+		t.Fatalf("ForkConversation failed: %v", err)
+	}
+	live, err := controller.lookupConversation(fork.ID)
+	if err != nil {
+		t.Fatalf("lookupConversation failed: %v", err)
+	}
+	controller.mutex.Lock()
+	live.Messages[1].Content = "Plan a hike"
+	live.Messages = append(live.Messages, ai.Message{Role: "user", Content: "Somewhere warm"})
+	controller.mutex.Unlock()
+
+	entries, err := controller.DiffConversations(parent.ID, fork.ID)
+	if err != nil {
+		t.Fatalf("DiffConversations failed: %v", err)
+	}
+
+	want := []DiffStatus{DiffEqual, DiffChanged, DiffEqual, DiffAdded}
+	if len(entries) != len(want) {
+		t.Fatalf("Expected %d entries, got %d", len(want), len(entries))
+	}
+	for i, entry := range entries {
+		if entry.Index != i || entry.Status != want[i] {
+			t.Errorf("Expected entry %d to be %s, got %d %s", i, want[i], entry.Index, entry.Status)
+		}
+	}
+	if entries[1].A.Content != "Plan a trip" || entries[1].B.Content != "Plan a hike" {
+		t.Errorf("Expected changed entry to hold both messages, got %+v", entries[1])
+	}
+	if entries[3].A != nil || entries[3].B.Content != "Somewhere warm" {
+		t.Errorf("Expected added entry to hold only the second message, got %+v", entries[3])
+	}
+
+	// Swapping the arguments turns additions into removals
+	entries, err = controller.DiffConversations(fork.ID, parent.ID)
+	if err != nil {
+		t.Fatalf("DiffConversations failed: %v", err)
+	}
+	if last := entries[len(entries)-1]; last.Status != DiffRemoved || last.B != nil {
+		t.Errorf("Expected last entry to be removed, got %+v", last)
+	}
+}
+
+func TestDiffConversationsComparesRole(t *testing.T) {
+	entries := diffMessages(
+		[]ai.Message{{Role: "user", Content: "same"}},
+		[]ai.Message{{Role: "assistant", Content: "same"}},
+	)
+	if entries[0].Status != DiffChanged {
+		t.Errorf("Expected messages with different roles to be changed, got %s", entries[0].Status)
+	}
+}
+
+func TestDiffConversationsNotFound(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), nil)
+	conv := controller.CreateConversation("")
+
+	if _, err := controller.DiffConversations(conv.ID, "missing"); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Expected ErrConversationNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// ErrEmptyResponse is returned by SendMessage when the backend replies with
+// no content, such as a content-filtered response, and the EmptyResponses
+// policy does not store it
+var ErrEmptyResponse = errors.New("empty response")
+
+// EmptyResponsePolicy decides what SendMessage does with a reply that has
+// neither content nor tool calls
+type EmptyResponsePolicy string
+
+const (
+	// EmptyResponseStore records the blank reply like any other, with
+	// ChatResponse.EmptyResponse set. This is the default. Stored blank
+	// replies are left out of later requests, which backends reject.
+	EmptyResponseStore EmptyResponsePolicy = "store"
+
+	// EmptyResponseRetry sends the request once more and fails with
+	// ErrEmptyResponse if the second reply is empty too
+	EmptyResponseRetry EmptyResponsePolicy = "retry"
+
+	// EmptyResponseError fails with ErrEmptyResponse without storing the
+	// reply
+	EmptyResponseError EmptyResponsePolicy = "error"
+)
+
+// isEmptyResponse reports whether the first choice of a response carries
+// no text and no tool calls. Whitespace counts as empty.
+func isEmptyResponse(response *ai.ChatCompletionResponse) bool {
+	message := response.Choices[0].Message
+	return strings.TrimSpace(message.Content) == "" && len(message.ToolCalls) == 0
+}
+
+// withoutEmptyReplies drops assistant messages that carry no text and no
+// tool calls, as stored under EmptyResponseStore, from an outbound history
+func withoutEmptyReplies(messages []ai.Message) []ai.Message {
+	return slices.DeleteFunc(messages, func(msg ai.Message) bool {
+		return msg.Role == "assistant" && strings.TrimSpace(msg.Content) == "" &&
+			len(msg.ContentParts) == 0 && len(msg.ToolCalls) == 0
+	})
+}
+
+// emptyResponseError describes an empty reply, including the finish reason
+// that may explain it, e.g. "content_filter"
+func emptyResponseError(response *ai.ChatCompletionResponse) error {
+	return fmt.Errorf("%w: backend returned no content (finish reason %q)", ErrEmptyResponse, response.Choices[0].FinishReason)
+}
+
+// handleEmptyResponse applies the EmptyResponses policy to a response with
+// at least one choice. It returns the response to record, which is the
+// retried one if a retry produced content.
+func (c *Controller) handleEmptyResponse(ctx context.Context, pending *pendingRequest, response *ai.ChatCompletionResponse) (*ai.ChatCompletionResponse, error) {
+	if !isEmptyResponse(response) {
+		return response, nil
+	}
+
+	switch c.emptyResponses {
+	case EmptyResponseRetry:
+		c.logger.Warn("empty response, retrying",
+			slog.String("conversation_id", string(pending.conversation.ID)),
+			slog.String("model", pending.request.Model),
+			slog.String("finish_reason", response.Choices[0].FinishReason),
+		)
+
+		var retried *ai.ChatCompletionResponse
+		err := c.withRetry(ctx, func() error {
+			var err error
+			retried, err = c.backend.ChatCompletion(ctx, pending.request)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(retried.Choices) == 0 {
+			return nil, fmt.Errorf("no response choices returned")
+		}
+		if isEmptyResponse(retried) {
+			return nil, emptyResponseError(retried)
+		}
+		return retried, nil
+	case EmptyResponseError:
+		return nil, emptyResponseError(response)
+	default:
+		return response, nil
+	}
+}
@@ -0,0 +1,163 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/backends/mock"
+)
+
+// newEmptyResponseController returns a controller whose backend replies
+// with the scripted responses in order
+func newEmptyResponseController(policy EmptyResponsePolicy, responses ...string) (*Controller, *recordingBackend) {
+	backend := newRecordingBackend()
+	backend.SetLatency(0)
+	backend.SetResponses(responses)
+	return NewController(backend, &ControllerConfig{EmptyResponses: policy}), backend
+}
+
+func TestController_EmptyResponseStore(t *testing.T) {
+	controller, _ := newEmptyResponseController("", "  \n")
+	conv := controller.CreateConversation("")
+
+	response, err := controller.SendMessage(context.Background(), ChatRequest{ConversationID: conv.ID, Message: "hi"})
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	if !response.EmptyResponse || response.FinishReason != "stop" {
+		t.Errorf("Expected an empty response flagged with its finish reason, got %+v", response)
+	}
+
+	stored, _ := controller.GetConversation(conv.ID)
+	if len(stored.Messages) != 2 {
+		t.Errorf("Expected the blank reply to be stored by default, got %+v", stored.Messages)
+	}
+}
+
+func TestController_EmptyResponseStore_NextMessage(t *testing.T) {
+	controller, backend := newEmptyResponseController("", "", "back again")
+	conv := controller.CreateConversation("")
+
+	if _, err := controller.SendMessage(context.Background(), ChatRequest{ConversationID: conv.ID, Message: "hi"}); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	response, err := controller.SendMessage(context.Background(), ChatRequest{ConversationID: conv.ID, Message: "still there?"})
+	if err != nil {
+		t.Fatalf("Expected a send after an empty reply to succeed, got %v", err)
+	}
+	if response.Message.Content != "back again" {
+		t.Errorf("Expected the second reply, got %+v", response.Message)
+	}
+
+	for _, msg := range backend.lastRequest().Messages {
+		if msg.Role == "assistant" {
+			t.Errorf("Expected the blank reply to be left out of the request, got %+v", backend.lastRequest().Messages)
+		}
+	}
+	stored, _ := controller.GetConversation(conv.ID)
+	if len(stored.Messages) != 4 {
+		t.Errorf("Expected the blank reply to stay in the history, got %+v", stored.Messages)
+	}
+}
+
+func TestController_EmptyResponseError(t *testing.T) {
+	controller, _ := newEmptyResponseController(EmptyResponseError, "")
+	conv := controller.CreateConversation("")
+
+	response, err := controller.SendMessage(context.Background(), ChatRequest{ConversationID: conv.ID, Message: "hi"})
+	if !errors.Is(err, ErrEmptyResponse) {
+		t.Fatalf("Expected ErrEmptyResponse, got %v", err)
+	}
+	if response == nil || response.Error == "" {
+		t.Errorf("Expected a response describing the error, got %+v", response)
+	}
+
+	stored, _ := controller.GetConversation(conv.ID)
+	for _, msg := range stored.Messages {
+		if msg.Role == "assistant" {
+			t.Errorf("Expected no assistant reply to be stored, got %+v", stored.Messages)
+		}
+	}
+}
+
+func TestController_EmptyResponseRetry(t *testing.T) {
+	controller, backend := newEmptyResponseController(EmptyResponseRetry, "", "second try")
+	conv := controller.CreateConversation("")
+
+	response, err := controller.SendMessage(context.Background(), ChatRequest{ConversationID: conv.ID, Message: "hi"})
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	if response.Message.Content != "second try" || response.EmptyResponse {
+		t.Errorf("Expected the retried reply, got %+v", response)
+	}
+	if len(backend.requests) != 2 {
+		t.Errorf("Expected one retry, got %d requests", len(backend.requests))
+	}
+
+	backend.SetResponses([]string{"", " "})
+	_, err = controller.SendMessage(context.Background(), ChatRequest{ConversationID: conv.ID, Message: "again"})
+	if !errors.Is(err, ErrEmptyResponse) {
+		t.Errorf("Expected ErrEmptyResponse after two empty replies, got %v", err)
+	}
+	if len(backend.requests) != 4 {
+		t.Errorf("Expected a single retry, got %d requests in total", len(backend.requests))
+	}
+}
+
+func TestController_EmptyResponseToolCall(t *testing.T) {
+	backend := mock.NewMockBackend()
+	backend.SetLatency(0)
+	controller := NewController(backend, &ControllerConfig{EmptyResponses: EmptyResponseError})
+	conv := controller.CreateConversation("")
+
+	// A tool call has no content but is not an empty response
+	response, err := controller.SendMessage(context.Background(), ChatRequest{ConversationID: conv.ID, Message: `call:get_weather {"city":"Paris"}`})
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	if response.EmptyResponse || response.FinishReason != "tool_calls" {
+		t.Errorf("Expected a tool call response, got %+v", response)
+	}
+}
+
+func TestController_EmptyResponseStream(t *testing.T) {
+	controller, backend := newEmptyResponseController(EmptyResponseError, "")
+	conv := controller.CreateConversation("")
+
+	events, err := controller.SendMessageStream(context.Background(), ChatRequest{ConversationID: conv.ID, Message: "hi"})
+	if err != nil {
+		t.Fatalf("SendMessageStream failed: %v", err)
+	}
+	_, final := collect(t, events)
+	if !errors.Is(final.Err, ErrEmptyResponse) {
+		t.Fatalf("Expected ErrEmptyResponse from the stream, got %v", final.Err)
+	}
+	stored, _ := controller.GetConversation(conv.ID)
+	for _, msg := range stored.Messages {
+		if msg.Role == "assistant" {
+			t.Errorf("Expected no assistant reply to be stored, got %+v", stored.Messages)
+		}
+	}
+
+	// With retry, the retried reply is passed on as a delta and stored
+	controller, backend = newEmptyResponseController(EmptyResponseRetry, "", "second try")
+	conv = controller.CreateConversation("")
+	events, err = controller.SendMessageStream(context.Background(), ChatRequest{ConversationID: conv.ID, Message: "again"})
+	if err != nil {
+		t.Fatalf("SendMessageStream failed: %v", err)
+	}
+	deltas, final := collect(t, events)
+	if final.Err != nil || final.Response.Message.Content != "second try" {
+		t.Fatalf("Expected the retried reply, got %+v (%v)", final.Response, final.Err)
+	}
+	if strings.Join(deltas, "") != "second try" {
+		t.Errorf("Expected the retried reply as a delta, got %q", deltas)
+	}
+	// Only ChatCompletion is recorded, not the stream
+	if len(backend.requests) != 1 {
+		t.Errorf("Expected one retry without streaming, got %d requests", len(backend.requests))
+	}
+}
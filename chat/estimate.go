@@ -0,0 +1,57 @@
+package chat
+
+import (
+	"fmt"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// TokenEstimate projects the token usage and cost of a message without
+// sending it
+type TokenEstimate struct {
+	Model string `json:"model"`
+	// PromptTokens covers the system prompt, the history, and the new message
+	PromptTokens int `json:"prompt_tokens"`
+	// MaxCompletionTokens is the completion ceiling set by MaxTokens
+	MaxCompletionTokens int `json:"max_completion_tokens"`
+	// EstimatedCostUSD is the worst-case cost, assuming the full completion
+	// ceiling is used
+	EstimatedCostUSD float64 `json:"estimated_cost_usd"`
+	// Priced is false when the model has no pricing entry
+	Priced bool `json:"priced"`
+}
+
+// EstimateRequest projects what sending message to a conversation would
+// cost, using the same token counter and pricing table as real sends. The
+// backend is not called and the conversation is not modified.
+func (c *Controller) EstimateRequest(id ConversationID, message string) (TokenEstimate, error) {
+	userMessage := ai.Message{Role: "user", Content: message}
+	if err := ai.ValidateMessage(userMessage); err != nil {
+		return TokenEstimate{}, err
+	}
+
+	c.ensureLoaded(id)
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	conversation, exists := c.conversations[id]
+	if !exists {
+		return TokenEstimate{}, fmt.Errorf("conversation %s %w", id, ErrConversationNotFound)
+	}
+
+	messages := make([]ai.Message, len(conversation.Messages), len(conversation.Messages)+1)
+	copy(messages, conversation.Messages)
+	messages = append(messages, userMessage)
+
+	estimate := TokenEstimate{
+		Model:               c.defaultModel,
+		PromptTokens:        c.tokenCounter(messages),
+		MaxCompletionTokens: c.maxTokens,
+	}
+	estimate.EstimatedCostUSD, estimate.Priced = estimateCost(c.pricing, c.defaultModel, ai.Usage{
+		PromptTokens:     estimate.PromptTokens,
+		CompletionTokens: estimate.MaxCompletionTokens,
+	})
+
+	return estimate, nil
+}
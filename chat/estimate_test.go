@@ -0,0 +1,67 @@
+package chat
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/backends/mock"
+)
+
+func TestController_EstimateRequest(t *testing.T) {
+	backend := newRecordingBackend()
+	controller := NewController(backend, &ControllerConfig{
+		DefaultModel: "gpt-4",
+		MaxTokens:    100,
+		TokenCounter: messageCounter,
+	})
+
+	conv := controller.CreateConversation("system")
+	estimate, err := controller.EstimateRequest(conv.ID, "Hello")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// System prompt plus the new message, at 10 tokens each
+	if estimate.PromptTokens != 20 {
+		t.Errorf("Expected 20 prompt tokens, got %d", estimate.PromptTokens)
+	}
+	if estimate.MaxCompletionTokens != 100 {
+		t.Errorf("Expected completion ceiling of 100, got %d", estimate.MaxCompletionTokens)
+	}
+
+	// 20/1000*0.03 + 100/1000*0.06
+	if !estimate.Priced || math.Abs(estimate.EstimatedCostUSD-0.0066) > 1e-9 {
+		t.Errorf("Expected priced estimate of $0.0066, got %+v", estimate)
+	}
+
+	if len(backend.requests) != 0 {
+		t.Errorf("Expected backend not to be called, got %d requests", len(backend.requests))
+	}
+	stored, _ := controller.GetConversation(conv.ID)
+	if len(stored.Messages) != 1 {
+		t.Errorf("Expected conversation to be unchanged, got %d messages", len(stored.Messages))
+	}
+}
+
+func TestController_EstimateRequestErrors(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), &ControllerConfig{DefaultModel: "unpriced"})
+
+	if _, err := controller.EstimateRequest("missing", "Hello"); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Expected ErrConversationNotFound, got %v", err)
+	}
+
+	conv := controller.CreateConversation("")
+	if _, err := controller.EstimateRequest(conv.ID, ""); !errors.Is(err, ai.ErrInvalidRequest) {
+		t.Errorf("Expected ErrInvalidRequest for empty message, got %v", err)
+	}
+
+	estimate, err := controller.EstimateRequest(conv.ID, "Hello")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if estimate.Priced || estimate.EstimatedCostUSD != 0 {
+		t.Errorf("Expected unpriced estimate, got %+v", estimate)
+	}
+}
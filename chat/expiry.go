@@ -0,0 +1,134 @@
+package chat
+
+import (
+	"log/slog"
+	"time"
+)
+
+// DefaultPruneInterval is how often the background pruner runs unless
+// ControllerConfig.PruneInterval is set
+const DefaultPruneInterval = time.Minute
+
+// PruneExpired deletes every conversation that has gone longer than
+// ConversationTTL without an update, from memory and from the store,
+// including those only in the store, and returns how many were removed.
+// Conversations with a request in flight are kept. It does nothing when no
+// TTL is configured.
+func (c *Controller) PruneExpired() int {
+	if c.conversationTTL <= 0 {
+		return 0
+	}
+
+	stored := c.storedConversations()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	cutoff := time.Now().Add(-c.conversationTTL)
+	pruned := 0
+	for id, conversation := range c.conversations {
+		if c.inFlight[id] > 0 || !conversation.UpdatedAt.Before(cutoff) {
+			continue
+		}
+		c.deleteLocked(id)
+		pruned++
+	}
+	if c.writer != nil {
+		for id, conversation := range c.writer.overlay(stored) {
+			if _, loaded := c.conversations[id]; loaded || c.inFlight[id] > 0 || !conversation.UpdatedAt.Before(cutoff) {
+				continue
+			}
+			c.forgetLocked(id)
+			pruned++
+		}
+	}
+
+	if pruned > 0 {
+		c.logger.Info("pruned expired conversations", slog.Int("count", pruned))
+	}
+	return pruned
+}
+
+// expiredLocked reports whether a conversation has gone longer than
+// ConversationTTL without an update. Must be called with the controller
+// lock held.
+func (c *Controller) expiredLocked(conversation *Conversation) bool {
+	return c.conversationTTL > 0 && time.Since(conversation.UpdatedAt) > c.conversationTTL
+}
+
+// Start runs PruneExpired in the background every PruneInterval until Stop
+// is called. It does nothing when no TTL is configured or the pruner is
+// already running.
+func (c *Controller) Start() {
+	if c.conversationTTL <= 0 {
+		return
+	}
+
+	c.lifecycleMutex.Lock()
+	defer c.lifecycleMutex.Unlock()
+
+	if c.stopPruning != nil {
+		return
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	c.stopPruning, c.pruneDone = stop, done
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(c.pruneInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				c.PruneExpired()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts the background pruner and waits for it to exit, then waits
+// for pending store writes like Flush. It is safe to call when the pruner
+// is not running.
+func (c *Controller) Stop() {
+	defer c.Flush()
+	c.lifecycleMutex.Lock()
+	defer c.lifecycleMutex.Unlock()
+
+	if c.stopPruning == nil {
+		return
+	}
+
+	close(c.stopPruning)
+	<-c.pruneDone
+	c.stopPruning, c.pruneDone = nil, nil
+}
+
+// beginRequestLocked marks a request's conversation as in flight. Must be
+// called with the controller lock held.
+func (c *Controller) beginRequestLocked(pending *pendingRequest) {
+	c.inFlight[pending.conversation.ID]++
+	pending.active = true
+}
+
+// releaseRequest clears the in-flight mark set by beginRequestLocked. It is
+// safe to call with a nil or inactive request.
+func (c *Controller) releaseRequest(pending *pendingRequest) {
+	if pending == nil || !pending.active {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	pending.active = false
+	id := pending.conversation.ID
+	if c.inFlight[id]--; c.inFlight[id] <= 0 {
+		delete(c.inFlight, id)
+	}
+}
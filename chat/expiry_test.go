@@ -0,0 +1,109 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/backends/mock"
+)
+
+// backdate makes a conversation look idle for age
+func backdate(controller *Controller, id ConversationID, age time.Duration) {
+	controller.mutex.Lock()
+	defer controller.mutex.Unlock()
+	controller.conversations[id].UpdatedAt = time.Now().Add(-age)
+}
+
+func TestController_PruneExpired(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), &ControllerConfig{ConversationTTL: time.Hour})
+	stale := controller.CreateConversation("")
+	fresh := controller.CreateConversation("")
+	backdate(controller, stale.ID, 2*time.Hour)
+
+	if pruned := controller.PruneExpired(); pruned != 1 {
+		t.Errorf("Expected 1 conversation pruned, got %d", pruned)
+	}
+	if _, err := controller.GetConversation(stale.ID); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Expected stale conversation to be deleted, got %v", err)
+	}
+	if _, err := controller.GetConversation(fresh.ID); err != nil {
+		t.Errorf("Expected fresh conversation to be kept, got %v", err)
+	}
+
+	disabled := NewController(mock.NewMockBackend(), nil)
+	old := disabled.CreateConversation("")
+	backdate(disabled, old.ID, 24*time.Hour)
+	if pruned := disabled.PruneExpired(); pruned != 0 {
+		t.Errorf("Expected nothing pruned without a TTL, got %d", pruned)
+	}
+}
+
+func TestController_PruneExpiredSkipsInFlight(t *testing.T) {
+	backend := mock.NewMockBackend()
+	backend.SetLatency(200 * time.Millisecond)
+	controller := NewController(backend, &ControllerConfig{ConversationTTL: time.Hour})
+	conv := controller.CreateConversation("")
+
+	done := make(chan error)
+	go func() {
+		_, err := controller.SendMessage(context.Background(), ChatRequest{
+			ConversationID: conv.ID,
+			Message:        "Hello",
+		})
+		done <- err
+	}()
+
+	// Wait for the request to reach the backend
+	for {
+		controller.mutex.RLock()
+		inFlight := controller.inFlight[conv.ID]
+		controller.mutex.RUnlock()
+		if inFlight > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	backdate(controller, conv.ID, 2*time.Hour)
+	if pruned := controller.PruneExpired(); pruned != 0 {
+		t.Errorf("Expected in-flight conversation to be kept, got %d pruned", pruned)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+
+	backdate(controller, conv.ID, 2*time.Hour)
+	if pruned := controller.PruneExpired(); pruned != 1 {
+		t.Errorf("Expected conversation to be pruned once idle, got %d", pruned)
+	}
+}
+
+func TestController_StartStop(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), &ControllerConfig{
+		ConversationTTL: time.Hour,
+		PruneInterval:   5 * time.Millisecond,
+	})
+	conv := controller.CreateConversation("")
+	backdate(controller, conv.ID, 2*time.Hour)
+
+	controller.Start()
+	controller.Start()
+	defer controller.Stop()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := controller.GetConversation(conv.ID); err != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected background pruner to delete the stale conversation")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	controller.Stop()
+	controller.Stop()
+}
@@ -0,0 +1,39 @@
+package chat
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// withModelFallback calls attempt with pending.request, retrying transient
+// failures. While the backend reports the model unavailable, it moves on to
+// the next of FallbackModels, updating pending.request.Model and recording
+// the originally requested model in pending.fallbackFrom. Other errors end
+// the search immediately.
+func (c *Controller) withModelFallback(ctx context.Context, pending *pendingRequest, attempt func(request ai.ChatCompletionRequest) error) error {
+	requested := pending.request.Model
+	err := c.withRetry(ctx, func() error { return attempt(pending.request) })
+
+	for _, model := range c.fallbackModels {
+		if err == nil || !ai.IsModelUnavailable(err) {
+			break
+		}
+		if model == requested {
+			continue
+		}
+
+		c.logger.Warn("model unavailable, falling back",
+			slog.String("conversation_id", string(pending.conversation.ID)),
+			slog.String("model", pending.request.Model),
+			slog.String("fallback_model", model),
+			slog.String("error", err.Error()),
+		)
+		pending.request.Model = model
+		pending.fallbackFrom = requested
+		err = c.withRetry(ctx, func() error { return attempt(pending.request) })
+	}
+
+	return err
+}
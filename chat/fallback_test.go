@@ -0,0 +1,126 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/backends/mock"
+)
+
+// modelGateBackend only serves the models it allows and rejects the rest
+// with a provider-style model-not-found error. It does not stream, so
+// streaming requests go through the controller's non-streaming adapter.
+type modelGateBackend struct {
+	ai.Backend
+	allowed map[string]bool
+
+	mutex sync.Mutex
+	tried []string
+}
+
+func (b *modelGateBackend) ChatCompletion(ctx context.Context, req ai.ChatCompletionRequest) (*ai.ChatCompletionResponse, error) {
+	b.mutex.Lock()
+	b.tried = append(b.tried, req.Model)
+	b.mutex.Unlock()
+
+	if !b.allowed[req.Model] {
+		return nil, &ai.APIError{
+			Provider:   "OpenAI",
+			StatusCode: http.StatusNotFound,
+			Message:    fmt.Sprintf("The model `%s` does not exist or you do not have access to it.", req.Model),
+		}
+	}
+	return b.Backend.ChatCompletion(ctx, req)
+}
+
+func newModelGateBackend(allowed ...string) *modelGateBackend {
+	inner := mock.NewMockBackend()
+	inner.SetLatency(0)
+
+	backend := &modelGateBackend{Backend: inner, allowed: make(map[string]bool)}
+	for _, model := range allowed {
+		backend.allowed[model] = true
+	}
+	return backend
+}
+
+func TestController_FallbackModels(t *testing.T) {
+	backend := newModelGateBackend("gpt-3.5-turbo")
+	controller := NewController(backend, &ControllerConfig{
+		DefaultModel:   "gpt-4",
+		FallbackModels: []string{"gpt-4", "gpt-4o", "gpt-3.5-turbo"},
+	})
+	conv := controller.CreateConversation("")
+
+	response, err := controller.SendMessage(context.Background(), ChatRequest{ConversationID: conv.ID, Message: "Hello"})
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	if response.Model != "gpt-3.5-turbo" || response.FallbackFrom != "gpt-4" {
+		t.Errorf("Expected gpt-3.5-turbo to serve in place of gpt-4, got model %q from %q", response.Model, response.FallbackFrom)
+	}
+	// The requested model is not retried when it appears in the list
+	if fmt.Sprint(backend.tried) != "[gpt-4 gpt-4o gpt-3.5-turbo]" {
+		t.Errorf("Expected each model to be tried once in order, got %v", backend.tried)
+	}
+
+	// Streaming falls back the same way
+	events, err := controller.SendMessageStream(context.Background(), ChatRequest{ConversationID: conv.ID, Message: "Again"})
+	if err != nil {
+		t.Fatalf("SendMessageStream failed: %v", err)
+	}
+	var streamed *ChatResponse
+	for event := range events {
+		if event.Response != nil {
+			streamed = event.Response
+		}
+	}
+	if streamed == nil || streamed.Model != "gpt-3.5-turbo" || streamed.FallbackFrom != "gpt-4" {
+		t.Errorf("Expected the stream to fall back too, got %+v", streamed)
+	}
+
+	stored, _ := controller.GetConversation(conv.ID)
+	if stored.LastModel != "gpt-3.5-turbo" {
+		t.Errorf("Expected the serving model to be recorded, got %q", stored.LastModel)
+	}
+}
+
+func TestController_FallbackModelsOnlyForModelErrors(t *testing.T) {
+	// Without any accessible model the last model error is returned
+	backend := newModelGateBackend()
+	controller := NewController(backend, &ControllerConfig{
+		DefaultModel:   "gpt-4",
+		FallbackModels: []string{"gpt-4o"},
+	})
+	conv := controller.CreateConversation("")
+
+	_, err := controller.SendMessage(context.Background(), ChatRequest{ConversationID: conv.ID, Message: "Hello"})
+	if !ai.IsModelUnavailable(err) {
+		t.Errorf("Expected a model error once the list is exhausted, got %v", err)
+	}
+
+	// General failures never switch models
+	inner := mock.NewMockBackend()
+	inner.SetLatency(0)
+	inner.InjectError(&ai.APIError{Provider: "OpenAI", StatusCode: http.StatusUnauthorized, Message: "Incorrect API key provided"})
+	recorder := &modelGateBackend{Backend: inner, allowed: map[string]bool{"gpt-4": true, "gpt-4o": true}}
+	controller = NewController(recorder, &ControllerConfig{
+		DefaultModel:   "gpt-4",
+		FallbackModels: []string{"gpt-4o"},
+	})
+	conv = controller.CreateConversation("")
+
+	response, err := controller.SendMessage(context.Background(), ChatRequest{ConversationID: conv.ID, Message: "Hello"})
+	var apiErr *ai.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected the auth error to be returned as is, got %v", err)
+	}
+	if len(recorder.tried) != 1 || response.FallbackFrom != "" {
+		t.Errorf("Expected no fallback for an auth error, tried %v", recorder.tried)
+	}
+}
@@ -0,0 +1,47 @@
+package chat
+
+import (
+	"fmt"
+	"slices"
+)
+
+// ForkConversation branches a conversation at its current point. The new
+// conversation gets a fresh ID and timestamps, a deep copy of the source's
+// messages, metadata, and tags, and the same tool restrictions, so either
+// branch can continue without affecting the other. Usage and cost start at
+// zero. The source ID is recorded in the fork's "forked_from" metadata.
+// Like GetConversation, it returns a deep copy.
+func (c *Controller) ForkConversation(id ConversationID) (*Conversation, error) {
+	c.ensureLoaded(id)
+	defer c.enforceCapacity()
+	var notifications []thresholdNotification
+	defer func() { notifyThresholds(notifications) }()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	source, exists := c.conversations[id]
+	if !exists {
+		return nil, fmt.Errorf("conversation %s %w", id, ErrConversationNotFound)
+	}
+
+	c.touchLocked(id)
+	fork := c.createConversationLocked("")
+	fork.Messages = copyMessages(source.Messages)
+	for key, value := range source.Metadata {
+		fork.Metadata[key] = value
+	}
+	fork.Metadata["forked_from"] = string(source.ID)
+	fork.Tags = slices.Clone(source.Tags)
+	c.changedLocked(fork)
+
+	if allowlist, restricted := c.toolAllowlists[id]; restricted {
+		copied := make(map[string]bool, len(allowlist))
+		for name := range allowlist {
+			copied[name] = true
+		}
+		c.toolAllowlists[fork.ID] = copied
+	}
+
+	notifications = c.checkThresholds(fork)
+	return copyConversation(fork), nil
+}
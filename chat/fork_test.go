@@ -0,0 +1,74 @@
+package chat
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/backends/mock"
+)
+
+func TestForkConversation(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), nil)
+	parent := controller.CreateConversation("You are helpful.")
+
+	if _, err := controller.SendMessage(context.Background(), ChatRequest{
+		ConversationID: parent.ID,
+		Message:        "Plan a trip",
+	}); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	live, err := controller.lookupConversation(parent.ID)
+	if err != nil {
+		t.Fatalf("lookupConversation failed: %v", err)
+	}
+	controller.mutex.Lock()
+	live.Messages = append(live.Messages, ai.Message{
+		Role:      "assistant",
+		ToolCalls: []ai.ToolCall{{ID: "call_1", Type: "function", Function: ai.FunctionCall{Name: "search"}}},
+	}, ai.Message{Role: "tool", Content: "results", ToolCallID: "call_1"})
+	controller.mutex.Unlock()
+
+	fork, err := controller.ForkConversation(parent.ID)
+	if err != nil {
+		t.Fatalf("ForkConversation failed: %v", err)
+	}
+	parent, _ = controller.GetConversation(parent.ID)
+
+	if fork.ID == parent.ID {
+		t.Error("Expected fork to get a new ID")
+	}
+	if !reflect.DeepEqual(fork.Messages, parent.Messages) {
+		t.Errorf("Expected fork messages %+v, got %+v", parent.Messages, fork.Messages)
+	}
+	if fork.Metadata["forked_from"] != string(parent.ID) {
+		t.Errorf("Expected forked_from %s, got %q", parent.ID, fork.Metadata["forked_from"])
+	}
+	if fork.Usage.TotalTokens != 0 {
+		t.Errorf("Expected fork usage to start at zero, got %d", fork.Usage.TotalTokens)
+	}
+
+	// Continuing or editing the fork must not touch the parent
+	parentMessages := copyMessages(parent.Messages)
+	fork.Messages[3].ToolCalls[0].Function.Name = "edited"
+	if _, err := controller.SendMessage(context.Background(), ChatRequest{
+		ConversationID: fork.ID,
+		Message:        "Go somewhere else",
+	}); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+
+	parent, _ = controller.GetConversation(parent.ID)
+	fork, _ = controller.GetConversation(fork.ID)
+	if !reflect.DeepEqual(parent.Messages, parentMessages) {
+		t.Errorf("Expected parent to be unchanged, got %+v", parent.Messages)
+	}
+	if len(fork.Messages) != len(parentMessages)+2 {
+		t.Errorf("Expected fork to grow by 2 messages, got %d", len(fork.Messages))
+	}
+
+	if _, err := controller.ForkConversation("missing"); err == nil {
+		t.Error("Expected error for unknown conversation")
+	}
+}
@@ -0,0 +1,65 @@
+package chat
+
+import (
+	"regexp"
+	"slices"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// MessageHook rewrites a message, for example to redact personal data
+// before it leaves the process. Hooks receive a copy and return the
+// message to use in its place.
+type MessageHook func(msg ai.Message) ai.Message
+
+// ForRoles limits hook to messages with one of the given roles. Other
+// messages pass through unchanged.
+func ForRoles(hook MessageHook, roles ...string) MessageHook {
+	return func(msg ai.Message) ai.Message {
+		if !slices.Contains(roles, msg.Role) {
+			return msg
+		}
+		return hook(msg)
+	}
+}
+
+// RedactPattern returns a hook replacing every match of pattern in a
+// message's text with replacement, which may use $1-style references
+func RedactPattern(pattern *regexp.Regexp, replacement string) MessageHook {
+	return func(msg ai.Message) ai.Message {
+		msg.Content = pattern.ReplaceAllString(msg.Content, replacement)
+		if msg.ContentParts != nil {
+			parts := make([]ai.ContentPart, len(msg.ContentParts))
+			for i, part := range msg.ContentParts {
+				if part.Type == ai.ContentPartText {
+					part.Text = pattern.ReplaceAllString(part.Text, replacement)
+				}
+				parts[i] = part
+			}
+			msg.ContentParts = parts
+		}
+		return msg
+	}
+}
+
+// applyHooks runs hooks over msg in order
+func applyHooks(hooks []MessageHook, msg ai.Message) ai.Message {
+	for _, hook := range hooks {
+		msg = hook(msg)
+	}
+	return msg
+}
+
+// preprocessMessages applies the message preprocessors to every message of
+// an outbound history, returning a new slice
+func (c *Controller) preprocessMessages(messages []ai.Message) []ai.Message {
+	if len(c.preprocessors) == 0 {
+		return messages
+	}
+
+	processed := make([]ai.Message, len(messages))
+	for i, msg := range messages {
+		processed[i] = applyHooks(c.preprocessors, msg)
+	}
+	return processed
+}
@@ -0,0 +1,92 @@
+package chat
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+var emailPattern = regexp.MustCompile(`[\w.+-]+@[\w-]+\.[\w.]+`)
+
+func TestController_MessagePreprocessors(t *testing.T) {
+	backend := newRecordingBackend()
+	controller := NewController(backend, &ControllerConfig{
+		MessagePreprocessors: []MessageHook{
+			ForRoles(RedactPattern(emailPattern, "[email]"), "user"),
+		},
+	})
+	conv := controller.CreateConversation("Contact admin@example.com for help.")
+
+	_, err := controller.SendMessage(context.Background(), ChatRequest{
+		ConversationID: conv.ID,
+		Message:        "My address is jane.doe@example.org",
+	})
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+
+	sent := backend.lastRequest().Messages
+	if sent[1].Content != "My address is [email]" {
+		t.Errorf("Expected the user email to be redacted, got %q", sent[1].Content)
+	}
+	if !strings.Contains(sent[0].Content, "admin@example.com") {
+		t.Errorf("Expected the system message to be left alone, got %q", sent[0].Content)
+	}
+
+	stored, _ := controller.GetConversation(conv.ID)
+	if stored.Messages[1].Content != "My address is jane.doe@example.org" {
+		t.Errorf("Expected the stored message to keep the original, got %q", stored.Messages[1].Content)
+	}
+}
+
+func TestController_ResponsePostprocessors(t *testing.T) {
+	backend := newRecordingBackend()
+	shout := func(msg ai.Message) ai.Message {
+		msg.Content = strings.ToUpper(msg.Content)
+		return msg
+	}
+
+	for _, store := range []bool{false, true} {
+		controller := NewController(backend, &ControllerConfig{
+			ResponsePostprocessors: []MessageHook{shout},
+			MessagePreprocessors:   []MessageHook{RedactPattern(emailPattern, "[email]")},
+			StoreProcessedMessages: store,
+		})
+		conv := controller.CreateConversation("")
+
+		response, err := controller.SendMessage(context.Background(), ChatRequest{
+			ConversationID: conv.ID,
+			Message:        "mail me at a@b.co",
+		})
+		if err != nil {
+			t.Fatalf("SendMessage failed: %v", err)
+		}
+		if response.Message.Content != strings.ToUpper(response.Message.Content) {
+			t.Errorf("Expected a postprocessed reply, got %q", response.Message.Content)
+		}
+
+		stored, _ := controller.GetConversation(conv.ID)
+		user, reply := stored.Messages[0].Content, stored.Messages[1].Content
+		if store && (user != "mail me at [email]" || reply != response.Message.Content) {
+			t.Errorf("Expected processed messages to be stored, got %q and %q", user, reply)
+		}
+		if !store && (user != "mail me at a@b.co" || reply == response.Message.Content) {
+			t.Errorf("Expected the original messages to be stored, got %q and %q", user, reply)
+		}
+	}
+}
+
+func TestRedactPattern_ContentParts(t *testing.T) {
+	msg := ai.NewMultipartMessage("user", ai.TextPart("from x@y.io"), ai.ImagePart("https://example.com/a.png"))
+	redacted := RedactPattern(emailPattern, "[email]")(msg)
+
+	if redacted.Content != "from [email]" || redacted.ContentParts[0].Text != "from [email]" {
+		t.Errorf("Expected text and parts to be redacted, got %q and %q", redacted.Content, redacted.ContentParts[0].Text)
+	}
+	if msg.ContentParts[0].Text != "from x@y.io" {
+		t.Error("Expected the original parts to be left unchanged")
+	}
+}
@@ -0,0 +1,118 @@
+package chat
+
+import (
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/backends/mock"
+)
+
+// crockford is the ULID alphabet, which sorts in the same order as the
+// values it encodes
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ulidGenerator returns a generator of prefixed ULIDs. IDs made within the
+// same millisecond increment the random part, so they still sort in the
+// order they were generated.
+func ulidGenerator(prefix string) func() ConversationID {
+	var mutex sync.Mutex
+	var lastMillis, hi, lo uint64 // hi holds the top 16 of 80 random bits
+
+	return func() ConversationID {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		millis := uint64(time.Now().UnixMilli())
+		if millis == lastMillis {
+			if lo++; lo == 0 {
+				hi = (hi + 1) & 0xffff
+			}
+		} else {
+			lastMillis, hi, lo = millis, rand.Uint64()&0x7fff, rand.Uint64()
+		}
+
+		var b strings.Builder
+		b.WriteString(prefix)
+		for shift := 45; shift >= 0; shift -= 5 {
+			b.WriteByte(crockford[(millis>>shift)&31])
+		}
+		for shift := 75; shift >= 0; shift -= 5 {
+			var bits uint64
+			switch {
+			case shift >= 64:
+				bits = hi >> (shift - 64)
+			case shift > 59:
+				bits = hi<<(64-shift) | lo>>shift
+			default:
+				bits = lo >> shift
+			}
+			b.WriteByte(crockford[bits&31])
+		}
+		return ConversationID(b.String())
+	}
+}
+
+func TestController_IDGenerator(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), &ControllerConfig{
+		IDGenerator: ulidGenerator("conv_"),
+	})
+
+	const workers, perWorker = 8, 50
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range perWorker {
+				controller.CreateConversation("")
+			}
+		}()
+	}
+	wg.Wait()
+
+	conversations := controller.ListConversations()
+	if len(conversations) != workers*perWorker {
+		t.Fatalf("Expected %d conversations, got %d", workers*perWorker, len(conversations))
+	}
+
+	seen := make(map[ConversationID]bool)
+	for _, conversation := range conversations {
+		if !strings.HasPrefix(string(conversation.ID), "conv_") || len(conversation.ID) != len("conv_")+26 {
+			t.Errorf("Expected a prefixed ULID, got %s", conversation.ID)
+		}
+		if seen[conversation.ID] {
+			t.Errorf("Expected unique IDs, got %s twice", conversation.ID)
+		}
+		seen[conversation.ID] = true
+	}
+
+	// IDs are generated under the controller lock, so sorting by ID must
+	// also sort by creation time
+	sort.Slice(conversations, func(i, j int) bool {
+		return conversations[i].ID < conversations[j].ID
+	})
+	for i := 1; i < len(conversations); i++ {
+		if conversations[i].CreatedAt.Before(conversations[i-1].CreatedAt) {
+			t.Fatalf("Expected %s created after %s", conversations[i].ID, conversations[i-1].ID)
+		}
+	}
+}
+
+func TestController_IDGeneratorCollision(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), &ControllerConfig{
+		IDGenerator: func() ConversationID { return "fixed" },
+	})
+
+	first := controller.CreateConversation("")
+	second := controller.CreateConversation("")
+	if first.ID != "fixed" {
+		t.Errorf("Expected generated ID fixed, got %s", first.ID)
+	}
+	if second.ID == first.ID {
+		t.Errorf("Expected a repeated ID to fall back to the default format, got %s", second.ID)
+	}
+}
@@ -0,0 +1,68 @@
+package chat
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// DefaultIdempotencyTTL is how long idempotency keys are remembered by default
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// idempotencyEntry maps a client-supplied key to the conversation it created
+type idempotencyEntry struct {
+	id        ConversationID
+	expiresAt time.Time
+}
+
+// CreateConversationIdempotent creates a conversation unless the same key was
+// used within the idempotency TTL, in which case the conversation created
+// for that key is returned instead. This lets clients safely retry creation
+// after network failures. created reports whether a new conversation was
+// made. Like GetConversation, it returns a deep copy.
+func (c *Controller) CreateConversationIdempotent(key, systemPrompt string) (conversation *Conversation, created bool, err error) {
+	if key == "" {
+		return nil, false, fmt.Errorf("%w: idempotency key cannot be empty", ai.ErrInvalidRequest)
+	}
+
+	// The conversation made for the key may only be in the store
+	c.mutex.RLock()
+	entry, ok := c.idempotencyKeys[key]
+	c.mutex.RUnlock()
+	if ok {
+		c.ensureLoaded(entry.id)
+	}
+
+	defer c.enforceCapacity()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	c.pruneIdempotencyKeysLocked(now)
+
+	if entry, ok := c.idempotencyKeys[key]; ok {
+		if existing, exists := c.conversations[entry.id]; exists {
+			return copyConversation(existing), false, nil
+		}
+		// The conversation was deleted since, so the key is free again
+	}
+
+	conversation = c.createConversationLocked(systemPrompt)
+	c.idempotencyKeys[key] = idempotencyEntry{
+		id:        conversation.ID,
+		expiresAt: now.Add(c.idempotencyTTL),
+	}
+
+	return copyConversation(conversation), true, nil
+}
+
+// pruneIdempotencyKeysLocked forgets expired keys. Must be called with the
+// controller lock held.
+func (c *Controller) pruneIdempotencyKeysLocked(now time.Time) {
+	for key, entry := range c.idempotencyKeys {
+		if now.After(entry.expiresAt) {
+			delete(c.idempotencyKeys, key)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// ImportConversation reads a conversation in the JSON export format, as
+// written by /save, and registers it under a fresh ID so it cannot collide
+// with a local conversation. Messages, timestamps, title, and metadata are
+// preserved and the original ID is recorded in the "imported_from" metadata
+// key. Every message must have a valid role and there must be at least one.
+// Like GetConversation, the result is a deep copy.
+func (c *Controller) ImportConversation(r io.Reader) (*Conversation, error) {
+	var conversation Conversation
+	if err := json.NewDecoder(r).Decode(&conversation); err != nil {
+		return nil, fmt.Errorf("failed to parse conversation: %w", err)
+	}
+
+	if len(conversation.Messages) == 0 {
+		return nil, fmt.Errorf("%w: conversation has no messages", ai.ErrInvalidRequest)
+	}
+	for i, msg := range conversation.Messages {
+		if err := ai.ValidateMessage(msg); err != nil {
+			return nil, fmt.Errorf("message %d: %w", i, err)
+		}
+	}
+
+	defer c.enforceCapacity()
+	var notifications []thresholdNotification
+	defer func() { notifyThresholds(notifications) }()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if conversation.Metadata == nil {
+		conversation.Metadata = make(map[string]string)
+	}
+	if conversation.ID != "" {
+		conversation.Metadata["imported_from"] = string(conversation.ID)
+	}
+
+	conversation.ID = c.newIDLocked()
+	notifications = c.registerLocked(&conversation)
+	return copyConversation(&conversation), nil
+}
@@ -0,0 +1,107 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/backends/mock"
+)
+
+func TestController_ImportConversation(t *testing.T) {
+	source := NewController(mock.NewMockBackend(), nil)
+	original := source.CreateConversation("system")
+	sendN(t, source, original.ID, 1)
+	source.RenameConversation(original.ID, "Shared plan")
+
+	exported, _ := source.GetConversation(original.ID)
+	data, err := json.Marshal(exported)
+	if err != nil {
+		t.Fatalf("Failed to encode conversation: %v", err)
+	}
+
+	controller := NewController(mock.NewMockBackend(), nil)
+	local := controller.CreateConversation("")
+
+	imported, err := controller.ImportConversation(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if imported.ID == original.ID || imported.ID == local.ID {
+		t.Errorf("Expected a fresh ID, got %s", imported.ID)
+	}
+	if imported.Metadata["imported_from"] != string(original.ID) {
+		t.Errorf("Expected imported_from %s, got %q", original.ID, imported.Metadata["imported_from"])
+	}
+	if len(imported.Messages) != len(exported.Messages) || imported.Messages[1].Content != exported.Messages[1].Content {
+		t.Errorf("Expected messages to be preserved, got %+v", imported.Messages)
+	}
+	if !imported.CreatedAt.Equal(exported.CreatedAt) || !imported.UpdatedAt.Equal(exported.UpdatedAt) {
+		t.Errorf("Expected timestamps to be preserved, got %v/%v", imported.CreatedAt, imported.UpdatedAt)
+	}
+	if imported.Title != "Shared plan" {
+		t.Errorf("Expected title to be preserved, got %q", imported.Title)
+	}
+
+	// The result is a copy, so changing it leaves the controller alone
+	imported.Messages[1].Content = "changed"
+	imported.Title = "changed"
+	got, err := controller.GetConversation(imported.ID)
+	if err != nil {
+		t.Fatalf("Expected imported conversation to be registered, got %v", err)
+	}
+	if got.Title != "Shared plan" || got.Messages[1].Content != exported.Messages[1].Content {
+		t.Errorf("Expected the stored conversation to be unchanged, got %+v", got)
+	}
+}
+
+func TestController_ImportConversationRejectsInvalid(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), nil)
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"malformed", `{"messages": [`},
+		{"no messages", `{"id": "conv_1", "messages": []}`},
+		{"bad role", `{"id": "conv_1", "messages": [{"role": "wizard", "content": "hi"}]}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := controller.ImportConversation(strings.NewReader(test.input)); err == nil {
+				t.Errorf("Expected error for %s input", test.name)
+			}
+		})
+	}
+
+	_, err := controller.ImportConversation(strings.NewReader(`{"messages": [{"role": "wizard", "content": "hi"}]}`))
+	if !errors.Is(err, ai.ErrInvalidRequest) {
+		t.Errorf("Expected ErrInvalidRequest for bad role, got %v", err)
+	}
+
+	if len(controller.ListConversations()) != 0 {
+		t.Errorf("Expected nothing to be registered after failed imports")
+	}
+}
+
+func TestController_ImportConversationDefaultsTimestamps(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), nil)
+
+	before := time.Now()
+	imported, err := controller.ImportConversation(strings.NewReader(`{"messages": [{"role": "user", "content": "hi"}]}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if imported.CreatedAt.Before(before) {
+		t.Errorf("Expected missing CreatedAt to default to now, got %v", imported.CreatedAt)
+	}
+	if _, ok := imported.Metadata["imported_from"]; ok {
+		t.Errorf("Expected no imported_from without a source ID")
+	}
+}
@@ -0,0 +1,51 @@
+package chat
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// SetMetadata sets a metadata key on a conversation, such as the end user
+// or project it belongs to. An empty value removes the key. Metadata is
+// included in exports and preserved on import.
+func (c *Controller) SetMetadata(id ConversationID, key, value string) error {
+	if strings.TrimSpace(key) == "" {
+		return fmt.Errorf("%w: metadata key cannot be empty", ai.ErrInvalidRequest)
+	}
+
+	c.ensureLoaded(id)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	conversation, exists := c.conversations[id]
+	if !exists {
+		return fmt.Errorf("conversation %s %w", id, ErrConversationNotFound)
+	}
+
+	if value == "" {
+		delete(conversation.Metadata, key)
+	} else {
+		conversation.Metadata[key] = value
+	}
+	conversation.UpdatedAt = time.Now()
+	c.changedLocked(conversation)
+	return nil
+}
+
+// GetMetadata returns a copy of a conversation's metadata
+func (c *Controller) GetMetadata(id ConversationID) (map[string]string, error) {
+	c.ensureLoaded(id)
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	conversation, exists := c.conversations[id]
+	if !exists {
+		return nil, fmt.Errorf("conversation %s %w", id, ErrConversationNotFound)
+	}
+
+	return maps.Clone(conversation.Metadata), nil
+}
@@ -0,0 +1,77 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/backends/mock"
+)
+
+func TestController_Metadata(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), nil)
+	conv := controller.CreateConversation("You are helpful.")
+
+	if err := controller.SetMetadata(conv.ID, "user_id", "u-42"); err != nil {
+		t.Fatalf("SetMetadata failed: %v", err)
+	}
+	controller.SetMetadata(conv.ID, "priority", "high")
+	controller.SetMetadata(conv.ID, "priority", "")
+
+	metadata, err := controller.GetMetadata(conv.ID)
+	if err != nil {
+		t.Fatalf("GetMetadata failed: %v", err)
+	}
+	if len(metadata) != 1 || metadata["user_id"] != "u-42" {
+		t.Errorf("Expected only user_id=u-42, got %v", metadata)
+	}
+
+	metadata["user_id"] = "tampered"
+	if again, _ := controller.GetMetadata(conv.ID); again["user_id"] != "u-42" {
+		t.Error("Expected GetMetadata to return a copy")
+	}
+
+	if err := controller.SetMetadata(conv.ID, " ", "x"); err == nil {
+		t.Error("Expected an empty key to be rejected")
+	}
+	if err := controller.SetMetadata("missing", "k", "v"); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Expected ErrConversationNotFound, got %v", err)
+	}
+
+	// Metadata survives an export and import
+	exported, _ := controller.GetConversation(conv.ID)
+	data, _ := json.Marshal(exported)
+	imported, err := controller.ImportConversation(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ImportConversation failed: %v", err)
+	}
+	if imported.Metadata["user_id"] != "u-42" {
+		t.Errorf("Expected imported metadata user_id=u-42, got %v", imported.Metadata)
+	}
+}
+
+func TestController_MetadataConcurrent(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), nil)
+	conv := controller.CreateConversation("")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("key-%d", i)
+			for j := 0; j < 50; j++ {
+				controller.SetMetadata(conv.ID, key, fmt.Sprint(j))
+				controller.GetMetadata(conv.ID)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if metadata, _ := controller.GetMetadata(conv.ID); len(metadata) != 10 {
+		t.Errorf("Expected 10 keys, got %d", len(metadata))
+	}
+}
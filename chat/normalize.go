@@ -0,0 +1,86 @@
+package chat
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// NormalizeInPlace tidies a conversation that has picked up noise from
+// editing or importing. It converts line endings to "\n", strips trailing
+// whitespace from every line and surrounding whitespace from every message,
+// drops messages left empty, and merges adjacent plain messages from the
+// same role so the result alternates cleanly. Messages that carry tool calls
+// or tool results keep their place. It returns the number of changes made.
+func (c *Controller) NormalizeInPlace(id ConversationID) (int, error) {
+	c.ensureLoaded(id)
+	var notifications []thresholdNotification
+	defer func() { notifyThresholds(notifications) }()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	conversation, exists := c.conversations[id]
+	if !exists {
+		return 0, fmt.Errorf("conversation %s %w", id, ErrConversationNotFound)
+	}
+
+	changes := 0
+	normalized := make([]ai.Message, 0, len(conversation.Messages))
+
+	for _, msg := range conversation.Messages {
+		content := normalizeContent(msg.Content)
+		if content != msg.Content {
+			msg.Content = content
+			changes++
+		}
+
+		if content == "" && !isToolMessage(msg) {
+			changes++
+			continue
+		}
+
+		if n := len(normalized); n > 0 && canMerge(normalized[n-1], msg) {
+			normalized[n-1].Content += "\n\n" + msg.Content
+			changes++
+			continue
+		}
+
+		normalized = append(normalized, msg)
+	}
+
+	if changes > 0 {
+		conversation.Messages = normalized
+		conversation.UpdatedAt = time.Now()
+		c.changedLocked(conversation)
+		notifications = c.checkThresholds(conversation)
+	}
+
+	return changes, nil
+}
+
+// normalizeContent converts line endings and strips trailing whitespace from
+// each line as well as leading and trailing whitespace overall
+func normalizeContent(content string) string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.ReplaceAll(content, "\r", "\n")
+
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// isToolMessage reports whether a message is part of a tool call exchange
+func isToolMessage(msg ai.Message) bool {
+	return len(msg.ToolCalls) > 0 || msg.ToolCallID != "" || msg.Role == "tool"
+}
+
+// canMerge reports whether next can be folded into prev without losing
+// structure
+func canMerge(prev, next ai.Message) bool {
+	return prev.Role == next.Role && !isToolMessage(prev) && !isToolMessage(next)
+}
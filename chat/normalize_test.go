@@ -0,0 +1,57 @@
+package chat
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/backends/mock"
+)
+
+func TestNormalizeInPlace(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), nil)
+	conv := controller.newConversation("  You are helpful.  \r\n")
+
+	controller.mutex.Lock()
+	conv.Messages = append(conv.Messages,
+		ai.Message{Role: "user", Content: "first line   \r\nsecond line\t\r\n"},
+		ai.Message{Role: "assistant", Content: "   \n\t"},
+		ai.Message{Role: "user", Content: "follow up"},
+		ai.Message{Role: "assistant", Content: "", ToolCalls: []ai.ToolCall{{ID: "call_1", Type: "function"}}},
+		ai.Message{Role: "tool", Content: "", ToolCallID: "call_1"},
+		ai.Message{Role: "assistant", Content: "done\rreally"},
+	)
+	controller.mutex.Unlock()
+
+	changes, err := controller.NormalizeInPlace(conv.ID)
+	if err != nil {
+		t.Fatalf("NormalizeInPlace failed: %v", err)
+	}
+
+	// system trim, user trim, empty assistant dropped (trim + removal),
+	// user merge, final assistant line ending
+	if changes != 6 {
+		t.Errorf("Expected 6 changes, got %d", changes)
+	}
+
+	want := []ai.Message{
+		{Role: "system", Content: "You are helpful."},
+		{Role: "user", Content: "first line\nsecond line\n\nfollow up"},
+		{Role: "assistant", Content: "", ToolCalls: []ai.ToolCall{{ID: "call_1", Type: "function"}}},
+		{Role: "tool", Content: "", ToolCallID: "call_1"},
+		{Role: "assistant", Content: "done\nreally"},
+	}
+	got, _ := controller.GetConversation(conv.ID)
+	if !reflect.DeepEqual(got.Messages, want) {
+		t.Errorf("Expected normalized messages %+v, got %+v", want, got.Messages)
+	}
+
+	changes, err = controller.NormalizeInPlace(conv.ID)
+	if err != nil || changes != 0 {
+		t.Errorf("Expected normalizing again to be a no-op, got %d changes, err %v", changes, err)
+	}
+
+	if _, err := controller.NormalizeInPlace("missing"); err == nil {
+		t.Error("Expected error for unknown conversation")
+	}
+}
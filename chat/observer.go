@@ -0,0 +1,75 @@
+package chat
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// Request outcomes reported in RequestRecord.Status
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+// RequestRecord describes the outcome of a single send
+type RequestRecord struct {
+	Backend  string
+	Model    string
+	Status   string
+	Duration time.Duration
+	Usage    ai.Usage
+}
+
+// RequestObserver is notified after every send, successful or not, for
+// monitoring such as metrics. ObserveRequest is called on the sending
+// goroutine, possibly concurrently, and should not block.
+type RequestObserver interface {
+	ObserveRequest(record RequestRecord)
+}
+
+// logSent logs a completed send and reports it to the observer
+func (c *Controller) logSent(response *ChatResponse, start time.Time) {
+	duration := time.Since(start)
+	usage := response.Response.Usage
+
+	c.logger.Info("message sent",
+		slog.String("conversation_id", string(response.ConversationID)),
+		slog.String("model", response.Response.Model),
+		slog.Int("tokens", usage.TotalTokens),
+		slog.Int64("duration_ms", duration.Milliseconds()),
+	)
+	c.observeRequest(response.Response.Model, StatusOK, duration, usage)
+}
+
+// logFailure logs a failed send and reports it to the observer
+func (c *Controller) logFailure(id ConversationID, model string, start time.Time, err error) {
+	duration := time.Since(start)
+
+	c.logger.Error("message failed",
+		slog.String("conversation_id", string(id)),
+		slog.String("model", model),
+		slog.Int64("duration_ms", duration.Milliseconds()),
+		slog.String("error", err.Error()),
+	)
+	c.observeRequest(model, StatusError, duration, ai.Usage{})
+}
+
+// observeRequest passes a request outcome to the observer, if any
+func (c *Controller) observeRequest(model, status string, duration time.Duration, usage ai.Usage) {
+	if c.observer == nil {
+		return
+	}
+
+	if model == "" {
+		model = c.defaultModel
+	}
+	c.observer.ObserveRequest(RequestRecord{
+		Backend:  c.GetBackend().Name(),
+		Model:    model,
+		Status:   status,
+		Duration: duration,
+		Usage:    usage,
+	})
+}
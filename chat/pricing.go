@@ -0,0 +1,35 @@
+package chat
+
+import (
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// ModelPrice holds per-1K-token prices in USD for a model
+type ModelPrice struct {
+	InputPer1K  float64 `json:"input_per_1k"`
+	OutputPer1K float64 `json:"output_per_1k"`
+}
+
+// DefaultModelPricing holds list prices for commonly used models
+var DefaultModelPricing = map[string]ModelPrice{
+	"gpt-4":                    {InputPer1K: 0.03, OutputPer1K: 0.06},
+	"gpt-4-turbo":              {InputPer1K: 0.01, OutputPer1K: 0.03},
+	"gpt-4o":                   {InputPer1K: 0.005, OutputPer1K: 0.015},
+	"gpt-3.5-turbo":            {InputPer1K: 0.0005, OutputPer1K: 0.0015},
+	"claude-3-opus-20240229":   {InputPer1K: 0.015, OutputPer1K: 0.075},
+	"claude-3-sonnet-20240229": {InputPer1K: 0.003, OutputPer1K: 0.015},
+	"claude-3-haiku-20240307":  {InputPer1K: 0.00025, OutputPer1K: 0.00125},
+}
+
+// estimateCost prices token usage for a model. ok is false when the model
+// has no pricing entry, in which case the cost is zero.
+func estimateCost(pricing map[string]ModelPrice, model string, usage ai.Usage) (cost float64, ok bool) {
+	price, ok := pricing[model]
+	if !ok {
+		return 0, false
+	}
+
+	cost = float64(usage.PromptTokens)/1000*price.InputPer1K +
+		float64(usage.CompletionTokens)/1000*price.OutputPer1K
+	return cost, true
+}
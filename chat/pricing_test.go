@@ -0,0 +1,80 @@
+package chat
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/backends/mock"
+)
+
+func TestController_CostEstimation(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), &ControllerConfig{
+		ModelPricing: map[string]ModelPrice{
+			"priced-model": {InputPer1K: 1, OutputPer1K: 2},
+		},
+	})
+
+	priced := controller.CreateConversation("")
+	response, err := controller.SendMessage(context.Background(), ChatRequest{
+		ConversationID: priced.ID,
+		Message:        "How much will this cost me?",
+		Model:          "priced-model",
+	})
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+
+	usage := response.Response.Usage
+	expected := float64(usage.PromptTokens)/1000*1 + float64(usage.CompletionTokens)/1000*2
+
+	summary, _ := controller.GetConversationSummary(priced.ID)
+	if math.Abs(summary.EstimatedCostUSD-expected) > 1e-9 {
+		t.Errorf("Expected cost %v, got %v", expected, summary.EstimatedCostUSD)
+	}
+	if summary.PricingUnavailable {
+		t.Error("Priced model should not be flagged")
+	}
+
+	// Models missing from the table cost nothing but are flagged
+	unpriced := controller.CreateConversation("")
+	if _, err := controller.SendMessage(context.Background(), ChatRequest{
+		ConversationID: unpriced.ID,
+		Message:        "And this?",
+		Model:          "gpt-4",
+	}); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+
+	summary, _ = controller.GetConversationSummary(unpriced.ID)
+	if summary.EstimatedCostUSD != 0 || !summary.PricingUnavailable {
+		t.Errorf("Expected zero cost with pricing flag, got %v flagged=%v", summary.EstimatedCostUSD, summary.PricingUnavailable)
+	}
+
+	stats := controller.GetStats()
+	if math.Abs(stats.EstimatedCostUSD-expected) > 1e-9 {
+		t.Errorf("Expected aggregate cost %v, got %v", expected, stats.EstimatedCostUSD)
+	}
+	if !stats.PricingUnavailable {
+		t.Error("Stats should report that some usage was unpriced")
+	}
+}
+
+func TestController_DefaultPricing(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), nil)
+	conv := controller.CreateConversation("")
+
+	if _, err := controller.SendMessage(context.Background(), ChatRequest{
+		ConversationID: conv.ID,
+		Message:        "Price me with the defaults",
+		Model:          "gpt-3.5-turbo",
+	}); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+
+	summary, _ := controller.GetConversationSummary(conv.ID)
+	if summary.EstimatedCostUSD <= 0 || summary.PricingUnavailable {
+		t.Errorf("Expected default gpt-3.5-turbo pricing to apply, got %v flagged=%v",
+			summary.EstimatedCostUSD, summary.PricingUnavailable)
+	}
+}
@@ -0,0 +1,150 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// ErrNothingToRegenerate is returned by RegenerateLast when a conversation
+// does not end with an assistant reply
+var ErrNothingToRegenerate = errors.New("nothing to regenerate")
+
+// RegenerateLast replaces the last assistant turn of a conversation with a
+// fresh reply. Everything after the last user message, including any tool
+// call exchange, is removed and the history ending at that user message is
+// sent again, with the model and parameters that turn was sent with. If the
+// send fails, the previous turn is put back.
+func (c *Controller) RegenerateLast(ctx context.Context, id ConversationID) (*ChatResponse, error) {
+	return c.resendLastTurn(ctx, id, func(messages []ai.Message) error {
+		if len(messages) == 0 {
+			return fmt.Errorf("%w: conversation %s has no messages", ErrNothingToRegenerate, id)
+		}
+		if last := messages[len(messages)-1]; last.Role != "assistant" {
+			return fmt.Errorf("%w: last message of conversation %s is a %s message, not an assistant reply", ErrNothingToRegenerate, id, last.Role)
+		}
+		if lastUserIndex(messages) < 0 {
+			return fmt.Errorf("%w: conversation %s has no user message to reply to", ErrNothingToRegenerate, id)
+		}
+		return nil
+	}, nil)
+}
+
+// EditLastUserMessage replaces the content of the last user message and
+// regenerates the reply to it, with the model and parameters that turn was
+// sent with. Every message after the edited one is discarded. If the send
+// fails, the original turn is put back.
+func (c *Controller) EditLastUserMessage(ctx context.Context, id ConversationID, newContent string) (*ChatResponse, error) {
+	if err := ai.ValidateMessage(ai.Message{Role: "user", Content: newContent}); err != nil {
+		return nil, err
+	}
+
+	return c.resendLastTurn(ctx, id, func(messages []ai.Message) error {
+		if lastUserIndex(messages) < 0 {
+			return fmt.Errorf("conversation %s has no user message to edit", id)
+		}
+		return nil
+	}, &newContent)
+}
+
+// turnSettings keeps the model and parameters of a request, which
+// resendLastTurn reuses when the turn is sent again
+func turnSettings(request ChatRequest) ChatRequest {
+	return ChatRequest{
+		Model:            request.Model,
+		MaxTokens:        copyOptional(request.MaxTokens),
+		Temperature:      copyOptional(request.Temperature),
+		Stop:             slices.Clone(request.Stop),
+		PresencePenalty:  copyOptional(request.PresencePenalty),
+		FrequencyPenalty: copyOptional(request.FrequencyPenalty),
+		Seed:             copyOptional(request.Seed),
+	}
+}
+
+// lastUserIndex returns the index of the last user message, or -1
+func lastUserIndex(messages []ai.Message) int {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return i
+		}
+	}
+	return -1
+}
+
+// resendLastTurn cuts a conversation back to its last user message,
+// optionally replacing that message's content, and sends the history again.
+// check vets the history under the lock before anything is changed. On
+// failure the original turn is restored.
+func (c *Controller) resendLastTurn(ctx context.Context, id ConversationID, check func(messages []ai.Message) error, content *string) (*ChatResponse, error) {
+	start := time.Now()
+
+	c.ensureLoaded(id)
+	c.mutex.Lock()
+	conversation, exists := c.conversations[id]
+	if !exists {
+		c.mutex.Unlock()
+		return nil, fmt.Errorf("conversation %s %w", id, ErrConversationNotFound)
+	}
+
+	messages := conversation.Messages
+	if err := check(messages); err != nil {
+		c.mutex.Unlock()
+		return nil, err
+	}
+	lastUser := lastUserIndex(messages)
+
+	// Build the request before the turn is cut, so one that cannot be sent
+	// leaves the conversation as it was
+	history := copyMessages(messages[:lastUser+1])
+	if content != nil {
+		history[lastUser].Content = *content
+	}
+	pending := &pendingRequest{conversation: conversation, userMessage: history[lastUser]}
+	history, outbound, trimmed, err := c.trimToBudgetLocked(history)
+	if err == nil {
+		pending.request, err = c.buildRequestLocked(c.lastTurns[id], outbound, c.toolsForLocked(id))
+	}
+	if err != nil {
+		c.mutex.Unlock()
+		c.logFailure(id, pending.request.Model, start, err)
+		return pending.failure(err), err
+	}
+	pending.trimmed = trimmed
+
+	// Keep the original turn to put back if the send fails
+	c.touchLocked(id)
+	removed := copyMessages(messages[lastUser:])
+	conversation.Messages = history
+	conversation.UpdatedAt = time.Now()
+	c.changedLocked(conversation)
+	cut := len(conversation.Messages)
+	c.beginRequestLocked(pending)
+	defer c.releaseRequest(pending)
+	c.mutex.Unlock()
+
+	response, err := c.send(ctx, pending, start)
+	if err != nil {
+		c.restoreTurn(conversation, cut, removed)
+	}
+	return response, err
+}
+
+// restoreTurn puts back a turn cut by resendLastTurn in place of the user
+// message it resent, unless the conversation has changed since it was cut
+func (c *Controller) restoreTurn(conversation *Conversation, cut int, removed []ai.Message) {
+	var notifications []thresholdNotification
+	defer func() { notifyThresholds(notifications) }()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(conversation.Messages) != cut {
+		return
+	}
+	conversation.Messages = append(conversation.Messages[:cut-1], removed...)
+	c.changedLocked(conversation)
+	notifications = c.checkThresholds(conversation)
+}
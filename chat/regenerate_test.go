@@ -0,0 +1,193 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/backends/mock"
+)
+
+func TestController_RegenerateLast(t *testing.T) {
+	backend := newRecordingBackend()
+	backend.SetLatency(0)
+	controller := NewController(backend, nil)
+	conv := controller.CreateConversation("system")
+
+	backend.QueueResponse("first answer")
+	if _, err := controller.SendMessage(context.Background(), ChatRequest{
+		ConversationID: conv.ID,
+		Message:        "Question",
+	}); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+
+	backend.QueueResponse("second answer")
+	response, err := controller.RegenerateLast(context.Background(), conv.ID)
+	if err != nil {
+		t.Fatalf("RegenerateLast failed: %v", err)
+	}
+	if response.Message.Content != "second answer" {
+		t.Errorf("Expected regenerated reply, got %q", response.Message.Content)
+	}
+
+	sent := backend.lastRequest().Messages
+	if len(sent) != 2 || sent[1].Content != "Question" {
+		t.Errorf("Expected history ending at the user message to be resent, got %+v", sent)
+	}
+
+	stored, _ := controller.GetConversation(conv.ID)
+	if len(stored.Messages) != 3 || stored.Messages[2].Content != "second answer" {
+		t.Errorf("Expected the old reply to be replaced, got %+v", stored.Messages)
+	}
+}
+
+func TestController_RegenerateLastKeepsTurnSettings(t *testing.T) {
+	backend := newRecordingBackend()
+	backend.SetLatency(0)
+	controller := NewController(backend, &ControllerConfig{DefaultModel: "gpt-4"})
+	conv := controller.CreateConversation("")
+
+	temperature := 0.2
+	if _, err := controller.SendMessage(context.Background(), ChatRequest{
+		ConversationID: conv.ID,
+		Message:        "Question",
+		Model:          "gpt-4o-mini",
+		Temperature:    &temperature,
+		Stop:           []string{"END"},
+	}); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+
+	for name, resend := range map[string]func() (*ChatResponse, error){
+		"RegenerateLast": func() (*ChatResponse, error) {
+			return controller.RegenerateLast(context.Background(), conv.ID)
+		},
+		"EditLastUserMessage": func() (*ChatResponse, error) {
+			return controller.EditLastUserMessage(context.Background(), conv.ID, "Edited")
+		},
+	} {
+		if _, err := resend(); err != nil {
+			t.Fatalf("%s failed: %v", name, err)
+		}
+		request := backend.lastRequest()
+		if request.Model != "gpt-4o-mini" || request.Temperature == nil || *request.Temperature != 0.2 ||
+			len(request.Stop) != 1 || request.Stop[0] != "END" {
+			t.Errorf("Expected %s to reuse the turn's model and parameters, got %+v", name, request)
+		}
+	}
+}
+
+func TestController_RegenerateLastReplacesToolExchange(t *testing.T) {
+	backend := mock.NewMockBackend()
+	backend.SetLatency(0)
+	controller := NewController(backend, nil)
+	conv := controller.CreateConversation("")
+
+	controller.mutex.Lock()
+	controller.conversations[conv.ID].Messages = []ai.Message{
+		{Role: "user", Content: "Weather?"},
+		{Role: "assistant", ToolCalls: []ai.ToolCall{{ID: "call_1", Type: "function", Function: ai.FunctionCall{Name: "get_weather", Arguments: "{}"}}}},
+		{Role: "tool", ToolCallID: "call_1", Content: "sunny"},
+		{Role: "assistant", Content: "It is sunny"},
+	}
+	controller.mutex.Unlock()
+
+	backend.QueueResponse("Sunny today")
+	if _, err := controller.RegenerateLast(context.Background(), conv.ID); err != nil {
+		t.Fatalf("RegenerateLast failed: %v", err)
+	}
+
+	stored, _ := controller.GetConversation(conv.ID)
+	if len(stored.Messages) != 2 || stored.Messages[1].Content != "Sunny today" {
+		t.Errorf("Expected the whole turn to be replaced, got %+v", stored.Messages)
+	}
+}
+
+func TestController_RegenerateLastErrors(t *testing.T) {
+	backend := mock.NewMockBackend()
+	backend.SetLatency(0)
+	controller := NewController(backend, nil)
+
+	if _, err := controller.RegenerateLast(context.Background(), "missing"); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Expected ErrConversationNotFound, got %v", err)
+	}
+
+	conv := controller.CreateConversation("system")
+	if _, err := controller.RegenerateLast(context.Background(), conv.ID); !errors.Is(err, ErrNothingToRegenerate) {
+		t.Errorf("Expected ErrNothingToRegenerate after a system prompt, got %v", err)
+	}
+
+	sendN(t, controller, conv.ID, 1)
+	backend.InjectError(&ai.APIError{StatusCode: 400, Message: "bad"})
+	before, _ := controller.GetConversation(conv.ID)
+	if _, err := controller.RegenerateLast(context.Background(), conv.ID); err == nil {
+		t.Fatal("Expected backend error")
+	}
+
+	after, _ := controller.GetConversation(conv.ID)
+	if len(after.Messages) != len(before.Messages) || after.Messages[2].Content != before.Messages[2].Content {
+		t.Errorf("Expected the previous reply to be restored after a failure, got %+v", after.Messages)
+	}
+}
+
+func TestController_EditLastUserMessage(t *testing.T) {
+	backend := newRecordingBackend()
+	backend.SetLatency(0)
+	controller := NewController(backend, nil)
+	conv := controller.CreateConversation("system")
+	sendN(t, controller, conv.ID, 2)
+
+	response, err := controller.EditLastUserMessage(context.Background(), conv.ID, "Fixed typo")
+	if err != nil {
+		t.Fatalf("EditLastUserMessage failed: %v", err)
+	}
+	if response.Message.Role != "assistant" {
+		t.Errorf("Expected an assistant reply, got %+v", response.Message)
+	}
+
+	sent := backend.lastRequest().Messages
+	if sent[len(sent)-1].Content != "Fixed typo" {
+		t.Errorf("Expected the edited message to be sent last, got %+v", sent[len(sent)-1])
+	}
+
+	stored, _ := controller.GetConversation(conv.ID)
+	if len(stored.Messages) != 5 {
+		t.Fatalf("Expected the old reply to be discarded, got %d messages", len(stored.Messages))
+	}
+	if stored.Messages[3].Content != "Fixed typo" || stored.Messages[4].Role != "assistant" {
+		t.Errorf("Expected the edited turn at the end, got %+v", stored.Messages[3:])
+	}
+}
+
+func TestController_EditLastUserMessageErrors(t *testing.T) {
+	backend := mock.NewMockBackend()
+	backend.SetLatency(0)
+	controller := NewController(backend, nil)
+
+	if _, err := controller.EditLastUserMessage(context.Background(), "missing", "text"); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Expected ErrConversationNotFound, got %v", err)
+	}
+
+	conv := controller.CreateConversation("system")
+	if _, err := controller.EditLastUserMessage(context.Background(), conv.ID, "text"); err == nil {
+		t.Error("Expected error without a user message")
+	}
+
+	sendN(t, controller, conv.ID, 1)
+	if _, err := controller.EditLastUserMessage(context.Background(), conv.ID, ""); !errors.Is(err, ai.ErrInvalidRequest) {
+		t.Errorf("Expected ErrInvalidRequest for empty content, got %v", err)
+	}
+
+	before, _ := controller.GetConversation(conv.ID)
+	backend.InjectError(&ai.APIError{StatusCode: 400, Message: "bad"})
+	if _, err := controller.EditLastUserMessage(context.Background(), conv.ID, "edited"); err == nil {
+		t.Fatal("Expected backend error")
+	}
+
+	after, _ := controller.GetConversation(conv.ID)
+	if len(after.Messages) != len(before.Messages) || after.Messages[1].Content != before.Messages[1].Content {
+		t.Errorf("Expected the original turn to be restored, got %+v", after.Messages)
+	}
+}
@@ -0,0 +1,50 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// DefaultRetryBaseDelay is the first backoff delay when
+// ControllerConfig.RetryBaseDelay is zero
+const DefaultRetryBaseDelay = 500 * time.Millisecond
+
+// withRetry calls attempt until it succeeds, fails with an error that is not
+// retryable, or the retry budget runs out. Delays double after each attempt
+// with jitter, and retrying stops early if the next delay would outlast the
+// context deadline. When more than one attempt was made the returned error
+// notes the attempt count.
+func (c *Controller) withRetry(ctx context.Context, attempt func() error) error {
+	backoff := &ai.Backoff{Base: c.retryBaseDelay, Multiplier: 2, Jitter: 0.5}
+
+	for attempts := 1; ; attempts++ {
+		err := attempt()
+		if err == nil || attempts > c.maxRetries || !ai.IsRetryable(err) {
+			if err != nil && attempts > 1 {
+				return fmt.Errorf("failed after %d attempts: %w", attempts, err)
+			}
+			return err
+		}
+
+		wait := backoff.Next()
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return fmt.Errorf("failed after %d attempts, no time left to retry: %w", attempts, err)
+		}
+
+		c.logger.Warn("retrying request",
+			slog.Int("attempt", attempts),
+			slog.Int64("delay_ms", wait.Milliseconds()),
+			slog.String("error", err.Error()),
+		)
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return fmt.Errorf("failed after %d attempts: %w", attempts, ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/backends/mock"
+)
+
+// flakyBackend fails with the queued errors before answering normally
+type flakyBackend struct {
+	*mock.MockBackend
+	failures []error
+	calls    int
+}
+
+func (f *flakyBackend) ChatCompletion(ctx context.Context, req ai.ChatCompletionRequest) (*ai.ChatCompletionResponse, error) {
+	f.calls++
+	if len(f.failures) > 0 {
+		err := f.failures[0]
+		f.failures = f.failures[1:]
+		return nil, err
+	}
+	return f.MockBackend.ChatCompletion(ctx, req)
+}
+
+func newRetryController(backend ai.Backend, retries int) (*Controller, ConversationID) {
+	controller := NewController(backend, &ControllerConfig{
+		MaxRetries:     retries,
+		RetryBaseDelay: time.Millisecond,
+	})
+	return controller, controller.CreateConversation("").ID
+}
+
+func TestController_RetriesTransientErrors(t *testing.T) {
+	backend := &flakyBackend{
+		MockBackend: mock.NewMockBackend(),
+		failures: []error{
+			&ai.APIError{Provider: "Test", StatusCode: 503, Message: "overloaded"},
+			&ai.APIError{Provider: "Test", StatusCode: 429, Message: "slow down"},
+		},
+	}
+	controller, id := newRetryController(backend, 3)
+
+	if _, err := controller.SendMessage(context.Background(), ChatRequest{ConversationID: id, Message: "hi"}); err != nil {
+		t.Fatalf("Expected retries to succeed, got %v", err)
+	}
+	if backend.calls != 3 {
+		t.Errorf("Expected 3 attempts, got %d", backend.calls)
+	}
+}
+
+func TestController_RetryGivesUp(t *testing.T) {
+	unavailable := &ai.APIError{Provider: "Test", StatusCode: 500, Message: "boom"}
+	backend := &flakyBackend{
+		MockBackend: mock.NewMockBackend(),
+		failures:    []error{unavailable, unavailable, unavailable, unavailable},
+	}
+	controller, id := newRetryController(backend, 2)
+
+	_, err := controller.SendMessage(context.Background(), ChatRequest{ConversationID: id, Message: "hi"})
+	if err == nil || !strings.Contains(err.Error(), "failed after 3 attempts") {
+		t.Fatalf("Expected error noting 3 attempts, got %v", err)
+	}
+
+	var apiErr *ai.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 500 {
+		t.Errorf("Expected the last backend error to be wrapped, got %v", err)
+	}
+}
+
+func TestController_NoRetryOnPermanentErrors(t *testing.T) {
+	backend := &flakyBackend{
+		MockBackend: mock.NewMockBackend(),
+		failures:    []error{&ai.APIError{Provider: "Test", StatusCode: 401, Message: "bad key"}},
+	}
+	controller, id := newRetryController(backend, 3)
+
+	_, err := controller.SendMessage(context.Background(), ChatRequest{ConversationID: id, Message: "hi"})
+	if err == nil || strings.Contains(err.Error(), "attempts") {
+		t.Errorf("Expected the auth error unchanged, got %v", err)
+	}
+	if backend.calls != 1 {
+		t.Errorf("Expected a single attempt, got %d", backend.calls)
+	}
+}
+
+func TestController_RetryRespectsDeadline(t *testing.T) {
+	backend := &flakyBackend{
+		MockBackend: mock.NewMockBackend(),
+		failures:    []error{&ai.APIError{Provider: "Test", StatusCode: 503, Message: "overloaded"}},
+	}
+	controller := NewController(backend, &ControllerConfig{
+		MaxRetries:     3,
+		RetryBaseDelay: time.Hour,
+	})
+	id := controller.CreateConversation("").ID
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+	_, err := controller.SendMessage(ctx, ChatRequest{ConversationID: id, Message: "hi"})
+	if err == nil || !strings.Contains(err.Error(), "no time left") {
+		t.Errorf("Expected retry to stop at the deadline, got %v", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("Should not wait for a backoff past the deadline, took %v", time.Since(start))
+	}
+}
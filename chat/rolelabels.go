@@ -0,0 +1,56 @@
+package chat
+
+import (
+	"regexp"
+	"strings"
+)
+
+// DefaultRoleLabels are the role labels models most often echo at the start
+// of a response
+var DefaultRoleLabels = []string{"Assistant", "AI", "Bot", "Model"}
+
+// RoleLabelTrimmer strips spurious role labels such as "Assistant:" from the
+// start of a response. A label is only removed when it is directly followed
+// by a colon and more text, so content like "Assistant managers report..."
+// is left alone.
+type RoleLabelTrimmer struct {
+	pattern *regexp.Regexp
+}
+
+// NewRoleLabelTrimmer creates a trimmer for the given labels, matched
+// case-insensitively. With no labels, DefaultRoleLabels is used.
+func NewRoleLabelTrimmer(labels ...string) *RoleLabelTrimmer {
+	if len(labels) == 0 {
+		labels = DefaultRoleLabels
+	}
+
+	quoted := make([]string, len(labels))
+	for i, label := range labels {
+		quoted[i] = regexp.QuoteMeta(label)
+	}
+
+	// Optional markdown emphasis may wrap the label or the colon,
+	// e.g. "**Assistant:**" or "**Assistant**:"
+	pattern := `(?i)^\s*[*_]{0,2}(?:` + strings.Join(quoted, "|") + `)[*_]{0,2}\s*:[*_]{0,2}[ \t]*(?:\r?\n)?`
+	return &RoleLabelTrimmer{pattern: regexp.MustCompile(pattern)}
+}
+
+// Trim removes any leading role labels from content. Content that would be
+// empty after trimming is returned unchanged.
+func (t *RoleLabelTrimmer) Trim(content string) string {
+	trimmed := content
+	for {
+		loc := t.pattern.FindStringIndex(trimmed)
+		if loc == nil {
+			break
+		}
+
+		rest := trimmed[loc[1]:]
+		if strings.TrimSpace(rest) == "" {
+			break
+		}
+		trimmed = rest
+	}
+
+	return trimmed
+}
@@ -0,0 +1,91 @@
+package chat
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/backends/mock"
+)
+
+func TestRoleLabelTrimmer_Trim(t *testing.T) {
+	trimmer := NewRoleLabelTrimmer()
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"plain label", "Assistant: Hello there.", "Hello there."},
+		{"lowercase label", "assistant: Hello there.", "Hello there."},
+		{"label on its own line", "AI:\nHere is the plan.", "Here is the plan."},
+		{"bold label", "**Assistant:** Sure.", "Sure."},
+		{"bold label outside colon", "**Assistant**: Sure.", "Sure."},
+		{"leading whitespace", "  Bot:  Done.", "Done."},
+		{"repeated labels", "Assistant: Assistant: Twice.", "Twice."},
+		{"no label", "Hello there.", "Hello there."},
+		{"legitimate word", "Assistant managers report to the director.", "Assistant managers report to the director."},
+		{"label without colon", "AI is a broad field.", "AI is a broad field."},
+		{"label mid-sentence", "I am your Assistant: ask away.", "I am your Assistant: ask away."},
+		{"label only", "Assistant:", "Assistant:"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := trimmer.Trim(tt.content); got != tt.want {
+				t.Errorf("Trim(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoleLabelTrimmer_CustomLabels(t *testing.T) {
+	trimmer := NewRoleLabelTrimmer("Claude")
+
+	if got := trimmer.Trim("Claude: Hi."); got != "Hi." {
+		t.Errorf("Expected custom label to be trimmed, got %q", got)
+	}
+	if got := trimmer.Trim("Assistant: Hi."); got != "Assistant: Hi." {
+		t.Errorf("Default labels should not apply when custom labels are given, got %q", got)
+	}
+}
+
+// labelEchoBackend replies with a response prefixed by a role label
+type labelEchoBackend struct {
+	*mock.MockBackend
+}
+
+func (b labelEchoBackend) ChatCompletion(ctx context.Context, req ai.ChatCompletionRequest) (*ai.ChatCompletionResponse, error) {
+	response, err := b.MockBackend.ChatCompletion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	response.Choices[0].Message.Content = "Assistant: " + response.Choices[0].Message.Content
+	return response, nil
+}
+
+func TestController_RoleLabelTrimmer(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		config := &ControllerConfig{DefaultModel: "gpt-4", MaxTokens: 100}
+		if enabled {
+			config.RoleLabelTrimmer = NewRoleLabelTrimmer()
+		}
+		controller := NewController(labelEchoBackend{mock.NewMockBackend()}, config)
+
+		conv := controller.CreateConversation("")
+		response, err := controller.SendMessage(context.Background(), ChatRequest{ConversationID: conv.ID, Message: "hi"})
+		if err != nil {
+			t.Fatalf("SendMessage failed: %v", err)
+		}
+
+		hasLabel := response.Message.Content[:len("Assistant:")] == "Assistant:"
+		if hasLabel == enabled {
+			t.Errorf("With trimming=%v got response %q", enabled, response.Message.Content)
+		}
+
+		stored, _ := controller.GetConversation(conv.ID)
+		if stored.Messages[len(stored.Messages)-1].Content != response.Message.Content {
+			t.Error("Stored assistant message should match the returned response")
+		}
+	}
+}
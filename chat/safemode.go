@@ -0,0 +1,72 @@
+package chat
+
+import (
+	"errors"
+)
+
+// ErrConfirmationRequired is returned by destructive operations when the
+// controller runs in safe mode and no confirmation token was supplied
+var ErrConfirmationRequired = errors.New("confirmation required for destructive operation")
+
+// ConfirmationToken acknowledges that a destructive operation is intended
+type ConfirmationToken string
+
+// Confirm is the token destructive operations accept in safe mode
+const Confirm ConfirmationToken = "confirm"
+
+// SafeMode reports whether destructive operations require confirmation
+func (c *Controller) SafeMode() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.safeMode
+}
+
+// SetSafeMode enables or disables confirmation for destructive operations
+func (c *Controller) SetSafeMode(enabled bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.safeMode = enabled
+}
+
+// DeleteAll removes every conversation, including those only in the store,
+// and returns how many were deleted. In safe mode the Confirm token must be
+// passed.
+func (c *Controller) DeleteAll(confirm ...ConfirmationToken) (int, error) {
+	if err := c.requireConfirmation(confirm); err != nil {
+		return 0, err
+	}
+
+	stored := c.storedIDs()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	deleted := len(c.conversations)
+	for _, id := range stored {
+		if _, loaded := c.conversations[id]; !loaded {
+			c.forgetLocked(id)
+			deleted++
+		}
+	}
+	for id := range c.conversations {
+		c.deleteLocked(id)
+	}
+
+	return deleted, nil
+}
+
+// requireConfirmation returns ErrConfirmationRequired when safe mode is on
+// and the Confirm token is missing
+func (c *Controller) requireConfirmation(tokens []ConfirmationToken) error {
+	if !c.SafeMode() {
+		return nil
+	}
+
+	for _, token := range tokens {
+		if token == Confirm {
+			return nil
+		}
+	}
+
+	return ErrConfirmationRequired
+}
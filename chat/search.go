@@ -0,0 +1,74 @@
+package chat
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// SearchResult is a conversation matching a search query
+type SearchResult struct {
+	ConversationSummary
+	// Matches is the number of messages containing the query
+	Matches int `json:"matches"`
+	// Snippet is the first line that contains the query
+	Snippet string `json:"snippet"`
+}
+
+// SearchConversations finds conversations whose messages contain query,
+// ignoring case. Results are ranked by number of matching messages, then by
+// most recent update. An empty query is an error.
+func (c *Controller) SearchConversations(query string) ([]SearchResult, error) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return nil, fmt.Errorf("%w: search query cannot be empty", ai.ErrInvalidRequest)
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	var results []SearchResult
+	for _, conversation := range c.conversations {
+		matches := 0
+		snippet := ""
+		for _, msg := range conversation.Messages {
+			if !strings.Contains(strings.ToLower(msg.Content), query) {
+				continue
+			}
+			matches++
+			if snippet == "" {
+				snippet = matchingLine(msg.Content, query)
+			}
+		}
+
+		if matches > 0 {
+			results = append(results, SearchResult{
+				ConversationSummary: *c.summarizeLocked(conversation),
+				Matches:             matches,
+				Snippet:             snippet,
+			})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Matches != results[j].Matches {
+			return results[i].Matches > results[j].Matches
+		}
+		return results[i].UpdatedAt.After(results[j].UpdatedAt)
+	})
+
+	return results, nil
+}
+
+// matchingLine returns the first line of content containing the lowercased
+// query, trimmed of surrounding whitespace
+func matchingLine(content, query string) string {
+	for _, line := range strings.Split(content, "\n") {
+		if strings.Contains(strings.ToLower(line), query) {
+			return strings.TrimSpace(line)
+		}
+	}
+	return ""
+}
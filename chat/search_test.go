@@ -0,0 +1,57 @@
+package chat
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/backends/mock"
+)
+
+func TestSearchConversations(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), nil)
+
+	seed := func(updated time.Time, contents ...string) ConversationID {
+		conv := controller.newConversation("")
+		controller.mutex.Lock()
+		for _, content := range contents {
+			conv.Messages = append(conv.Messages, ai.Message{Role: "user", Content: content})
+		}
+		conv.UpdatedAt = updated
+		controller.mutex.Unlock()
+		return conv.ID
+	}
+
+	now := time.Now()
+	once := seed(now, "intro\nHow do I find Goroutine leaks?\nthanks")
+	twice := seed(now.Add(-time.Hour), "goroutine leaks again", "more about GOROUTINE LEAKS")
+	recentOnce := seed(now.Add(time.Minute), "another goroutine leaks question")
+	seed(now, "nothing relevant here")
+
+	results, err := controller.SearchConversations("goroutine leaks")
+	if err != nil {
+		t.Fatalf("SearchConversations failed: %v", err)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 matching conversations, got %d", len(results))
+	}
+
+	order := []ConversationID{twice, recentOnce, once}
+	for i, id := range order {
+		if results[i].ID != id {
+			t.Errorf("Result %d: expected %s, got %s", i, id, results[i].ID)
+		}
+	}
+	if results[0].Matches != 2 {
+		t.Errorf("Expected 2 matches, got %d", results[0].Matches)
+	}
+	if results[2].Snippet != "How do I find Goroutine leaks?" {
+		t.Errorf("Expected first matching line as snippet, got %q", results[2].Snippet)
+	}
+
+	if _, err := controller.SearchConversations("   "); !errors.Is(err, ai.ErrInvalidRequest) {
+		t.Errorf("Expected ErrInvalidRequest for empty query, got %v", err)
+	}
+}
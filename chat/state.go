@@ -0,0 +1,166 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// StateFormatVersion is the archive format written by SaveState. Bump it
+// when the layout changes and teach LoadState to migrate older versions.
+const StateFormatVersion = 1
+
+// StateArchive is the versioned document written by SaveState, holding every
+// conversation and the controller statistics at the time of the save
+type StateArchive struct {
+	Version       int             `json:"version"`
+	SavedAt       time.Time       `json:"saved_at"`
+	Conversations []*Conversation `json:"conversations"`
+	Stats         ControllerStats `json:"stats"`
+}
+
+// SaveState writes all conversations, including those only in the store,
+// and statistics to w as a single versioned JSON archive, for backup or
+// migration. It returns the number of conversations archived.
+func (c *Controller) SaveState(w io.Writer) (int, error) {
+	stored := c.storedConversations()
+
+	c.mutex.RLock()
+	conversations := c.listLocked()
+	if c.writer != nil {
+		// Conversations evicted since the store was listed are among the
+		// writer's pending changes
+		latest := c.writer.overlay(stored)
+		for _, conversation := range conversations {
+			delete(latest, conversation.ID)
+		}
+		for _, conversation := range latest {
+			conversations = append(conversations, conversation)
+		}
+		sortConversations(conversations)
+	}
+	archive := StateArchive{
+		Version:       StateFormatVersion,
+		SavedAt:       time.Now(),
+		Conversations: conversations,
+		Stats:         c.statsLocked(),
+	}
+	c.mutex.RUnlock()
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(archive); err != nil {
+		return 0, fmt.Errorf("failed to write state: %w", err)
+	}
+	return len(conversations), nil
+}
+
+// LoadState replaces every conversation, including those only in the store,
+// with those in an archive written by SaveState, and restores the eviction
+// count. The archive is validated in full before anything changes. In safe
+// mode the Confirm token must be passed, since current conversations are
+// discarded.
+func (c *Controller) LoadState(r io.Reader, confirm ...ConfirmationToken) error {
+	if err := c.requireConfirmation(confirm); err != nil {
+		return err
+	}
+
+	archive, err := readStateArchive(r)
+	if err != nil {
+		return err
+	}
+
+	stored := c.storedIDs()
+
+	defer c.enforceCapacity()
+	var notifications []thresholdNotification
+	defer func() { notifyThresholds(notifications) }()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, id := range stored {
+		c.forgetLocked(id)
+	}
+	for id := range c.conversations {
+		c.deleteLocked(id)
+	}
+	for _, conversation := range archive.Conversations {
+		notifications = append(notifications, c.registerLocked(conversation)...)
+	}
+	c.stats.evictions.Store(int64(archive.Stats.EvictedConversations))
+	return nil
+}
+
+// MergeState adds the conversations in an archive written by SaveState to
+// the current set. An archived conversation replaces a current one with the
+// same ID; in safe mode that requires the Confirm token, and nothing changes
+// without it. It returns the number of conversations restored.
+func (c *Controller) MergeState(r io.Reader, confirm ...ConfirmationToken) (int, error) {
+	archive, err := readStateArchive(r)
+	if err != nil {
+		return 0, err
+	}
+
+	// Only needed if a conversation is replaced, checked before locking
+	confirmErr := c.requireConfirmation(confirm)
+	for _, conversation := range archive.Conversations {
+		c.ensureLoaded(conversation.ID)
+	}
+
+	defer c.enforceCapacity()
+	var notifications []thresholdNotification
+	defer func() { notifyThresholds(notifications) }()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if confirmErr != nil {
+		for _, conversation := range archive.Conversations {
+			if _, exists := c.conversations[conversation.ID]; exists {
+				return 0, confirmErr
+			}
+		}
+	}
+
+	for _, conversation := range archive.Conversations {
+		if _, exists := c.conversations[conversation.ID]; exists {
+			c.deleteLocked(conversation.ID)
+		}
+		notifications = append(notifications, c.registerLocked(conversation)...)
+	}
+	return len(archive.Conversations), nil
+}
+
+// readStateArchive decodes and validates a state archive. Every conversation
+// must have a unique ID and valid messages.
+func readStateArchive(r io.Reader) (*StateArchive, error) {
+	var archive StateArchive
+	if err := json.NewDecoder(r).Decode(&archive); err != nil {
+		return nil, fmt.Errorf("failed to parse state: %w", err)
+	}
+
+	if archive.Version < 1 || archive.Version > StateFormatVersion {
+		return nil, fmt.Errorf("unsupported state format version %d (expected %d)", archive.Version, StateFormatVersion)
+	}
+
+	seen := make(map[ConversationID]bool, len(archive.Conversations))
+	for i, conversation := range archive.Conversations {
+		if conversation == nil || conversation.ID == "" {
+			return nil, fmt.Errorf("conversation %d: conversation ID is required", i)
+		}
+		if seen[conversation.ID] {
+			return nil, fmt.Errorf("conversation %s appears more than once", conversation.ID)
+		}
+		seen[conversation.ID] = true
+
+		for j, msg := range conversation.Messages {
+			if err := ai.ValidateMessage(msg); err != nil {
+				return nil, fmt.Errorf("conversation %s: message %d: %w", conversation.ID, j, err)
+			}
+		}
+	}
+
+	return &archive, nil
+}
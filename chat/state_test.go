@@ -0,0 +1,177 @@
+package chat
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/backends/mock"
+)
+
+func TestController_SaveAndLoadState(t *testing.T) {
+	source := NewController(mock.NewMockBackend(), nil)
+	first := source.CreateConversation("system")
+	sendN(t, source, first.ID, 2)
+	second := source.CreateConversation("other")
+	if err := source.AddTag(second.ID, "work"); err != nil {
+		t.Fatalf("AddTag failed: %v", err)
+	}
+
+	var archive bytes.Buffer
+	if _, err := source.SaveState(&archive); err != nil {
+		t.Fatalf("SaveState failed: %v", err)
+	}
+	if !strings.Contains(archive.String(), `"version": 1`) {
+		t.Errorf("Expected a format version in the archive, got:\n%s", archive.String())
+	}
+
+	target := NewController(mock.NewMockBackend(), nil)
+	stale := target.CreateConversation("stale")
+	if err := target.LoadState(bytes.NewReader(archive.Bytes())); err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+
+	if _, err := target.GetConversation(stale.ID); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Expected LoadState to replace existing conversations, got %v", err)
+	}
+	restored, err := target.GetConversation(first.ID)
+	if err != nil {
+		t.Fatalf("Expected restored conversation, got %v", err)
+	}
+	if len(restored.Messages) != 5 {
+		t.Errorf("Expected 5 restored messages, got %d", len(restored.Messages))
+	}
+	if tagged := target.ListConversationsByTag("work"); len(tagged) != 1 || tagged[0].ID != second.ID {
+		t.Errorf("Expected tags to survive the round trip, got %+v", tagged)
+	}
+	if got, want := target.GetStats().TotalMessages, source.GetStats().TotalMessages; got != want {
+		t.Errorf("Expected %d messages after restore, got %d", want, got)
+	}
+}
+
+func TestController_SaveStateIncludesStoredConversations(t *testing.T) {
+	config := &ControllerConfig{DefaultModel: "gpt-4", Store: NewMemoryStore(), MaxConversations: 1}
+	source := NewController(mock.NewMockBackend(), config)
+	evicted := source.CreateConversation("evicted")
+	current := source.CreateConversation("current")
+
+	var archive bytes.Buffer
+	saved, err := source.SaveState(&archive)
+	if err != nil {
+		t.Fatalf("SaveState failed: %v", err)
+	}
+	if saved != 2 {
+		t.Errorf("Expected 2 archived conversations, got %d", saved)
+	}
+
+	// Restoring into the same store keeps the evicted conversation
+	if err := source.LoadState(bytes.NewReader(archive.Bytes())); err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	for _, id := range []ConversationID{evicted.ID, current.ID} {
+		if _, err := source.GetConversation(id); err != nil {
+			t.Errorf("Expected %s to be restored, got %v", id, err)
+		}
+	}
+}
+
+func TestController_MergeState(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), nil)
+	kept := controller.CreateConversation("kept")
+	shared := controller.CreateConversation("before backup")
+
+	var archive bytes.Buffer
+	if _, err := controller.SaveState(&archive); err != nil {
+		t.Fatalf("SaveState failed: %v", err)
+	}
+
+	// Changes after the backup are overwritten by the archived copy
+	sendN(t, controller, shared.ID, 1)
+	if err := controller.DeleteConversation(kept.ID); err != nil {
+		t.Fatalf("DeleteConversation failed: %v", err)
+	}
+	extra := controller.CreateConversation("after backup")
+
+	restored, err := controller.MergeState(&archive)
+	if err != nil {
+		t.Fatalf("MergeState failed: %v", err)
+	}
+	if restored != 2 {
+		t.Errorf("Expected 2 conversations restored, got %d", restored)
+	}
+	if stats := controller.GetStats(); stats.TotalConversations != 3 {
+		t.Errorf("Expected merged set of 3 conversations, got %d", stats.TotalConversations)
+	}
+	if conv, _ := controller.GetConversation(shared.ID); len(conv.Messages) != 1 {
+		t.Errorf("Expected the archived copy to win, got %d messages", len(conv.Messages))
+	}
+	if _, err := controller.GetConversation(extra.ID); err != nil {
+		t.Errorf("Expected conversations missing from the archive to be kept, got %v", err)
+	}
+}
+
+func TestController_MergeStateInSafeMode(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), &ControllerConfig{SafeMode: true})
+	shared := controller.CreateConversation("before backup")
+
+	var archive bytes.Buffer
+	if _, err := controller.SaveState(&archive); err != nil {
+		t.Fatalf("SaveState failed: %v", err)
+	}
+	sendN(t, controller, shared.ID, 1)
+
+	// Replacing an existing conversation needs confirmation
+	if _, err := controller.MergeState(bytes.NewReader(archive.Bytes())); !errors.Is(err, ErrConfirmationRequired) {
+		t.Fatalf("Expected ErrConfirmationRequired, got %v", err)
+	}
+	if conv, _ := controller.GetConversation(shared.ID); len(conv.Messages) != 3 {
+		t.Errorf("Expected an unconfirmed merge to change nothing, got %d messages", len(conv.Messages))
+	}
+
+	if _, err := controller.MergeState(bytes.NewReader(archive.Bytes()), Confirm); err != nil {
+		t.Fatalf("MergeState failed: %v", err)
+	}
+	if conv, _ := controller.GetConversation(shared.ID); len(conv.Messages) != 1 {
+		t.Errorf("Expected the confirmed merge to restore the archived copy, got %d messages", len(conv.Messages))
+	}
+
+	// Adding conversations without replacing any needs no confirmation
+	if err := controller.DeleteConversation(shared.ID, Confirm); err != nil {
+		t.Fatalf("DeleteConversation failed: %v", err)
+	}
+	if _, err := controller.MergeState(bytes.NewReader(archive.Bytes())); err != nil {
+		t.Errorf("Expected a merge without replacements to succeed, got %v", err)
+	}
+}
+
+func TestController_LoadStateRejectsBadArchives(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), &ControllerConfig{SafeMode: true})
+	existing := controller.CreateConversation("system")
+
+	tests := map[string]string{
+		"not json":        `{`,
+		"missing version": `{"conversations": []}`,
+		"future version":  `{"version": 99, "conversations": []}`,
+		"missing ID":      `{"version": 1, "conversations": [{"messages": []}]}`,
+		"duplicate ID":    `{"version": 1, "conversations": [{"id": "a"}, {"id": "a"}]}`,
+		"invalid message": `{"version": 1, "conversations": [{"id": "a", "messages": [{"role": "robot", "content": "beep"}]}]}`,
+	}
+	for name, archive := range tests {
+		if err := controller.LoadState(strings.NewReader(archive), Confirm); err == nil {
+			t.Errorf("%s: expected LoadState to fail", name)
+		}
+		if _, err := controller.MergeState(strings.NewReader(archive)); err == nil {
+			t.Errorf("%s: expected MergeState to fail", name)
+		}
+	}
+
+	if _, err := controller.GetConversation(existing.ID); err != nil {
+		t.Errorf("Expected failed restores to leave conversations untouched, got %v", err)
+	}
+
+	err := controller.LoadState(strings.NewReader(`{"version": 1, "conversations": []}`))
+	if !errors.Is(err, ErrConfirmationRequired) {
+		t.Errorf("Expected ErrConfirmationRequired in safe mode, got %v", err)
+	}
+}
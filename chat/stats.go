@@ -0,0 +1,184 @@
+package chat
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// ControllerStats provides statistics about the controller
+type ControllerStats struct {
+	TotalConversations int       `json:"total_conversations"`
+	TotalMessages      int       `json:"total_messages"`
+	BackendName        string    `json:"backend_name"`
+	OldestConversation time.Time `json:"oldest_conversation"`
+	NewestConversation time.Time `json:"newest_conversation"`
+	// EstimatedCostUSD is the total estimated cost across conversations
+	EstimatedCostUSD float64 `json:"estimated_cost_usd"`
+	// PricingUnavailable is set when some usage could not be priced
+	PricingUnavailable bool `json:"pricing_unavailable,omitempty"`
+	// EvictedConversations counts conversations evicted to stay within
+	// MaxConversations
+	EvictedConversations int `json:"evicted_conversations,omitempty"`
+}
+
+// statsCounters are running totals kept up to date as conversations change,
+// so GetStats can read them without walking the map or waiting on the
+// controller lock. They are only written with the controller lock held.
+type statsCounters struct {
+	conversations atomic.Int64
+	messages      atomic.Int64
+	costBits      atomic.Uint64 // math.Float64bits of the total cost
+	unpriced      atomic.Int64  // conversations with PricingUnavailable set
+	evictions     atomic.Int64
+	backendName   atomic.Value // string
+
+	// oldest and newest hold the earliest CreatedAt and latest UpdatedAt
+	// in Unix nanoseconds, or zero when there are no conversations. A
+	// deletion may remove either, so it marks them stale until the next
+	// reconcileLocked.
+	oldest atomic.Int64
+	newest atomic.Int64
+	stale  atomic.Bool
+}
+
+// conversationTally is what the counters last included for a conversation
+type conversationTally struct {
+	messages int
+	cost     float64
+	unpriced bool
+}
+
+// GetStats returns controller statistics. Totals are exact and read without
+// taking the controller lock. The oldest and newest timestamps are
+// recomputed after deletions, but only when the lock is free, so under
+// heavy load they may briefly still reflect a deleted conversation.
+func (c *Controller) GetStats() ControllerStats {
+	if c.stats.stale.Load() && c.mutex.TryRLock() {
+		c.reconcileLocked()
+		c.mutex.RUnlock()
+	}
+	return c.snapshotStats()
+}
+
+// statsLocked returns exact statistics. Must be called with the controller
+// lock held.
+func (c *Controller) statsLocked() ControllerStats {
+	if c.stats.stale.Load() {
+		c.reconcileLocked()
+	}
+	return c.snapshotStats()
+}
+
+// snapshotStats reads the counters
+func (c *Controller) snapshotStats() ControllerStats {
+	stats := ControllerStats{
+		TotalConversations:   int(c.stats.conversations.Load()),
+		TotalMessages:        int(c.stats.messages.Load()),
+		EstimatedCostUSD:     math.Float64frombits(c.stats.costBits.Load()),
+		PricingUnavailable:   c.stats.unpriced.Load() > 0,
+		EvictedConversations: int(c.stats.evictions.Load()),
+		OldestConversation:   time.Now(),
+	}
+	stats.BackendName, _ = c.stats.backendName.Load().(string)
+
+	if oldest := c.stats.oldest.Load(); oldest != 0 {
+		stats.OldestConversation = time.Unix(0, oldest)
+	}
+	if newest := c.stats.newest.Load(); newest != 0 {
+		stats.NewestConversation = time.Unix(0, newest)
+	}
+	return stats
+}
+
+// tallyLocked brings the counters up to date with a changed or newly stored
+// conversation. Must be called with the controller lock held.
+func (c *Controller) tallyLocked(conversation *Conversation) {
+	previous, seen := c.tallies[conversation.ID]
+	current := conversationTally{
+		messages: len(conversation.Messages),
+		cost:     conversation.EstimatedCostUSD,
+		unpriced: conversation.PricingUnavailable,
+	}
+	c.tallies[conversation.ID] = current
+
+	if !seen {
+		c.stats.conversations.Add(1)
+	}
+	c.stats.messages.Add(int64(current.messages - previous.messages))
+	c.addCost(current.cost - previous.cost)
+	if current.unpriced != previous.unpriced {
+		if current.unpriced {
+			c.stats.unpriced.Add(1)
+		} else {
+			c.stats.unpriced.Add(-1)
+		}
+	}
+
+	if created := conversation.CreatedAt.UnixNano(); c.stats.oldest.Load() == 0 || created < c.stats.oldest.Load() {
+		c.stats.oldest.Store(created)
+	}
+	if updated := conversation.UpdatedAt.UnixNano(); updated > c.stats.newest.Load() {
+		c.stats.newest.Store(updated)
+	}
+}
+
+// untallyLocked removes a deleted conversation from the counters. Must be
+// called with the controller lock held.
+func (c *Controller) untallyLocked(id ConversationID) {
+	previous, seen := c.tallies[id]
+	if !seen {
+		return
+	}
+	delete(c.tallies, id)
+
+	c.stats.conversations.Add(-1)
+	c.stats.messages.Add(int64(-previous.messages))
+	c.addCost(-previous.cost)
+	if previous.unpriced {
+		c.stats.unpriced.Add(-1)
+	}
+	c.stats.stale.Store(true)
+}
+
+// reconcileLocked recomputes the oldest and newest timestamps, and the
+// total cost so repeated additions cannot drift, from the conversations
+// themselves. Must be called with the controller lock held, shared or
+// exclusive.
+func (c *Controller) reconcileLocked() {
+	c.stats.stale.Store(false)
+
+	var oldest, newest int64
+	var cost float64
+	for _, conversation := range c.conversations {
+		if created := conversation.CreatedAt.UnixNano(); oldest == 0 || created < oldest {
+			oldest = created
+		}
+		if updated := conversation.UpdatedAt.UnixNano(); updated > newest {
+			newest = updated
+		}
+		cost += conversation.EstimatedCostUSD
+	}
+
+	c.stats.oldest.Store(oldest)
+	c.stats.newest.Store(newest)
+	c.stats.costBits.Store(math.Float64bits(cost))
+}
+
+// addCost adds delta to the total cost. Must be called with the controller
+// lock held exclusively.
+func (c *Controller) addCost(delta float64) {
+	if delta == 0 {
+		return
+	}
+	total := math.Float64frombits(c.stats.costBits.Load()) + delta
+	c.stats.costBits.Store(math.Float64bits(total))
+}
+
+// changedLocked records a change to a conversation in the statistics and
+// writes it through to the store. Must be called with the controller lock
+// held.
+func (c *Controller) changedLocked(conversation *Conversation) {
+	c.tallyLocked(conversation)
+	c.persistLocked(conversation)
+}
@@ -0,0 +1,175 @@
+package chat
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/backends/mock"
+)
+
+// newStatsController returns a controller over a mock backend that answers
+// immediately
+func newStatsController() *Controller {
+	backend := mock.NewMockBackend()
+	backend.SetLatency(0)
+	return NewController(backend, nil)
+}
+
+// recountStats computes the totals GetStats should report from the
+// conversations themselves
+func recountStats(c *Controller) (conversations, messages int) {
+	for _, conversation := range c.ListConversations() {
+		conversations++
+		messages += len(conversation.Messages)
+	}
+	return conversations, messages
+}
+
+func TestGetStatsStaysExact(t *testing.T) {
+	ctx := context.Background()
+	controller := newStatsController()
+
+	check := func(step string) {
+		t.Helper()
+		wantConversations, wantMessages := recountStats(controller)
+		stats := controller.GetStats()
+		if stats.TotalConversations != wantConversations || stats.TotalMessages != wantMessages {
+			t.Errorf("After %s: expected %d conversations and %d messages, got %d and %d",
+				step, wantConversations, wantMessages, stats.TotalConversations, stats.TotalMessages)
+		}
+	}
+
+	first := controller.CreateConversation("You are helpful.")
+	second := controller.CreateConversation("")
+	check("create")
+
+	for _, id := range []ConversationID{first.ID, second.ID, first.ID} {
+		if _, err := controller.SendMessage(ctx, ChatRequest{ConversationID: id, Message: "Hello"}); err != nil {
+			t.Fatalf("SendMessage failed: %v", err)
+		}
+	}
+	check("send")
+
+	fork, err := controller.ForkConversation(first.ID)
+	if err != nil {
+		t.Fatalf("ForkConversation failed: %v", err)
+	}
+	check("fork")
+
+	if err := controller.ClearConversation(first.ID); err != nil {
+		t.Fatalf("ClearConversation failed: %v", err)
+	}
+	check("clear")
+
+	if err := controller.SetSystemPrompt(second.ID, "Be brief."); err != nil {
+		t.Fatalf("SetSystemPrompt failed: %v", err)
+	}
+	check("system prompt")
+
+	if err := controller.DeleteConversation(fork.ID); err != nil {
+		t.Fatalf("DeleteConversation failed: %v", err)
+	}
+	check("delete")
+}
+
+func TestGetStatsTimestampsAfterDelete(t *testing.T) {
+	controller := newStatsController()
+	oldest := controller.CreateConversation("")
+	newer := controller.CreateConversation("")
+
+	stats := controller.GetStats()
+	if !stats.OldestConversation.Equal(oldest.CreatedAt) {
+		t.Errorf("Expected oldest %v, got %v", oldest.CreatedAt, stats.OldestConversation)
+	}
+
+	if err := controller.DeleteConversation(oldest.ID); err != nil {
+		t.Fatalf("DeleteConversation failed: %v", err)
+	}
+	stats = controller.GetStats()
+	if !stats.OldestConversation.Equal(newer.CreatedAt) {
+		t.Errorf("Expected oldest to move to %v after delete, got %v", newer.CreatedAt, stats.OldestConversation)
+	}
+	if !stats.NewestConversation.Equal(newer.UpdatedAt) {
+		t.Errorf("Expected newest %v, got %v", newer.UpdatedAt, stats.NewestConversation)
+	}
+}
+
+func TestGetStatsDuringConcurrentSends(t *testing.T) {
+	const senders, messagesEach = 8, 10
+	controller := newStatsController()
+
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				controller.GetStats()
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conversation := controller.CreateConversation("")
+			for j := 0; j < messagesEach; j++ {
+				if _, err := controller.SendMessage(context.Background(), ChatRequest{ConversationID: conversation.ID, Message: "Hello"}); err != nil {
+					t.Errorf("SendMessage failed: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	readers.Wait()
+
+	stats := controller.GetStats()
+	if stats.TotalConversations != senders || stats.TotalMessages != senders*messagesEach*2 {
+		t.Errorf("Expected %d conversations and %d messages, got %d and %d",
+			senders, senders*messagesEach*2, stats.TotalConversations, stats.TotalMessages)
+	}
+}
+
+// BenchmarkGetStatsDuringSends calls GetStats while other goroutines send
+// messages. Run it with -race to check the counters are read safely.
+func BenchmarkGetStatsDuringSends(b *testing.B) {
+	controller := newStatsController()
+	for i := 0; i < 100; i++ {
+		controller.CreateConversation("You are helpful.")
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conversation := controller.CreateConversation("")
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					controller.SendMessage(context.Background(), ChatRequest{ConversationID: conversation.ID, Message: "Hello"})
+				}
+			}
+		}()
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		controller.GetStats()
+	}
+	b.StopTimer()
+
+	close(stop)
+	wg.Wait()
+}
@@ -0,0 +1,355 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+)
+
+// ConversationStore keeps conversations outside the controller, such as in
+// Redis or SQLite. The controller works on its own in-memory copies and
+// writes every change through to the store in the background, so a durable
+// store survives restarts. Conversations evicted from memory stay in the
+// store and are loaded again when next used; expired conversations are
+// deleted from it. Implementations must be safe for concurrent use.
+type ConversationStore interface {
+	// Get returns a conversation, or an error wrapping
+	// ErrConversationNotFound if there is none with that ID
+	Get(ctx context.Context, id ConversationID) (*Conversation, error)
+
+	// Put creates or replaces a conversation. The controller passes a
+	// copy, which the store may keep.
+	Put(ctx context.Context, conversation *Conversation) error
+
+	// Delete removes a conversation. Deleting a missing conversation is
+	// not an error.
+	Delete(ctx context.Context, id ConversationID) error
+
+	// List returns every stored conversation
+	List(ctx context.Context) ([]*Conversation, error)
+}
+
+// MemoryStore is a ConversationStore that keeps conversations in a map, so
+// they last as long as the process. It is mostly useful in tests.
+type MemoryStore struct {
+	mutex         sync.RWMutex
+	conversations map[ConversationID]*Conversation
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{conversations: make(map[ConversationID]*Conversation)}
+}
+
+// Get returns a copy of a stored conversation
+func (s *MemoryStore) Get(ctx context.Context, id ConversationID) (*Conversation, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	conversation, exists := s.conversations[id]
+	if !exists {
+		return nil, fmt.Errorf("conversation %s %w", id, ErrConversationNotFound)
+	}
+	return copyConversation(conversation), nil
+}
+
+// Put stores a copy of a conversation
+func (s *MemoryStore) Put(ctx context.Context, conversation *Conversation) error {
+	if conversation == nil || conversation.ID == "" {
+		return fmt.Errorf("conversation ID is required")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.conversations[conversation.ID] = copyConversation(conversation)
+	return nil
+}
+
+// Delete removes a conversation
+func (s *MemoryStore) Delete(ctx context.Context, id ConversationID) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.conversations, id)
+	return nil
+}
+
+// List returns copies of every stored conversation, oldest first
+func (s *MemoryStore) List(ctx context.Context) ([]*Conversation, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	conversations := make([]*Conversation, 0, len(s.conversations))
+	for _, conversation := range s.conversations {
+		conversations = append(conversations, copyConversation(conversation))
+	}
+	sort.Slice(conversations, func(i, j int) bool {
+		return conversations[i].CreatedAt.Before(conversations[j].CreatedAt)
+	})
+	return conversations, nil
+}
+
+// storeWriter writes conversation changes to the store from a background
+// goroutine, so store calls never run under the controller lock. Changes
+// to a conversation made while an earlier one is being written are
+// coalesced, so only the latest is written.
+type storeWriter struct {
+	store  ConversationStore
+	logger *slog.Logger
+
+	mutex sync.Mutex
+	idle  *sync.Cond
+	// pending holds the changes not yet written and writing those being
+	// written, keyed by conversation. A nil conversation is a deletion.
+	pending map[ConversationID]*Conversation
+	writing map[ConversationID]*Conversation
+	running bool
+}
+
+// newStoreWriter creates a writer for store
+func newStoreWriter(store ConversationStore, logger *slog.Logger) *storeWriter {
+	w := &storeWriter{
+		store:   store,
+		logger:  logger,
+		pending: make(map[ConversationID]*Conversation),
+	}
+	w.idle = sync.NewCond(&w.mutex)
+	return w
+}
+
+// enqueue schedules conversation to be written under id, or id to be
+// deleted when conversation is nil. The writer keeps conversation, so the
+// caller must pass a copy.
+func (w *storeWriter) enqueue(id ConversationID, conversation *Conversation) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.pending[id] = conversation
+	if !w.running {
+		w.running = true
+		go w.run()
+	}
+}
+
+// run writes pending changes until there are none left
+func (w *storeWriter) run() {
+	for {
+		w.mutex.Lock()
+		if len(w.pending) == 0 {
+			w.running = false
+			w.writing = nil
+			w.idle.Broadcast()
+			w.mutex.Unlock()
+			return
+		}
+		batch := w.pending
+		w.pending = make(map[ConversationID]*Conversation)
+		w.writing = batch
+		w.mutex.Unlock()
+
+		for id, conversation := range batch {
+			w.write(id, conversation)
+		}
+	}
+}
+
+// write applies one change to the store. Failures are logged rather than
+// returned, since the in-memory change has already been made.
+func (w *storeWriter) write(id ConversationID, conversation *Conversation) {
+	if conversation == nil {
+		if err := w.store.Delete(context.Background(), id); err != nil {
+			w.logger.Warn("failed to delete stored conversation",
+				slog.String("conversation_id", string(id)),
+				slog.String("error", err.Error()),
+			)
+		}
+		return
+	}
+
+	if err := w.store.Put(context.Background(), conversation); err != nil {
+		w.logger.Warn("failed to store conversation",
+			slog.String("conversation_id", string(id)),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// get returns a copy of the latest version of a conversation, taking
+// changes not yet written into account
+func (w *storeWriter) get(id ConversationID) (*Conversation, error) {
+	w.mutex.Lock()
+	conversation, queued := w.pending[id]
+	if !queued {
+		conversation, queued = w.writing[id]
+	}
+	w.mutex.Unlock()
+
+	if !queued {
+		return w.store.Get(context.Background(), id)
+	}
+	if conversation == nil {
+		return nil, fmt.Errorf("conversation %s %w", id, ErrConversationNotFound)
+	}
+	return copyConversation(conversation), nil
+}
+
+// overlay applies the changes not yet written to conversations listed from
+// the store, returning copies of the result keyed by ID
+func (w *storeWriter) overlay(stored []*Conversation) map[ConversationID]*Conversation {
+	latest := make(map[ConversationID]*Conversation, len(stored))
+	for _, conversation := range stored {
+		latest[conversation.ID] = conversation
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for _, changes := range []map[ConversationID]*Conversation{w.writing, w.pending} {
+		for id, conversation := range changes {
+			if conversation == nil {
+				delete(latest, id)
+				continue
+			}
+			latest[id] = copyConversation(conversation)
+		}
+	}
+	return latest
+}
+
+// flush waits until every change enqueued so far has been written
+func (w *storeWriter) flush() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for w.running {
+		w.idle.Wait()
+	}
+}
+
+// Flush waits until every change made so far has been written to the
+// ConversationStore. It returns at once when there is no store.
+func (c *Controller) Flush() {
+	if c.writer != nil {
+		c.writer.flush()
+	}
+}
+
+// loadStore registers every conversation already in the store, so a
+// controller backed by a durable store resumes where it left off.
+// Conversations that expired while the controller was not running are
+// deleted instead.
+func (c *Controller) loadStore() {
+	if c.writer == nil {
+		return
+	}
+
+	conversations, err := c.store.List(context.Background())
+	if err != nil {
+		c.logger.Warn("failed to load stored conversations", slog.String("error", err.Error()))
+		return
+	}
+
+	defer c.enforceCapacity()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, conversation := range conversations {
+		if c.expiredLocked(conversation) {
+			c.forgetLocked(conversation.ID)
+			continue
+		}
+		// Crossings were reported before the conversation was stored,
+		// so thresholds are marked fired without notifying again
+		c.installLocked(conversation)
+	}
+}
+
+// storedIDs returns the IDs of every conversation in the store, once pending
+// writes have finished. Must be called without the controller lock held.
+func (c *Controller) storedIDs() []ConversationID {
+	conversations := c.storedConversations()
+	ids := make([]ConversationID, len(conversations))
+	for i, conversation := range conversations {
+		ids[i] = conversation.ID
+	}
+	return ids
+}
+
+// storedConversations returns every conversation in the store, once pending
+// writes have finished. Must be called without the controller lock held.
+func (c *Controller) storedConversations() []*Conversation {
+	if c.writer == nil {
+		return nil
+	}
+
+	c.writer.flush()
+	conversations, err := c.store.List(context.Background())
+	if err != nil {
+		c.logger.Warn("failed to list stored conversations", slog.String("error", err.Error()))
+		return nil
+	}
+	return conversations
+}
+
+// ensureLoaded loads a conversation from the store when it is not in
+// memory, such as after it was evicted. A stored conversation that has
+// expired is deleted from the store instead. Nothing happens when there is
+// no store or the store does not have it. Must be called without the
+// controller lock held.
+func (c *Controller) ensureLoaded(id ConversationID) {
+	if c.writer == nil || id == "" {
+		return
+	}
+
+	c.mutex.RLock()
+	_, exists := c.conversations[id]
+	c.mutex.RUnlock()
+	if exists {
+		return
+	}
+
+	conversation, err := c.writer.get(id)
+	if err != nil {
+		if !errors.Is(err, ErrConversationNotFound) {
+			c.logger.Warn("failed to load stored conversation",
+				slog.String("conversation_id", string(id)),
+				slog.String("error", err.Error()),
+			)
+		}
+		return
+	}
+
+	defer c.enforceCapacity()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, exists := c.conversations[id]; exists {
+		return
+	}
+	if c.expiredLocked(conversation) {
+		c.forgetLocked(id)
+		return
+	}
+	// Any crossing was reported before the conversation was evicted
+	c.installLocked(conversation)
+}
+
+// persistLocked schedules a copy of a conversation to be written to the
+// store. Must be called with the controller lock held.
+func (c *Controller) persistLocked(conversation *Conversation) {
+	if c.writer != nil {
+		c.writer.enqueue(conversation.ID, copyConversation(conversation))
+	}
+}
+
+// forgetLocked schedules a conversation to be removed from the store. Must
+// be called with the controller lock held.
+func (c *Controller) forgetLocked(id ConversationID) {
+	if c.writer != nil {
+		c.writer.enqueue(id, nil)
+	}
+}
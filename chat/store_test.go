@@ -0,0 +1,271 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/backends/mock"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	conversation := &Conversation{ID: "conv_1", Messages: []ai.Message{{Role: "user", Content: "Hello"}}}
+	if err := store.Put(ctx, conversation); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	conversation.Messages[0].Content = "changed after Put"
+
+	got, err := store.Get(ctx, "conv_1")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got.Messages[0].Content != "Hello" {
+		t.Errorf("Expected the store to keep its own copy, got %q", got.Messages[0].Content)
+	}
+
+	list, err := store.List(ctx)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("Expected 1 stored conversation, got %d (%v)", len(list), err)
+	}
+
+	if err := store.Delete(ctx, "conv_1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := store.Get(ctx, "conv_1"); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Expected ErrConversationNotFound after Delete, got %v", err)
+	}
+	if err := store.Delete(ctx, "conv_1"); err != nil {
+		t.Errorf("Expected deleting a missing conversation to succeed, got %v", err)
+	}
+	if err := store.Put(ctx, &Conversation{}); err == nil {
+		t.Error("Expected Put without an ID to fail")
+	}
+}
+
+func TestControllerWritesThroughToStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	controller := NewController(mock.NewMockBackend(), &ControllerConfig{DefaultModel: "gpt-4", Store: store})
+
+	conversation := controller.CreateConversation("You are helpful.")
+	if _, err := controller.SendMessage(ctx, ChatRequest{ConversationID: conversation.ID, Message: "Hello"}); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	if err := controller.SetMetadata(conversation.ID, "user", "alice"); err != nil {
+		t.Fatalf("SetMetadata failed: %v", err)
+	}
+	controller.Flush()
+
+	stored, err := store.Get(ctx, conversation.ID)
+	if err != nil {
+		t.Fatalf("Expected conversation in store: %v", err)
+	}
+	if len(stored.Messages) != 3 {
+		t.Errorf("Expected 3 stored messages, got %d", len(stored.Messages))
+	}
+	if stored.Metadata["user"] != "alice" {
+		t.Errorf("Expected stored metadata, got %v", stored.Metadata)
+	}
+
+	if err := controller.DeleteConversation(conversation.ID); err != nil {
+		t.Fatalf("DeleteConversation failed: %v", err)
+	}
+	controller.Flush()
+	if _, err := store.Get(ctx, conversation.ID); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Expected conversation removed from store, got %v", err)
+	}
+}
+
+func TestControllerLoadsStore(t *testing.T) {
+	store := NewMemoryStore()
+	first := NewController(mock.NewMockBackend(), &ControllerConfig{DefaultModel: "gpt-4", Store: store})
+	conversation := first.CreateConversation("You are helpful.")
+	if _, err := first.SendMessage(context.Background(), ChatRequest{ConversationID: conversation.ID, Message: "Hello"}); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	first.Flush()
+
+	second := NewController(mock.NewMockBackend(), &ControllerConfig{DefaultModel: "gpt-4", Store: store})
+	restored, err := second.GetConversation(conversation.ID)
+	if err != nil {
+		t.Fatalf("Expected conversation to be loaded from the store: %v", err)
+	}
+	if len(restored.Messages) != 3 {
+		t.Errorf("Expected 3 restored messages, got %d", len(restored.Messages))
+	}
+}
+
+func TestMemoryStoreConcurrentUse(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := ConversationID(string(rune('a' + i)))
+			store.Put(ctx, &Conversation{ID: id})
+			store.Get(ctx, id)
+			store.List(ctx)
+			store.Delete(ctx, id)
+		}(i)
+	}
+	wg.Wait()
+
+	if list, _ := store.List(ctx); len(list) != 0 {
+		t.Errorf("Expected an empty store, got %d conversations", len(list))
+	}
+}
+
+func TestControllerKeepsEvictedConversationsInStore(t *testing.T) {
+	store := NewMemoryStore()
+	controller := NewController(mock.NewMockBackend(), &ControllerConfig{DefaultModel: "gpt-4", Store: store, MaxConversations: 1})
+
+	first := controller.CreateConversation("You are helpful.")
+	if err := controller.SetMetadata(first.ID, "user", "alice"); err != nil {
+		t.Fatalf("SetMetadata failed: %v", err)
+	}
+	controller.CreateConversation("")
+	if got := len(controller.ListConversations()); got != 1 {
+		t.Fatalf("Expected 1 conversation in memory, got %d", got)
+	}
+
+	// The evicted conversation is loaded back from the store when used
+	restored, err := controller.GetConversation(first.ID)
+	if err != nil {
+		t.Fatalf("Expected evicted conversation to be loaded from the store: %v", err)
+	}
+	if restored.Metadata["user"] != "alice" {
+		t.Errorf("Expected restored metadata, got %v", restored.Metadata)
+	}
+
+	controller.Flush()
+	if list, _ := store.List(context.Background()); len(list) != 2 {
+		t.Errorf("Expected both conversations to stay in the store, got %d", len(list))
+	}
+}
+
+func TestControllerDeletesExpiredConversationsFromStore(t *testing.T) {
+	store := NewMemoryStore()
+	config := &ControllerConfig{DefaultModel: "gpt-4", Store: store, ConversationTTL: time.Hour}
+	controller := NewController(mock.NewMockBackend(), config)
+
+	pruned := controller.CreateConversation("You are helpful.")
+	backdate(controller, pruned.ID, 2*time.Hour)
+	if count := controller.PruneExpired(); count != 1 {
+		t.Fatalf("Expected 1 pruned conversation, got %d", count)
+	}
+	controller.Flush()
+	if _, err := store.Get(context.Background(), pruned.ID); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Expected the pruned conversation to be deleted from the store, got %v", err)
+	}
+
+	// A conversation that expires while no controller is running is
+	// dropped on the next start
+	stale := controller.CreateConversation("")
+	fresh := controller.CreateConversation("")
+	backdate(controller, stale.ID, 2*time.Hour)
+	controller.mutex.Lock()
+	controller.persistLocked(controller.conversations[stale.ID])
+	controller.mutex.Unlock()
+	controller.Stop()
+
+	restarted := NewController(mock.NewMockBackend(), config)
+	if _, err := restarted.GetConversation(stale.ID); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Expected the expired conversation to be gone after a restart, got %v", err)
+	}
+	if _, err := restarted.GetConversation(fresh.ID); err != nil {
+		t.Errorf("Expected the fresh conversation to be restored, got %v", err)
+	}
+	restarted.Flush()
+	if list, _ := store.List(context.Background()); len(list) != 1 {
+		t.Errorf("Expected only the fresh conversation in the store, got %d", len(list))
+	}
+}
+
+func TestControllerExpiresConversationsOnlyInStore(t *testing.T) {
+	store := NewMemoryStore()
+	controller := NewController(mock.NewMockBackend(), &ControllerConfig{DefaultModel: "gpt-4", Store: store, ConversationTTL: time.Hour})
+
+	// Written by another controller sharing the store
+	old := time.Now().Add(-2 * time.Hour)
+	for _, id := range []ConversationID{"accessed", "pruned"} {
+		if err := store.Put(context.Background(), &Conversation{ID: id, CreatedAt: old, UpdatedAt: old}); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	// An expired conversation is not loaded back on access
+	if _, err := controller.GetConversation("accessed"); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Expected the expired conversation not to load, got %v", err)
+	}
+	if pruned := controller.PruneExpired(); pruned != 1 {
+		t.Errorf("Expected 1 pruned conversation, got %d", pruned)
+	}
+	controller.Flush()
+	if list, _ := store.List(context.Background()); len(list) != 0 {
+		t.Errorf("Expected the expired conversations to be deleted from the store, got %d", len(list))
+	}
+}
+
+func TestControllerDeleteAllClearsStore(t *testing.T) {
+	store := NewMemoryStore()
+	controller := NewController(mock.NewMockBackend(), &ControllerConfig{DefaultModel: "gpt-4", Store: store, MaxConversations: 1})
+
+	controller.CreateConversation("")
+	controller.CreateConversation("")
+
+	deleted, err := controller.DeleteAll()
+	if err != nil {
+		t.Fatalf("DeleteAll failed: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("Expected 2 deleted conversations, got %d", deleted)
+	}
+	controller.Flush()
+	if list, _ := store.List(context.Background()); len(list) != 0 {
+		t.Errorf("Expected an empty store, got %d conversations", len(list))
+	}
+}
+
+// blockingStore is a MemoryStore whose Put waits until release is closed
+type blockingStore struct {
+	*MemoryStore
+	release chan struct{}
+}
+
+func (s *blockingStore) Put(ctx context.Context, conversation *Conversation) error {
+	<-s.release
+	return s.MemoryStore.Put(ctx, conversation)
+}
+
+func TestControllerWritesStoreOutsideLock(t *testing.T) {
+	store := &blockingStore{MemoryStore: NewMemoryStore(), release: make(chan struct{})}
+	controller := NewController(mock.NewMockBackend(), &ControllerConfig{DefaultModel: "gpt-4", Store: store})
+
+	// A slow store must not hold up the controller
+	conversation := controller.CreateConversation("")
+	for i := 0; i < 5; i++ {
+		if err := controller.SetMetadata(conversation.ID, "step", string(rune('a'+i))); err != nil {
+			t.Fatalf("SetMetadata failed: %v", err)
+		}
+	}
+
+	close(store.release)
+	controller.Flush()
+
+	stored, err := store.Get(context.Background(), conversation.ID)
+	if err != nil {
+		t.Fatalf("Expected conversation in store: %v", err)
+	}
+	if stored.Metadata["step"] != "e" {
+		t.Errorf("Expected the latest change to be stored, got %v", stored.Metadata)
+	}
+}
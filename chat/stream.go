@@ -0,0 +1,205 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// StreamEvent is sent on the channel returned by SendMessageStream. Events
+// carry content deltas as they arrive; the last event carries Response once
+// the assistant message has been added to the conversation, and Err if the
+// stream ended early.
+type StreamEvent struct {
+	// Delta is the next piece of assistant content
+	Delta string
+	// Response is set on the final event
+	Response *ChatResponse
+	// Err is set on the final event when the stream failed
+	Err error
+}
+
+// SendMessageStream sends a message and streams the response back as it is
+// generated. Backends that do not implement ai.StreamingBackend are sent a
+// regular ChatCompletion and their response is delivered as a single delta.
+//
+// The returned channel is closed after the final event. Callers must read
+// until it is closed. If ctx is cancelled mid-stream, the content received so
+// far is kept in the conversation and the final event carries the error.
+func (c *Controller) SendMessageStream(ctx context.Context, request ChatRequest) (<-chan StreamEvent, error) {
+	start := time.Now()
+
+	pending, err := c.prepareRequest(request)
+	if err != nil {
+		c.releaseRequest(pending)
+		c.logFailure(request.ConversationID, request.Model, start, err)
+		return nil, err
+	}
+
+	chunks, err := c.startStream(ctx, pending)
+	if err != nil {
+		c.releaseRequest(pending)
+		c.logFailure(pending.conversation.ID, pending.request.Model, start, err)
+		return nil, err
+	}
+
+	events := make(chan StreamEvent)
+	go func() {
+		defer close(events)
+		defer c.releaseRequest(pending)
+
+		var content strings.Builder
+		var toolCalls []ai.ToolCall
+		var finishReason string
+		var usage ai.Usage
+		var metadata map[string]string
+		var responseID, fingerprint string
+		model := pending.request.Model
+		var streamErr error
+
+	receive:
+		for chunk := range chunks {
+			if chunk.Err != nil {
+				streamErr = chunk.Err
+				break
+			}
+
+			content.WriteString(chunk.Delta)
+			toolCalls = append(toolCalls, chunk.ToolCalls...)
+			if chunk.FinishReason != "" {
+				finishReason = chunk.FinishReason
+			}
+			if chunk.Usage != nil {
+				usage = *chunk.Usage
+			}
+			if chunk.ProviderMetadata != nil {
+				metadata = chunk.ProviderMetadata
+			}
+			if chunk.ID != "" {
+				responseID = chunk.ID
+			}
+			if chunk.Model != "" {
+				model = chunk.Model
+			}
+			if chunk.SystemFingerprint != "" {
+				fingerprint = chunk.SystemFingerprint
+			}
+
+			if chunk.Delta == "" {
+				continue
+			}
+			select {
+			case events <- StreamEvent{Delta: chunk.Delta}:
+			case <-ctx.Done():
+				streamErr = ctx.Err()
+				break receive
+			}
+		}
+		if streamErr != nil {
+			// Let the backend finish shutting down without blocking it
+			go func() {
+				for range chunks {
+				}
+			}()
+		}
+
+		if streamErr != nil && content.Len() == 0 && len(toolCalls) == 0 {
+			c.logFailure(pending.conversation.ID, pending.request.Model, start, streamErr)
+			events <- StreamEvent{Response: pending.failure(streamErr), Err: streamErr}
+			return
+		}
+
+		if fingerprint == "" {
+			fingerprint = metadata["system_fingerprint"]
+		}
+		completion := &ai.ChatCompletionResponse{
+			ID:      responseID,
+			Object:  "chat.completion",
+			Created: time.Now().Unix(),
+			Model:   model,
+			Choices: []ai.Choice{{
+				Message: ai.Message{
+					Role:      "assistant",
+					Content:   content.String(),
+					ToolCalls: toolCalls,
+				},
+				FinishReason: finishReason,
+			}},
+			Usage:             usage,
+			ProviderMetadata:  metadata,
+			SystemFingerprint: fingerprint,
+		}
+		if streamErr == nil {
+			handled, err := c.handleEmptyResponse(ctx, pending, completion)
+			if err != nil {
+				c.logFailure(pending.conversation.ID, pending.request.Model, start, err)
+				events <- StreamEvent{Response: pending.failure(err), Err: err}
+				return
+			}
+			if handled != completion {
+				// A retry replaced the empty reply, which streamed nothing
+				events <- StreamEvent{Delta: handled.Choices[0].Message.Content}
+				completion = handled
+			}
+		}
+
+		response := c.recordResponse(pending, completion)
+		if streamErr != nil {
+			response.Error = streamErr.Error()
+			c.logFailure(pending.conversation.ID, pending.request.Model, start, streamErr)
+		} else {
+			c.logSent(response, start)
+			c.autoSummarize(ctx, response)
+		}
+
+		events <- StreamEvent{Response: response, Err: streamErr}
+	}()
+
+	return events, nil
+}
+
+// startStream opens a stream from the backend, retrying transient failures
+// and falling back to other models before any content arrives, and adapts
+// non-streaming backends into a single-chunk stream
+func (c *Controller) startStream(ctx context.Context, pending *pendingRequest) (<-chan ai.StreamChunk, error) {
+	if streaming, ok := c.backend.(ai.StreamingBackend); ok {
+		var chunks <-chan ai.StreamChunk
+		err := c.withModelFallback(ctx, pending, func(request ai.ChatCompletionRequest) error {
+			var err error
+			chunks, err = streaming.ChatCompletionStream(ctx, request)
+			return err
+		})
+		return chunks, err
+	}
+
+	var response *ai.ChatCompletionResponse
+	err := c.withModelFallback(ctx, pending, func(request ai.ChatCompletionRequest) error {
+		var err error
+		response, err = c.backend.ChatCompletion(ctx, request)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Choices) == 0 {
+		return nil, fmt.Errorf("no response choices returned")
+	}
+
+	chunks := make(chan ai.StreamChunk, 1)
+	usage := response.Usage
+	chunks <- ai.StreamChunk{
+		Delta:             response.Choices[0].Message.Content,
+		ToolCalls:         response.Choices[0].Message.ToolCalls,
+		FinishReason:      response.Choices[0].FinishReason,
+		Usage:             &usage,
+		ProviderMetadata:  response.ProviderMetadata,
+		ID:                response.ID,
+		Model:             response.Model,
+		SystemFingerprint: response.SystemFingerprint,
+	}
+	close(chunks)
+	return chunks, nil
+}
@@ -0,0 +1,166 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/backends/mock"
+)
+
+// collect reads a stream to completion and returns the deltas and final event
+func collect(t *testing.T, events <-chan StreamEvent) ([]string, StreamEvent) {
+	t.Helper()
+
+	var deltas []string
+	var final StreamEvent
+	for event := range events {
+		if event.Delta != "" {
+			deltas = append(deltas, event.Delta)
+		}
+		if event.Response != nil {
+			final = event
+		}
+	}
+	return deltas, final
+}
+
+func TestSendMessageStream(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), nil)
+	conv := controller.CreateConversation("")
+
+	events, err := controller.SendMessageStream(context.Background(), ChatRequest{
+		ConversationID: conv.ID,
+		Message:        "Stream this please",
+	})
+	if err != nil {
+		t.Fatalf("SendMessageStream failed: %v", err)
+	}
+
+	deltas, final := collect(t, events)
+	if len(deltas) < 5 {
+		t.Errorf("Expected the response word by word, got %d deltas", len(deltas))
+	}
+	if final.Err != nil || final.Response == nil {
+		t.Fatalf("Expected a successful final event, got %+v", final)
+	}
+
+	streamed := strings.Join(deltas, "")
+	if final.Response.Message.Content != streamed {
+		t.Errorf("Expected final message %q to match streamed content %q", final.Response.Message.Content, streamed)
+	}
+
+	got, _ := controller.GetConversation(conv.ID)
+	if len(got.Messages) != 2 || got.Messages[1].Content != streamed {
+		t.Errorf("Expected assembled assistant message in conversation, got %+v", got.Messages)
+	}
+	if got.Usage.TotalTokens == 0 {
+		t.Error("Expected usage from the final chunk to be recorded")
+	}
+}
+
+func TestSendMessageStream_CancelKeepsPartialContent(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), nil)
+	conv := controller.CreateConversation("")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := controller.SendMessageStream(ctx, ChatRequest{
+		ConversationID: conv.ID,
+		Message:        "Stream this please",
+	})
+	if err != nil {
+		t.Fatalf("SendMessageStream failed: %v", err)
+	}
+
+	var received []string
+	var final StreamEvent
+	for event := range events {
+		if event.Delta != "" {
+			received = append(received, event.Delta)
+			if len(received) == 3 {
+				cancel()
+			}
+		}
+		if event.Response != nil {
+			final = event
+		}
+	}
+
+	if !errors.Is(final.Err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled on final event, got %v", final.Err)
+	}
+
+	got, _ := controller.GetConversation(conv.ID)
+	if len(got.Messages) != 2 {
+		t.Fatalf("Expected partial assistant message to be kept, got %+v", got.Messages)
+	}
+	partial := got.Messages[1].Content
+	if !strings.HasPrefix(partial, strings.Join(received[:3], "")) {
+		t.Errorf("Expected partial content to start with received deltas, got %q", partial)
+	}
+	if strings.HasSuffix(partial, "API!") {
+		t.Errorf("Expected the response to be cut short, got %q", partial)
+	}
+}
+
+func TestSendMessageStream_NonStreamingBackend(t *testing.T) {
+	// Embedding only the Backend interface hides ChatCompletionStream
+	backend := struct{ ai.Backend }{mock.NewMockBackend()}
+	controller := NewController(backend, nil)
+
+	events, err := controller.SendMessageStream(context.Background(), ChatRequest{Message: "hello"})
+	if err != nil {
+		t.Fatalf("SendMessageStream failed: %v", err)
+	}
+
+	deltas, final := collect(t, events)
+	if len(deltas) != 1 || !strings.Contains(deltas[0], "received: 'hello'") {
+		t.Errorf("Expected the full response as a single delta, got %q", deltas)
+	}
+	if final.Err != nil || final.Response.Message.Content != deltas[0] {
+		t.Errorf("Expected final response to match the delta, got %+v", final)
+	}
+}
+
+// servedByBackend answers as a different model than the one requested, as a
+// router or fallback backend does
+type servedByBackend struct {
+	ai.Backend
+}
+
+func (b servedByBackend) ChatCompletion(ctx context.Context, req ai.ChatCompletionRequest) (*ai.ChatCompletionResponse, error) {
+	response, err := b.Backend.ChatCompletion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	response.ID = "resp-1"
+	response.Model = "gpt-4o-mini"
+	response.SystemFingerprint = "fp-1"
+	return response, nil
+}
+
+func TestSendMessageStream_KeepsServedModel(t *testing.T) {
+	controller := NewController(servedByBackend{mock.NewMockBackend()}, nil)
+
+	events, err := controller.SendMessageStream(context.Background(), ChatRequest{Message: "hello", Model: "gpt-4"})
+	if err != nil {
+		t.Fatalf("SendMessageStream failed: %v", err)
+	}
+
+	_, final := collect(t, events)
+	if final.Err != nil {
+		t.Fatalf("Stream failed: %v", final.Err)
+	}
+	response := final.Response.Response
+	if response.ID != "resp-1" || response.Model != "gpt-4o-mini" || response.SystemFingerprint != "fp-1" {
+		t.Errorf("Expected the backend's ID, model and fingerprint, got %+v", response)
+	}
+	conversation, _ := controller.GetConversation(final.Response.ConversationID)
+	if conversation.LastModel != "gpt-4o-mini" {
+		t.Errorf("Expected the served model to be recorded, got %q", conversation.LastModel)
+	}
+}
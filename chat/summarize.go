@@ -0,0 +1,214 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// DefaultAutoSummarizeKeepRecent is the number of recent turns kept verbatim
+// by automatic summarization when ControllerConfig.AutoSummarizeKeepRecent
+// is zero
+const DefaultAutoSummarizeKeepRecent = 2
+
+// summarizeInstructions is the system prompt used to summarize old history
+const summarizeInstructions = "Summarize the following conversation concisely. " +
+	"Keep facts, decisions, names, numbers, and open questions that later turns may rely on. " +
+	"Reply with the summary only."
+
+// SummarizeAndCompress asks the backend to summarize the older part of a
+// conversation and replaces it with a single summary message, marked with
+// SummaryPrefix, right after the system prompt. The last keepRecent turns,
+// each starting at a user message, are kept verbatim. An earlier summary in
+// the old part is folded into the new one; if it is the only thing old
+// enough to compress, nothing is sent. The compression is recorded in the
+// conversation's history and the summarization request counts toward its
+// usage.
+func (c *Controller) SummarizeAndCompress(ctx context.Context, id ConversationID, keepRecent int) error {
+	_, err := c.summarizeAndCompress(ctx, id, keepRecent)
+	return err
+}
+
+// summarizeAndCompress does the work of SummarizeAndCompress and returns the
+// compression record, or nil if there was nothing to summarize
+func (c *Controller) summarizeAndCompress(ctx context.Context, id ConversationID, keepRecent int) (*CompressionRecord, error) {
+	if keepRecent < 0 {
+		return nil, fmt.Errorf("%w: keepRecent cannot be negative", ai.ErrInvalidRequest)
+	}
+
+	c.ensureLoaded(id)
+	c.mutex.RLock()
+	conversation, exists := c.conversations[id]
+	if !exists {
+		c.mutex.RUnlock()
+		return nil, fmt.Errorf("conversation %s %w", id, ErrConversationNotFound)
+	}
+	start := compressionStart(conversation.Messages)
+	end := recentTurnsStart(conversation.Messages, keepRecent)
+	var old []ai.Message
+	if end > start {
+		old = copyMessages(conversation.Messages[start:end])
+	}
+	model := c.defaultModel
+	c.mutex.RUnlock()
+
+	if !hasUnsummarized(old) {
+		return nil, nil
+	}
+
+	request := ai.ChatCompletionRequest{
+		Model: model,
+		Messages: []ai.Message{
+			{Role: "system", Content: summarizeInstructions},
+			// The transcript is sent to the backend, so it is preprocessed
+			// too; old stays raw to check against the stored history later
+			{Role: "user", Content: transcript(c.preprocessMessages(copyMessages(old)))},
+		},
+	}
+
+	var response *ai.ChatCompletionResponse
+	err := c.withRetry(ctx, func() error {
+		var err error
+		response, err = c.backend.ChatCompletion(ctx, request)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize conversation: %w", err)
+	}
+	if len(response.Choices) == 0 {
+		return nil, fmt.Errorf("failed to summarize conversation: no response choices returned")
+	}
+
+	servedModel := model
+	if response.Model != "" {
+		servedModel = response.Model
+	}
+	cost, priced := estimateCost(c.pricing, servedModel, response.Usage)
+
+	c.mutex.Lock()
+	conversation, exists = c.conversations[id]
+	if !exists {
+		c.mutex.Unlock()
+		return nil, fmt.Errorf("conversation %s %w", id, ErrConversationNotFound)
+	}
+
+	// The history may have been trimmed or cleared while the backend was
+	// summarizing; only compress if the old messages are still in place
+	start = compressionStart(conversation.Messages)
+	if start+len(old) > len(conversation.Messages) ||
+		!reflect.DeepEqual(conversation.Messages[start:start+len(old)], old) {
+		c.mutex.Unlock()
+		return nil, fmt.Errorf("conversation %s changed while it was being summarized", id)
+	}
+
+	record, err := c.compressLocked(conversation, len(old), response.Choices[0].Message.Content)
+	if err != nil {
+		c.mutex.Unlock()
+		return nil, fmt.Errorf("failed to compress conversation: %w", err)
+	}
+	conversation.Usage.PromptTokens += response.Usage.PromptTokens
+	conversation.Usage.CompletionTokens += response.Usage.CompletionTokens
+	conversation.Usage.TotalTokens += response.Usage.TotalTokens
+	conversation.EstimatedCostUSD += cost
+	if !priced && response.Usage.TotalTokens > 0 {
+		conversation.PricingUnavailable = true
+	}
+	c.changedLocked(conversation)
+	notifications := c.checkThresholds(conversation)
+	c.mutex.Unlock()
+
+	notifyThresholds(notifications)
+	c.recordUsage(id, servedModel, response.Usage, cost)
+	return record, nil
+}
+
+// autoSummarize runs SummarizeAndCompress once a conversation reaches the
+// AutoSummarizeAtTokens threshold and reports the outcome on response
+func (c *Controller) autoSummarize(ctx context.Context, response *ChatResponse) {
+	if c.autoSummarizeAt <= 0 {
+		return
+	}
+
+	c.mutex.RLock()
+	conversation, exists := c.conversations[response.ConversationID]
+	tokens := 0
+	if exists {
+		tokens = c.tokenCounter(conversation.Messages)
+	}
+	c.mutex.RUnlock()
+
+	if tokens < c.autoSummarizeAt {
+		return
+	}
+
+	record, err := c.summarizeAndCompress(ctx, response.ConversationID, c.autoSummarizeKeep)
+	if err != nil {
+		c.logger.Warn("automatic summarization failed",
+			slog.String("conversation_id", string(response.ConversationID)),
+			slog.String("error", err.Error()),
+		)
+		response.SummarizeError = err.Error()
+		return
+	}
+	if record != nil {
+		response.SummarizedMessages = record.MessagesReplaced
+	}
+}
+
+// recentTurnsStart returns the index of the user message that starts the
+// keepRecent-th most recent turn, or len(messages) when keepRecent is zero.
+// If there are fewer turns than that, it returns 0 so nothing is old enough
+// to summarize.
+func recentTurnsStart(messages []ai.Message, keepRecent int) int {
+	if keepRecent == 0 {
+		return len(messages)
+	}
+
+	turns := 0
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			turns++
+			if turns == keepRecent {
+				return i
+			}
+		}
+	}
+	return 0
+}
+
+// hasUnsummarized reports whether messages contain anything besides earlier
+// summaries
+func hasUnsummarized(messages []ai.Message) bool {
+	for _, msg := range messages {
+		if !IsSummary(msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// transcript renders messages as plain text for the summarizer
+func transcript(messages []ai.Message) string {
+	var b strings.Builder
+	for _, msg := range messages {
+		switch {
+		case IsSummary(msg):
+			fmt.Fprintf(&b, "Earlier summary: %s\n\n", strings.TrimPrefix(msg.Content, SummaryPrefix))
+		case len(msg.ToolCalls) > 0:
+			for _, call := range msg.ToolCalls {
+				fmt.Fprintf(&b, "%s called %s(%s)\n", msg.Role, call.Function.Name, call.Function.Arguments)
+			}
+			if msg.Content != "" {
+				fmt.Fprintf(&b, "%s: %s\n", msg.Role, msg.Content)
+			}
+			b.WriteString("\n")
+		default:
+			fmt.Fprintf(&b, "%s: %s\n\n", msg.Role, msg.Content)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,145 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestController_SummarizeAndCompress(t *testing.T) {
+	backend := newRecordingBackend()
+	controller := NewController(backend, &ControllerConfig{TokenCounter: messageCounter})
+	conv := controller.CreateConversation("system")
+	sendN(t, controller, conv.ID, 4)
+
+	backend.QueueResponse("  The user pinged three times.  ")
+	if err := controller.SummarizeAndCompress(context.Background(), conv.ID, 1); err != nil {
+		t.Fatalf("SummarizeAndCompress failed: %v", err)
+	}
+
+	// The summarizer sees the old turns as a transcript
+	request := backend.lastRequest()
+	if len(request.Messages) != 2 || !strings.Contains(request.Messages[1].Content, "user: ping") {
+		t.Errorf("Expected transcript of old turns, got %+v", request.Messages)
+	}
+
+	got, _ := controller.GetConversation(conv.ID)
+	if len(got.Messages) != 4 {
+		t.Fatalf("Expected system, summary, and one turn, got %d messages: %+v", len(got.Messages), got.Messages)
+	}
+	if got.Messages[0].Content != "system" {
+		t.Errorf("Expected system prompt to be kept, got %+v", got.Messages[0])
+	}
+	if want := SummaryPrefix + "The user pinged three times."; got.Messages[1].Content != want {
+		t.Errorf("Expected summary %q, got %q", want, got.Messages[1].Content)
+	}
+	if got.Messages[2].Role != "user" || got.Messages[3].Role != "assistant" {
+		t.Errorf("Expected the last turn verbatim, got %+v", got.Messages[2:])
+	}
+	if len(got.Compressions) != 1 || got.Compressions[0].MessagesReplaced != 6 {
+		t.Errorf("Expected one compression of 6 messages, got %+v", got.Compressions)
+	}
+
+	// Only the summary is old enough now, so nothing is sent
+	requests := len(backend.requests)
+	if err := controller.SummarizeAndCompress(context.Background(), conv.ID, 1); err != nil {
+		t.Fatalf("SummarizeAndCompress failed: %v", err)
+	}
+	if len(backend.requests) != requests {
+		t.Error("A lone summary should not be summarized again")
+	}
+
+	// New turns are folded in along with the earlier summary
+	sendN(t, controller, conv.ID, 1)
+	backend.QueueResponse("Pinged four times.")
+	if err := controller.SummarizeAndCompress(context.Background(), conv.ID, 1); err != nil {
+		t.Fatalf("SummarizeAndCompress failed: %v", err)
+	}
+	if !strings.Contains(backend.lastRequest().Messages[1].Content, "Earlier summary: The user pinged three times.") {
+		t.Errorf("Expected earlier summary in transcript, got %q", backend.lastRequest().Messages[1].Content)
+	}
+	got, _ = controller.GetConversation(conv.ID)
+	if len(got.Messages) != 4 || got.Messages[1].Content != SummaryPrefix+"Pinged four times." {
+		t.Errorf("Expected a single rolled-up summary, got %+v", got.Messages)
+	}
+
+	if err := controller.SummarizeAndCompress(context.Background(), "missing", 1); err == nil {
+		t.Error("Expected error for unknown conversation")
+	}
+}
+
+func TestController_SummarizeAndCompress_Preprocessed(t *testing.T) {
+	backend := newRecordingBackend()
+	controller := NewController(backend, &ControllerConfig{
+		MessagePreprocessors: []MessageHook{RedactPattern(emailPattern, "[email]")},
+	})
+	conv := controller.CreateConversation("")
+	for _, message := range []string{"Mail me at ann@example.com", "thanks"} {
+		if _, err := controller.SendMessage(context.Background(), ChatRequest{ConversationID: conv.ID, Message: message}); err != nil {
+			t.Fatalf("SendMessage failed: %v", err)
+		}
+	}
+
+	// Rewritten content must not look like a concurrent change
+	backend.QueueResponse("The user shared an email address.")
+	if err := controller.SummarizeAndCompress(context.Background(), conv.ID, 1); err != nil {
+		t.Fatalf("SummarizeAndCompress failed: %v", err)
+	}
+	if sent := backend.lastRequest().Messages[1].Content; strings.Contains(sent, "ann@example.com") || !strings.Contains(sent, "[email]") {
+		t.Errorf("Expected the transcript to be preprocessed, got %q", sent)
+	}
+	got, _ := controller.GetConversation(conv.ID)
+	if len(got.Messages) != 3 || !IsSummary(got.Messages[0]) {
+		t.Errorf("Expected a summary and the last turn, got %+v", got.Messages)
+	}
+}
+
+func TestController_SummarizeAndCompress_BackendError(t *testing.T) {
+	backend := newRecordingBackend()
+	controller := NewController(backend, nil)
+	conv := controller.CreateConversation("system")
+	sendN(t, controller, conv.ID, 3)
+	before, _ := controller.GetConversation(conv.ID)
+
+	backend.InjectError(errors.New("backend down"))
+	if err := controller.SummarizeAndCompress(context.Background(), conv.ID, 1); err == nil {
+		t.Fatal("Expected backend error")
+	}
+
+	after, _ := controller.GetConversation(conv.ID)
+	if len(after.Messages) != len(before.Messages) {
+		t.Errorf("Expected history untouched after a failure, got %d messages", len(after.Messages))
+	}
+}
+
+func TestController_AutoSummarize(t *testing.T) {
+	backend := newRecordingBackend()
+	controller := NewController(backend, &ControllerConfig{
+		TokenCounter:          messageCounter,
+		AutoSummarizeAtTokens: 70,
+	})
+	conv := controller.CreateConversation("system")
+	sendN(t, controller, conv.ID, 2)
+
+	backend.SetResponses([]string{"third reply", "Two pings so far."})
+	response, err := controller.SendMessage(context.Background(), ChatRequest{
+		ConversationID: conv.ID,
+		Message:        "ping",
+	})
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+
+	if response.Message.Content != "third reply" {
+		t.Errorf("Expected the reply to be unaffected, got %q", response.Message.Content)
+	}
+	if response.SummarizedMessages != 2 || response.SummarizeError != "" {
+		t.Errorf("Expected 2 summarized messages, got %d (error %q)", response.SummarizedMessages, response.SummarizeError)
+	}
+
+	got, _ := controller.GetConversation(conv.ID)
+	if len(got.Messages) != 6 || got.Messages[1].Content != SummaryPrefix+"Two pings so far." {
+		t.Errorf("Expected system, summary, and the last two turns, got %+v", got.Messages)
+	}
+}
@@ -0,0 +1,58 @@
+package chat
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// SetSystemPrompt replaces the system prompt of a conversation. If the first
+// message is a system message its content is replaced; otherwise a system
+// message is inserted at the start. Other messages are left untouched.
+func (c *Controller) SetSystemPrompt(id ConversationID, prompt string) error {
+	message := ai.Message{Role: "system", Content: prompt}
+	if err := ai.ValidateMessage(message); err != nil {
+		return fmt.Errorf("invalid system prompt: %w", err)
+	}
+
+	c.ensureLoaded(id)
+	var notifications []thresholdNotification
+	defer func() { notifyThresholds(notifications) }()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	conversation, exists := c.conversations[id]
+	if !exists {
+		return fmt.Errorf("conversation %s %w", id, ErrConversationNotFound)
+	}
+
+	if len(conversation.Messages) > 0 && conversation.Messages[0].Role == "system" {
+		conversation.Messages[0].Content = prompt
+	} else {
+		conversation.Messages = append([]ai.Message{message}, conversation.Messages...)
+	}
+
+	conversation.UpdatedAt = time.Now()
+	c.changedLocked(conversation)
+	notifications = c.checkThresholds(conversation)
+	return nil
+}
+
+// GetSystemPrompt returns the system prompt of a conversation, or an empty
+// string if it has none
+func (c *Controller) GetSystemPrompt(id ConversationID) (string, error) {
+	c.ensureLoaded(id)
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	conversation, exists := c.conversations[id]
+	if !exists {
+		return "", fmt.Errorf("conversation %s %w", id, ErrConversationNotFound)
+	}
+
+	if len(conversation.Messages) > 0 && conversation.Messages[0].Role == "system" {
+		return conversation.Messages[0].Content, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,60 @@
+package chat
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/backends/mock"
+)
+
+func TestSetSystemPrompt(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), nil)
+
+	// Replacing an existing system message keeps the rest of the history
+	conv := controller.newConversation("Be brief.")
+	controller.mutex.Lock()
+	conv.Messages = append(conv.Messages,
+		ai.Message{Role: "user", Content: "Hi"},
+		ai.Message{Role: "assistant", Content: "Hello"},
+	)
+	controller.mutex.Unlock()
+
+	if err := controller.SetSystemPrompt(conv.ID, "Be verbose."); err != nil {
+		t.Fatalf("SetSystemPrompt failed: %v", err)
+	}
+
+	want := []ai.Message{
+		{Role: "system", Content: "Be verbose."},
+		{Role: "user", Content: "Hi"},
+		{Role: "assistant", Content: "Hello"},
+	}
+	if !reflect.DeepEqual(conv.Messages, want) {
+		t.Errorf("Expected messages %+v, got %+v", want, conv.Messages)
+	}
+
+	// Without a system message one is inserted at the start
+	bare := controller.newConversation("")
+	controller.mutex.Lock()
+	bare.Messages = append(bare.Messages, ai.Message{Role: "user", Content: "Hi"})
+	controller.mutex.Unlock()
+
+	if err := controller.SetSystemPrompt(bare.ID, "Be kind."); err != nil {
+		t.Fatalf("SetSystemPrompt failed: %v", err)
+	}
+	if len(bare.Messages) != 2 || bare.Messages[0].Role != "system" || bare.Messages[1].Content != "Hi" {
+		t.Errorf("Expected system message to be inserted first, got %+v", bare.Messages)
+	}
+
+	prompt, err := controller.GetSystemPrompt(bare.ID)
+	if err != nil || prompt != "Be kind." {
+		t.Errorf("Expected prompt %q, got %q (err %v)", "Be kind.", prompt, err)
+	}
+
+	if err := controller.SetSystemPrompt(conv.ID, ""); err == nil {
+		t.Error("Expected error for empty system prompt")
+	}
+	if err := controller.SetSystemPrompt("missing", "x"); err == nil {
+		t.Error("Expected error for unknown conversation")
+	}
+}
@@ -0,0 +1,107 @@
+package chat
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// normalizeTag trims a tag and lowercases it, so tags compare
+// case-insensitively
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// AddTag tags a conversation. Tags are stored lowercased and adding a tag
+// the conversation already has is a no-op.
+func (c *Controller) AddTag(id ConversationID, tag string) error {
+	tag = normalizeTag(tag)
+	if tag == "" {
+		return fmt.Errorf("%w: tag cannot be empty", ai.ErrInvalidRequest)
+	}
+
+	c.ensureLoaded(id)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	conversation, exists := c.conversations[id]
+	if !exists {
+		return fmt.Errorf("conversation %s %w", id, ErrConversationNotFound)
+	}
+
+	if slices.Contains(conversation.Tags, tag) {
+		return nil
+	}
+
+	conversation.Tags = append(conversation.Tags, tag)
+	conversation.UpdatedAt = time.Now()
+	c.changedLocked(conversation)
+	return nil
+}
+
+// RemoveTag removes a tag from a conversation. Removing a tag the
+// conversation does not have is a no-op.
+func (c *Controller) RemoveTag(id ConversationID, tag string) error {
+	tag = normalizeTag(tag)
+
+	c.ensureLoaded(id)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	conversation, exists := c.conversations[id]
+	if !exists {
+		return fmt.Errorf("conversation %s %w", id, ErrConversationNotFound)
+	}
+
+	i := slices.Index(conversation.Tags, tag)
+	if i < 0 {
+		return nil
+	}
+
+	conversation.Tags = slices.Delete(conversation.Tags, i, i+1)
+	conversation.UpdatedAt = time.Now()
+	c.changedLocked(conversation)
+	return nil
+}
+
+// ListConversationsByTag returns summaries of the conversations carrying a
+// tag, oldest first
+func (c *Controller) ListConversationsByTag(tag string) []ConversationSummary {
+	tag = normalizeTag(tag)
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	var summaries []ConversationSummary
+	for _, conversation := range c.conversations {
+		if slices.Contains(conversation.Tags, tag) {
+			summaries = append(summaries, *c.summarizeLocked(conversation))
+		}
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].CreatedAt.Equal(summaries[j].CreatedAt) {
+			return summaries[i].ID < summaries[j].ID
+		}
+		return summaries[i].CreatedAt.Before(summaries[j].CreatedAt)
+	})
+
+	return summaries
+}
+
+// normalizeTags lowercases and de-duplicates tags, such as those of an
+// imported conversation, keeping their order
+func normalizeTags(tags []string) []string {
+	var normalized []string
+	for _, tag := range tags {
+		tag = normalizeTag(tag)
+		if tag != "" && !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
@@ -0,0 +1,105 @@
+package chat
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/backends/mock"
+)
+
+func TestController_Tags(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), nil)
+	conv := controller.CreateConversation("")
+
+	for _, tag := range []string{"Work", "work", " WORK ", "planning"} {
+		if err := controller.AddTag(conv.ID, tag); err != nil {
+			t.Fatalf("AddTag(%q) failed: %v", tag, err)
+		}
+	}
+
+	summary, _ := controller.GetConversationSummary(conv.ID)
+	if !reflect.DeepEqual(summary.Tags, []string{"work", "planning"}) {
+		t.Errorf("Expected de-duplicated tags [work planning], got %v", summary.Tags)
+	}
+
+	if err := controller.RemoveTag(conv.ID, "WORK"); err != nil {
+		t.Fatalf("RemoveTag failed: %v", err)
+	}
+	if err := controller.RemoveTag(conv.ID, "missing"); err != nil {
+		t.Errorf("Expected removing an absent tag to be a no-op, got %v", err)
+	}
+
+	stored, _ := controller.GetConversation(conv.ID)
+	if !reflect.DeepEqual(stored.Tags, []string{"planning"}) {
+		t.Errorf("Expected tags [planning], got %v", stored.Tags)
+	}
+
+	stored.Tags[0] = "changed"
+	if again, _ := controller.GetConversation(conv.ID); again.Tags[0] != "planning" {
+		t.Errorf("Expected snapshot tags to be independent, got %v", again.Tags)
+	}
+}
+
+func TestController_TagErrors(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), nil)
+
+	if err := controller.AddTag("missing", "work"); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Expected ErrConversationNotFound, got %v", err)
+	}
+	if err := controller.RemoveTag("missing", "work"); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Expected ErrConversationNotFound, got %v", err)
+	}
+
+	conv := controller.CreateConversation("")
+	if err := controller.AddTag(conv.ID, "  "); !errors.Is(err, ai.ErrInvalidRequest) {
+		t.Errorf("Expected ErrInvalidRequest for empty tag, got %v", err)
+	}
+}
+
+func TestController_ListConversationsByTag(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), nil)
+	first := controller.CreateConversation("")
+	second := controller.CreateConversation("")
+	untagged := controller.CreateConversation("")
+
+	controller.AddTag(first.ID, "project-x")
+	controller.AddTag(second.ID, "Project-X")
+	controller.AddTag(second.ID, "other")
+
+	summaries := controller.ListConversationsByTag("PROJECT-X")
+	if len(summaries) != 2 || summaries[0].ID != first.ID || summaries[1].ID != second.ID {
+		t.Fatalf("Expected both tagged conversations oldest first, got %+v", summaries)
+	}
+	for _, summary := range summaries {
+		if summary.ID == untagged.ID {
+			t.Errorf("Expected untagged conversation to be excluded")
+		}
+	}
+
+	if summaries := controller.ListConversationsByTag("none"); len(summaries) != 0 {
+		t.Errorf("Expected no matches, got %d", len(summaries))
+	}
+}
+
+func TestController_TagsSurviveForkAndImport(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), nil)
+	conv := controller.CreateConversation("")
+	controller.AddTag(conv.ID, "work")
+
+	fork, _ := controller.ForkConversation(conv.ID)
+	if !reflect.DeepEqual(fork.Tags, []string{"work"}) {
+		t.Errorf("Expected fork to keep tags, got %v", fork.Tags)
+	}
+
+	imported, err := controller.ImportConversation(strings.NewReader(
+		`{"tags": ["Work", "work", "Home"], "messages": [{"role": "user", "content": "hi"}]}`))
+	if err != nil {
+		t.Fatalf("ImportConversation failed: %v", err)
+	}
+	if !reflect.DeepEqual(imported.Tags, []string{"work", "home"}) {
+		t.Errorf("Expected imported tags to be normalized, got %v", imported.Tags)
+	}
+}
@@ -0,0 +1,213 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"slices"
+	"strings"
+
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/tasks"
+)
+
+// TaskGraphMetadataKey is the metadata key BreakTaskGraph stores its graph
+// under, as JSON, when ControllerConfig.StoreSubtasks is set
+const TaskGraphMetadataKey = "task_graph"
+
+// breakTaskGraphInstructions is the system prompt used to split a goal into
+// subtasks with dependencies
+const breakTaskGraphInstructions = "Break the user's goal into concrete, actionable subtasks. " +
+	"A subtask depends on another if it needs that subtask's result; subtasks that do not depend on each other can be done in parallel. " +
+	`Reply with JSON only, in the form {"subtasks": [{"id": "1", "description": "...", "depends_on": []}]}, ` +
+	"where depends_on lists the ids of the subtasks that must be done first. The dependencies must not form a cycle."
+
+// TaskGraph is a task breakdown whose subtasks may depend on each other. It
+// is always a valid graph: IDs are unique and there are no cycles.
+type TaskGraph struct {
+	// Goal is what the subtasks accomplish together
+	Goal string
+
+	// nodes are the subtasks in the order they were given, and order the
+	// same subtasks in dependency order
+	nodes []tasks.Subtask
+	order []tasks.Subtask
+}
+
+// NewTaskGraph builds a graph from subtasks, returning a *tasks.GraphError
+// if an ID is empty or repeated, a dependency is unknown, or the
+// dependencies form a cycle
+func NewTaskGraph(goal string, subtasks []tasks.Subtask) (*TaskGraph, error) {
+	nodes := make([]tasks.Subtask, len(subtasks))
+	for i, subtask := range subtasks {
+		subtask.DependsOn = slices.Clone(subtask.DependsOn)
+		nodes[i] = subtask
+	}
+
+	order, err := tasks.TopologicalOrder(nodes)
+	if err != nil {
+		return nil, err
+	}
+	return &TaskGraph{Goal: goal, nodes: nodes, order: order}, nil
+}
+
+// Len returns the number of subtasks in the graph
+func (g *TaskGraph) Len() int {
+	return len(g.nodes)
+}
+
+// Nodes returns a copy of the subtasks in the order they were given
+func (g *TaskGraph) Nodes() []tasks.Subtask {
+	nodes := make([]tasks.Subtask, len(g.nodes))
+	for i, node := range g.nodes {
+		node.DependsOn = slices.Clone(node.DependsOn)
+		nodes[i] = node
+	}
+	return nodes
+}
+
+// Node returns the subtask with the given ID
+func (g *TaskGraph) Node(id string) (tasks.Subtask, bool) {
+	for _, node := range g.nodes {
+		if node.ID == id {
+			node.DependsOn = slices.Clone(node.DependsOn)
+			return node, true
+		}
+	}
+	return tasks.Subtask{}, false
+}
+
+// Ordered iterates over the subtasks in dependency order, so each subtask
+// comes after everything it depends on
+func (g *TaskGraph) Ordered() iter.Seq[tasks.Subtask] {
+	return func(yield func(tasks.Subtask) bool) {
+		for _, node := range g.order {
+			node.DependsOn = slices.Clone(node.DependsOn)
+			if !yield(node) {
+				return
+			}
+		}
+	}
+}
+
+// MarshalJSON encodes the graph's goal and subtasks
+func (g *TaskGraph) MarshalJSON() ([]byte, error) {
+	return json.Marshal(taskGraphJSON{Goal: g.Goal, Subtasks: g.nodes})
+}
+
+// taskGraphJSON is the encoded form of a TaskGraph
+type taskGraphJSON struct {
+	Goal     string          `json:"goal,omitempty"`
+	Subtasks []tasks.Subtask `json:"subtasks"`
+}
+
+// BreakTaskGraph asks the backend to split goal into subtasks with
+// dependencies between them. The conversation is used the same way as by
+// BreakTask. A reply that is not valid JSON, or whose dependencies are
+// unknown or form a cycle, is returned as an error; the latter as a
+// *tasks.GraphError. When ControllerConfig.StoreSubtasks is set the graph
+// is also saved in the conversation's metadata under TaskGraphMetadataKey.
+func (c *Controller) BreakTaskGraph(ctx context.Context, id ConversationID, goal string) (*TaskGraph, error) {
+	goal = strings.TrimSpace(goal)
+	if goal == "" {
+		return nil, fmt.Errorf("%w: goal cannot be empty", ai.ErrInvalidRequest)
+	}
+
+	reply, err := c.askAbout(ctx, id, breakTaskGraphInstructions, "Goal: "+goal)
+	if err != nil {
+		return nil, fmt.Errorf("failed to break down task: %w", err)
+	}
+
+	subtasks, err := parseTaskGraph(reply)
+	if err != nil {
+		return nil, fmt.Errorf("failed to break down task: %w", err)
+	}
+	graph, err := NewTaskGraph(goal, subtasks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to break down task: %w", err)
+	}
+
+	if c.storeSubtasks {
+		data, err := json.Marshal(graph)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode task graph: %w", err)
+		}
+		if err := c.SetMetadata(id, TaskGraphMetadataKey, string(data)); err != nil {
+			return nil, fmt.Errorf("failed to store task graph: %w", err)
+		}
+	}
+	return graph, nil
+}
+
+// graphNode is a subtask as a model writes it, which may use numbers for IDs
+type graphNode struct {
+	ID          flexibleID   `json:"id"`
+	Description string       `json:"description"`
+	DependsOn   []flexibleID `json:"depends_on"`
+}
+
+// flexibleID decodes a JSON string or number as a string
+type flexibleID string
+
+// UnmarshalJSON implements json.Unmarshaler
+func (f *flexibleID) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*f = flexibleID(strings.TrimSpace(s))
+		return nil
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("id must be a string or number, got %s", data)
+	}
+	*f = flexibleID(n.String())
+	return nil
+}
+
+// parseTaskGraph decodes the subtasks in a model reply. The JSON may be
+// wrapped in prose or a code fence, and may be an object with a "subtasks"
+// list or the list itself.
+func parseTaskGraph(reply string) ([]tasks.Subtask, error) {
+	start := strings.IndexAny(reply, "{[")
+	end := strings.LastIndexAny(reply, "}]")
+	if start < 0 || end < start {
+		if strings.TrimSpace(reply) == "" {
+			return nil, ErrEmptyResponse
+		}
+		return nil, fmt.Errorf("no JSON task graph in reply")
+	}
+	data := []byte(reply[start : end+1])
+
+	var nodes []graphNode
+	if bytes.HasPrefix(data, []byte("[")) {
+		if err := json.Unmarshal(data, &nodes); err != nil {
+			return nil, fmt.Errorf("invalid task graph JSON: %w", err)
+		}
+	} else {
+		var wrapped struct {
+			Subtasks []graphNode `json:"subtasks"`
+		}
+		if err := json.Unmarshal(data, &wrapped); err != nil {
+			return nil, fmt.Errorf("invalid task graph JSON: %w", err)
+		}
+		nodes = wrapped.Subtasks
+	}
+	if len(nodes) == 0 {
+		return nil, ErrEmptyResponse
+	}
+
+	subtasks := make([]tasks.Subtask, len(nodes))
+	for i, node := range nodes {
+		subtasks[i] = tasks.Subtask{
+			ID:          string(node.ID),
+			Description: strings.TrimSpace(node.Description),
+		}
+		for _, dep := range node.DependsOn {
+			subtasks[i].DependsOn = append(subtasks[i].DependsOn, string(dep))
+		}
+	}
+	return subtasks, nil
+}
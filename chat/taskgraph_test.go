@@ -0,0 +1,115 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/tasks"
+)
+
+func TestParseTaskGraph(t *testing.T) {
+	want := []tasks.Subtask{
+		{ID: "1", Description: "Design"},
+		{ID: "2", Description: "Build", DependsOn: []string{"1"}},
+	}
+
+	replies := map[string]string{
+		"object":  `{"subtasks": [{"id": "1", "description": "Design"}, {"id": "2", "description": "Build", "depends_on": ["1"]}]}`,
+		"fenced":  "Here you go:\n```json\n[{\"id\": 1, \"description\": \" Design \", \"depends_on\": []}, {\"id\": 2, \"description\": \"Build\", \"depends_on\": [1]}]\n```",
+		"numeric": `[{"id": 1, "description": "Design"}, {"id": "2", "description": "Build", "depends_on": [1]}]`,
+	}
+	for name, reply := range replies {
+		got, err := parseTaskGraph(reply)
+		if err != nil {
+			t.Errorf("%s: parseTaskGraph failed: %v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: Expected %+v, got %+v", name, want, got)
+		}
+	}
+
+	for _, reply := range []string{"1. Design\n2. Build", `{"subtasks": [{"id": true}]}`, `{"subtasks": []}`, ""} {
+		if _, err := parseTaskGraph(reply); err == nil {
+			t.Errorf("Expected an error for %q", reply)
+		}
+	}
+}
+
+func TestController_BreakTaskGraph(t *testing.T) {
+	backend := newRecordingBackend()
+	controller := NewController(backend, &ControllerConfig{StoreSubtasks: true})
+	conv := controller.CreateConversation("")
+
+	backend.QueueResponse(`{"subtasks": [
+		{"id": "ship", "description": "Ship it", "depends_on": ["api", "ui"]},
+		{"id": "ui", "description": "Build the UI", "depends_on": ["design"]},
+		{"id": "design", "description": "Design"},
+		{"id": "api", "description": "Build the API", "depends_on": ["design"]}
+	]}`)
+	graph, err := controller.BreakTaskGraph(context.Background(), conv.ID, "launch a site")
+	if err != nil {
+		t.Fatalf("BreakTaskGraph failed: %v", err)
+	}
+	if graph.Goal != "launch a site" || graph.Len() != 4 {
+		t.Errorf("Expected 4 subtasks for the goal, got %q with %d", graph.Goal, graph.Len())
+	}
+	if backend.lastRequest().Messages[0].Content != breakTaskGraphInstructions {
+		t.Errorf("Expected JSON instructions, got %+v", backend.lastRequest().Messages)
+	}
+
+	var order []string
+	for subtask := range graph.Ordered() {
+		order = append(order, subtask.ID)
+	}
+	if want := []string{"design", "ui", "api", "ship"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("Expected dependency order %v, got %v", want, order)
+	}
+	if ship, ok := graph.Node("ship"); !ok || !reflect.DeepEqual(ship.DependsOn, []string{"api", "ui"}) {
+		t.Errorf("Expected ship to depend on api and ui, got %+v", ship)
+	}
+
+	metadata, _ := controller.GetMetadata(conv.ID)
+	if !strings.Contains(metadata[TaskGraphMetadataKey], `"goal":"launch a site"`) {
+		t.Errorf("Expected the graph in metadata, got %q", metadata[TaskGraphMetadataKey])
+	}
+}
+
+func TestController_BreakTaskGraph_RejectsCycles(t *testing.T) {
+	backend := newRecordingBackend()
+	controller := NewController(backend, nil)
+	conv := controller.CreateConversation("")
+
+	backend.QueueResponse(`[{"id": "a", "depends_on": ["b"]}, {"id": "b", "depends_on": ["a"]}]`)
+	_, err := controller.BreakTaskGraph(context.Background(), conv.ID, "goal")
+	var graphErr *tasks.GraphError
+	if !errors.As(err, &graphErr) || graphErr.Problem != tasks.ProblemCycle {
+		t.Fatalf("Expected a cycle error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "a -> b -> a") {
+		t.Errorf("Expected the cycle in the error, got %v", err)
+	}
+
+	backend.QueueResponse("not json")
+	if _, err := controller.BreakTaskGraph(context.Background(), conv.ID, "goal"); err == nil {
+		t.Error("Expected an error for a reply without JSON")
+	}
+}
+
+func TestNewTaskGraph_Copies(t *testing.T) {
+	subtasks := []tasks.Subtask{{ID: "1"}, {ID: "2", DependsOn: []string{"1"}}}
+	graph, err := NewTaskGraph("goal", subtasks)
+	if err != nil {
+		t.Fatalf("NewTaskGraph failed: %v", err)
+	}
+
+	subtasks[1].DependsOn[0] = "2"
+	nodes := graph.Nodes()
+	nodes[1].DependsOn[0] = "3"
+	if node, _ := graph.Node("2"); node.DependsOn[0] != "1" {
+		t.Errorf("Expected the graph to keep its own dependencies, got %v", node.DependsOn)
+	}
+}
@@ -0,0 +1,228 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/tasks"
+)
+
+// taskPlanGrace is how long RunTaskPlan lets the step in flight run on
+// after ctx is cancelled
+var taskPlanGrace = 5 * time.Second
+
+// RunTaskPlan works through subtasks in order, sending each one as a user
+// message in the conversation. The replies stay in the conversation, so
+// later steps can build on earlier answers. onStep, if not nil, is called
+// with the index and reply of each completed step.
+//
+// Cancelling ctx gives the step in flight up to five seconds to finish,
+// then cancels it, and starts no more steps; ctx's deadline applies to the
+// step as usual. The plan then returns the context's error. A failed step
+// stops the plan and returns its error; the steps before it are kept.
+func (c *Controller) RunTaskPlan(ctx context.Context, id ConversationID, subtasks []string, onStep func(i int, result string)) error {
+	for i, subtask := range subtasks {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("task plan stopped before step %d: %w", i+1, err)
+		}
+
+		stepCtx, cancel := stepContext(ctx)
+		response, err := c.SendMessage(stepCtx, ChatRequest{
+			ConversationID: id,
+			Message:        subtask,
+		})
+		cancel()
+		if err != nil {
+			return fmt.Errorf("task plan failed at step %d: %w", i+1, err)
+		}
+
+		if onStep != nil {
+			onStep(i, response.Message.Content)
+		}
+	}
+	return nil
+}
+
+// stepContext returns a context for one RunTaskPlan step that keeps ctx's
+// deadline but is only cancelled taskPlanGrace after ctx is
+func stepContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	var stepCtx context.Context
+	var cancel context.CancelFunc
+	if deadline, ok := ctx.Deadline(); ok {
+		stepCtx, cancel = context.WithDeadline(context.WithoutCancel(ctx), deadline)
+	} else {
+		stepCtx, cancel = context.WithCancel(context.WithoutCancel(ctx))
+	}
+
+	grace := taskPlanGrace
+	stop := context.AfterFunc(ctx, func() {
+		time.AfterFunc(grace, cancel)
+	})
+	return stepCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// TaskGraphConversations decides which conversations RunTaskGraph sends
+// subtasks to
+type TaskGraphConversations string
+
+const (
+	// TaskGraphSeparate sends each subtask to a new conversation of its
+	// own, along with the goal and the results of the subtasks it depends
+	// on, so independent subtasks run in parallel. This is the default.
+	TaskGraphSeparate TaskGraphConversations = "separate"
+
+	// TaskGraphShared sends every subtask to one new conversation, so each
+	// sees all earlier results. Subtasks are then sent one at a time.
+	TaskGraphShared TaskGraphConversations = "shared"
+)
+
+// taskResult is the outcome of one subtask of a RunTaskGraph run
+type taskResult struct {
+	id     string
+	result string
+	err    error
+}
+
+// RunTaskGraph runs the subtasks of graph, starting each once everything it
+// depends on has finished, with at most maxConcurrency in flight. It
+// returns each subtask's reply keyed by subtask ID. The conversations it
+// creates for the subtasks are deleted, from the store too, before it
+// returns.
+//
+// If a subtask fails or ctx is cancelled, no more subtasks are started,
+// those in flight are cancelled, and the results finished so far are
+// returned along with the error. ControllerConfig.TaskGraphConversations
+// decides which conversations the subtasks are sent to.
+func (c *Controller) RunTaskGraph(ctx context.Context, graph *TaskGraph, maxConcurrency int) (map[string]string, error) {
+	if graph == nil {
+		return nil, fmt.Errorf("%w: task graph cannot be nil", ai.ErrInvalidRequest)
+	}
+	if maxConcurrency < 1 {
+		return nil, fmt.Errorf("%w: maxConcurrency must be at least 1, got %d", ai.ErrInvalidRequest, maxConcurrency)
+	}
+
+	var shared ConversationID
+	if c.taskGraphMode == TaskGraphShared {
+		shared = c.CreateConversation("").ID
+		defer c.discardConversation(shared)
+		// A conversation holds one exchange at a time
+		maxConcurrency = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// waiting counts the unfinished dependencies of each subtask, and
+	// dependents lists the subtasks waiting on each one
+	waiting := make(map[string]int, graph.Len())
+	dependents := make(map[string][]string, graph.Len())
+	for node := range graph.Ordered() {
+		waiting[node.ID] = len(node.DependsOn)
+		for _, dep := range node.DependsOn {
+			dependents[dep] = append(dependents[dep], node.ID)
+		}
+	}
+
+	results := make(map[string]string, graph.Len())
+	done := make(chan taskResult)
+	running := 0
+	var runErr error
+
+	for {
+		// Start ready subtasks in dependency order while there is room
+		if runErr == nil {
+			for node := range graph.Ordered() {
+				if running >= maxConcurrency {
+					break
+				}
+				if waiting[node.ID] != 0 {
+					continue
+				}
+				// Mark the subtask as started
+				waiting[node.ID] = -1
+				running++
+
+				prompt := taskPrompt(graph, node, results, shared == "")
+				go func() {
+					result, err := c.runTask(ctx, shared, prompt)
+					done <- taskResult{id: node.ID, result: result, err: err}
+				}()
+			}
+		}
+		if running == 0 {
+			break
+		}
+
+		outcome := <-done
+		running--
+		if outcome.err != nil {
+			if runErr == nil {
+				runErr = fmt.Errorf("subtask %s failed: %w", outcome.id, outcome.err)
+				cancel()
+			}
+			continue
+		}
+		results[outcome.id] = outcome.result
+		for _, dependent := range dependents[outcome.id] {
+			waiting[dependent]--
+		}
+	}
+
+	return results, runErr
+}
+
+// runTask sends prompt to the given conversation, or to a new one when id
+// is empty, and returns the reply
+func (c *Controller) runTask(ctx context.Context, id ConversationID, prompt string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if id == "" {
+		id = c.CreateConversation("").ID
+		defer c.discardConversation(id)
+	}
+
+	response, err := c.SendMessage(ctx, ChatRequest{ConversationID: id, Message: prompt})
+	if err != nil {
+		return "", err
+	}
+	return response.Message.Content, nil
+}
+
+// discardConversation deletes a conversation RunTaskGraph created for its
+// own use. Like pruning, it needs no confirmation in safe mode.
+func (c *Controller) discardConversation(id ConversationID) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.deleteLocked(id)
+}
+
+// taskPrompt builds the message sent for a subtask. With withResults set,
+// as when the subtask runs in a conversation of its own, the results of
+// the subtasks it depends on are included.
+func taskPrompt(graph *TaskGraph, node tasks.Subtask, results map[string]string, withResults bool) string {
+	var b strings.Builder
+	if graph.Goal != "" {
+		fmt.Fprintf(&b, "Overall goal: %s\n\n", graph.Goal)
+	}
+	if withResults && len(node.DependsOn) > 0 {
+		b.WriteString("Results of earlier subtasks:\n")
+		for _, dep := range node.DependsOn {
+			description := dep
+			if depNode, ok := graph.Node(dep); ok && depNode.Description != "" {
+				description = depNode.Description
+			}
+			fmt.Fprintf(&b, "- %s: %s\n", description, results[dep])
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "Subtask: %s", node.Description)
+	return b.String()
+}
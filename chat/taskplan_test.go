@@ -0,0 +1,260 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/backends/mock"
+	"github.com/jeanhaley/task-breaker/tasks"
+)
+
+func TestController_RunTaskPlan(t *testing.T) {
+	backend := newRecordingBackend()
+	controller := NewController(backend, nil)
+	conv := controller.CreateConversation("system")
+
+	backend.QueueResponse("outline done")
+	backend.QueueResponse("draft done")
+	var steps []string
+	err := controller.RunTaskPlan(context.Background(), conv.ID, []string{"Outline", "Draft"}, func(i int, result string) {
+		steps = append(steps, result)
+	})
+	if err != nil {
+		t.Fatalf("RunTaskPlan failed: %v", err)
+	}
+	if len(steps) != 2 || steps[0] != "outline done" || steps[1] != "draft done" {
+		t.Errorf("Expected a callback per step in order, got %q", steps)
+	}
+
+	// Later steps see earlier answers, which stay in the conversation
+	request := backend.lastRequest()
+	if len(request.Messages) != 4 || request.Messages[2].Content != "outline done" {
+		t.Errorf("Expected the first answer in the second request, got %+v", request.Messages)
+	}
+	got, _ := controller.GetConversation(conv.ID)
+	if len(got.Messages) != 5 || got.Messages[4].Content != "draft done" {
+		t.Errorf("Expected both steps in the conversation, got %+v", got.Messages)
+	}
+
+	backend.InjectError(errors.New("backend down"))
+	err = controller.RunTaskPlan(context.Background(), conv.ID, []string{"Edit"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "step 1") {
+		t.Errorf("Expected the failed step in the error, got %v", err)
+	}
+}
+
+func TestController_RunTaskPlan_Cancel(t *testing.T) {
+	backend := mock.NewMockBackend()
+	backend.SetLatency(50 * time.Millisecond)
+	controller := NewController(backend, nil)
+	conv := controller.CreateConversation("")
+
+	// Cancelling mid-step lets that step finish but starts no more
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	var completed []int
+	err := controller.RunTaskPlan(ctx, conv.ID, []string{"one", "two", "three"}, func(i int, result string) {
+		completed = append(completed, i)
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if len(completed) != 1 || completed[0] != 0 {
+		t.Errorf("Expected only the first step to complete, got %v", completed)
+	}
+	got, _ := controller.GetConversation(conv.ID)
+	if len(got.Messages) != 2 {
+		t.Errorf("Expected one finished exchange, got %d messages", len(got.Messages))
+	}
+}
+
+func TestController_RunTaskPlan_CancelAfterGrace(t *testing.T) {
+	defer func(grace time.Duration) { taskPlanGrace = grace }(taskPlanGrace)
+	taskPlanGrace = 10 * time.Millisecond
+
+	backend := mock.NewMockBackend()
+	backend.SetLatency(time.Second)
+	controller := NewController(backend, nil)
+	conv := controller.CreateConversation("")
+
+	// A step that outlasts the grace period is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start := time.Now()
+	err := controller.RunTaskPlan(ctx, conv.ID, []string{"one", "two"}, nil)
+	if !errors.Is(err, context.Canceled) || !strings.Contains(err.Error(), "step 1") {
+		t.Errorf("Expected step 1 to be cancelled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the step to be cancelled after the grace period, took %v", elapsed)
+	}
+
+	// The caller's deadline applies to the step in flight
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	taskPlanGrace = time.Minute
+	err = controller.RunTaskPlan(ctx, conv.ID, []string{"one"}, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the deadline to stop the step, got %v", err)
+	}
+}
+
+// taskBackend answers each subtask after a delay, tracking how many
+// requests are in flight, and fails subtasks that mention "fail"
+type taskBackend struct {
+	*mock.MockBackend
+	mutex       sync.Mutex
+	inFlight    int
+	maxInFlight int
+	prompts     []string
+	received    []ai.ChatCompletionRequest
+}
+
+func newTaskBackend() *taskBackend {
+	return &taskBackend{MockBackend: mock.NewMockBackend()}
+}
+
+func (b *taskBackend) ChatCompletion(ctx context.Context, req ai.ChatCompletionRequest) (*ai.ChatCompletionResponse, error) {
+	prompt := req.Messages[len(req.Messages)-1].Content
+	b.mutex.Lock()
+	b.inFlight++
+	b.maxInFlight = max(b.maxInFlight, b.inFlight)
+	b.prompts = append(b.prompts, prompt)
+	b.received = append(b.received, req)
+	b.mutex.Unlock()
+	defer func() {
+		b.mutex.Lock()
+		b.inFlight--
+		b.mutex.Unlock()
+	}()
+
+	select {
+	case <-time.After(20 * time.Millisecond):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if strings.Contains(prompt, "fail") {
+		return nil, errors.New("backend down")
+	}
+
+	subtask := prompt[strings.LastIndex(prompt, "Subtask: ")+len("Subtask: "):]
+	return &ai.ChatCompletionResponse{
+		Choices: []ai.Choice{{Message: ai.Message{Role: "assistant", Content: "did " + subtask}}},
+	}, nil
+}
+
+// requests returns the requests received so far
+func (b *taskBackend) requests() []ai.ChatCompletionRequest {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return slices.Clone(b.received)
+}
+
+func TestController_RunTaskGraph(t *testing.T) {
+	graph, err := NewTaskGraph("launch", []tasks.Subtask{
+		{ID: "design", Description: "design"},
+		{ID: "api", Description: "api", DependsOn: []string{"design"}},
+		{ID: "ui", Description: "ui", DependsOn: []string{"design"}},
+		{ID: "docs", Description: "docs", DependsOn: []string{"design"}},
+		{ID: "ship", Description: "ship", DependsOn: []string{"api", "ui", "docs"}},
+	})
+	if err != nil {
+		t.Fatalf("NewTaskGraph failed: %v", err)
+	}
+
+	backend := newTaskBackend()
+	controller := NewController(backend, nil)
+	results, err := controller.RunTaskGraph(context.Background(), graph, 2)
+	if err != nil {
+		t.Fatalf("RunTaskGraph failed: %v", err)
+	}
+
+	want := map[string]string{"design": "did design", "api": "did api", "ui": "did ui", "docs": "did docs", "ship": "did ship"}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("Expected %v, got %v", want, results)
+	}
+	if backend.maxInFlight != 2 {
+		t.Errorf("Expected independent subtasks to run two at a time, got at most %d", backend.maxInFlight)
+	}
+
+	// Each subtask ran in its own conversation with its dependencies'
+	// results, and none of them are left behind
+	for _, request := range backend.requests() {
+		if len(request.Messages) != 1 {
+			t.Errorf("Expected each subtask in a fresh conversation, got %d messages", len(request.Messages))
+		}
+	}
+	if conversations := len(controller.ListConversations()); conversations != 0 {
+		t.Errorf("Expected the subtask conversations to be deleted, got %d", conversations)
+	}
+	last := backend.prompts[len(backend.prompts)-1]
+	for _, want := range []string{"Overall goal: launch", "- api: did api", "- ui: did ui", "- docs: did docs", "Subtask: ship"} {
+		if !strings.Contains(last, want) {
+			t.Errorf("Expected %q in the final prompt, got %q", want, last)
+		}
+	}
+
+	if _, err := controller.RunTaskGraph(context.Background(), graph, 0); !errors.Is(err, ai.ErrInvalidRequest) {
+		t.Errorf("Expected ErrInvalidRequest for zero concurrency, got %v", err)
+	}
+}
+
+func TestController_RunTaskGraph_Failure(t *testing.T) {
+	graph, err := NewTaskGraph("", []tasks.Subtask{
+		{ID: "a", Description: "a"},
+		{ID: "b", Description: "b fail", DependsOn: []string{"a"}},
+		{ID: "c", Description: "c", DependsOn: []string{"b"}},
+	})
+	if err != nil {
+		t.Fatalf("NewTaskGraph failed: %v", err)
+	}
+
+	backend := newTaskBackend()
+	controller := NewController(backend, nil)
+	results, err := controller.RunTaskGraph(context.Background(), graph, 3)
+	if err == nil || !strings.Contains(err.Error(), "subtask b failed") {
+		t.Errorf("Expected subtask b to fail the run, got %v", err)
+	}
+	if !reflect.DeepEqual(results, map[string]string{"a": "did a"}) {
+		t.Errorf("Expected the partial result of a, got %v", results)
+	}
+	if len(backend.prompts) != 2 {
+		t.Errorf("Expected c never to be sent, got %d requests", len(backend.prompts))
+	}
+}
+
+func TestController_RunTaskGraph_Shared(t *testing.T) {
+	graph, err := NewTaskGraph("", []tasks.Subtask{
+		{ID: "a", Description: "a"},
+		{ID: "b", Description: "b"},
+		{ID: "c", Description: "c", DependsOn: []string{"a", "b"}},
+	})
+	if err != nil {
+		t.Fatalf("NewTaskGraph failed: %v", err)
+	}
+
+	backend := newTaskBackend()
+	controller := NewController(backend, &ControllerConfig{TaskGraphConversations: TaskGraphShared})
+	if _, err := controller.RunTaskGraph(context.Background(), graph, 4); err != nil {
+		t.Fatalf("RunTaskGraph failed: %v", err)
+	}
+	if backend.maxInFlight != 1 {
+		t.Errorf("Expected a shared conversation to send one subtask at a time, got %d", backend.maxInFlight)
+	}
+
+	requests := backend.requests()
+	last := requests[len(requests)-1]
+	if len(last.Messages) != 5 || last.Messages[3].Content != "did b" {
+		t.Errorf("Expected every earlier subtask in the shared conversation, got %+v", last.Messages)
+	}
+	if conversations := len(controller.ListConversations()); conversations != 0 {
+		t.Errorf("Expected the shared conversation to be deleted, got %d", conversations)
+	}
+}
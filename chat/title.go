@@ -0,0 +1,63 @@
+package chat
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxTitleLength is the length, in runes, generated titles are cut to
+const maxTitleLength = 40
+
+// RenameConversation sets a conversation's title. An empty title clears it,
+// so one is generated again from the first user message.
+func (c *Controller) RenameConversation(id ConversationID, title string) error {
+	c.ensureLoaded(id)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	conversation, exists := c.conversations[id]
+	if !exists {
+		return fmt.Errorf("conversation %s %w", id, ErrConversationNotFound)
+	}
+
+	conversation.Title = strings.Join(strings.Fields(title), " ")
+	if conversation.Title == "" {
+		c.autoTitleLocked(conversation)
+	}
+	conversation.UpdatedAt = time.Now()
+	c.changedLocked(conversation)
+	return nil
+}
+
+// autoTitleLocked gives an untitled conversation a title generated from its
+// first user message. Must be called with the controller lock held.
+func (c *Controller) autoTitleLocked(conversation *Conversation) {
+	if conversation.Title != "" {
+		return
+	}
+
+	for _, msg := range conversation.Messages {
+		if msg.Role == "user" {
+			conversation.Title = generateTitle(msg.Content)
+			return
+		}
+	}
+}
+
+// generateTitle collapses whitespace in content and shortens it to
+// maxTitleLength runes, breaking at a word boundary where possible
+func generateTitle(content string) string {
+	title := strings.Join(strings.Fields(content), " ")
+
+	runes := []rune(title)
+	if len(runes) <= maxTitleLength {
+		return title
+	}
+
+	cut := string(runes[:maxTitleLength])
+	if i := strings.LastIndex(cut, " "); i > maxTitleLength/2 {
+		cut = cut[:i]
+	}
+	return cut + "..."
+}
@@ -0,0 +1,71 @@
+package chat
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/backends/mock"
+)
+
+func TestController_AutoTitle(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), nil)
+	conv := controller.CreateConversation("system")
+
+	if _, err := controller.SendMessage(context.Background(), ChatRequest{
+		ConversationID: conv.ID,
+		Message:        "How do I break   a large\nmigration into smaller reviewable steps?",
+	}); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	sendN(t, controller, conv.ID, 1)
+
+	summary, _ := controller.GetConversationSummary(conv.ID)
+	if want := "How do I break a large migration into..."; summary.Title != want {
+		t.Errorf("Expected title %q, got %q", want, summary.Title)
+	}
+}
+
+func TestController_RenameConversation(t *testing.T) {
+	controller := NewController(mock.NewMockBackend(), nil)
+	conv := controller.CreateConversation("system")
+
+	if err := controller.RenameConversation(conv.ID, "  Trip   planning "); err != nil {
+		t.Fatalf("RenameConversation failed: %v", err)
+	}
+	sendN(t, controller, conv.ID, 1)
+
+	summary, _ := controller.GetConversationSummary(conv.ID)
+	if summary.Title != "Trip planning" {
+		t.Errorf("Expected explicit title to be kept, got %q", summary.Title)
+	}
+
+	// Clearing the title falls back to the generated one
+	if err := controller.RenameConversation(conv.ID, ""); err != nil {
+		t.Fatalf("RenameConversation failed: %v", err)
+	}
+	summary, _ = controller.GetConversationSummary(conv.ID)
+	if summary.Title != "ping" {
+		t.Errorf("Expected generated title %q, got %q", "ping", summary.Title)
+	}
+
+	if err := controller.RenameConversation("missing", "x"); err == nil {
+		t.Error("Expected error for unknown conversation")
+	}
+}
+
+func TestGenerateTitle(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"short", "short"},
+		{"Supercalifragilisticexpialidocious-and-then-some-more", "Supercalifragilisticexpialidocious-and-t..."},
+		{"  spaced\n\tout  ", "spaced out"},
+	}
+
+	for _, test := range tests {
+		if got := generateTitle(test.content); got != test.want {
+			t.Errorf("generateTitle(%q): expected %q, got %q", test.content, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package chat
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// TokenCounter estimates the number of tokens a message history occupies
+type TokenCounter func(messages []ai.Message) int
+
+// ThresholdFunc is called when a conversation's token usage crosses a
+// registered threshold of the context window
+type ThresholdFunc func(id ConversationID, used, limit int)
+
+// tokenThreshold pairs a context window fraction with its callback. key
+// identifies the threshold in the fired state, whatever its position.
+type tokenThreshold struct {
+	key      int
+	fraction float64
+	callback ThresholdFunc
+}
+
+// thresholdNotification is a pending callback invocation, collected while the
+// controller lock is held and delivered after it is released
+type thresholdNotification struct {
+	callback ThresholdFunc
+	id       ConversationID
+	used     int
+	limit    int
+}
+
+// DefaultModelContextLimits holds the context window sizes of commonly used
+// models
+var DefaultModelContextLimits = map[string]int{
+	"gpt-4":                    8192,
+	"gpt-4-turbo":              128000,
+	"gpt-4o":                   128000,
+	"gpt-4o-mini":              128000,
+	"gpt-3.5-turbo":            16385,
+	"claude-3-opus-20240229":   200000,
+	"claude-3-sonnet-20240229": 200000,
+	"claude-3-haiku-20240307":  200000,
+}
+
+// EstimateTokens is a TokenCounter that uses the rough
+// four-characters-per-token heuristic shared with the mock backend.
+func EstimateTokens(messages []ai.Message) int {
+	tokens := 0
+	for _, msg := range messages {
+		tokens += len(msg.Content) / 4
+	}
+	return tokens
+}
+
+// OnTokenThreshold registers a callback fired when a conversation's token
+// usage reaches pct of the context window, where pct is a fraction in (0, 1]
+// such as 0.8 for 80%. Each threshold fires once per conversation and is
+// re-armed only after usage drops back below it, e.g. after a clear.
+// Thresholds are inert unless ControllerConfig.ContextWindow is set. A pct
+// outside (0, 1] is rejected.
+func (c *Controller) OnTokenThreshold(pct float64, callback func(id ConversationID, used, limit int)) error {
+	if !(pct > 0 && pct <= 1) {
+		return fmt.Errorf("%w: threshold must be a fraction in (0, 1], got %v", ai.ErrInvalidRequest, pct)
+	}
+	if callback == nil {
+		return fmt.Errorf("%w: threshold callback cannot be nil", ai.ErrInvalidRequest)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// Thresholds are never removed, so the count is an unused key. Fired
+	// state is keyed by it, so thresholds registered earlier keep theirs.
+	c.thresholds = append(c.thresholds, tokenThreshold{key: len(c.thresholds), fraction: pct, callback: callback})
+	sort.SliceStable(c.thresholds, func(i, j int) bool {
+		return c.thresholds[i].fraction < c.thresholds[j].fraction
+	})
+	return nil
+}
+
+// ContextUtilization returns the fraction of the context window used by a
+// conversation's message history
+func (c *Controller) ContextUtilization(id ConversationID) (float64, error) {
+	c.ensureLoaded(id)
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	conversation, exists := c.conversations[id]
+	if !exists {
+		return 0, fmt.Errorf("conversation %s %w", id, ErrConversationNotFound)
+	}
+
+	if c.contextWindow <= 0 {
+		return 0, fmt.Errorf("context window is not configured")
+	}
+
+	return float64(c.tokenCounter(conversation.Messages)) / float64(c.contextWindow), nil
+}
+
+// GetContextUsage returns a conversation's estimated prompt tokens and the
+// context limit of the model it runs on. ControllerConfig.ContextWindow takes
+// precedence over the model table; limit is zero when neither knows the
+// model. The model is the one that served the last reply, or DefaultModel
+// before the first.
+func (c *Controller) GetContextUsage(id ConversationID) (used, limit int, err error) {
+	c.ensureLoaded(id)
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	conversation, exists := c.conversations[id]
+	if !exists {
+		return 0, 0, fmt.Errorf("conversation %s %w", id, ErrConversationNotFound)
+	}
+
+	used = c.tokenCounter(conversation.Messages)
+	if c.contextWindow > 0 {
+		return used, c.contextWindow, nil
+	}
+
+	model := conversation.LastModel
+	if model == "" {
+		model = c.defaultModel
+	}
+	return used, c.contextLimits[model], nil
+}
+
+// checkThresholds updates the fired state of every threshold for a
+// conversation and returns the callbacks that need to run. Must be called
+// with the controller lock held.
+func (c *Controller) checkThresholds(conversation *Conversation) []thresholdNotification {
+	if c.contextWindow <= 0 || len(c.thresholds) == 0 {
+		return nil
+	}
+
+	used := c.tokenCounter(conversation.Messages)
+	fired := c.firedThresholds[conversation.ID]
+	if fired == nil {
+		fired = make(map[int]bool)
+		c.firedThresholds[conversation.ID] = fired
+	}
+
+	var notifications []thresholdNotification
+	for _, threshold := range c.thresholds {
+		reached := float64(used) >= threshold.fraction*float64(c.contextWindow)
+		switch {
+		case reached && !fired[threshold.key]:
+			fired[threshold.key] = true
+			notifications = append(notifications, thresholdNotification{
+				callback: threshold.callback,
+				id:       conversation.ID,
+				used:     used,
+				limit:    c.contextWindow,
+			})
+		case !reached && fired[threshold.key]:
+			// Dropped back below, re-arm the threshold
+			delete(fired, threshold.key)
+		}
+	}
+
+	return notifications
+}
+
+// notifyThresholds runs pending threshold callbacks outside the controller lock
+func notifyThresholds(notifications []thresholdNotification) {
+	for _, n := range notifications {
+		n.callback(n.id, n.used, n.limit)
+	}
+}
+
+// trimToBudgetLocked builds the outbound copy of a history, preprocessed
+// and compressed, and drops the oldest non-system messages until that copy
+// fits within MaxContextTokens, so nothing is dropped that compression
+// would have made fit. System messages and the latest message are always
+// kept, as are tool results whose call is kept. It returns the trimmed
+// history, leaving messages unchanged, its outbound copy, and the number of
+// messages dropped. Must be called with the controller lock held.
+func (c *Controller) trimToBudgetLocked(messages []ai.Message) (kept, outbound []ai.Message, trimmed int, err error) {
+	for {
+		outbound, err = c.outboundLocked(messages)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if c.maxContextTokens <= 0 || c.tokenCounter(outbound) <= c.maxContextTokens {
+			return messages, outbound, trimmed, nil
+		}
+
+		drop := -1
+		for i, msg := range messages[:len(messages)-1] {
+			if msg.Role != "system" {
+				drop = i
+				break
+			}
+		}
+		if drop < 0 {
+			return messages, outbound, trimmed, nil
+		}
+
+		// Tool results cannot outlive the call they answer
+		end := drop + 1
+		for end < len(messages)-1 && messages[end].Role == "tool" {
+			end++
+		}
+
+		trimmed += end - drop
+		messages = append(messages[:drop:drop], messages[end:]...)
+	}
+}
@@ -0,0 +1,227 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// ErrNoPendingToolCall is returned when a tool result does not answer a call
+// from the conversation's latest assistant message
+var ErrNoPendingToolCall = errors.New("no pending tool call")
+
+// ToolResult is the output of a tool call, sent back to the model
+type ToolResult struct {
+	// ToolCallID is the ID of the ai.ToolCall this result answers
+	ToolCallID string `json:"tool_call_id"`
+	Content    string `json:"content"`
+}
+
+// RegisterTool makes a tool available to conversations. Registering a tool
+// with an existing name replaces it.
+func (c *Controller) RegisterTool(tool ai.Tool) error {
+	if tool.Function.Name == "" {
+		return fmt.Errorf("%w: tool function name is required", ai.ErrInvalidRequest)
+	}
+	if tool.Type == "" {
+		tool.Type = "function"
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.tools[tool.Function.Name] = tool
+	return nil
+}
+
+// SetConversationTools restricts a conversation to the named registered
+// tools, so only they are advertised to the backend and only they may be
+// called. Passing nil removes the restriction and allows every registered
+// tool; an empty non-nil slice allows none.
+func (c *Controller) SetConversationTools(id ConversationID, names []string) error {
+	c.ensureLoaded(id)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, exists := c.conversations[id]; !exists {
+		return fmt.Errorf("conversation %s %w", id, ErrConversationNotFound)
+	}
+
+	if names == nil {
+		delete(c.toolAllowlists, id)
+		return nil
+	}
+
+	allowlist := make(map[string]bool, len(names))
+	for _, name := range names {
+		if _, registered := c.tools[name]; !registered {
+			return fmt.Errorf("%w: tool %q is not registered", ai.ErrInvalidRequest, name)
+		}
+		allowlist[name] = true
+	}
+
+	c.toolAllowlists[id] = allowlist
+	return nil
+}
+
+// ConversationTools returns the tools advertised for a conversation, sorted
+// by name
+func (c *Controller) ConversationTools(id ConversationID) ([]ai.Tool, error) {
+	c.ensureLoaded(id)
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	if _, exists := c.conversations[id]; !exists {
+		return nil, fmt.Errorf("conversation %s %w", id, ErrConversationNotFound)
+	}
+	return c.toolsForLocked(id), nil
+}
+
+// toolsForLocked returns the tools advertised for a conversation. Must be
+// called with the controller lock held.
+func (c *Controller) toolsForLocked(id ConversationID) []ai.Tool {
+	allowlist, restricted := c.toolAllowlists[id]
+
+	var tools []ai.Tool
+	for name, tool := range c.tools {
+		if restricted && !allowlist[name] {
+			continue
+		}
+		tools = append(tools, tool)
+	}
+
+	sort.Slice(tools, func(i, j int) bool {
+		return tools[i].Function.Name < tools[j].Function.Name
+	})
+	return tools
+}
+
+// rejectDisallowedToolCallsLocked splits out tool calls the conversation may
+// not make and builds the tool-error messages answering them. Must be called
+// with the controller lock held.
+func (c *Controller) rejectDisallowedToolCallsLocked(id ConversationID, calls []ai.ToolCall) (rejected []ai.ToolCall, errorMessages []ai.Message) {
+	allowlist, restricted := c.toolAllowlists[id]
+
+	for _, call := range calls {
+		_, registered := c.tools[call.Function.Name]
+		if registered && (!restricted || allowlist[call.Function.Name]) {
+			continue
+		}
+
+		rejected = append(rejected, call)
+		errorMessages = append(errorMessages, ai.Message{
+			Role:       "tool",
+			ToolCallID: call.ID,
+			Content:    fmt.Sprintf("error: tool %q is not allowed in this conversation", call.Function.Name),
+		})
+	}
+
+	return rejected, errorMessages
+}
+
+// SubmitToolResults appends the results of tool calls made by the latest
+// assistant message to a conversation as "tool" messages, then asks the
+// backend to continue. Every result must answer a call that has not been
+// answered yet; calls may be answered across several submissions. The
+// follow-up request uses the controller's default model parameters.
+func (c *Controller) SubmitToolResults(ctx context.Context, id ConversationID, results []ToolResult) (*ChatResponse, error) {
+	start := time.Now()
+
+	pending, err := c.prepareToolResults(id, results)
+	defer c.releaseRequest(pending)
+	if err != nil {
+		c.logFailure(id, "", start, err)
+		if pending == nil {
+			return nil, err
+		}
+		return pending.failure(err), err
+	}
+
+	return c.send(ctx, pending, start)
+}
+
+// prepareToolResults appends tool results to a conversation and builds the
+// follow-up backend request. A pendingRequest is returned alongside any error
+// that occurs after the results were stored.
+func (c *Controller) prepareToolResults(id ConversationID, results []ToolResult) (*pendingRequest, error) {
+	if len(results) == 0 {
+		return nil, fmt.Errorf("%w: at least one tool result is required", ai.ErrInvalidRequest)
+	}
+
+	toolMessages := make([]ai.Message, len(results))
+	for i, result := range results {
+		toolMessages[i] = ai.Message{Role: "tool", ToolCallID: result.ToolCallID, Content: result.Content}
+		if err := ai.ValidateMessage(toolMessages[i]); err != nil {
+			return nil, fmt.Errorf("tool result %d: %w", i, err)
+		}
+	}
+
+	c.ensureLoaded(id)
+	c.mutex.Lock()
+	conversation, exists := c.conversations[id]
+	if !exists {
+		c.mutex.Unlock()
+		return nil, fmt.Errorf("conversation %s %w", id, ErrConversationNotFound)
+	}
+
+	awaiting := pendingToolCalls(conversation.Messages)
+	for _, result := range results {
+		if !awaiting[result.ToolCallID] {
+			c.mutex.Unlock()
+			return nil, fmt.Errorf("tool call %q: %w", result.ToolCallID, ErrNoPendingToolCall)
+		}
+		// Answering the same call twice in one submission is an error too
+		delete(awaiting, result.ToolCallID)
+	}
+
+	// Build the request before storing the results, so one that cannot be
+	// sent leaves the conversation as it was
+	pending := &pendingRequest{conversation: conversation}
+	history := append(slices.Clone(conversation.Messages), toolMessages...)
+	history, outbound, trimmed, err := c.trimToBudgetLocked(history)
+	if err == nil {
+		pending.request, err = c.buildRequestLocked(ChatRequest{}, outbound, c.toolsForLocked(id))
+	}
+	if err != nil {
+		c.mutex.Unlock()
+		return pending, err
+	}
+	pending.trimmed = trimmed
+
+	c.touchLocked(id)
+	conversation.Messages = history
+	conversation.UpdatedAt = time.Now()
+	c.changedLocked(conversation)
+	c.beginRequestLocked(pending)
+	c.mutex.Unlock()
+	return pending, nil
+}
+
+// pendingToolCalls returns the IDs of tool calls from the latest assistant
+// message that no tool message has answered yet
+func pendingToolCalls(messages []ai.Message) map[string]bool {
+	awaiting := make(map[string]bool)
+	for i := len(messages) - 1; i >= 0; i-- {
+		msg := messages[i]
+		if msg.Role == "tool" {
+			continue
+		}
+		if msg.Role != "assistant" {
+			return awaiting
+		}
+
+		for _, call := range msg.ToolCalls {
+			awaiting[call.ID] = true
+		}
+		for _, answer := range messages[i+1:] {
+			delete(awaiting, answer.ToolCallID)
+		}
+		return awaiting
+	}
+	return awaiting
+}
@@ -0,0 +1,187 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/backends/mock"
+)
+
+func newToolController(t *testing.T) (*Controller, *recordingBackend) {
+	t.Helper()
+
+	backend := newRecordingBackend()
+	controller := NewController(backend, &ControllerConfig{DefaultModel: "gpt-4", MaxTokens: 100})
+	for _, name := range []string{"read_file", "write_file"} {
+		if err := controller.RegisterTool(ai.Tool{Function: ai.FunctionDefinition{Name: name}}); err != nil {
+			t.Fatalf("RegisterTool failed: %v", err)
+		}
+	}
+	return controller, backend
+}
+
+func toolNames(tools []ai.Tool) string {
+	names := make([]string, len(tools))
+	for i, tool := range tools {
+		names[i] = tool.Function.Name
+	}
+	return strings.Join(names, ",")
+}
+
+func TestController_ConversationToolAllowlist(t *testing.T) {
+	controller, backend := newToolController(t)
+	ctx := context.Background()
+
+	readOnly := controller.CreateConversation("read only")
+	if err := controller.SetConversationTools(readOnly.ID, []string{"read_file"}); err != nil {
+		t.Fatalf("SetConversationTools failed: %v", err)
+	}
+	unrestricted := controller.CreateConversation("anything goes")
+
+	// Only allowed tools are advertised
+	if _, err := controller.SendMessage(ctx, ChatRequest{ConversationID: readOnly.ID, Message: "hello"}); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	if got := toolNames(backend.lastRequest().Tools); got != "read_file" {
+		t.Errorf("Expected only read_file advertised, got %q", got)
+	}
+
+	if _, err := controller.SendMessage(ctx, ChatRequest{ConversationID: unrestricted.ID, Message: "hello"}); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	if got := toolNames(backend.lastRequest().Tools); got != "read_file,write_file" {
+		t.Errorf("Expected all tools advertised, got %q", got)
+	}
+
+	// Calling a disallowed tool is rejected with a tool error
+	response, err := controller.SendMessage(ctx, ChatRequest{
+		ConversationID: readOnly.ID,
+		Message:        mock.ToolCallDirective + `write_file {"path":"/etc/passwd"}`,
+	})
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	if len(response.RejectedToolCalls) != 1 || response.RejectedToolCalls[0].Function.Name != "write_file" {
+		t.Fatalf("Expected write_file call to be rejected, got %+v", response.RejectedToolCalls)
+	}
+
+	stored, _ := controller.GetConversation(readOnly.ID)
+	last := stored.Messages[len(stored.Messages)-1]
+	if last.Role != "tool" || last.ToolCallID != response.RejectedToolCalls[0].ID ||
+		!strings.Contains(last.Content, `tool "write_file" is not allowed`) {
+		t.Errorf("Expected tool-error message answering the call, got %+v", last)
+	}
+
+	// Allowed calls pass through untouched
+	response, err = controller.SendMessage(ctx, ChatRequest{
+		ConversationID: readOnly.ID,
+		Message:        mock.ToolCallDirective + `read_file {"path":"README.md"}`,
+	})
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	if len(response.RejectedToolCalls) != 0 || len(response.Message.ToolCalls) != 1 {
+		t.Errorf("Expected read_file call to be allowed, got %+v", response)
+	}
+
+	// The same call is fine in the unrestricted conversation
+	response, _ = controller.SendMessage(ctx, ChatRequest{
+		ConversationID: unrestricted.ID,
+		Message:        mock.ToolCallDirective + "write_file {}",
+	})
+	if len(response.RejectedToolCalls) != 0 {
+		t.Errorf("Unrestricted conversation should allow write_file, got %+v", response.RejectedToolCalls)
+	}
+
+	// Unregistered tools are always rejected
+	response, _ = controller.SendMessage(ctx, ChatRequest{
+		ConversationID: unrestricted.ID,
+		Message:        mock.ToolCallDirective + "delete_everything {}",
+	})
+	if len(response.RejectedToolCalls) != 1 {
+		t.Errorf("Expected unregistered tool call to be rejected, got %+v", response.RejectedToolCalls)
+	}
+}
+
+func TestController_SetConversationTools_Validation(t *testing.T) {
+	controller, _ := newToolController(t)
+	conv := controller.CreateConversation("")
+
+	if err := controller.SetConversationTools(conv.ID, []string{"unknown"}); err == nil {
+		t.Error("Expected error for unregistered tool name")
+	}
+	if err := controller.SetConversationTools("missing", []string{"read_file"}); err == nil {
+		t.Error("Expected error for unknown conversation")
+	}
+
+	controller.SetConversationTools(conv.ID, []string{})
+	tools, _ := controller.ConversationTools(conv.ID)
+	if len(tools) != 0 {
+		t.Errorf("Empty allowlist should advertise no tools, got %q", toolNames(tools))
+	}
+
+	controller.SetConversationTools(conv.ID, nil)
+	tools, _ = controller.ConversationTools(conv.ID)
+	if len(tools) != 2 {
+		t.Errorf("Nil allowlist should restore all tools, got %q", toolNames(tools))
+	}
+}
+
+func TestController_SubmitToolResults(t *testing.T) {
+	controller, backend := newToolController(t)
+	ctx := context.Background()
+	conv := controller.CreateConversation("system")
+
+	response, err := controller.SendMessage(ctx, ChatRequest{
+		ConversationID: conv.ID,
+		Message:        mock.ToolCallDirective + `read_file {"path":"README.md"}`,
+	})
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	if response.Response.Choices[0].FinishReason != "tool_calls" || len(response.Message.ToolCalls) != 1 {
+		t.Fatalf("Expected a tool call, got %+v", response.Message)
+	}
+	callID := response.Message.ToolCalls[0].ID
+
+	if _, err := controller.SubmitToolResults(ctx, conv.ID, []ToolResult{{ToolCallID: "call_unknown", Content: "x"}}); !errors.Is(err, ErrNoPendingToolCall) {
+		t.Errorf("Expected ErrNoPendingToolCall for an unknown call, got %v", err)
+	}
+	if _, err := controller.SubmitToolResults(ctx, conv.ID, nil); !errors.Is(err, ai.ErrInvalidRequest) {
+		t.Errorf("Expected ErrInvalidRequest without results, got %v", err)
+	}
+	if _, err := controller.SubmitToolResults(ctx, "missing", []ToolResult{{ToolCallID: callID, Content: "x"}}); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Expected ErrConversationNotFound, got %v", err)
+	}
+
+	response, err = controller.SubmitToolResults(ctx, conv.ID, []ToolResult{{ToolCallID: callID, Content: "# Task Breaker"}})
+	if err != nil {
+		t.Fatalf("SubmitToolResults failed: %v", err)
+	}
+	if !strings.Contains(response.Message.Content, "# Task Breaker") {
+		t.Errorf("Expected the model to see the tool result, got %q", response.Message.Content)
+	}
+
+	sent := backend.lastRequest().Messages
+	last := sent[len(sent)-1]
+	if last.Role != "tool" || last.ToolCallID != callID {
+		t.Errorf("Expected the tool result to end the request, got %+v", last)
+	}
+
+	stored, _ := controller.GetConversation(conv.ID)
+	roles := make([]string, len(stored.Messages))
+	for i, msg := range stored.Messages {
+		roles[i] = msg.Role
+	}
+	if got := strings.Join(roles, ","); got != "system,user,assistant,tool,assistant" {
+		t.Errorf("Expected the tool result between the call and the reply, got %s", got)
+	}
+
+	// The call has been answered, so a second result is rejected
+	if _, err := controller.SubmitToolResults(ctx, conv.ID, []ToolResult{{ToolCallID: callID, Content: "again"}}); !errors.Is(err, ErrNoPendingToolCall) {
+		t.Errorf("Expected ErrNoPendingToolCall for an answered call, got %v", err)
+	}
+}
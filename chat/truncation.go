@@ -0,0 +1,78 @@
+package chat
+
+import (
+	"strings"
+	"unicode"
+)
+
+// longResponseChars is the length past which a response that does not end
+// a sentence is considered likely cut off
+const longResponseChars = 200
+
+// LikelyTruncated applies heuristics to decide whether a response was cut off,
+// since some backends report finish_reason "stop" even when they ran out of
+// tokens. A response is flagged when the finish reason is "length", a code
+// fence is left open, brackets are unbalanced, or a long response stops
+// without sentence-ending punctuation. The result is advisory only.
+func LikelyTruncated(content, finishReason string) bool {
+	if finishReason == "length" {
+		return true
+	}
+
+	trimmed := strings.TrimSpace(content)
+	if trimmed == "" {
+		return false
+	}
+
+	if strings.Count(trimmed, "```")%2 != 0 {
+		return true
+	}
+
+	if hasUnclosedBrackets(trimmed) {
+		return true
+	}
+
+	if len(trimmed) >= longResponseChars && !endsSentence(trimmed) {
+		return true
+	}
+
+	return false
+}
+
+// hasUnclosedBrackets reports whether any (, [ or { is left open. Stray
+// closing brackets, as in "1) first", are ignored since they do not indicate
+// a cut-off.
+func hasUnclosedBrackets(s string) bool {
+	pairs := map[rune]rune{')': '(', ']': '[', '}': '{'}
+	var stack []rune
+
+	for _, r := range s {
+		switch r {
+		case '(', '[', '{':
+			stack = append(stack, r)
+		case ')', ']', '}':
+			if len(stack) > 0 && stack[len(stack)-1] == pairs[r] {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+
+	return len(stack) > 0
+}
+
+// endsSentence reports whether text ends with punctuation, a closing
+// bracket/quote, a code fence, or an emoji that plausibly finishes a response
+func endsSentence(s string) bool {
+	if strings.HasSuffix(s, "```") {
+		return true
+	}
+
+	last := []rune(s)[len([]rune(s))-1]
+	switch last {
+	case '.', '!', '?', ':', ';', ')', ']', '}', '"', '\'', '`', '*', '…', '”', '’':
+		return true
+	}
+
+	// Emoji and other symbols commonly close chatty responses
+	return unicode.IsSymbol(last)
+}
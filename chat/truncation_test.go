@@ -0,0 +1,39 @@
+package chat
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLikelyTruncated(t *testing.T) {
+	longProse := strings.Repeat("This sentence keeps going and going ", 8)
+
+	tests := []struct {
+		name         string
+		content      string
+		finishReason string
+		want         bool
+	}{
+		{"finish reason length", "Short answer.", "length", true},
+		{"complete sentence", "The answer is 42.", "stop", false},
+		{"short fragment is fine", "Sure thing", "stop", false},
+		{"empty content", "", "stop", false},
+		{"open code fence", "Here you go:\n```go\nfunc main() {\n}", "stop", true},
+		{"closed code fence", "Here you go:\n```go\nfunc main() {}\n```", "stop", false},
+		{"unbalanced brackets", "Call it like foo(bar, baz", "stop", true},
+		{"nested unbalanced", "config := map[string]int{\"a\": 1", "stop", true},
+		{"list numbering with stray closers", "Steps:\n1) install\n2) run.", "stop", false},
+		{"long response ends mid-sentence", longProse + "and then the", "stop", true},
+		{"long response ends with period", longProse + "to the end.", "stop", false},
+		{"long response ends with emoji", longProse + "done 🎉", "stop", false},
+		{"long response ends with quote", longProse + "he said \"ok\"", "stop", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LikelyTruncated(tt.content, tt.finishReason); got != tt.want {
+				t.Errorf("LikelyTruncated(%q, %q) = %v, want %v", tt.content, tt.finishReason, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package chat
+
+import (
+	"time"
+)
+
+// UsageRecord describes the token usage of a single completed request
+type UsageRecord struct {
+	Timestamp        time.Time      `json:"timestamp"`
+	ConversationID   ConversationID `json:"conversation_id"`
+	Model            string         `json:"model"`
+	PromptTokens     int            `json:"prompt_tokens"`
+	CompletionTokens int            `json:"completion_tokens"`
+	TotalTokens      int            `json:"total_tokens"`
+	EstimatedCostUSD float64        `json:"estimated_cost_usd"`
+}
+
+// UsageRecorder receives a record for every request the controller completes.
+// RecordUsage is called on the sending goroutine and should not block.
+type UsageRecorder interface {
+	RecordUsage(record UsageRecord)
+}
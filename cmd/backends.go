@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/backends/claude"
+	"github.com/jeanhaley/task-breaker/backends/mock"
+	"github.com/jeanhaley/task-breaker/backends/openai"
+	"github.com/jeanhaley/task-breaker/backends/router"
+	"github.com/jeanhaley/task-breaker/chat"
+	"github.com/jeanhaley/task-breaker/config"
+)
+
+// newConfiguredBackend creates the named backend from its config section.
+// "router" builds a router over the sections listed in router.backends.
+func newConfiguredBackend(cfg *config.Config, name string) (ai.Backend, error) {
+	switch name {
+	case "openai":
+		if cfg.OpenAI.APIKey == "" {
+			return nil, fmt.Errorf("OpenAI API key not configured (set OPENAI_API_KEY)")
+		}
+		return openai.NewClient(openai.Config{
+			APIKey:     cfg.OpenAI.APIKey,
+			BaseURL:    cfg.OpenAI.BaseURL,
+			Model:      cfg.OpenAI.Model,
+			Timeout:    cfg.OpenAI.Timeout,
+			MaxRetries: cfg.OpenAI.MaxRetries,
+		}), nil
+	case "claude":
+		if cfg.Claude.APIKey == "" {
+			return nil, fmt.Errorf("Claude API key not configured (set CLAUDE_API_KEY)")
+		}
+		return claude.NewClaudeBackend(claude.Config{
+			APIKey:     cfg.Claude.APIKey,
+			BaseURL:    cfg.Claude.BaseURL,
+			Model:      cfg.Claude.Model,
+			Timeout:    cfg.Claude.Timeout,
+			MaxRetries: cfg.Claude.MaxRetries,
+		}), nil
+	case "azure":
+		if cfg.Azure.APIKey == "" || cfg.Azure.Deployment == "" {
+			return nil, fmt.Errorf("Azure OpenAI api_key and deployment not configured")
+		}
+		return newAzureBackend(cfg.Azure), nil
+	case "mock":
+		return mock.NewMockBackend(), nil
+	case "router":
+		return newRouterBackend(cfg)
+	default:
+		return nil, fmt.Errorf("unknown backend: %s", name)
+	}
+}
+
+// newAzureBackend builds an OpenAI client addressed to an Azure deployment
+func newAzureBackend(cfg config.AzureConfig) ai.Backend {
+	return openai.NewAzureClient(openai.AzureConfig{
+		APIKey:       cfg.APIKey,
+		ResourceName: cfg.ResourceName,
+		Endpoint:     cfg.Endpoint,
+		Deployment:   cfg.Deployment,
+		APIVersion:   cfg.APIVersion,
+		Model:        cfg.Model,
+		Timeout:      cfg.Timeout,
+		MaxRetries:   cfg.MaxRetries,
+	})
+}
+
+// newRouterBackend builds a router over the backends named in the router
+// section. Each candidate asks for its own section's model, priced from
+// chat.DefaultModelPricing.
+func newRouterBackend(cfg *config.Config) (ai.Backend, error) {
+	models := map[string]string{
+		"openai": cfg.OpenAI.Model,
+		"claude": cfg.Claude.Model,
+		"azure":  cfg.Azure.Model,
+	}
+
+	var candidates []router.Candidate
+	for _, name := range cfg.Router.Backends {
+		if name == "router" {
+			return nil, fmt.Errorf("router cannot route to another router")
+		}
+		backend, err := newConfiguredBackend(cfg, name)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, router.Candidate{
+			Backend: backend,
+			Model:   models[name],
+			Weight:  cfg.Router.Weights[name],
+		})
+	}
+
+	return router.NewRouterBackend(router.Policy(cfg.Router.Policy), routerPricing(chat.DefaultModelPricing), candidates...)
+}
+
+// routerPricing blends a pricing table into the per-1K prices the router
+// compares, averaging each model's input and output prices
+func routerPricing(pricing map[string]chat.ModelPrice) map[string]float64 {
+	blended := make(map[string]float64, len(pricing))
+	for model, price := range pricing {
+		blended[model] = (price.InputPer1K + price.OutputPer1K) / 2
+	}
+	return blended
+}
@@ -3,143 +3,606 @@ package main
 import (
 	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
+	"os/signal"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"text/template"
 	"time"
 
-	"github.com/jeanhaley32/go-openai-client"
-	"github.com/jeanhaley32/go-openai-client/chat"
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/backends/mock"
+	"github.com/jeanhaley/task-breaker/backends/router"
+	"github.com/jeanhaley/task-breaker/chat"
 	"github.com/jeanhaley/task-breaker/config"
+	"github.com/jeanhaley/task-breaker/store/sqlite"
+	"github.com/jeanhaley/task-breaker/tasks"
+	"github.com/jeanhaley/task-breaker/usagelog"
 )
 
+// session holds the state of an interactive chat session along with the
+// streams it reads input from and writes output to.
+type session struct {
+	controller *chat.Controller
+	cfg        *config.Config
+	current    *chat.Conversation
+
+	// lastBreakdown holds the most recent task breakdown
+	lastBreakdown []tasks.Subtask
+
+	// lastResponse holds the most recent response, shown by /debug
+	lastResponse *chat.ChatResponse
+
+	// multiline makes every message a block ended by multilineTerminator
+	multiline bool
+
+	// jsonOutput prints each exchange as a JSON line instead of prose, and
+	// drops banners and prompts so stdout can be parsed
+	jsonOutput bool
+
+	// configPath is the config file in effect, shown in the startup banner
+	configPath string
+
+	// manager loaded cfg and saves changes made with /config set. Nil
+	// disables /config set.
+	manager *config.Manager
+
+	// systemPromptOverride replaces the configured system prompt when set
+	systemPromptOverride string
+
+	// systemPromptFile is the resolved default.system_prompt_file, if any
+	systemPromptFile string
+
+	// spinnerOut shows a spinner while waiting for replies. Nil disables
+	// it, as in batch mode or when stderr is not a terminal.
+	spinnerOut io.Writer
+
+	// ctx is the root of every request. Cancelling it, as Ctrl-C does,
+	// stops the request in flight and ends the session.
+	ctx context.Context
+
+	in      io.Reader
+	out     io.Writer
+	errOut  io.Writer
+	scanner *bufio.Scanner
+}
+
+// newSession creates a session bound to the standard streams
+func newSession(controller *chat.Controller, cfg *config.Config) *session {
+	return &session{
+		controller: controller,
+		cfg:        cfg,
+		ctx:        context.Background(),
+		in:         os.Stdin,
+		out:        os.Stdout,
+		errOut:     os.Stderr,
+	}
+}
+
 func main() {
+	batch := flag.Bool("batch", false, "read all of stdin as one message, print only the reply, and exit (default when stdin is not a terminal)")
+	configPath := flag.String("config", "", "path to the config file (default ~/.task-breaker-config.json)")
+	backendName := flag.String("backend", "", "backend to use for this session: openai, claude, azure, router, or mock")
+	model := flag.String("model", "", "model to use for this session")
+	profile := flag.String("profile", "", "config profile to use for this session")
+	systemPrompt := flag.String("system-prompt", "", "system prompt for new conversations, overriding the configured one")
+	logLevel := flag.String("log-level", "warn", "minimum level of logs written to stderr: debug, info, warn, or error")
+	showVersion := flag.Bool("version", false, "print version and build information and exit")
+	jsonOutput := flag.Bool("json", false, "print each exchange as a JSON line with conversation_id, user, assistant, and usage (or error)")
+	storePath := flag.String("store", "", "SQLite file to keep conversations in across sessions, overriding chat_controller.store_path")
+	flag.Parse()
+
+	// Registered first so it runs last, after the usage log and store are
+	// closed
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+
+	if *showVersion {
+		fmt.Println(versionString(buildInfo()))
+		return
+	}
+
+	logger, err := newLogger(os.Stderr, *logLevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+
 	// Load configuration
-	configManager := config.NewManager("")
+	configManager := config.NewManager(*configPath)
 	if err := configManager.Load(); err != nil {
+		logger.Warn("could not load configuration", "error", err)
+
 		// First run, initialize config
 		if err := configManager.InitializeConfig(); err != nil {
-			log.Fatalf("Failed to initialize configuration: %v", err)
+			fatal(logger, "failed to initialize configuration", "error", err)
+		}
+	}
+
+	if *profile != "" {
+		if err := configManager.UseProfile(*profile); err != nil {
+			fatal(logger, "invalid profile", "error", err)
 		}
 	}
 
-	cfg := configManager.GetConfig()
+	// Flags override the loaded configuration for this session only, so
+	// they are applied to a copy that /config set never saves
+	effective := *configManager.GetConfig()
+	cfg := &effective
+	applyOverrides(cfg, *backendName, *model)
 
 	// Validate configuration
-	if err := configManager.ValidateConfig(); err != nil {
-		log.Fatalf("Invalid configuration: %v", err)
+	if err := configManager.Validate(cfg); err != nil {
+		fatal(logger, "invalid configuration", "error", err)
 	}
 
 	// Initialize backend based on configuration
-	var backend openai.Backend
-
-	switch cfg.Default.Backend {
-	case "openai":
-		if cfg.OpenAI.APIKey == "" {
-			log.Fatal("OpenAI API key not configured. Set OPENAI_API_KEY environment variable.")
-		}
-		backend = openai.NewClient(openai.Config{
-			APIKey:     cfg.OpenAI.APIKey,
-			BaseURL:    cfg.OpenAI.BaseURL,
-			Model:      cfg.OpenAI.Model,
-			Timeout:    cfg.OpenAI.Timeout,
-			MaxRetries: cfg.OpenAI.MaxRetries,
-		})
-	case "mock":
-		backend = openai.NewMockBackend()
-	default:
-		log.Fatalf("Unknown backend: %s", cfg.Default.Backend)
+	backend, err := newConfiguredBackend(cfg, cfg.Default.Backend)
+	if err != nil {
+		fatal(logger, "failed to create backend", "error", err)
 	}
 
+	// Ctrl-C or SIGTERM cancels the request in flight and ends the session
+	rootCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Check backend availability
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(rootCtx, 10*time.Second)
 	defer cancel()
 
 	if !backend.IsAvailable(ctx) {
-		log.Printf("Warning: Backend '%s' is not available", backend.Name())
+		logger.Warn("backend is not available", "backend", backend.Name())
 		if cfg.Default.Backend != "mock" {
-			log.Println("Falling back to mock backend")
-			backend = openai.NewMockBackend()
+			logger.Warn("falling back to mock backend")
+			backend = mock.NewMockBackend()
+		}
+	}
+
+	controllerConfig := &chat.ControllerConfig{
+		DefaultModel:          cfg.ChatController.DefaultModel,
+		MaxTokens:             cfg.ChatController.MaxTokens,
+		Temperature:           cfg.ChatController.Temperature,
+		SafeMode:              cfg.ChatController.SafeMode,
+		MaxContextTokens:      cfg.ChatController.MaxContextTokens,
+		MaxRetries:            cfg.ChatController.MaxRetries,
+		RetryBaseDelay:        cfg.ChatController.RetryBaseDelay,
+		AutoSummarizeAtTokens: cfg.ChatController.AutoSummarizeAtTokens,
+		FallbackModels:        cfg.ChatController.FallbackModels,
+		AvailabilityTTL:       cfg.ChatController.AvailabilityTTL,
+		EmptyResponses:        chat.EmptyResponsePolicy(cfg.ChatController.EmptyResponses),
+		Logger:                logger,
+	}
+
+	// Fall back to the backend's retry setting
+	if controllerConfig.MaxRetries == 0 {
+		switch cfg.Default.Backend {
+		case "openai":
+			controllerConfig.MaxRetries = cfg.OpenAI.MaxRetries
+		case "claude":
+			controllerConfig.MaxRetries = cfg.Claude.MaxRetries
+		}
+	}
+
+	if cfg.ChatController.CompressPrompts {
+		controllerConfig.Compressor = chat.WhitespaceCompressor{}
+	}
+	if cfg.ChatController.TrimRoleLabels {
+		controllerConfig.RoleLabelTrimmer = chat.NewRoleLabelTrimmer()
+	}
+
+	// Keep conversations across sessions if a store is configured
+	if *storePath != "" {
+		cfg.ChatController.StorePath = *storePath
+	}
+	if cfg.ChatController.StorePath != "" {
+		store, err := sqlite.Open(cfg.ChatController.StorePath)
+		if err != nil {
+			fatal(logger, "failed to open conversation store", "error", err)
+		}
+		defer store.Close()
+		controllerConfig.Store = store
+	}
+
+	// Record token usage over time if a log path is configured
+	if cfg.ChatController.UsageLogPath != "" {
+		usageLog, err := usagelog.Open(cfg.ChatController.UsageLogPath)
+		if err != nil {
+			logger.Warn("usage logging disabled", "error", err)
+		} else {
+			defer func() {
+				if err := usageLog.Close(); err != nil {
+					logger.Error("failed to write usage log", "error", err)
+				}
+			}()
+			controllerConfig.UsageRecorder = usageLog
 		}
 	}
 
 	// Initialize chat controller
-	controller := chat.NewController(backend, &chat.ControllerConfig{
-		DefaultModel: cfg.ChatController.DefaultModel,
-		MaxTokens:    cfg.ChatController.MaxTokens,
-		Temperature:  cfg.ChatController.Temperature,
+	controller := chat.NewController(backend, controllerConfig)
+	defer controller.Stop()
+
+	s := newSession(controller, cfg)
+	s.ctx = rootCtx
+	s.configPath = configManager.GetConfigPath()
+	s.manager = configManager
+	s.systemPromptOverride = *systemPrompt
+	s.systemPromptFile = configManager.SystemPromptPath()
+	s.jsonOutput = *jsonOutput
+	if *batch || !isTerminal(os.Stdin) {
+		if err := s.runBatch(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			// Exit only after the deferred closes have run
+			exitCode = 1
+		}
+		return
+	}
+	if isTerminal(os.Stderr) {
+		s.spinnerOut = os.Stderr
+	}
+
+	if err := s.run(); err != nil {
+		logger.Error("error reading input", "error", err)
+	}
+	if err := s.autoSave(); err != nil {
+		logger.Error("failed to save conversations", "error", err)
+	}
+}
+
+// newLogger creates a text logger writing to w that drops records below the
+// named level
+func newLogger(w io.Writer, level string) (*slog.Logger, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: use debug, info, warn, or error", level)
+	}
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: l})), nil
+}
+
+// fatal logs an error and exits
+func fatal(logger *slog.Logger, msg string, args ...interface{}) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
+
+// applyOverrides applies the --backend and --model flags to cfg. Choosing a
+// backend without a model selects that backend's configured model.
+func applyOverrides(cfg *config.Config, backendName, model string) {
+	if backendName != "" {
+		cfg.Default.Backend = backendName
+		switch backendName {
+		case "openai":
+			cfg.Default.Model = cfg.OpenAI.Model
+		case "claude":
+			cfg.Default.Model = cfg.Claude.Model
+		case "azure":
+			cfg.Default.Model = cfg.Azure.Model
+		}
+	}
+	if model != "" {
+		cfg.Default.Model = model
+	}
+}
+
+// isTerminal reports whether f is an interactive terminal rather than a
+// pipe or file
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// runBatch reads the whole input as a single message, sends it, and writes
+// only the reply, with no banners or prompts, so the chat can be used in
+// pipelines
+func (s *session) runBatch() error {
+	data, err := io.ReadAll(s.in)
+	if err != nil {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+
+	message := strings.TrimSpace(string(data))
+	if message == "" {
+		return errors.New("no input to send")
+	}
+
+	s.current = s.controller.CreateConversation(s.systemPrompt())
+	if s.jsonOutput {
+		return s.sendJSON(message)
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, 60*time.Second)
+	defer cancel()
+
+	response, err := s.controller.SendMessage(ctx, chat.ChatRequest{
+		ConversationID: s.current.ID,
+		Message:        message,
+		Model:          s.cfg.Default.Model,
 	})
+	if err != nil {
+		return err
+	}
+	s.lastResponse = response
 
-	// Start interactive chat session
-	fmt.Printf("🤖 Task Breaker Chat Interface\n")
-	fmt.Printf("Backend: %s\n", backend.Name())
-	fmt.Printf("Model: %s\n", cfg.Default.Model)
-	fmt.Printf("\nType your message and press Enter. Type 'quit' to exit.\n")
-	fmt.Printf("Commands: /new, /list, /clear, /stats, /help\n\n")
+	fmt.Fprintln(s.out, response.Message.Content)
+	return nil
+}
 
-	scanner := bufio.NewScanner(os.Stdin)
-	var currentConversation *chat.Conversation
+// run starts the interactive chat loop and returns once the input is
+// exhausted or the user quits. The returned error reports input failures.
+func (s *session) run() error {
+	s.scanner = bufio.NewScanner(&contextReader{ctx: s.ctx, r: s.in})
 
 	// Create initial conversation
-	systemPrompt := loadSystemPrompt()
-	currentConversation = controller.CreateConversation(systemPrompt)
-	fmt.Printf("Started new conversation: %s\n\n", currentConversation.ID)
+	s.current = s.controller.CreateConversation(s.systemPrompt())
+
+	if s.jsonOutput {
+		return s.runJSON()
+	}
+
+	// Start interactive chat session
+	fmt.Fprintf(s.out, "🤖 Task Breaker Chat Interface\n")
+	fmt.Fprintf(s.out, "Backend: %s\n", s.controller.GetBackend().Name())
+	fmt.Fprintf(s.out, "Model: %s\n", s.cfg.Default.Model)
+	if s.configPath != "" {
+		fmt.Fprintf(s.out, "Config: %s\n", s.configPath)
+	}
+	if s.cfg.ActiveProfile != "" {
+		fmt.Fprintf(s.out, "Profile: %s\n", s.cfg.ActiveProfile)
+	}
+	fmt.Fprintf(s.out, "System prompt: %s\n", s.systemPromptSource())
+	fmt.Fprintf(s.out, "\nType your message and press Enter. Type 'quit' to exit.\n")
+	fmt.Fprintf(s.out, "Commands: /new, /list, /clear, /stats, /help\n\n")
+	s.printBanner()
 
 	for {
-		fmt.Print("You: ")
-		if !scanner.Scan() {
+		input, block, ok := s.readInput()
+		if !ok {
 			break
 		}
-
-		input := strings.TrimSpace(scanner.Text())
-		if input == "" {
+		if strings.TrimSpace(input) == "" {
 			continue
 		}
 
-		// Handle commands
-		if strings.HasPrefix(input, "/") {
-			handleCommand(input, controller, &currentConversation, cfg)
-			continue
-		}
+		if !block {
+			// Handle commands
+			if strings.HasPrefix(input, "/") {
+				s.handleCommand(input)
+				continue
+			}
 
-		// Handle quit
-		if input == "quit" || input == "exit" {
-			fmt.Println("Goodbye! 👋")
-			break
+			// Handle quit
+			if input == "quit" || input == "exit" {
+				fmt.Fprintln(s.out, "Goodbye! 👋")
+				break
+			}
 		}
 
-		// Send message
-		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-		response, err := controller.SendMessage(ctx, chat.ChatRequest{
-			ConversationID: currentConversation.ID,
+		// Send message and print the response as it streams in. The
+		// spinner runs until the first tokens arrive.
+		ctx, cancel := context.WithTimeout(s.ctx, 60*time.Second)
+		spin := s.startSpinner()
+		events, err := s.controller.SendMessageStream(ctx, chat.ChatRequest{
+			ConversationID: s.current.ID,
 			Message:        input,
-			Model:          cfg.Default.Model,
+			Model:          s.cfg.Default.Model,
 		})
+		if err != nil {
+			spin.Stop()
+			cancel()
+			fmt.Fprintf(s.errOut, "❌ Error: %v\n\n", err)
+			continue
+		}
+
+		replying := false
+		var response *chat.ChatResponse
+		for event := range events {
+			if !replying {
+				spin.Stop()
+				fmt.Fprintf(s.out, "🤖 %s: ", s.controller.GetBackend().Name())
+				replying = true
+			}
+			fmt.Fprint(s.out, event.Delta)
+			if event.Response != nil {
+				response, err = event.Response, event.Err
+			}
+		}
 		cancel()
+		spin.Stop()
+		fmt.Fprint(s.out, "\n\n")
 
+		if s.ctx.Err() != nil {
+			break
+		}
 		if err != nil {
-			fmt.Printf("❌ Error: %v\n\n", err)
+			fmt.Fprintf(s.errOut, "❌ Error: %v\n\n", err)
 			continue
 		}
+		s.reportResponse(response)
+	}
+
+	// Interrupted at the prompt or mid-reply
+	if s.ctx.Err() != nil {
+		fmt.Fprintln(s.out, "\nGoodbye! 👋")
+		return nil
+	}
+	return s.scanner.Err()
+}
 
-		// Display response
-		fmt.Printf("🤖 %s: %s\n\n", backend.Name(), response.Message.Content)
+// runJSON is the chat loop for --json. Every message is answered with one
+// JSON line; commands still work but their output is not JSON.
+func (s *session) runJSON() error {
+	for {
+		input, block, ok := s.readInput()
+		if !ok {
+			break
+		}
+		if strings.TrimSpace(input) == "" {
+			continue
+		}
+
+		if !block {
+			if strings.HasPrefix(input, "/") {
+				s.handleCommand(input)
+				continue
+			}
+			if input == "quit" || input == "exit" {
+				break
+			}
+		}
 
-		// Show token usage if available
-		if response.Response != nil {
-			usage := response.Response.Usage
-			fmt.Printf("📊 Tokens: %d prompt + %d completion = %d total\n\n",
-				usage.PromptTokens, usage.CompletionTokens, usage.TotalTokens)
+		// Failures are reported in the printed line
+		s.sendJSON(input)
+		if s.ctx.Err() != nil {
+			return nil
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		log.Printf("Error reading input: %v", err)
+	if s.ctx.Err() != nil {
+		return nil
 	}
+	return s.scanner.Err()
 }
 
-func handleCommand(command string, controller *chat.Controller, currentConv **chat.Conversation, cfg *config.Config) {
+// startSpinner shows a spinner on spinnerOut until the returned spinner is
+// stopped
+func (s *session) startSpinner() *spinner {
+	return startSpinner(s.spinnerOut, spinnerInterval)
+}
+
+// reportResponse remembers a reply and prints the notices and token usage
+// that follow it
+func (s *session) reportResponse(response *chat.ChatResponse) {
+	s.lastResponse = response
+
+	if response.FallbackFrom != "" {
+		fmt.Fprintf(s.errOut, "⚠️  %s is unavailable, answered with %s\n\n", response.FallbackFrom, response.Model)
+	}
+	if response.TrimmedMessages > 0 {
+		fmt.Fprintf(s.out, "✂️  Dropped %d old messages to fit the context budget\n\n", response.TrimmedMessages)
+	}
+	if response.SummarizedMessages > 0 {
+		fmt.Fprintf(s.out, "🗜️  Summarized %d older messages to save context\n\n", response.SummarizedMessages)
+	}
+	if response.SummarizeError != "" {
+		fmt.Fprintf(s.errOut, "⚠️  Automatic summarization failed: %s\n\n", response.SummarizeError)
+	}
+	if response.LikelyTruncated {
+		fmt.Fprintf(s.errOut, "⚠️  Response may be truncated\n\n")
+	}
+
+	// Show token usage if available
+	if response.Response != nil {
+		usage := response.Response.Usage
+		fmt.Fprintf(s.out, "📊 Tokens: %d prompt + %d completion = %d total\n\n",
+			usage.PromptTokens, usage.CompletionTokens, usage.TotalTokens)
+	}
+}
+
+// codeFence starts and ends a one-off multiline block
+const codeFence = "```"
+
+// multilineTerminator ends a message in multiline mode
+const multilineTerminator = "."
+
+// readInput prompts for and reads the next message or command. A line
+// holding only a code fence starts a block that runs until the closing
+// fence; in multiline mode every message is a block ended by a line holding
+// only multilineTerminator. Commands and quit are recognized on the first
+// line in either mode. block reports whether input came from a block and
+// ok is false once the input is exhausted.
+func (s *session) readInput() (input string, block bool, ok bool) {
+	switch {
+	case s.jsonOutput:
+		// Prompts would corrupt the JSON lines
+	case s.multiline:
+		fmt.Fprintf(s.out, "You (multiline, end with %s): ", multilineTerminator)
+	default:
+		fmt.Fprint(s.out, "You: ")
+	}
+	if !s.scanner.Scan() {
+		return "", false, false
+	}
+
+	line := s.scanner.Text()
+	trimmed := strings.TrimSpace(line)
+
+	switch {
+	case trimmed == codeFence:
+		return s.readBlock(codeFence), true, true
+	case s.multiline && trimmed != multilineTerminator && !strings.HasPrefix(trimmed, "/") &&
+		trimmed != "quit" && trimmed != "exit":
+		return s.readBlock(multilineTerminator, line), true, true
+	case s.multiline && trimmed == multilineTerminator:
+		return "", true, true
+	}
+
+	return trimmed, false, true
+}
+
+// readBlock accumulates lines until one holding only terminator, or until
+// the input ends, and returns them joined with surrounding blank lines
+// removed. Indentation inside the block is preserved.
+func (s *session) readBlock(terminator string, lines ...string) string {
+	for {
+		if !s.jsonOutput {
+			fmt.Fprint(s.out, "... ")
+		}
+		if !s.scanner.Scan() {
+			break
+		}
+
+		line := s.scanner.Text()
+		if strings.TrimSpace(line) == terminator {
+			break
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
+
+// confirm asks a yes/no question and reads the answer from the session input
+func (s *session) confirm(question string) bool {
+	fmt.Fprintf(s.out, "%s [y/N]: ", question)
+	if s.scanner == nil || !s.scanner.Scan() {
+		return false
+	}
+
+	answer := strings.ToLower(strings.TrimSpace(s.scanner.Text()))
+	return answer == "y" || answer == "yes"
+}
+
+// confirmations returns the token destructive controller calls need,
+// prompting the user first when the controller is in safe mode. ok is false
+// if the user declined.
+func (s *session) confirmations(question string) (tokens []chat.ConfirmationToken, ok bool) {
+	if !s.controller.SafeMode() {
+		return nil, true
+	}
+
+	if !s.confirm(question) {
+		return nil, false
+	}
+
+	return []chat.ConfirmationToken{chat.Confirm}, true
+}
+
+func (s *session) handleCommand(command string) {
 	parts := strings.Fields(command)
 	if len(parts) == 0 {
 		return
@@ -147,135 +610,919 @@ func handleCommand(command string, controller *chat.Controller, currentConv **ch
 
 	switch parts[0] {
 	case "/new":
-		// Create new conversation
-		systemPrompt := loadSystemPrompt()
-		*currentConv = controller.CreateConversation(systemPrompt)
-		fmt.Printf("✓ Started new conversation: %s\n\n", (*currentConv).ID)
+		// Create new conversation, with an inline system prompt if given
+		prompt := strings.TrimSpace(strings.TrimPrefix(command, parts[0]))
+		if prompt == "" {
+			prompt = s.systemPrompt()
+		}
+		s.current = s.controller.CreateConversation(prompt)
+		s.printBanner()
 
 	case "/list":
-		// List all conversations
-		conversations := controller.ListConversations()
-		fmt.Printf("📋 Conversations (%d total):\n", len(conversations))
-		for _, conv := range conversations {
-			summary, err := controller.GetConversationSummary(conv.ID)
-			if err != nil {
-				fmt.Printf("  %s (error getting summary)\n", conv.ID)
-				continue
+		// List all conversations, or those with a tag
+		conversations := s.controller.ListConversations()
+		var summaries []chat.ConversationSummary
+		if len(parts) > 1 {
+			summaries = s.controller.ListConversationsByTag(parts[1])
+			fmt.Fprintf(s.out, "📋 Conversations tagged %q (%d of %d):\n", parts[1], len(summaries), len(conversations))
+		} else {
+			for _, conv := range conversations {
+				summary, err := s.controller.GetConversationSummary(conv.ID)
+				if err != nil {
+					// Deleted since it was listed
+					continue
+				}
+				summaries = append(summaries, *summary)
 			}
+			fmt.Fprintf(s.out, "📋 Conversations (%d total):\n", len(conversations))
+		}
 
+		// Number entries by their place in the full list so /switch-conv #
+		// works the same whether or not the list is filtered
+		index := make(map[chat.ConversationID]int, len(conversations))
+		for i, conv := range conversations {
+			index[conv.ID] = i + 1
+		}
+
+		for _, summary := range summaries {
 			status := ""
-			if conv.ID == (*currentConv).ID {
+			if summary.ID == s.current.ID {
 				status = " [CURRENT]"
 			}
 
-			fmt.Printf("  %s%s - %d messages, updated %s\n",
-				conv.ID, status, summary.MessageCount, summary.UpdatedAt.Format("15:04:05"))
+			name := string(summary.ID)
+			if summary.Title != "" {
+				name = fmt.Sprintf("%s (%s)", summary.Title, summary.ID)
+			}
+
+			fmt.Fprintf(s.out, "  [%d] %s%s - %d messages, updated %s\n",
+				index[summary.ID], name, status, summary.MessageCount, summary.UpdatedAt.Format("15:04:05"))
 
+			if len(summary.Tags) > 0 {
+				fmt.Fprintf(s.out, "    Tags: %s\n", strings.Join(summary.Tags, ", "))
+			}
 			if summary.LastUserMessage != "" {
 				preview := summary.LastUserMessage
 				if len(preview) > 50 {
 					preview = preview[:50] + "..."
 				}
-				fmt.Printf("    Last: %s\n", preview)
+				fmt.Fprintf(s.out, "    Last: %s\n", preview)
+			}
+		}
+		fmt.Fprintln(s.out)
+
+	case "/tag", "/untag":
+		// Add or remove a tag on the current conversation
+		if len(parts) < 2 {
+			fmt.Fprintf(s.out, "Usage: %s <name>\n\n", parts[0])
+			return
+		}
+
+		if parts[0] == "/tag" {
+			if err := s.controller.AddTag(s.current.ID, parts[1]); err != nil {
+				fmt.Fprintf(s.errOut, "❌ Failed to tag conversation: %v\n\n", err)
+				return
 			}
+			fmt.Fprintf(s.out, "✓ Tagged %s with %q\n\n", s.current.ID, strings.ToLower(parts[1]))
+			return
+		}
+
+		if err := s.controller.RemoveTag(s.current.ID, parts[1]); err != nil {
+			fmt.Fprintf(s.errOut, "❌ Failed to untag conversation: %v\n\n", err)
+			return
 		}
-		fmt.Println()
+		fmt.Fprintf(s.out, "✓ Removed tag %q from %s\n\n", strings.ToLower(parts[1]), s.current.ID)
 
 	case "/clear":
 		// Clear current conversation
-		if err := controller.ClearConversation((*currentConv).ID); err != nil {
-			fmt.Printf("❌ Error clearing conversation: %v\n\n", err)
+		confirm, ok := s.confirmations(fmt.Sprintf("Clear all messages in %s?", s.current.ID))
+		if !ok {
+			fmt.Fprintf(s.out, "Clear cancelled\n\n")
+			return
+		}
+
+		if err := s.controller.ClearConversation(s.current.ID, confirm...); err != nil {
+			fmt.Fprintf(s.errOut, "❌ Error clearing conversation: %v\n\n", err)
 		} else {
-			fmt.Printf("✓ Cleared conversation %s\n\n", (*currentConv).ID)
+			fmt.Fprintf(s.out, "✓ Cleared conversation %s\n\n", s.current.ID)
 		}
 
 	case "/stats":
 		// Show controller statistics
-		stats := controller.GetStats()
-		fmt.Printf("📊 Chat Statistics:\n")
-		fmt.Printf("  Backend: %s\n", stats.BackendName)
-		fmt.Printf("  Total Conversations: %d\n", stats.TotalConversations)
-		fmt.Printf("  Total Messages: %d\n", stats.TotalMessages)
+		stats := s.controller.GetStats()
+		fmt.Fprintf(s.out, "📊 Chat Statistics:\n")
+		fmt.Fprintf(s.out, "  Backend: %s\n", stats.BackendName)
+		if r, ok := s.controller.GetBackend().(*router.Backend); ok {
+			fmt.Fprintf(s.out, "  Selection Policy: %s\n", r.Policy())
+			for _, candidate := range r.Stats() {
+				fmt.Fprintf(s.out, "    %s - %d requests, %d errors, avg latency %s\n",
+					candidate.Name, candidate.Requests, candidate.Errors, candidate.AverageLatency.Round(time.Millisecond))
+			}
+		}
+		fmt.Fprintf(s.out, "  Total Conversations: %d\n", stats.TotalConversations)
+		if stats.EvictedConversations > 0 {
+			fmt.Fprintf(s.out, "  Evicted Conversations: %d\n", stats.EvictedConversations)
+		}
+		fmt.Fprintf(s.out, "  Total Messages: %d\n", stats.TotalMessages)
+		fmt.Fprintf(s.out, "  Estimated Cost: $%.4f\n", stats.EstimatedCostUSD)
+		if stats.PricingUnavailable {
+			fmt.Fprintf(s.out, "    (some usage is from models without pricing and is not included)\n")
+		}
 		if stats.TotalConversations > 0 {
-			fmt.Printf("  Oldest: %s\n", stats.OldestConversation.Format("2006-01-02 15:04:05"))
-			fmt.Printf("  Newest: %s\n", stats.NewestConversation.Format("2006-01-02 15:04:05"))
+			fmt.Fprintf(s.out, "  Oldest: %s\n", stats.OldestConversation.Format("2006-01-02 15:04:05"))
+			fmt.Fprintf(s.out, "  Newest: %s\n", stats.NewestConversation.Format("2006-01-02 15:04:05"))
 		}
 
-		// Backend availability
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		available := controller.IsBackendAvailable(ctx)
+		// Backend health, with details when it is down
+		ctx, cancel := context.WithTimeout(s.ctx, 5*time.Second)
+		health, err := s.controller.CheckBackendHealth(ctx)
 		cancel()
 
-		if available {
-			fmt.Printf("  Backend Status: ✅ Available\n")
-		} else {
-			fmt.Printf("  Backend Status: ❌ Unavailable\n")
+		switch {
+		case err != nil:
+			fmt.Fprintf(s.out, "  Backend Status: ❌ Health check failed: %v\n", err)
+		case health.Available:
+			fmt.Fprintf(s.out, "  Backend Status: ✅ Available\n")
+		default:
+			fmt.Fprintf(s.out, "  Backend Status: ❌ Unavailable (%s)\n", health.Failure)
+			if health.Endpoint != "" {
+				fmt.Fprintf(s.out, "    Endpoint: %s\n", health.Endpoint)
+			}
+			if health.Detail != "" {
+				fmt.Fprintf(s.out, "    Detail: %s\n", health.Detail)
+			}
+			fmt.Fprintf(s.out, "    Latency: %s\n", health.Latency.Round(time.Millisecond))
 		}
-		fmt.Println()
+		fmt.Fprintln(s.out)
 
 	case "/switch":
 		// Switch backend
 		if len(parts) < 2 {
-			fmt.Printf("Usage: /switch <backend>\nAvailable: openai, mock\n\n")
+			fmt.Fprintf(s.out, "Usage: /switch <backend>\nAvailable: openai, claude, azure, router, mock\n\n")
 			return
 		}
 
-		var newBackend openai.Backend
-		switch parts[1] {
-		case "openai":
-			if cfg.OpenAI.APIKey == "" {
-				fmt.Printf("❌ OpenAI API key not configured\n\n")
+		newBackend, err := s.newBackend(parts[1])
+		if err != nil {
+			fmt.Fprintf(s.errOut, "❌ %v\n\n", err)
+			return
+		}
+
+		s.controller.SetBackend(newBackend)
+		s.cfg.Default.Backend = parts[1]
+		fmt.Fprintf(s.out, "✓ Switched to %s backend\n\n", newBackend.Name())
+
+	case "/config":
+		// Show or change settings
+		s.configCommand(parts[1:])
+
+	case "/history":
+		// Show the messages of the current conversation
+		s.printHistory(parts[1:])
+
+	case "/compressions":
+		// Show only the compression timeline of the current conversation
+		history, err := s.controller.GetCompressionHistory(s.current.ID)
+		if err != nil {
+			fmt.Fprintf(s.errOut, "❌ Error getting history: %v\n\n", err)
+			return
+		}
+
+		if len(history) == 0 {
+			fmt.Fprintf(s.out, "No compressions recorded for %s\n\n", s.current.ID)
+			return
+		}
+		s.printCompressions(history)
+
+	case "/break":
+		// Split a goal into subtasks
+		goal := strings.TrimSpace(strings.TrimPrefix(command, parts[0]))
+		if goal == "" {
+			fmt.Fprintf(s.out, "Usage: /break <goal>\n\n")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(s.ctx, 60*time.Second)
+		spin := s.startSpinner()
+		subtasks, err := s.controller.BreakTask(ctx, s.current.ID, goal)
+		spin.Stop()
+		cancel()
+		if err != nil {
+			fmt.Fprintf(s.errOut, "❌ Failed to break down task: %v\n\n", err)
+			return
+		}
+
+		s.lastBreakdown = make([]tasks.Subtask, len(subtasks))
+		fmt.Fprintf(s.out, "🧩 Subtasks:\n")
+		for i, subtask := range subtasks {
+			s.lastBreakdown[i] = tasks.Subtask{ID: strconv.Itoa(i + 1), Description: subtask}
+			fmt.Fprintf(s.out, "  %d. %s\n", i+1, subtask)
+		}
+		fmt.Fprintln(s.out)
+
+	case "/break-graph":
+		// Split a goal into subtasks with dependencies
+		goal := strings.TrimSpace(strings.TrimPrefix(command, parts[0]))
+		if goal == "" {
+			fmt.Fprintf(s.out, "Usage: /break-graph <goal>\n\n")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(s.ctx, 60*time.Second)
+		spin := s.startSpinner()
+		graph, err := s.controller.BreakTaskGraph(ctx, s.current.ID, goal)
+		spin.Stop()
+		cancel()
+		if err != nil {
+			fmt.Fprintf(s.errOut, "❌ Failed to break down task: %v\n\n", err)
+			return
+		}
+
+		s.lastBreakdown = graph.Nodes()
+		fmt.Fprintf(s.out, "🧩 Subtasks in dependency order:\n")
+		for subtask := range graph.Ordered() {
+			fmt.Fprintf(s.out, "  [%s] %s", subtask.ID, subtask.Description)
+			if len(subtask.DependsOn) > 0 {
+				fmt.Fprintf(s.out, " (after %s)", strings.Join(subtask.DependsOn, ", "))
+			}
+			fmt.Fprintln(s.out)
+		}
+		fmt.Fprintln(s.out)
+
+	case "/run-tasks":
+		// Work through the last task breakdown in this conversation
+		if len(s.lastBreakdown) == 0 {
+			fmt.Fprintf(s.out, "No task breakdown to run. Use /break <goal> first\n\n")
+			return
+		}
+
+		subtasks := make([]string, len(s.lastBreakdown))
+		for i, subtask := range s.lastBreakdown {
+			subtasks[i] = subtask.Description
+		}
+
+		fmt.Fprintf(s.out, "▶️  Running %d subtasks (Ctrl-C stops after the current one, waiting up to 5s)\n\n", len(subtasks))
+		err := s.controller.RunTaskPlan(s.ctx, s.current.ID, subtasks, func(i int, result string) {
+			fmt.Fprintf(s.out, "[%d/%d] %s\n🤖 %s\n\n", i+1, len(subtasks), subtasks[i], result)
+		})
+		if err != nil {
+			fmt.Fprintf(s.errOut, "❌ %v\n\n", err)
+			return
+		}
+		fmt.Fprintf(s.out, "✓ Completed %d subtasks\n\n", len(subtasks))
+
+	case "/validate-tasks":
+		// Check the last task breakdown's dependency graph
+		if len(s.lastBreakdown) == 0 {
+			fmt.Fprintf(s.out, "No task breakdown to validate\n\n")
+			return
+		}
+
+		if err := tasks.ValidateGraph(s.lastBreakdown); err != nil {
+			fmt.Fprintf(s.errOut, "❌ %v\n\n", err)
+			return
+		}
+		fmt.Fprintf(s.out, "✓ Task graph is valid (%d subtasks)\n\n", len(s.lastBreakdown))
+
+	case "/switch-conv":
+		// Make another conversation the current one
+		if len(parts) < 2 {
+			fmt.Fprintf(s.out, "Usage: /switch-conv <id, id prefix, or /list index>\n\n")
+			return
+		}
+
+		conv, err := s.resolveConversation(parts[1])
+		if err != nil {
+			fmt.Fprintf(s.errOut, "❌ %v\n\n", err)
+			return
+		}
+
+		s.current = conv
+		fmt.Fprintf(s.out, "✓ Switched to conversation %s\n", conv.ID)
+		s.printBanner()
+
+	case "/normalize":
+		// Tidy whitespace and empty messages in the current conversation
+		changes, err := s.controller.NormalizeInPlace(s.current.ID)
+		if err != nil {
+			fmt.Fprintf(s.errOut, "❌ Failed to normalize conversation: %v\n\n", err)
+			return
+		}
+		if changes == 0 {
+			fmt.Fprintf(s.out, "✓ Conversation already normalized\n\n")
+			return
+		}
+		fmt.Fprintf(s.out, "✓ Normalized conversation (%d changes)\n\n", changes)
+
+	case "/debug":
+		// Show details of the last response for troubleshooting
+		if s.lastResponse == nil {
+			fmt.Fprintf(s.out, "No responses yet\n\n")
+			return
+		}
+
+		fmt.Fprintf(s.out, "🔎 Last response:\n")
+		fmt.Fprintf(s.out, "  Conversation: %s\n", s.lastResponse.ConversationID)
+		if s.lastResponse.Response != nil {
+			fmt.Fprintf(s.out, "  Response ID: %s\n", s.lastResponse.Response.ID)
+			fmt.Fprintf(s.out, "  Model: %s\n", s.lastResponse.Response.Model)
+		}
+		if len(s.lastResponse.ProviderMetadata) == 0 {
+			fmt.Fprintf(s.out, "  Provider metadata: none\n\n")
+			return
+		}
+
+		fmt.Fprintf(s.out, "  Provider metadata:\n")
+		keys := make([]string, 0, len(s.lastResponse.ProviderMetadata))
+		for key := range s.lastResponse.ProviderMetadata {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(s.out, "    %s: %s\n", key, s.lastResponse.ProviderMetadata[key])
+		}
+		fmt.Fprintln(s.out)
+
+	case "/save":
+		// Write the current conversation to a JSON file
+		if len(parts) < 2 {
+			fmt.Fprintf(s.out, "Usage: /save <path>\n\n")
+			return
+		}
+
+		conv, err := s.controller.GetConversation(s.current.ID)
+		if err != nil {
+			fmt.Fprintf(s.errOut, "❌ Failed to save conversation: %v\n\n", err)
+			return
+		}
+
+		data, err := json.MarshalIndent(conv, "", "  ")
+		if err != nil {
+			fmt.Fprintf(s.errOut, "❌ Failed to encode conversation: %v\n\n", err)
+			return
+		}
+		if err := os.WriteFile(parts[1], data, 0600); err != nil {
+			fmt.Fprintf(s.errOut, "❌ Failed to save conversation: %v\n\n", err)
+			return
+		}
+		fmt.Fprintf(s.out, "✓ Saved conversation %s to %s\n\n", s.current.ID, parts[1])
+
+	case "/load":
+		// Read a saved conversation and make it the current one
+		if len(parts) < 2 {
+			fmt.Fprintf(s.out, "Usage: /load <path>\n\n")
+			return
+		}
+
+		data, err := os.ReadFile(parts[1])
+		if err != nil {
+			fmt.Fprintf(s.errOut, "❌ Failed to read conversation: %v\n\n", err)
+			return
+		}
+
+		var conv chat.Conversation
+		if err := json.Unmarshal(data, &conv); err != nil {
+			fmt.Fprintf(s.errOut, "❌ Failed to parse conversation: %v\n\n", err)
+			return
+		}
+		if err := s.controller.RegisterConversation(&conv); err != nil {
+			fmt.Fprintf(s.errOut, "❌ Failed to load conversation: %v\n\n", err)
+			return
+		}
+		loaded, err := s.controller.GetConversation(conv.ID)
+		if err != nil {
+			fmt.Fprintf(s.errOut, "❌ Failed to load conversation: %v\n\n", err)
+			return
+		}
+
+		s.current = loaded
+		fmt.Fprintf(s.out, "✓ Loaded conversation from %s\n", parts[1])
+		s.printBanner()
+
+	case "/import":
+		// Load a conversation exported elsewhere under a fresh ID
+		if len(parts) < 2 {
+			fmt.Fprintf(s.out, "Usage: /import <path>\n\n")
+			return
+		}
+
+		file, err := os.Open(parts[1])
+		if err != nil {
+			fmt.Fprintf(s.errOut, "❌ Failed to read conversation: %v\n\n", err)
+			return
+		}
+		conv, err := s.controller.ImportConversation(file)
+		file.Close()
+		if err != nil {
+			fmt.Fprintf(s.errOut, "❌ Failed to import conversation: %v\n\n", err)
+			return
+		}
+
+		s.current = conv
+		fmt.Fprintf(s.out, "✓ Imported conversation from %s as %s\n", parts[1], conv.ID)
+		s.printBanner()
+
+	case "/backup":
+		// Write every conversation to a single archive
+		if len(parts) < 2 {
+			fmt.Fprintf(s.out, "Usage: /backup <path>\n\n")
+			return
+		}
+
+		saved, err := s.writeState(parts[1])
+		if err != nil {
+			fmt.Fprintf(s.errOut, "❌ Failed to write backup: %v\n\n", err)
+			return
+		}
+		fmt.Fprintf(s.out, "✓ Backed up %d conversations to %s\n\n", saved, parts[1])
+
+	case "/restore":
+		// Replace or extend the conversations from a backup archive
+		merge := len(parts) == 3 && parts[2] == "merge"
+		if len(parts) < 2 || (len(parts) == 3 && !merge) || len(parts) > 3 {
+			fmt.Fprintf(s.out, "Usage: /restore <path> [merge]\n\n")
+			return
+		}
+
+		file, err := os.Open(parts[1])
+		if err != nil {
+			fmt.Fprintf(s.errOut, "❌ Failed to read backup: %v\n\n", err)
+			return
+		}
+		defer file.Close()
+
+		if merge {
+			restored, err := s.controller.MergeState(file)
+			if errors.Is(err, chat.ErrConfirmationRequired) {
+				// The backup replaces existing conversations, so ask first
+				confirm, ok := s.confirmations("Replace conversations that are also in the backup?")
+				if !ok {
+					fmt.Fprintf(s.out, "Restore cancelled\n\n")
+					return
+				}
+				if _, err := file.Seek(0, io.SeekStart); err != nil {
+					fmt.Fprintf(s.errOut, "❌ Failed to read backup: %v\n\n", err)
+					return
+				}
+				restored, err = s.controller.MergeState(file, confirm...)
+			}
+			if err != nil {
+				fmt.Fprintf(s.errOut, "❌ Failed to restore backup: %v\n\n", err)
 				return
 			}
-			newBackend = openai.NewClient(openai.Config{
-				APIKey:  cfg.OpenAI.APIKey,
-				BaseURL: cfg.OpenAI.BaseURL,
-				Model:   cfg.OpenAI.Model,
-				Timeout: cfg.OpenAI.Timeout,
-			})
-		case "mock":
-			newBackend = openai.NewMockBackend()
-		default:
-			fmt.Printf("❌ Unknown backend: %s\n\n", parts[1])
+			fmt.Fprintf(s.out, "✓ Merged %d conversations from %s\n\n", restored, parts[1])
 			return
 		}
 
-		// Test availability
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		if !newBackend.IsAvailable(ctx) {
-			cancel()
-			fmt.Printf("❌ Backend '%s' is not available\n\n", parts[1])
+		confirm, ok := s.confirmations("Replace all conversations with the backup?")
+		if !ok {
+			fmt.Fprintf(s.out, "Restore cancelled\n\n")
+			return
+		}
+		if err := s.controller.LoadState(file, confirm...); err != nil {
+			fmt.Fprintf(s.errOut, "❌ Failed to restore backup: %v\n\n", err)
+			return
+		}
+
+		// Stay in the current conversation if the backup has it, otherwise
+		// resume the most recently created one
+		conv, err := s.controller.GetConversation(s.current.ID)
+		if err != nil {
+			conversations := s.controller.ListConversations()
+			if len(conversations) == 0 {
+				conv = s.controller.CreateConversation(s.systemPrompt())
+			} else {
+				conv = conversations[len(conversations)-1]
+			}
+		}
+		s.current = conv
+		fmt.Fprintf(s.out, "✓ Restored %d conversations from %s\n", s.controller.GetStats().TotalConversations, parts[1])
+		s.printBanner()
+
+	case "/multiline":
+		// Toggle reading each message as a multiline block
+		s.multiline = !s.multiline
+		if s.multiline {
+			fmt.Fprintf(s.out, "✓ Multiline mode on. End each message with a line containing only %s\n\n", multilineTerminator)
+			return
+		}
+		fmt.Fprintf(s.out, "✓ Multiline mode off\n\n")
+
+	case "/rename":
+		// Set the title of the current conversation
+		title := strings.TrimSpace(strings.TrimPrefix(command, parts[0]))
+		if title == "" {
+			fmt.Fprintf(s.out, "Usage: /rename <title>\n\n")
+			return
+		}
+
+		if err := s.controller.RenameConversation(s.current.ID, title); err != nil {
+			fmt.Fprintf(s.errOut, "❌ Failed to rename conversation: %v\n\n", err)
+			return
+		}
+		fmt.Fprintf(s.out, "✓ Renamed conversation to %q\n\n", title)
+
+	case "/fork":
+		// Branch the current conversation and continue on the copy
+		fork, err := s.controller.ForkConversation(s.current.ID)
+		if err != nil {
+			fmt.Fprintf(s.errOut, "❌ Failed to fork conversation: %v\n\n", err)
+			return
+		}
+
+		parent := s.current.ID
+		s.current = fork
+		fmt.Fprintf(s.out, "✓ Forked %s into %s\n", parent, fork.ID)
+		s.printBanner()
+
+	case "/diff":
+		// Compare two conversations message by message
+		if len(parts) < 3 {
+			fmt.Fprintf(s.out, "Usage: /diff <id|#> <id|#>\n\n")
+			return
+		}
+
+		first, err := s.resolveConversation(parts[1])
+		if err != nil {
+			fmt.Fprintf(s.errOut, "❌ %v\n\n", err)
+			return
+		}
+		second, err := s.resolveConversation(parts[2])
+		if err != nil {
+			fmt.Fprintf(s.errOut, "❌ %v\n\n", err)
+			return
+		}
+
+		entries, err := s.controller.DiffConversations(first.ID, second.ID)
+		if err != nil {
+			fmt.Fprintf(s.errOut, "❌ Failed to compare conversations: %v\n\n", err)
 			return
 		}
+
+		fmt.Fprintf(s.out, "🔀 %s vs %s:\n", first.ID, second.ID)
+		differences := 0
+		for _, entry := range entries {
+			if entry.Status != chat.DiffEqual {
+				differences++
+			}
+			fmt.Fprintf(s.out, "  %s %3d  %-*s | %s\n", diffMarkers[entry.Status], entry.Index+1,
+				diffColumnWidth, diffCell(entry.A), diffCell(entry.B))
+		}
+		fmt.Fprintf(s.out, "%d of %d messages differ\n\n", differences, len(entries))
+
+	case "/system":
+		// Show or replace the system prompt of the current conversation
+		prompt := strings.TrimSpace(strings.TrimPrefix(command, parts[0]))
+		if prompt == "" {
+			current, err := s.controller.GetSystemPrompt(s.current.ID)
+			if err != nil {
+				fmt.Fprintf(s.errOut, "❌ Error getting system prompt: %v\n\n", err)
+				return
+			}
+			if current == "" {
+				fmt.Fprintf(s.out, "No system prompt set\nUsage: /system <prompt>\n\n")
+				return
+			}
+			fmt.Fprintf(s.out, "📝 System prompt:\n%s\n\n", current)
+			return
+		}
+
+		if err := s.controller.SetSystemPrompt(s.current.ID, prompt); err != nil {
+			fmt.Fprintf(s.errOut, "❌ Failed to set system prompt: %v\n\n", err)
+			return
+		}
+		fmt.Fprintf(s.out, "✓ System prompt updated\n\n")
+
+	case "/regenerate":
+		// Replace the last reply with a fresh one
+		ctx, cancel := context.WithTimeout(s.ctx, 60*time.Second)
+		spin := s.startSpinner()
+		response, err := s.controller.RegenerateLast(ctx, s.current.ID)
+		spin.Stop()
 		cancel()
+		if err != nil {
+			fmt.Fprintf(s.errOut, "❌ Failed to regenerate: %v\n\n", err)
+			return
+		}
+
+		fmt.Fprintf(s.out, "🤖 %s: %s\n\n", s.controller.GetBackend().Name(), response.Message.Content)
+		s.reportResponse(response)
+
+	case "/edit":
+		// Replace the last message and get a new reply to it
+		text := strings.TrimSpace(strings.TrimPrefix(command, parts[0]))
+		if text == "" {
+			fmt.Fprintf(s.out, "Usage: /edit <new text>\n\n")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(s.ctx, 60*time.Second)
+		spin := s.startSpinner()
+		response, err := s.controller.EditLastUserMessage(ctx, s.current.ID, text)
+		spin.Stop()
+		cancel()
+		if err != nil {
+			fmt.Fprintf(s.errOut, "❌ Failed to edit: %v\n\n", err)
+			return
+		}
+
+		fmt.Fprintf(s.out, "🤖 %s: %s\n\n", s.controller.GetBackend().Name(), response.Message.Content)
+		s.reportResponse(response)
+
+	case "/estimate":
+		// Project the cost of a message without sending it
+		message := strings.TrimSpace(strings.TrimPrefix(command, parts[0]))
+		if message == "" {
+			fmt.Fprintf(s.out, "Usage: /estimate <message>\n\n")
+			return
+		}
+
+		estimate, err := s.controller.EstimateRequest(s.current.ID, message)
+		if err != nil {
+			fmt.Fprintf(s.errOut, "❌ Failed to estimate: %v\n\n", err)
+			return
+		}
+
+		fmt.Fprintf(s.out, "🧮 Estimate for %s (not sent):\n", estimate.Model)
+		fmt.Fprintf(s.out, "  Prompt Tokens: %d\n", estimate.PromptTokens)
+		fmt.Fprintf(s.out, "  Max Completion Tokens: %d\n", estimate.MaxCompletionTokens)
+		if estimate.Priced {
+			fmt.Fprintf(s.out, "  Estimated Cost: up to $%.4f\n\n", estimate.EstimatedCostUSD)
+		} else {
+			fmt.Fprintf(s.out, "  Estimated Cost: unavailable (no pricing for %s)\n\n", estimate.Model)
+		}
+
+	case "/tokens":
+		// Show how much of the model's context window is in use
+		used, limit, err := s.controller.GetContextUsage(s.current.ID)
+		if err != nil {
+			fmt.Fprintf(s.errOut, "❌ Failed to get context usage: %v\n\n", err)
+			return
+		}
+
+		fmt.Fprintf(s.out, "🧮 Context Usage:\n")
+		fmt.Fprintf(s.out, "  Prompt Tokens: %d\n", used)
+		if limit <= 0 {
+			fmt.Fprintf(s.out, "  Context Limit: unknown for this model\n\n")
+			return
+		}
+		percent := float64(used) / float64(limit) * 100
+		fmt.Fprintf(s.out, "  Context Limit: %d\n", limit)
+		fmt.Fprintf(s.out, "  Used: %.1f%%\n", percent)
+		if percent > contextWarningPercent {
+			fmt.Fprintf(s.out, "⚠️  Nearly full: use /clear to start over, or rely on auto-summarization to compact older messages\n")
+		}
+		fmt.Fprintln(s.out)
+
+	case "/search":
+		// Find conversations mentioning the query
+		query := strings.TrimSpace(strings.TrimPrefix(command, parts[0]))
+		results, err := s.controller.SearchConversations(query)
+		if err != nil {
+			fmt.Fprintf(s.errOut, "❌ %v\nUsage: /search <query>\n\n", err)
+			return
+		}
+		if len(results) == 0 {
+			fmt.Fprintf(s.out, "No conversations match %q\n\n", query)
+			return
+		}
 
-		controller.SetBackend(newBackend)
-		fmt.Printf("✓ Switched to %s backend\n\n", newBackend.Name())
+		fmt.Fprintf(s.out, "🔍 %d conversations match %q:\n", len(results), query)
+		for _, result := range results {
+			snippet := result.Snippet
+			if len(snippet) > 60 {
+				snippet = snippet[:60] + "..."
+			}
+			fmt.Fprintf(s.out, "  %s (%d matches): %s\n", result.ID, result.Matches, snippet)
+		}
+		fmt.Fprintln(s.out)
 
 	case "/help":
-		fmt.Printf("🤖 Task Breaker Commands:\n")
-		fmt.Printf("  /new          - Start a new conversation\n")
-		fmt.Printf("  /list         - List all conversations\n")
-		fmt.Printf("  /clear        - Clear current conversation\n")
-		fmt.Printf("  /stats        - Show statistics\n")
-		fmt.Printf("  /switch <be>  - Switch backend (openai, mock)\n")
-		fmt.Printf("  /help         - Show this help\n")
-		fmt.Printf("  quit/exit     - Exit the chat\n\n")
+		fmt.Fprintf(s.out, "🤖 Task Breaker Commands:\n")
+		fmt.Fprintf(s.out, "  /new [prompt] - Start a new conversation, optionally with its own system prompt\n")
+		fmt.Fprintf(s.out, "  /list [tag]   - List all conversations, or those with a tag\n")
+		fmt.Fprintf(s.out, "  /tag <name>   - Tag the current conversation\n")
+		fmt.Fprintf(s.out, "  /untag <name> - Remove a tag from the current conversation\n")
+		fmt.Fprintf(s.out, "  /clear        - Clear current conversation\n")
+		fmt.Fprintf(s.out, "  /stats        - Show statistics\n")
+		fmt.Fprintf(s.out, "  /history [n] [--tokens] - Show the conversation, or its last n exchanges, and its compressions\n")
+		fmt.Fprintf(s.out, "  /compressions - Show only the compression history\n")
+		fmt.Fprintf(s.out, "  /break <goal> - Split a goal into subtasks\n")
+		fmt.Fprintf(s.out, "  /break-graph <goal> - Split a goal into subtasks with dependencies\n")
+		fmt.Fprintf(s.out, "  /run-tasks    - Run the last breakdown's subtasks in order\n")
+		fmt.Fprintf(s.out, "  /validate-tasks - Check the last task breakdown's dependencies\n")
+		fmt.Fprintf(s.out, "  /switch <be>  - Switch backend (openai, claude, azure, router, mock)\n")
+		fmt.Fprintf(s.out, "  /config [set <key> <value>] - Show settings, or change and save one\n")
+		fmt.Fprintf(s.out, "  /switch-conv <id|#> - Switch conversation by ID, prefix, or /list index\n")
+		fmt.Fprintf(s.out, "  /normalize    - Trim whitespace and drop empty messages\n")
+		fmt.Fprintf(s.out, "  /multiline    - Toggle multiline input (or wrap a message in %s)\n", codeFence)
+		fmt.Fprintf(s.out, "  /rename <t>   - Set the title of the current conversation\n")
+		fmt.Fprintf(s.out, "  /regenerate   - Replace the last reply with a fresh one\n")
+		fmt.Fprintf(s.out, "  /edit <text>  - Replace your last message and get a new reply\n")
+		fmt.Fprintf(s.out, "  /fork         - Branch the current conversation and switch to the copy\n")
+		fmt.Fprintf(s.out, "  /diff <a> <b> - Compare two conversations side by side\n")
+		fmt.Fprintf(s.out, "  /system [p]   - Show or replace the system prompt\n")
+		fmt.Fprintf(s.out, "  /estimate <m> - Show projected tokens and cost of a message without sending it\n")
+		fmt.Fprintf(s.out, "  /tokens       - Show context window usage for the current conversation\n")
+		fmt.Fprintf(s.out, "  /search <q>   - Find conversations mentioning a phrase\n")
+		fmt.Fprintf(s.out, "  /save <path>  - Save current conversation to a JSON file\n")
+		fmt.Fprintf(s.out, "  /load <path>  - Load a saved conversation and switch to it\n")
+		fmt.Fprintf(s.out, "  /import <path> - Import a conversation exported elsewhere under a new ID\n")
+		fmt.Fprintf(s.out, "  /backup <path> - Save every conversation to one archive\n")
+		fmt.Fprintf(s.out, "  /restore <path> [merge] - Replace conversations with a backup, or merge it in\n")
+		fmt.Fprintf(s.out, "  /debug        - Show provider details of the last response\n")
+		fmt.Fprintf(s.out, "  /help         - Show this help\n")
+		fmt.Fprintf(s.out, "  quit/exit     - Exit the chat\n\n")
 
 	default:
-		fmt.Printf("❌ Unknown command: %s\nType /help for available commands\n\n", parts[0])
+		fmt.Fprintf(s.errOut, "❌ Unknown command: %s\nType /help for available commands\n\n", parts[0])
 	}
 }
 
-func loadSystemPrompt() string {
-	// Try to load system prompt from file
-	if _, err := os.Stat("system-prompt.txt"); err == nil {
-		data, err := os.ReadFile("system-prompt.txt")
-		if err == nil {
-			return strings.TrimSpace(string(data))
+// newBackend creates the named backend from the configuration and checks
+// that it is available
+func (s *session) newBackend(name string) (ai.Backend, error) {
+	backend, err := newConfiguredBackend(s.cfg, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Test availability
+	ctx, cancel := context.WithTimeout(s.ctx, 5*time.Second)
+	defer cancel()
+	if !backend.IsAvailable(ctx) {
+		return nil, fmt.Errorf("backend '%s' is not available", name)
+	}
+	return backend, nil
+}
+
+// diffColumnWidth is the width of each side of /diff output
+const diffColumnWidth = 40
+
+// diffMarkers prefix each /diff line with how the messages differ
+var diffMarkers = map[chat.DiffStatus]string{
+	chat.DiffEqual:   " ",
+	chat.DiffChanged: "~",
+	chat.DiffAdded:   "+",
+	chat.DiffRemoved: "-",
+}
+
+// diffCell renders one side of a /diff line as a single truncated line
+func diffCell(msg *ai.Message) string {
+	if msg == nil {
+		return ""
+	}
+	text := []rune(strings.Join(strings.Fields(fmt.Sprintf("%s: %s", msg.Role, msg.Content)), " "))
+	if len(text) > diffColumnWidth {
+		text = append(text[:diffColumnWidth-3], []rune("...")...)
+	}
+	return string(text)
+}
+
+// contextWarningPercent is the context window usage above which /tokens
+// warns that the conversation is nearly full
+const contextWarningPercent = 80
+
+// defaultBanner is shown when a conversation starts or resumes unless the
+// configuration provides its own template
+const defaultBanner = `{{if .New}}Started new conversation: {{.Name}}{{else}}Resumed conversation: {{.Name}}{{with .Title}} - {{.}}{{end}}{{end}}
+  Messages: {{.MessageCount}} | Tokens: {{.Tokens}} | Cost: ${{printf "%.4f" .CostUSD}} | Model: {{.Model}}
+`
+
+// bannerData is the data available to the welcome banner template
+type bannerData struct {
+	ID   chat.ConversationID
+	Name string
+	// Title is the conversation's title, empty until one is set or generated
+	Title        string
+	MessageCount int
+	Tokens       int
+	CostUSD      float64
+	Model        string
+	// New is true until the user has sent a message
+	New bool
+}
+
+// printBanner writes the welcome banner for the current conversation
+func (s *session) printBanner() {
+	if s.jsonOutput {
+		return
+	}
+
+	summary, err := s.controller.GetConversationSummary(s.current.ID)
+	if err != nil {
+		fmt.Fprintf(s.errOut, "❌ %v\n\n", err)
+		return
+	}
+
+	model := summary.LastModel
+	if model == "" {
+		model = s.cfg.ChatController.DefaultModel
+	}
+
+	// Prefer the backend's reported usage and fall back to the estimate
+	tokens := summary.Usage.TotalTokens
+	if tokens == 0 {
+		tokens = summary.EstimatedTokens
+	}
+
+	data := bannerData{
+		ID:           summary.ID,
+		Name:         string(summary.ID),
+		Title:        summary.Title,
+		MessageCount: summary.MessageCount,
+		Tokens:       tokens,
+		CostUSD:      summary.EstimatedCostUSD,
+		Model:        model,
+		New:          summary.UserMessages == 0,
+	}
+
+	text := s.cfg.ChatController.WelcomeBanner
+	if text == "" {
+		text = defaultBanner
+	}
+
+	tmpl, err := template.New("banner").Parse(text)
+	if err != nil {
+		fmt.Fprintf(s.errOut, "❌ Invalid welcome banner template: %v\n", err)
+		tmpl = template.Must(template.New("banner").Parse(defaultBanner))
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		fmt.Fprintf(s.errOut, "❌ Failed to render welcome banner: %v\n\n", err)
+		return
+	}
+	fmt.Fprintf(s.out, "%s\n\n", strings.TrimRight(b.String(), "\n"))
+}
+
+// resolveConversation finds a conversation by /list index, exact ID, or
+// unique ID prefix
+func (s *session) resolveConversation(ref string) (*chat.Conversation, error) {
+	conversations := s.controller.ListConversations()
+
+	if index, err := strconv.Atoi(ref); err == nil {
+		if index < 1 || index > len(conversations) {
+			return nil, fmt.Errorf("no conversation at index %d (have %d)", index, len(conversations))
+		}
+		return conversations[index-1], nil
+	}
+
+	var matches []*chat.Conversation
+	for _, conv := range conversations {
+		if string(conv.ID) == ref {
+			return conv, nil
+		}
+		if strings.HasPrefix(string(conv.ID), ref) {
+			matches = append(matches, conv)
 		}
 	}
 
-	// Default system prompt
-	return "You are a helpful AI assistant built with Task Breaker. You are knowledgeable, concise, and always try to provide accurate information."
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no conversation matches %q", ref)
+	case 1:
+		return matches[0], nil
+	default:
+		candidates := make([]string, len(matches))
+		for i, conv := range matches {
+			candidates[i] = string(conv.ID)
+		}
+		return nil, fmt.Errorf("%q is ambiguous, candidates: %s", ref, strings.Join(candidates, ", "))
+	}
+}
+
+// defaultSystemPrompt is used when neither the flag nor the config sets one
+const defaultSystemPrompt = "You are a helpful AI assistant built with Task Breaker. You are knowledgeable, concise, and always try to provide accurate information."
+
+// systemPrompt returns the prompt new conversations start with
+func (s *session) systemPrompt() string {
+	prompt, _ := s.resolveSystemPrompt()
+	return prompt
+}
+
+// systemPromptSource describes where systemPrompt comes from
+func (s *session) systemPromptSource() string {
+	_, source := s.resolveSystemPrompt()
+	return source
+}
+
+// resolveSystemPrompt returns the system prompt and where it came from.
+// The --system-prompt flag wins, then default.system_prompt, then
+// default.system_prompt_file, then the built-in default. An unreadable
+// file falls back to the built-in default.
+func (s *session) resolveSystemPrompt() (prompt, source string) {
+	if s.systemPromptOverride != "" {
+		return s.systemPromptOverride, "--system-prompt flag"
+	}
+	if s.cfg != nil && s.cfg.Default.SystemPrompt != "" {
+		return s.cfg.Default.SystemPrompt, "config default.system_prompt"
+	}
+	if s.systemPromptFile != "" {
+		data, err := os.ReadFile(s.systemPromptFile)
+		if err == nil {
+			return strings.TrimSpace(string(data)), s.systemPromptFile
+		}
+	}
+	return defaultSystemPrompt, "built-in default"
 }
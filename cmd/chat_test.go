@@ -0,0 +1,911 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/backends/mock"
+	"github.com/jeanhaley/task-breaker/backends/openai"
+	"github.com/jeanhaley/task-breaker/chat"
+	"github.com/jeanhaley/task-breaker/config"
+	"github.com/jeanhaley/task-breaker/tasks"
+)
+
+// newTestSession creates a session backed by the mock backend that reads the
+// given script and captures everything written to stdout and stderr
+func newTestSession(t *testing.T, script string) (*session, *bytes.Buffer, *bytes.Buffer) {
+	t.Helper()
+
+	manager := config.NewManager(t.TempDir() + "/config.json")
+	cfg := manager.GetConfig()
+	controller := chat.NewController(mock.NewMockBackend(), &chat.ControllerConfig{
+		DefaultModel: cfg.ChatController.DefaultModel,
+		MaxTokens:    cfg.ChatController.MaxTokens,
+		Temperature:  cfg.ChatController.Temperature,
+	})
+
+	var out, errOut bytes.Buffer
+	s := newSession(controller, cfg)
+	s.in = strings.NewReader(script)
+	s.out = &out
+	s.errOut = &errOut
+	s.manager = manager
+
+	return s, &out, &errOut
+}
+
+func TestSession_Run(t *testing.T) {
+	s, out, errOut := newTestSession(t, "Hello there\n/stats\nquit\nnever sent\n")
+
+	if err := s.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+
+	output := out.String()
+	for _, want := range []string{
+		"Task Breaker Chat Interface",
+		"Started new conversation",
+		"received: 'Hello there'",
+		"Total Messages: 3",
+		"Estimated Cost: $",
+		"Goodbye!",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, output)
+		}
+	}
+
+	if strings.Contains(output, "never sent") {
+		t.Error("Input after quit should not be processed")
+	}
+
+	if errOut.Len() != 0 {
+		t.Errorf("Expected no error output, got: %s", errOut.String())
+	}
+}
+
+func TestSession_UnknownCommand(t *testing.T) {
+	s, out, errOut := newTestSession(t, "/bogus\n")
+
+	if err := s.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+
+	if !strings.Contains(errOut.String(), "Unknown command: /bogus") {
+		t.Errorf("Expected unknown command on error writer, got: %s", errOut.String())
+	}
+
+	if strings.Contains(out.String(), "Unknown command") {
+		t.Error("Errors should not be written to the output writer")
+	}
+}
+
+func TestSession_ClearInSafeMode(t *testing.T) {
+	s, out, _ := newTestSession(t, "Hello\n/clear\nn\n/stats\n/clear\ny\n/stats\n")
+	s.controller.SetSafeMode(true)
+
+	if err := s.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+
+	output := out.String()
+	if !strings.Contains(output, "Clear cancelled") {
+		t.Errorf("Expected declined clear to be cancelled, got:\n%s", output)
+	}
+	if !strings.Contains(output, "Total Messages: 3") {
+		t.Errorf("Expected messages to survive a declined clear, got:\n%s", output)
+	}
+	if !strings.Contains(output, "Total Messages: 1") {
+		t.Errorf("Expected confirmed clear to keep only the system prompt, got:\n%s", output)
+	}
+}
+
+func TestSession_StatsShowsSelectionPolicy(t *testing.T) {
+	s, out, errOut := newTestSession(t, "/switch router\nHello\n/stats\n")
+	s.cfg.Router.Backends = []string{"mock", "mock"}
+
+	if err := s.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+	if errOut.Len() > 0 {
+		t.Fatalf("Expected no errors, got: %s", errOut.String())
+	}
+
+	if !strings.Contains(out.String(), "Selection Policy: round-robin") {
+		t.Errorf("Expected /stats to show the selection policy, got:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "MockAI - 1 requests") {
+		t.Errorf("Expected /stats to show the routed request, got:\n%s", out.String())
+	}
+}
+
+func TestSession_ValidateTasks(t *testing.T) {
+	s, out, errOut := newTestSession(t, "/validate-tasks\n")
+	if err := s.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+	if !strings.Contains(out.String(), "No task breakdown to validate") {
+		t.Errorf("Expected message about missing breakdown, got:\n%s", out.String())
+	}
+
+	s, _, errOut = newTestSession(t, "/validate-tasks\n")
+	s.lastBreakdown = []tasks.Subtask{
+		{ID: "1", DependsOn: []string{"2"}},
+		{ID: "2", DependsOn: []string{"1"}},
+	}
+	if err := s.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+	if !strings.Contains(errOut.String(), "dependency cycle: 1 -> 2 -> 1") {
+		t.Errorf("Expected cycle to be reported, got:\n%s", errOut.String())
+	}
+}
+
+func TestSession_Break(t *testing.T) {
+	s, out, errOut := newTestSession(t, "")
+	backend := mock.NewMockBackend()
+	backend.SetLatency(0)
+	backend.QueueResponse("1. Pick a date\n2. Invite guests")
+	s.controller.SetBackend(backend)
+	s.current = s.controller.CreateConversation("")
+
+	s.handleCommand("/break plan a party")
+	if errOut.Len() > 0 {
+		t.Fatalf("Expected no errors, got: %s", errOut.String())
+	}
+	if !strings.Contains(out.String(), "1. Pick a date\n  2. Invite guests") {
+		t.Errorf("Expected numbered subtasks, got:\n%s", out.String())
+	}
+	if len(s.lastBreakdown) != 2 || s.lastBreakdown[1].ID != "2" || s.lastBreakdown[1].Description != "Invite guests" {
+		t.Errorf("Expected the breakdown to be kept for /validate-tasks, got %+v", s.lastBreakdown)
+	}
+}
+
+func TestSession_BreakGraph(t *testing.T) {
+	s, out, errOut := newTestSession(t, "")
+	backend := mock.NewMockBackend()
+	backend.SetLatency(0)
+	backend.QueueResponse(`[{"id": "2", "description": "Invite guests", "depends_on": ["1"]}, {"id": "1", "description": "Pick a date"}]`)
+	s.controller.SetBackend(backend)
+	s.current = s.controller.CreateConversation("")
+
+	s.handleCommand("/break-graph plan a party")
+	if errOut.Len() > 0 {
+		t.Fatalf("Expected no errors, got: %s", errOut.String())
+	}
+	if !strings.Contains(out.String(), "[1] Pick a date\n  [2] Invite guests (after 1)") {
+		t.Errorf("Expected subtasks in dependency order, got:\n%s", out.String())
+	}
+	if len(s.lastBreakdown) != 2 || s.lastBreakdown[0].ID != "2" {
+		t.Errorf("Expected the breakdown to be kept for /validate-tasks, got %+v", s.lastBreakdown)
+	}
+}
+
+func TestSession_RunTasks(t *testing.T) {
+	s, out, errOut := newTestSession(t, "")
+	backend := mock.NewMockBackend()
+	backend.SetLatency(0)
+	backend.QueueResponse("Saturday works")
+	backend.QueueResponse("Invites sent")
+	s.controller.SetBackend(backend)
+	s.current = s.controller.CreateConversation("")
+
+	s.handleCommand("/run-tasks")
+	if !strings.Contains(out.String(), "No task breakdown to run") {
+		t.Errorf("Expected message about missing breakdown, got:\n%s", out.String())
+	}
+
+	s.lastBreakdown = []tasks.Subtask{{ID: "1", Description: "Pick a date"}, {ID: "2", Description: "Invite guests"}}
+	s.handleCommand("/run-tasks")
+	if errOut.Len() > 0 {
+		t.Fatalf("Expected no errors, got: %s", errOut.String())
+	}
+	for _, want := range []string{"[1/2] Pick a date\n🤖 Saturday works", "[2/2] Invite guests\n🤖 Invites sent", "✓ Completed 2 subtasks"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in output, got:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestSession_SwitchConversation(t *testing.T) {
+	s, out, errOut := newTestSession(t, "")
+	first := s.controller.CreateConversation("first")
+	second := s.controller.CreateConversation("second")
+	s.current = first
+
+	s.handleCommand("/switch-conv 2")
+	if s.current.ID != second.ID {
+		t.Errorf("Expected index 2 to select %s, got %s", second.ID, s.current.ID)
+	}
+
+	s.current = first
+	s.handleCommand("/switch-conv " + string(second.ID)[:len(second.ID)-1])
+	if s.current.ID != second.ID {
+		t.Errorf("Expected unique prefix to select %s, got %s", second.ID, s.current.ID)
+	}
+
+	s.handleCommand("/switch-conv " + string(first.ID))
+	if s.current.ID != first.ID {
+		t.Errorf("Expected exact ID to select %s, got %s", first.ID, s.current.ID)
+	}
+
+	errOut.Reset()
+	s.handleCommand("/switch-conv conv_")
+	if !strings.Contains(errOut.String(), "ambiguous") ||
+		!strings.Contains(errOut.String(), string(first.ID)) ||
+		!strings.Contains(errOut.String(), string(second.ID)) {
+		t.Errorf("Expected ambiguous prefix to list candidates, got: %s", errOut.String())
+	}
+
+	errOut.Reset()
+	s.handleCommand("/switch-conv 9")
+	if !strings.Contains(errOut.String(), "no conversation at index 9") {
+		t.Errorf("Expected out-of-range index error, got: %s", errOut.String())
+	}
+
+	errOut.Reset()
+	s.handleCommand("/switch-conv nope")
+	if !strings.Contains(errOut.String(), "no conversation matches") {
+		t.Errorf("Expected no-match error, got: %s", errOut.String())
+	}
+
+	out.Reset()
+	s.handleCommand("/list")
+	if !strings.Contains(out.String(), "[1] "+string(first.ID)+" [CURRENT]") {
+		t.Errorf("Expected /list to show indexes in creation order, got:\n%s", out.String())
+	}
+}
+
+func TestSession_WelcomeBanner(t *testing.T) {
+	s, out, errOut := newTestSession(t, "")
+	ctx := context.Background()
+
+	s.current = s.controller.CreateConversation("")
+	s.printBanner()
+	if !strings.Contains(out.String(), "Started new conversation: "+string(s.current.ID)) ||
+		!strings.Contains(out.String(), "Messages: 0") ||
+		!strings.Contains(out.String(), "Cost: $0.0000") {
+		t.Errorf("Expected new conversation banner, got:\n%s", out.String())
+	}
+
+	resumed := s.controller.CreateConversation("")
+	if _, err := s.controller.SendMessage(ctx, chat.ChatRequest{ConversationID: resumed.ID, Message: "hi"}); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+
+	out.Reset()
+	s.handleCommand("/switch-conv " + string(resumed.ID))
+	output := out.String()
+	if !strings.Contains(output, "Resumed conversation: "+string(resumed.ID)) ||
+		!strings.Contains(output, "Messages: 2") ||
+		strings.Contains(output, "Tokens: 0 ") {
+		t.Errorf("Expected resumed conversation banner with stats, got:\n%s", output)
+	}
+
+	s.cfg.ChatController.WelcomeBanner = "{{.Name}} has {{.MessageCount}} messages"
+	out.Reset()
+	s.printBanner()
+	if got := out.String(); got != string(resumed.ID)+" has 2 messages\n\n" {
+		t.Errorf("Expected custom banner, got %q", got)
+	}
+
+	s.cfg.ChatController.WelcomeBanner = "{{.Nope"
+	out.Reset()
+	s.printBanner()
+	if !strings.Contains(errOut.String(), "Invalid welcome banner template") ||
+		!strings.Contains(out.String(), "Resumed conversation") {
+		t.Errorf("Expected invalid template to fall back to default banner, got out=%q err=%q", out.String(), errOut.String())
+	}
+}
+
+func TestSession_Debug(t *testing.T) {
+	s, out, _ := newTestSession(t, "/debug\nhello\n/debug\n")
+
+	if err := s.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+
+	output := out.String()
+	if !strings.Contains(output, "No responses yet") {
+		t.Errorf("Expected /debug before any message to say so, got:\n%s", output)
+	}
+	if !strings.Contains(output, "request_id: chatcmpl-mock-") {
+		t.Errorf("Expected /debug to show provider metadata, got:\n%s", output)
+	}
+}
+
+func TestSession_SwitchClaudeRequiresKey(t *testing.T) {
+	s, _, errOut := newTestSession(t, "")
+	s.cfg.Claude.APIKey = ""
+
+	s.handleCommand("/switch claude")
+	if !strings.Contains(errOut.String(), "Claude API key not configured") {
+		t.Errorf("Expected missing key error, got: %s", errOut.String())
+	}
+	if s.controller.GetBackend().Name() == "Claude" {
+		t.Error("Backend should not change without an API key")
+	}
+}
+
+func TestSession_SaveAndLoad(t *testing.T) {
+	path := t.TempDir() + "/conversation.json"
+	s, out, errOut := newTestSession(t, "Remember the number 42\n/save "+path+"\nquit\n")
+	if err := s.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+	if !strings.Contains(out.String(), "Saved conversation") {
+		t.Fatalf("Expected save confirmation, got:\n%s\nerrors: %s", out.String(), errOut.String())
+	}
+	saved, err := s.controller.GetConversation(s.current.ID)
+	if err != nil {
+		t.Fatalf("GetConversation failed: %v", err)
+	}
+
+	// A fresh session loads the file and keeps chatting in it
+	loader, out, errOut := newTestSession(t, "/load "+path+"\nWhat was the number?\n")
+	if err := loader.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+	if errOut.Len() != 0 {
+		t.Fatalf("Expected no errors, got: %s", errOut.String())
+	}
+	if loader.current.ID != saved.ID {
+		t.Errorf("Expected loaded conversation %s to be current, got %s", saved.ID, loader.current.ID)
+	}
+	if !strings.Contains(out.String(), "Resumed conversation: "+string(saved.ID)) {
+		t.Errorf("Expected banner for loaded conversation, got:\n%s", out.String())
+	}
+
+	conv, err := loader.controller.GetConversation(saved.ID)
+	if err != nil {
+		t.Fatalf("Loaded conversation not registered: %v", err)
+	}
+	if len(conv.Messages) != len(saved.Messages)+2 {
+		t.Errorf("Expected follow-up to extend the loaded conversation, got %d messages", len(conv.Messages))
+	}
+	if !conv.CreatedAt.Equal(saved.CreatedAt) {
+		t.Errorf("Expected CreatedAt %v to round-trip, got %v", saved.CreatedAt, conv.CreatedAt)
+	}
+
+	loader.handleCommand("/load " + path)
+	if !strings.Contains(errOut.String(), "already exists") {
+		t.Errorf("Expected loading a duplicate ID to fail, got: %s", errOut.String())
+	}
+}
+
+func TestSession_Search(t *testing.T) {
+	s, out, errOut := newTestSession(t, "How do I debug goroutine leaks?\n/search Goroutine Leaks\n/search\n/search nothing-like-this\n")
+
+	if err := s.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+
+	output := out.String()
+	if !strings.Contains(output, string(s.current.ID)+" (2 matches): How do I debug goroutine leaks?") {
+		t.Errorf("Expected current conversation with snippet, got:\n%s", output)
+	}
+	if !strings.Contains(output, `No conversations match "nothing-like-this"`) {
+		t.Errorf("Expected no-match message, got:\n%s", output)
+	}
+	if !strings.Contains(errOut.String(), "search query cannot be empty") {
+		t.Errorf("Expected empty query error, got: %s", errOut.String())
+	}
+}
+
+func TestSession_SystemPrompt(t *testing.T) {
+	s, out, errOut := newTestSession(t, "Hello\n/system You are a pirate.\n/system\n")
+
+	if err := s.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+
+	output := out.String()
+	if !strings.Contains(output, "System prompt updated") {
+		t.Errorf("Expected update confirmation, got:\n%s", output)
+	}
+	if !strings.Contains(output, "System prompt:\nYou are a pirate.") {
+		t.Errorf("Expected current prompt to be shown, got:\n%s", output)
+	}
+	if errOut.Len() != 0 {
+		t.Errorf("Expected no error output, got: %s", errOut.String())
+	}
+
+	conv, _ := s.controller.GetConversation(s.current.ID)
+	if len(conv.Messages) != 3 || conv.Messages[1].Content != "Hello" {
+		t.Errorf("Expected history to be preserved, got %+v", conv.Messages)
+	}
+}
+
+func TestSession_Fork(t *testing.T) {
+	s, out, errOut := newTestSession(t, "Hello\n/fork\nOnly on the branch\n")
+
+	if err := s.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+
+	if !strings.Contains(out.String(), "✓ Forked") {
+		t.Errorf("Expected fork confirmation, got:\n%s", out.String())
+	}
+	if errOut.Len() != 0 {
+		t.Errorf("Expected no error output, got: %s", errOut.String())
+	}
+
+	conversations := s.controller.ListConversations()
+	if len(conversations) != 2 {
+		t.Fatalf("Expected 2 conversations, got %d", len(conversations))
+	}
+	parent, fork := conversations[0], conversations[1]
+	if s.current.ID != fork.ID {
+		t.Errorf("Expected session to switch to the fork")
+	}
+	if len(parent.Messages) != 3 || len(fork.Messages) != 5 {
+		t.Errorf("Expected parent with 3 and fork with 5 messages, got %d and %d",
+			len(parent.Messages), len(fork.Messages))
+	}
+}
+
+func TestSession_Diff(t *testing.T) {
+	s, out, errOut := newTestSession(t, "Hello\n/fork\nOnly on the branch\n/diff 1 2\n/diff 1\n")
+
+	if err := s.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+	if errOut.Len() != 0 {
+		t.Errorf("Expected no error output, got: %s", errOut.String())
+	}
+
+	output := out.String()
+	if !strings.Contains(output, "+   4") || !strings.Contains(output, "user: Only on the branch") {
+		t.Errorf("Expected the fork's new messages marked as added, got:\n%s", output)
+	}
+	if !strings.Contains(output, "2 of 5 messages differ") {
+		t.Errorf("Expected a difference summary, got:\n%s", output)
+	}
+	if !strings.Contains(output, "Usage: /diff") {
+		t.Errorf("Expected usage for a missing argument, got:\n%s", output)
+	}
+}
+
+func TestSession_MultilineInput(t *testing.T) {
+	script := "```\nfunc main() {\n    fmt.Println(\"hi\")\n}\n```\n" +
+		"/multiline\nfirst line\n\nsecond line\n.\n/multiline\nsingle line\n" +
+		"```\nunterminated\nblock"
+	s, out, errOut := newTestSession(t, script)
+
+	if err := s.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+	if errOut.Len() != 0 {
+		t.Errorf("Expected no error output, got: %s", errOut.String())
+	}
+
+	conv, err := s.controller.GetConversation(s.current.ID)
+	if err != nil {
+		t.Fatalf("GetConversation failed: %v", err)
+	}
+	var userMessages []string
+	for _, msg := range conv.Messages {
+		if msg.Role == "user" {
+			userMessages = append(userMessages, msg.Content)
+		}
+	}
+
+	want := []string{
+		"func main() {\n    fmt.Println(\"hi\")\n}",
+		"first line\n\nsecond line",
+		"single line",
+		"unterminated\nblock",
+	}
+	if len(userMessages) != len(want) {
+		t.Fatalf("Expected %d user messages, got %d: %q", len(want), len(userMessages), userMessages)
+	}
+	for i := range want {
+		if userMessages[i] != want[i] {
+			t.Errorf("Expected message %d to be %q, got %q", i, want[i], userMessages[i])
+		}
+	}
+
+	output := out.String()
+	if !strings.Contains(output, "You (multiline, end with .): ") {
+		t.Errorf("Expected multiline prompt, got:\n%s", output)
+	}
+	if !strings.Contains(output, "Multiline mode off") {
+		t.Errorf("Expected multiline mode to toggle off, got:\n%s", output)
+	}
+}
+
+func TestSession_RunBatch(t *testing.T) {
+	s, out, errOut := newTestSession(t, "summarize this\nplease\n")
+
+	if err := s.runBatch(); err != nil {
+		t.Fatalf("runBatch() returned error: %v", err)
+	}
+
+	want := "Mock AI (OpenAI format) received: 'summarize this\nplease'. This is a simulated response using Chat Completions API!\n"
+	if out.String() != want {
+		t.Errorf("Expected only the reply %q, got %q", want, out.String())
+	}
+	if errOut.Len() != 0 {
+		t.Errorf("Expected no error output, got: %s", errOut.String())
+	}
+
+	empty, _, _ := newTestSession(t, "  \n")
+	if err := empty.runBatch(); err == nil {
+		t.Error("Expected error for empty input")
+	}
+}
+
+func TestApplyOverrides(t *testing.T) {
+	cfg := config.NewManager(t.TempDir() + "/config.json").GetConfig()
+	cfg.Claude.Model = "claude-test"
+
+	applyOverrides(cfg, "", "")
+	if cfg.Default.Backend != "mock" || cfg.Default.Model != "gpt-4" {
+		t.Errorf("Expected no overrides to keep defaults, got %s/%s", cfg.Default.Backend, cfg.Default.Model)
+	}
+
+	applyOverrides(cfg, "claude", "")
+	if cfg.Default.Backend != "claude" || cfg.Default.Model != "claude-test" {
+		t.Errorf("Expected claude with its configured model, got %s/%s", cfg.Default.Backend, cfg.Default.Model)
+	}
+
+	applyOverrides(cfg, "mock", "custom-model")
+	if cfg.Default.Backend != "mock" || cfg.Default.Model != "custom-model" {
+		t.Errorf("Expected mock with custom-model, got %s/%s", cfg.Default.Backend, cfg.Default.Model)
+	}
+}
+
+func TestSession_SystemPromptPrecedence(t *testing.T) {
+	s, _, _ := newTestSession(t, "")
+
+	if prompt, source := s.resolveSystemPrompt(); prompt != defaultSystemPrompt || source != "built-in default" {
+		t.Errorf("Expected the built-in default, got %q from %s", prompt, source)
+	}
+
+	path := filepath.Join(t.TempDir(), "prompt.txt")
+	os.WriteFile(path, []byte("  From a file.\n"), 0600)
+	s.systemPromptFile = path
+	if prompt, source := s.resolveSystemPrompt(); prompt != "From a file." || source != path {
+		t.Errorf("Expected the file prompt, got %q from %s", prompt, source)
+	}
+
+	s.cfg.Default.SystemPrompt = "From the config."
+	if prompt, _ := s.resolveSystemPrompt(); prompt != "From the config." {
+		t.Errorf("Expected the config prompt to beat the file, got %q", prompt)
+	}
+
+	s.systemPromptOverride = "From the flag."
+	if prompt, _ := s.resolveSystemPrompt(); prompt != "From the flag." {
+		t.Errorf("Expected the flag to beat the config, got %q", prompt)
+	}
+}
+
+func TestSession_SystemPromptOverride(t *testing.T) {
+	s, out, _ := newTestSession(t, "/new\n")
+	s.systemPromptOverride = "You only speak in haiku."
+
+	if err := s.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+
+	if !strings.Contains(out.String(), "System prompt: --system-prompt flag") {
+		t.Errorf("Expected banner to show the prompt source, got:\n%s", out.String())
+	}
+	for _, conv := range s.controller.ListConversations() {
+		if conv.Messages[0].Content != "You only speak in haiku." {
+			t.Errorf("Expected override prompt in %s, got %q", conv.ID, conv.Messages[0].Content)
+		}
+	}
+}
+
+func TestSession_NewWithSystemPrompt(t *testing.T) {
+	s, _, _ := newTestSession(t, "")
+	s.systemPromptOverride = "You only speak in haiku."
+
+	s.handleCommand("/new   You are a SQL expert  ")
+	if len(s.current.Messages) != 1 || s.current.Messages[0].Role != "system" || s.current.Messages[0].Content != "You are a SQL expert" {
+		t.Errorf("Expected only the inline system prompt, got %+v", s.current.Messages)
+	}
+
+	s.handleCommand("/new")
+	if len(s.current.Messages) != 1 || s.current.Messages[0].Content != "You only speak in haiku." {
+		t.Errorf("Expected bare /new to use the default prompt, got %+v", s.current.Messages)
+	}
+}
+
+func TestSession_Rename(t *testing.T) {
+	s, out, errOut := newTestSession(t, "Plan my week\n/list\n/rename Weekly planning\n/list\n/rename\n")
+
+	if err := s.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+	if errOut.Len() != 0 {
+		t.Errorf("Expected no error output, got: %s", errOut.String())
+	}
+
+	output := out.String()
+	for _, want := range []string{
+		"[1] Plan my week (" + string(s.current.ID) + ") [CURRENT]",
+		`Renamed conversation to "Weekly planning"`,
+		"[1] Weekly planning (" + string(s.current.ID) + ") [CURRENT]",
+		"Usage: /rename <title>",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	var logs bytes.Buffer
+	logger, err := newLogger(&logs, "WARN")
+	if err != nil {
+		t.Fatalf("newLogger failed: %v", err)
+	}
+
+	logger.Info("hidden")
+	logger.Warn("shown")
+	if strings.Contains(logs.String(), "hidden") || !strings.Contains(logs.String(), "shown") {
+		t.Errorf("Expected only warnings and above, got: %s", logs.String())
+	}
+
+	if _, err := newLogger(&logs, "loud"); err == nil {
+		t.Error("Expected error for unknown level")
+	}
+}
+
+func TestSession_Estimate(t *testing.T) {
+	s, out, errOut := newTestSession(t, "/estimate How long will this take?\n/estimate\n")
+
+	if err := s.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+
+	output := out.String()
+	if !strings.Contains(output, "Prompt Tokens:") || !strings.Contains(output, "Max Completion Tokens:") {
+		t.Errorf("Expected token projection, got:\n%s", output)
+	}
+	if !strings.Contains(output, "Usage: /estimate <message>") || errOut.Len() != 0 {
+		t.Errorf("Expected usage for empty estimate on stdout, got:\n%s\nstderr: %s", output, errOut.String())
+	}
+
+	conv, _ := s.controller.GetConversation(s.current.ID)
+	for _, msg := range conv.Messages {
+		if msg.Role != "system" {
+			t.Errorf("Expected nothing to be sent, got %+v", conv.Messages)
+			break
+		}
+	}
+}
+
+func TestSession_Tokens(t *testing.T) {
+	s, out, _ := newTestSession(t, "/tokens\n")
+	if err := s.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+	output := out.String()
+	if !strings.Contains(output, "Context Limit: 8192") || !strings.Contains(output, "Used:") {
+		t.Errorf("Expected usage against the gpt-4 limit, got:\n%s", output)
+	}
+	if strings.Contains(output, "Nearly full") {
+		t.Errorf("Expected no warning for a fresh conversation, got:\n%s", output)
+	}
+
+	// A tiny context window pushes a fresh conversation past the warning
+	s, out, _ = newTestSession(t, "/tokens\n")
+	s.controller = chat.NewController(mock.NewMockBackend(), &chat.ControllerConfig{ContextWindow: 10})
+	if err := s.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+	if !strings.Contains(out.String(), "Nearly full: use /clear") {
+		t.Errorf("Expected a warning near the limit, got:\n%s", out.String())
+	}
+}
+
+func TestSession_BackupAndRestore(t *testing.T) {
+	path := t.TempDir() + "/backup.json"
+	s, out, errOut := newTestSession(t, "Remember the number 42\n/backup "+path+"\n/new\nForget it\n/restore "+path+"\n/restore "+path+" merge\n/restore "+path+" everything\n")
+	if err := s.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+
+	output := out.String()
+	for _, want := range []string{
+		"✓ Backed up 1 conversations to " + path,
+		"✓ Restored 1 conversations from " + path,
+		"✓ Merged 1 conversations from " + path,
+		"Usage: /restore <path> [merge]",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, output)
+		}
+	}
+	if errOut.Len() != 0 {
+		t.Errorf("Expected no errors, got: %s", errOut.String())
+	}
+
+	// The replace dropped the conversation started after the backup and
+	// switched back to the backed up one
+	if stats := s.controller.GetStats(); stats.TotalConversations != 1 {
+		t.Errorf("Expected only the backed up conversation, got %d", stats.TotalConversations)
+	}
+	conv, err := s.controller.GetConversation(s.current.ID)
+	if err != nil || !strings.Contains(conv.Messages[1].Content, "Remember the number 42") {
+		t.Errorf("Expected to resume the restored conversation, got %+v (%v)", conv, err)
+	}
+}
+
+func TestSession_RestoreMergeInSafeMode(t *testing.T) {
+	path := t.TempDir() + "/backup.json"
+	s, out, errOut := newTestSession(t, "Hello\n/backup "+path+"\nMore\n/restore "+path+" merge\nn\n/stats\n/restore "+path+" merge\ny\n/stats\n")
+	s.controller.SetSafeMode(true)
+
+	if err := s.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+
+	output := out.String()
+	for _, want := range []string{
+		"Restore cancelled",
+		"Total Messages: 5",
+		"✓ Merged 1 conversations from " + path,
+		"Total Messages: 3",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, output)
+		}
+	}
+	if errOut.Len() != 0 {
+		t.Errorf("Expected no errors, got: %s", errOut.String())
+	}
+}
+
+func TestSession_StatsShowsHealthDetails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	s, out, _ := newTestSession(t, "/stats\n")
+	s.controller.SetBackend(openai.NewClient(openai.Config{APIKey: "sk-bad", BaseURL: server.URL}))
+	if err := s.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+
+	output := out.String()
+	for _, want := range []string{
+		"Backend Status: ❌ Unavailable (auth)",
+		"Endpoint: " + server.URL + "/models",
+		"Detail: 401 Unauthorized",
+		"Latency:",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestSession_Import(t *testing.T) {
+	path := t.TempDir() + "/conversation.json"
+	s, _, _ := newTestSession(t, "Remember the number 42\n/save "+path+"\nquit\n")
+	if err := s.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+	saved, err := s.controller.GetConversation(s.current.ID)
+	if err != nil {
+		t.Fatalf("GetConversation failed: %v", err)
+	}
+
+	// Importing twice succeeds because each import gets a fresh ID
+	importer, out, errOut := newTestSession(t, "/import "+path+"\n/import "+path+"\n/import missing.json\n")
+	if err := importer.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+	if strings.Count(out.String(), "Imported conversation") != 2 {
+		t.Errorf("Expected two imports, got:\n%s", out.String())
+	}
+	if importer.current.ID == saved.ID {
+		t.Errorf("Expected a fresh ID, got %s", importer.current.ID)
+	}
+	if len(importer.current.Messages) != len(saved.Messages) {
+		t.Errorf("Expected %d messages, got %d", len(saved.Messages), len(importer.current.Messages))
+	}
+	if !strings.Contains(errOut.String(), "Failed to read conversation") {
+		t.Errorf("Expected error for missing file, got: %s", errOut.String())
+	}
+}
+
+func TestSession_Tags(t *testing.T) {
+	s, out, errOut := newTestSession(t, "Hello\n/tag Work\n/new\n/tag home\n/list work\n/untag HOME\n/list home\n/tag\n")
+
+	if err := s.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+	if errOut.Len() != 0 {
+		t.Errorf("Expected no error output, got: %s", errOut.String())
+	}
+
+	output := out.String()
+	if !strings.Contains(output, `Conversations tagged "work" (1 of 2)`) {
+		t.Errorf("Expected filtered list, got:\n%s", output)
+	}
+	if !strings.Contains(output, "  [1] Hello") || !strings.Contains(output, "    Tags: work") {
+		t.Errorf("Expected the tagged conversation with its list index and tags, got:\n%s", output)
+	}
+	if !strings.Contains(output, `Conversations tagged "home" (0 of 2)`) {
+		t.Errorf("Expected untagged conversation to drop out of the filter, got:\n%s", output)
+	}
+	if !strings.Contains(output, "Usage: /tag <name>") {
+		t.Errorf("Expected usage for /tag without a name, got:\n%s", output)
+	}
+}
+
+func TestSession_Regenerate(t *testing.T) {
+	s, out, errOut := newTestSession(t, "/regenerate\nHello\n/regenerate\n")
+
+	if err := s.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+
+	if !strings.Contains(errOut.String(), "Failed to regenerate") {
+		t.Errorf("Expected error before any reply, got: %s", errOut.String())
+	}
+	if strings.Count(out.String(), "received: 'Hello'") != 2 {
+		t.Errorf("Expected the reply to be shown twice, got:\n%s", out.String())
+	}
+
+	conv, _ := s.controller.GetConversation(s.current.ID)
+	assistants := 0
+	for _, msg := range conv.Messages {
+		if msg.Role == "assistant" {
+			assistants++
+		}
+	}
+	if assistants != 1 {
+		t.Errorf("Expected the reply to be replaced, got %d assistant messages", assistants)
+	}
+}
+
+func TestSession_Edit(t *testing.T) {
+	s, out, errOut := newTestSession(t, "/edit too early\nHelo\n/edit Hello\n/edit\n")
+
+	if err := s.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+
+	if !strings.Contains(errOut.String(), "Failed to edit") {
+		t.Errorf("Expected error before any message, got: %s", errOut.String())
+	}
+	if !strings.Contains(out.String(), "received: 'Hello'") {
+		t.Errorf("Expected a reply to the edited message, got:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "Usage: /edit <new text>") {
+		t.Errorf("Expected usage for empty edit, got:\n%s", out.String())
+	}
+
+	conv, _ := s.controller.GetConversation(s.current.ID)
+	for _, msg := range conv.Messages {
+		if strings.Contains(msg.Content, "Helo") {
+			t.Errorf("Expected the typo to be gone, got %+v", conv.Messages)
+			break
+		}
+	}
+}
+
+func TestSession_BannerShowsProfile(t *testing.T) {
+	s, out, _ := newTestSession(t, "")
+	s.cfg.ActiveProfile = "work"
+
+	if err := s.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+	if !strings.Contains(out.String(), "Profile: work\n") {
+		t.Errorf("Expected active profile in banner, got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/chat"
+)
+
+// historyWidth is the column messages are wrapped at by /history
+const historyWidth = 80
+
+// historyIndent prefixes every line of a message body in /history
+const historyIndent = "    "
+
+// roleLabels name message roles in /history
+var roleLabels = map[string]string{
+	"system":    "⚙️  System",
+	"user":      "👤 You",
+	"assistant": "🤖 Assistant",
+	"tool":      "🔧 Tool",
+}
+
+// printHistory prints the messages of the current conversation followed by
+// its compression timeline, if any. args may hold a number of exchanges to
+// limit the output to the most recent ones, and --tokens to show a token
+// estimate per message.
+func (s *session) printHistory(args []string) {
+	exchanges, showTokens := 0, false
+	for _, arg := range args {
+		if arg == "--tokens" {
+			showTokens = true
+			continue
+		}
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 {
+			fmt.Fprintf(s.out, "Usage: /history [n] [--tokens]\n\n")
+			return
+		}
+		exchanges = n
+	}
+
+	conversation, err := s.controller.GetConversation(s.current.ID)
+	if err != nil {
+		fmt.Fprintf(s.errOut, "❌ Error getting conversation: %v\n\n", err)
+		return
+	}
+
+	messages := conversation.Messages
+	if len(messages) == 0 {
+		fmt.Fprintf(s.out, "No messages in %s yet\n\n", conversation.ID)
+		return
+	}
+
+	model := conversation.LastModel
+	if model == "" {
+		model = s.cfg.ChatController.DefaultModel
+	}
+
+	start := historyStart(messages, exchanges)
+	fmt.Fprintf(s.out, "📜 History of %s (%d messages):\n", conversation.ID, len(messages))
+	if start > 0 {
+		fmt.Fprintf(s.out, "  ... %d earlier messages hidden\n", start)
+	}
+	for i := start; i < len(messages); i++ {
+		msg := messages[i]
+
+		label, ok := roleLabels[msg.Role]
+		if !ok {
+			label = msg.Role
+		}
+		fmt.Fprintf(s.out, "[%d] %s", i+1, label)
+		if showTokens {
+			// On a tokenizer failure the heuristic count is still returned
+			tokens, _ := ai.CountTokens(model, []ai.Message{msg})
+			fmt.Fprintf(s.out, " (~%d tokens)", tokens)
+		}
+		fmt.Fprintln(s.out)
+
+		for _, line := range wrapText(historyText(msg), historyWidth-len(historyIndent)) {
+			fmt.Fprintf(s.out, "%s%s\n", historyIndent, line)
+		}
+	}
+	fmt.Fprintln(s.out)
+
+	if len(conversation.Compressions) > 0 {
+		s.printCompressions(conversation.Compressions)
+	}
+}
+
+// printCompressions prints a compression timeline, oldest first
+func (s *session) printCompressions(history []chat.CompressionRecord) {
+	fmt.Fprintf(s.out, "🗜️  Compression history (%d):\n", len(history))
+	for _, record := range history {
+		fmt.Fprintf(s.out, "  %s\n", record)
+	}
+	fmt.Fprintln(s.out)
+}
+
+// historyStart returns the index of the first message of the last n
+// exchanges, each starting at a user message. Zero n shows everything.
+func historyStart(messages []ai.Message, n int) int {
+	if n <= 0 {
+		return 0
+	}
+
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role != "user" {
+			continue
+		}
+		if n--; n == 0 {
+			return i
+		}
+	}
+	return 0
+}
+
+// historyText returns what /history shows for a message, describing tool
+// calls that carry no text
+func historyText(msg ai.Message) string {
+	if msg.Content != "" || len(msg.ToolCalls) == 0 {
+		return msg.Content
+	}
+
+	names := make([]string, len(msg.ToolCalls))
+	for i, call := range msg.ToolCalls {
+		names[i] = call.Function.Name
+	}
+	return fmt.Sprintf("(calls %s)", strings.Join(names, ", "))
+}
+
+// wrapText breaks text into lines of at most width runes at spaces,
+// keeping the text's own line breaks. Words longer than width get a line
+// of their own.
+func wrapText(text string, width int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		words := strings.Fields(paragraph)
+		if len(words) == 0 {
+			lines = append(lines, "")
+			continue
+		}
+
+		line := words[0]
+		for _, word := range words[1:] {
+			if len([]rune(line))+1+len([]rune(word)) > width {
+				lines = append(lines, line)
+				line = word
+				continue
+			}
+			line += " " + word
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/chat"
+)
+
+func TestSession_History(t *testing.T) {
+	s, out, errOut := newTestSession(t, "First question\nSecond question\n/history\n/history 1 --tokens\n/history zero\n")
+
+	if err := s.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+	if errOut.Len() != 0 {
+		t.Errorf("Expected no error output, got: %s", errOut.String())
+	}
+
+	output := out.String()
+	full, limited, _ := strings.Cut(output[strings.Index(output, "📜"):], "You: 📜")
+	if !strings.Contains(full, "[1] ⚙️  System") || !strings.Contains(full, "[2] 👤 You\n    First question") {
+		t.Errorf("Expected every message with role labels, got:\n%s", full)
+	}
+	if strings.Contains(full, "tokens)") {
+		t.Errorf("Expected no token estimates without --tokens, got:\n%s", full)
+	}
+
+	if !strings.Contains(limited, "3 earlier messages hidden") || strings.Contains(limited, "First question") {
+		t.Errorf("Expected only the last exchange, got:\n%s", limited)
+	}
+	if !strings.Contains(limited, "[4] 👤 You (~") {
+		t.Errorf("Expected token estimates with --tokens, got:\n%s", limited)
+	}
+	if !strings.Contains(output, "Usage: /history") {
+		t.Errorf("Expected usage for an invalid count, got:\n%s", output)
+	}
+}
+
+func TestSession_HistoryShowsCompressions(t *testing.T) {
+	s, out, errOut := newTestSession(t, "")
+	s.current = s.controller.CreateConversation("system")
+	s.handleCommand("/compressions")
+	if !strings.Contains(out.String(), "No compressions recorded for "+string(s.current.ID)) {
+		t.Errorf("Expected no compressions yet, got:\n%s", out.String())
+	}
+
+	for _, message := range []string{"First question", "Second question"} {
+		if _, err := s.controller.SendMessage(context.Background(), chat.ChatRequest{ConversationID: s.current.ID, Message: message}); err != nil {
+			t.Fatalf("SendMessage failed: %v", err)
+		}
+	}
+	if _, err := s.controller.CompressMessages(s.current.ID, 2, "Asked a first question"); err != nil {
+		t.Fatalf("CompressMessages failed: %v", err)
+	}
+
+	out.Reset()
+	s.handleCommand("/history")
+	history := out.String()
+	if !strings.Contains(history, "Second question") || !strings.Contains(history, "🗜️  Compression history (1):\n  summarized 2 messages") {
+		t.Errorf("Expected /history to show the messages and the compression, got:\n%s", history)
+	}
+
+	out.Reset()
+	s.handleCommand("/compressions")
+	compressions := out.String()
+	if !strings.Contains(compressions, "🗜️  Compression history (1):\n  summarized 2 messages") || strings.Contains(compressions, "Second question") {
+		t.Errorf("Expected /compressions to show only the compression, got:\n%s", compressions)
+	}
+	if errOut.Len() != 0 {
+		t.Errorf("Expected no error output, got: %s", errOut.String())
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	lines := wrapText("the quick brown fox jumps\n\nover", 10)
+	want := []string{"the quick", "brown fox", "jumps", "", "over"}
+	if len(lines) != len(want) {
+		t.Fatalf("Expected %q, got %q", want, lines)
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("Expected %q, got %q", want, lines)
+			break
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/chat"
+)
+
+// exchange is the line --json prints for each message sent. Error is set
+// instead of Assistant when the message failed.
+type exchange struct {
+	ConversationID chat.ConversationID `json:"conversation_id,omitempty"`
+	User           string              `json:"user"`
+	Assistant      string              `json:"assistant,omitempty"`
+	Usage          *ai.Usage           `json:"usage,omitempty"`
+	Error          string              `json:"error,omitempty"`
+}
+
+// sendJSON sends a message to the current conversation and prints the
+// exchange as a single compact JSON line. The returned error is the send
+// failure, already reported in the printed line.
+func (s *session) sendJSON(message string) error {
+	ctx, cancel := context.WithTimeout(s.ctx, 60*time.Second)
+	defer cancel()
+
+	response, err := s.controller.SendMessage(ctx, chat.ChatRequest{
+		ConversationID: s.current.ID,
+		Message:        message,
+		Model:          s.cfg.Default.Model,
+	})
+
+	line := exchange{ConversationID: s.current.ID, User: message}
+	if err != nil {
+		line.Error = err.Error()
+	} else {
+		s.lastResponse = response
+		line.Assistant = response.Message.Content
+		if response.Response != nil {
+			line.Usage = &response.Response.Usage
+		}
+	}
+
+	// Encode writes compact JSON followed by a newline
+	if encodeErr := json.NewEncoder(s.out).Encode(line); encodeErr != nil && err == nil {
+		return encodeErr
+	}
+	return err
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/backends/mock"
+)
+
+// decodeExchanges parses every line of out as an exchange
+func decodeExchanges(t *testing.T, out string) []exchange {
+	t.Helper()
+
+	var exchanges []exchange
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		var e exchange
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("Expected a JSON line, got %q: %v", line, err)
+		}
+		exchanges = append(exchanges, e)
+	}
+	return exchanges
+}
+
+func TestSession_RunJSON(t *testing.T) {
+	s, out, errOut := newTestSession(t, "Hello\nHow are you?\nquit\n")
+	s.jsonOutput = true
+
+	if err := s.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+	if errOut.Len() != 0 {
+		t.Errorf("Expected no error output, got: %s", errOut.String())
+	}
+
+	exchanges := decodeExchanges(t, out.String())
+	if len(exchanges) != 2 {
+		t.Fatalf("Expected 2 exchanges, got %d:\n%s", len(exchanges), out.String())
+	}
+	for i, user := range []string{"Hello", "How are you?"} {
+		e := exchanges[i]
+		if e.User != user || e.Assistant == "" || e.Error != "" {
+			t.Errorf("Expected a reply to %q, got %+v", user, e)
+		}
+		if e.ConversationID != s.current.ID {
+			t.Errorf("Expected conversation %s, got %s", s.current.ID, e.ConversationID)
+		}
+		if e.Usage == nil || e.Usage.TotalTokens == 0 {
+			t.Errorf("Expected usage, got %+v", e.Usage)
+		}
+	}
+}
+
+func TestSession_RunBatchJSON(t *testing.T) {
+	s, out, _ := newTestSession(t, "Hello from a script\n")
+	s.jsonOutput = true
+
+	if err := s.runBatch(); err != nil {
+		t.Fatalf("runBatch() returned error: %v", err)
+	}
+
+	exchanges := decodeExchanges(t, out.String())
+	if len(exchanges) != 1 || exchanges[0].User != "Hello from a script" || exchanges[0].Assistant == "" {
+		t.Errorf("Expected one exchange, got %+v", exchanges)
+	}
+}
+
+func TestSession_JSONError(t *testing.T) {
+	s, out, _ := newTestSession(t, "Hello\n")
+	s.jsonOutput = true
+	s.controller.GetBackend().(*mock.MockBackend).SetFailureRate(1)
+
+	if err := s.runBatch(); err == nil {
+		t.Error("Expected runBatch() to report the failure")
+	}
+
+	exchanges := decodeExchanges(t, out.String())
+	if len(exchanges) != 1 || exchanges[0].Error == "" || exchanges[0].Assistant != "" {
+		t.Errorf("Expected an error exchange, got %+v", exchanges)
+	}
+}
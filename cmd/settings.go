@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/config"
+)
+
+// configCommand handles /config. Without arguments it prints the effective
+// settings; "set <key> <value>" changes one for this session and saves it.
+func (s *session) configCommand(args []string) {
+	switch {
+	case len(args) == 0:
+		s.printConfig()
+	case args[0] == "set" && len(args) >= 3:
+		s.setConfig(args[1], strings.Join(args[2:], " "))
+	default:
+		fmt.Fprintf(s.out, "Usage: /config [set <key> <value>]\nEditable: %s\n\n", strings.Join(config.EditableKeys, ", "))
+	}
+}
+
+// printConfig prints the settings in effect with API keys redacted
+func (s *session) printConfig() {
+	source := s.configPath
+	if source == "" {
+		source = "defaults"
+	}
+	fmt.Fprintf(s.out, "⚙️  Configuration (%s):\n", source)
+	if s.cfg.ActiveProfile != "" {
+		fmt.Fprintf(s.out, "  %-16s %s\n", "profile", s.cfg.ActiveProfile)
+	}
+	fmt.Fprintf(s.out, "  %-16s %s\n", "backend", s.cfg.Default.Backend)
+	fmt.Fprintf(s.out, "  %-16s %s\n", "model", s.cfg.Default.Model)
+	fmt.Fprintf(s.out, "  %-16s %g\n", "temperature", s.cfg.ChatController.Temperature)
+	fmt.Fprintf(s.out, "  %-16s %d\n", "max_tokens", s.cfg.ChatController.MaxTokens)
+	fmt.Fprintf(s.out, "  %-16s %s\n", "openai.api_key", keyStatus(s.cfg.OpenAI.APIKey))
+	fmt.Fprintf(s.out, "  %-16s %s\n", "claude.api_key", keyStatus(s.cfg.Claude.APIKey))
+	fmt.Fprintf(s.out, "  %-16s %s\n", "azure.api_key", keyStatus(s.cfg.Azure.APIKey))
+	fmt.Fprintf(s.out, "Change with /config set <key> <value> (%s)\n\n", strings.Join(config.EditableKeys, ", "))
+}
+
+// keyStatus describes an API key without revealing it
+func keyStatus(key string) string {
+	if key == "" {
+		return "(not set)"
+	}
+	return config.RedactKey(key)
+}
+
+// setConfig validates and applies a setting, then saves the configuration.
+// A new backend must be available before it is switched to.
+func (s *session) setConfig(key, value string) {
+	if s.manager == nil {
+		fmt.Fprintf(s.errOut, "❌ Settings cannot be changed in this session\n\n")
+		return
+	}
+
+	var backend ai.Backend
+	if key == "backend" {
+		var err error
+		if backend, err = s.newBackend(value); err != nil {
+			fmt.Fprintf(s.errOut, "❌ %v\n\n", err)
+			return
+		}
+	}
+
+	if err := s.manager.Set(key, value); err != nil {
+		fmt.Fprintf(s.errOut, "❌ Invalid setting: %v\n\n", err)
+		return
+	}
+	// The session's settings are a copy with the flag overrides applied,
+	// and the value was just accepted
+	s.cfg.Set(key, value)
+
+	// Apply the new value to this session
+	switch key {
+	case "backend":
+		s.controller.SetBackend(backend)
+	case "temperature":
+		s.controller.SetTemperature(s.cfg.ChatController.Temperature)
+	case "max_tokens":
+		s.controller.SetMaxTokens(s.cfg.ChatController.MaxTokens)
+	}
+
+	if err := s.manager.Save(); err != nil {
+		fmt.Fprintf(s.errOut, "⚠️  Set %s = %s for this session, but saving failed: %v\n\n", key, value, err)
+		return
+	}
+	fmt.Fprintf(s.out, "✓ Set %s = %s (saved to %s)\n\n", key, value, s.manager.GetConfigPath())
+}
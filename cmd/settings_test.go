@@ -0,0 +1,119 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSession_ConfigShow(t *testing.T) {
+	s, out, _ := newTestSession(t, "")
+	s.cfg.OpenAI.APIKey = "sk-secret-abcdefghij1234567890"
+
+	s.handleCommand("/config")
+	output := out.String()
+	for _, want := range []string{"backend", "mock", "temperature", "0.7", "max_tokens", "500", "openai.api_key", "sk-...7890", "(not set)"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %q in output, got:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "sk-secret") {
+		t.Errorf("Expected the API key to be hidden, got:\n%s", output)
+	}
+}
+
+func TestSession_ConfigSet(t *testing.T) {
+	s, out, errOut := newTestSession(t, "")
+	s.current = s.controller.CreateConversation("")
+
+	s.handleCommand("/config set max_tokens 256")
+	s.handleCommand("/config set model gpt-4o")
+	if errOut.Len() > 0 {
+		t.Fatalf("Expected no errors, got: %s", errOut.String())
+	}
+	if !strings.Contains(out.String(), "✓ Set max_tokens = 256") {
+		t.Errorf("Expected confirmation, got: %s", out.String())
+	}
+
+	if s.cfg.Default.Model != "gpt-4o" {
+		t.Errorf("Expected model gpt-4o, got %s", s.cfg.Default.Model)
+	}
+	estimate, err := s.controller.EstimateRequest(s.current.ID, "hi")
+	if err != nil {
+		t.Fatalf("EstimateRequest failed: %v", err)
+	}
+	if estimate.MaxCompletionTokens != 256 {
+		t.Errorf("Expected the controller to use max_tokens 256, got %d", estimate.MaxCompletionTokens)
+	}
+
+	data, err := os.ReadFile(s.manager.GetConfigPath())
+	if err != nil {
+		t.Fatalf("Failed to read saved config: %v", err)
+	}
+	if !strings.Contains(string(data), `"max_tokens": 256`) || !strings.Contains(string(data), `"model": "gpt-4o"`) {
+		t.Errorf("Expected changes to be saved, got:\n%s", data)
+	}
+}
+
+func TestSession_ConfigSetRejects(t *testing.T) {
+	s, _, errOut := newTestSession(t, "")
+
+	s.handleCommand("/config set temperature 3")
+	if !strings.Contains(errOut.String(), "temperature must be between 0.0 and 2.0") {
+		t.Errorf("Expected a range error, got: %s", errOut.String())
+	}
+	if s.cfg.ChatController.Temperature != 0.7 {
+		t.Errorf("Expected temperature to stay 0.7, got %v", s.cfg.ChatController.Temperature)
+	}
+
+	errOut.Reset()
+	s.handleCommand("/config set color blue")
+	if !strings.Contains(errOut.String(), "editable: backend, model, temperature, max_tokens") {
+		t.Errorf("Expected the editable keys to be listed, got: %s", errOut.String())
+	}
+
+	errOut.Reset()
+	s.handleCommand("/config set backend claude")
+	if !strings.Contains(errOut.String(), "Claude API key not configured") || s.cfg.Default.Backend != "mock" {
+		t.Errorf("Expected backend to stay mock without a key, got %s: %s", s.cfg.Default.Backend, errOut.String())
+	}
+}
+
+func TestSession_ConfigSetSavesOnlyTheKey(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "sk-env-0123456789abcdef")
+
+	s, _, errOut := newTestSession(t, "")
+	path := s.manager.GetConfigPath()
+	if err := os.WriteFile(path, []byte(`{"default": {"backend": "mock", "model": "gpt-4"}}`), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if err := s.manager.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	// A session-only flag override, applied the way main does
+	effective := *s.manager.GetConfig()
+	s.cfg = &effective
+	applyOverrides(s.cfg, "", "flag-model")
+
+	s.handleCommand("/config set max_tokens 256")
+	if errOut.Len() > 0 {
+		t.Fatalf("Expected no errors, got: %s", errOut.String())
+	}
+	if s.cfg.ChatController.MaxTokens != 256 || s.cfg.Default.Model != "flag-model" {
+		t.Errorf("Expected the session to keep its override and get the new value, got %+v", s.cfg.ChatController)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read saved config: %v", err)
+	}
+	if !strings.Contains(string(data), `"max_tokens": 256`) {
+		t.Errorf("Expected max_tokens to be saved, got:\n%s", data)
+	}
+	for _, leaked := range []string{"sk-env-0123456789abcdef", "flag-model"} {
+		if strings.Contains(string(data), leaked) {
+			t.Errorf("Expected %q to stay out of the config file, got:\n%s", leaked, data)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// contextReader makes reads from r give up once ctx is cancelled, so a
+// prompt blocked on the terminal ends on Ctrl-C. An abandoned read finishes
+// in the background and its data is dropped.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// readResult is the outcome of a background read
+type readResult struct {
+	n   int
+	err error
+}
+
+// Read reads from the underlying reader unless ctx is cancelled first
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, len(p))
+	done := make(chan readResult, 1)
+	go func() {
+		n, err := cr.r.Read(buf)
+		done <- readResult{n: n, err: err}
+	}()
+
+	select {
+	case result := <-done:
+		copy(p, buf[:result.n])
+		return result.n, result.err
+	case <-cr.ctx.Done():
+		return 0, cr.ctx.Err()
+	}
+}
+
+// autoSave writes every conversation to the configured auto-save path, if
+// any
+func (s *session) autoSave() error {
+	path := s.cfg.ChatController.AutoSavePath
+	if path == "" {
+		return nil
+	}
+
+	saved, err := s.writeState(path)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "💾 Saved %d conversations to %s\n", saved, path)
+	return nil
+}
+
+// writeState writes a state archive to path and returns the number of
+// conversations in it. The archive is written to a temporary file first, so
+// an interrupted save leaves any previous archive intact.
+func (s *session) writeState(path string) (int, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create state file: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	saved, err := s.controller.SaveState(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.Rename(file.Name(), path); err != nil {
+		return 0, fmt.Errorf("failed to replace state file: %w", err)
+	}
+	return saved, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSession_InterruptAtPrompt(t *testing.T) {
+	s, out, _ := newTestSession(t, "")
+
+	// The pipe is never written to, so the prompt blocks until cancelled
+	in, w := io.Pipe()
+	defer w.Close()
+	s.in = in
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.ctx = ctx
+
+	done := make(chan error, 1)
+	go func() { done <- s.run() }()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected a clean exit, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected run to return after cancellation")
+	}
+	if !strings.Contains(out.String(), "Goodbye!") {
+		t.Errorf("Expected a goodbye message, got:\n%s", out.String())
+	}
+}
+
+func TestSession_AutoSave(t *testing.T) {
+	s, out, _ := newTestSession(t, "Hello\nquit\n")
+	path := filepath.Join(t.TempDir(), "state.json")
+	s.cfg.ChatController.AutoSavePath = path
+
+	if err := s.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+	if err := s.autoSave(); err != nil {
+		t.Fatalf("autoSave failed: %v", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Expected an archive at %s: %v", path, err)
+	}
+	defer file.Close()
+
+	restored, _, _ := newTestSession(t, "")
+	if err := restored.controller.LoadState(file); err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if got := restored.controller.GetStats().TotalConversations; got != 1 {
+		t.Errorf("Expected 1 saved conversation, got %d", got)
+	}
+	if !strings.Contains(out.String(), "Saved 1 conversations") {
+		t.Errorf("Expected a save notice, got:\n%s", out.String())
+	}
+
+	// Nothing is written without a path
+	s.cfg.ChatController.AutoSavePath = ""
+	if err := s.autoSave(); err != nil {
+		t.Errorf("Expected no-op without a path, got %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// spinnerFrames are drawn in turn while waiting for a reply
+var spinnerFrames = []string{"|", "/", "-", "\\"}
+
+// spinnerInterval is how long each frame is shown
+const spinnerInterval = 100 * time.Millisecond
+
+// spinnerLabel follows the frame so the wait reads as progress
+const spinnerLabel = " Waiting for response..."
+
+// spinner animates on a terminal while a request is in flight. A nil
+// spinner is valid and does nothing, so callers need not check whether
+// output is interactive.
+type spinner struct {
+	w        io.Writer
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+// startSpinner draws a spinner on w until Stop is called. It returns nil
+// when w is nil.
+func startSpinner(w io.Writer, interval time.Duration) *spinner {
+	if w == nil {
+		return nil
+	}
+
+	sp := &spinner{
+		w:        w,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go sp.run()
+	return sp
+}
+
+// run draws frames until stopped, then erases the spinner line
+func (sp *spinner) run() {
+	defer close(sp.done)
+
+	ticker := time.NewTicker(sp.interval)
+	defer ticker.Stop()
+
+	for frame := 0; ; frame++ {
+		fmt.Fprintf(sp.w, "\r%s%s", spinnerFrames[frame%len(spinnerFrames)], spinnerLabel)
+
+		select {
+		case <-sp.stop:
+			blank := strings.Repeat(" ", len(spinnerFrames[0])+len(spinnerLabel))
+			fmt.Fprintf(sp.w, "\r%s\r", blank)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop erases the spinner and waits for it to finish drawing. It is safe
+// to call more than once.
+func (sp *spinner) Stop() {
+	if sp == nil {
+		return
+	}
+	sp.once.Do(func() { close(sp.stop) })
+	<-sp.done
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpinner(t *testing.T) {
+	var out bytes.Buffer
+	sp := startSpinner(&out, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	sp.Stop()
+	sp.Stop()
+
+	output := out.String()
+	for _, frame := range spinnerFrames[:2] {
+		if !strings.Contains(output, "\r"+frame+spinnerLabel) {
+			t.Errorf("Expected frame %q to be drawn, got %q", frame, output)
+		}
+	}
+	if !strings.HasSuffix(output, strings.Repeat(" ", 1+len(spinnerLabel))+"\r") {
+		t.Errorf("Expected the spinner line to be erased, got %q", output)
+	}
+
+	// Without an output the spinner is disabled
+	if sp := startSpinner(nil, time.Millisecond); sp != nil {
+		t.Errorf("Expected nil spinner without an output")
+	}
+	var disabled *spinner
+	disabled.Stop()
+}
+
+func TestSession_SpinnerWhileWaiting(t *testing.T) {
+	s, out, _ := newTestSession(t, "Hello there\n/regenerate\n")
+	var spinnerOut bytes.Buffer
+	s.spinnerOut = &spinnerOut
+
+	if err := s.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+
+	// Each spinner erases its line exactly once when it stops
+	erase := "\r" + strings.Repeat(" ", 1+len(spinnerLabel)) + "\r"
+	if got := strings.Count(spinnerOut.String(), erase); got != 2 {
+		t.Errorf("Expected a spinner for the message and the regeneration, got %d in %q", got, spinnerOut.String())
+	}
+	if strings.Contains(out.String(), spinnerLabel) {
+		t.Errorf("Expected the spinner to stay off stdout, got:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "received: 'Hello there'") {
+		t.Errorf("Expected the reply after the spinner, got:\n%s", out.String())
+	}
+}
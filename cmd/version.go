@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strings"
+)
+
+// version is injected at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+// versionString describes the build for --version: the injected version,
+// or the module version for go install builds, followed by the git commit
+// and Go version from the embedded build info when available
+func versionString(info *debug.BuildInfo) string {
+	v := version
+	if v == "dev" && info != nil && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		v = info.Main.Version
+	}
+
+	var details []string
+	if info != nil {
+		var revision, modified string
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				revision = setting.Value
+			case "vcs.modified":
+				modified = setting.Value
+			}
+		}
+		if revision != "" {
+			if len(revision) > 12 {
+				revision = revision[:12]
+			}
+			if modified == "true" {
+				revision += "-dirty"
+			}
+			details = append(details, "commit "+revision)
+		}
+		if info.GoVersion != "" {
+			details = append(details, info.GoVersion)
+		}
+	}
+
+	if len(details) == 0 {
+		return "task-breaker " + v
+	}
+	return fmt.Sprintf("task-breaker %s (%s)", v, strings.Join(details, ", "))
+}
+
+// buildInfo returns the binary's embedded build info, or nil if it was
+// built without module support
+func buildInfo() *debug.BuildInfo {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return nil
+	}
+	return info
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"runtime/debug"
+	"testing"
+)
+
+func TestVersionString(t *testing.T) {
+	info := &debug.BuildInfo{
+		GoVersion: "go1.25.1",
+		Main:      debug.Module{Version: "(devel)"},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs.revision", Value: "0123456789abcdef0123"},
+			{Key: "vcs.modified", Value: "true"},
+		},
+	}
+
+	if got, want := versionString(info), "task-breaker dev (commit 0123456789ab-dirty, go1.25.1)"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	// go install builds report the module version
+	info.Main.Version = "v1.2.0"
+	info.Settings = nil
+	if got, want := versionString(info), "task-breaker v1.2.0 (go1.25.1)"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	old := version
+	version = "v1.3.0-rc1"
+	defer func() { version = old }()
+	if got, want := versionString(nil), "task-breaker v1.3.0-rc1"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
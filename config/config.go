@@ -3,56 +3,172 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 // Config represents the application configuration
 type Config struct {
-	OpenAI         OpenAIConfig     `json:"openai"`
-	Claude         ClaudeConfig     `json:"claude"`
-	Default        DefaultConfig    `json:"default"`
-	ChatController ControllerConfig `json:"chat_controller"`
+	OpenAI         OpenAIConfig     `json:"openai" yaml:"openai"`
+	Claude         ClaudeConfig     `json:"claude" yaml:"claude"`
+	Azure          AzureConfig      `json:"azure" yaml:"azure"`
+	Router         RouterConfig     `json:"router" yaml:"router"`
+	Default        DefaultConfig    `json:"default" yaml:"default"`
+	ChatController ControllerConfig `json:"chat_controller" yaml:"chat_controller"`
+
+	// Profiles are named overlays of the settings above, such as a work
+	// endpoint or a local server, selected with ActiveProfile
+	Profiles map[string]Config `json:"profiles,omitempty" yaml:"profiles,omitempty"`
+	// ActiveProfile names the profile applied at Load. Empty uses the
+	// top-level settings as they are.
+	ActiveProfile string `json:"active_profile,omitempty" yaml:"active_profile,omitempty"`
 }
 
 // OpenAIConfig holds OpenAI-specific configuration
 type OpenAIConfig struct {
-	APIKey     string        `json:"api_key"`
-	BaseURL    string        `json:"base_url"`
-	Model      string        `json:"model"`
-	Timeout    time.Duration `json:"timeout"`
-	MaxRetries int           `json:"max_retries"`
+	APIKey     string        `json:"api_key" yaml:"api_key"`
+	BaseURL    string        `json:"base_url" yaml:"base_url"`
+	Model      string        `json:"model" yaml:"model"`
+	Timeout    time.Duration `json:"timeout" yaml:"timeout"`
+	MaxRetries int           `json:"max_retries" yaml:"max_retries"`
+
+	// APIKeyFile is read for the key when APIKey and OPENAI_API_KEY are unset
+	APIKeyFile string `json:"api_key_file,omitempty" yaml:"api_key_file,omitempty"`
 }
 
 // ClaudeConfig holds Claude-specific configuration
 type ClaudeConfig struct {
-	APIKey     string        `json:"api_key"`
-	BaseURL    string        `json:"base_url"`
-	Model      string        `json:"model"`
-	Timeout    time.Duration `json:"timeout"`
-	MaxRetries int           `json:"max_retries"`
+	APIKey     string        `json:"api_key" yaml:"api_key"`
+	BaseURL    string        `json:"base_url" yaml:"base_url"`
+	Model      string        `json:"model" yaml:"model"`
+	Timeout    time.Duration `json:"timeout" yaml:"timeout"`
+	MaxRetries int           `json:"max_retries" yaml:"max_retries"`
+
+	// APIKeyFile is read for the key when APIKey and CLAUDE_API_KEY are unset
+	APIKeyFile string `json:"api_key_file,omitempty" yaml:"api_key_file,omitempty"`
+}
+
+// AzureConfig holds Azure OpenAI configuration. Requests go to a
+// deployment on the resource's endpoint rather than to a model.
+type AzureConfig struct {
+	APIKey       string        `json:"api_key" yaml:"api_key"`
+	ResourceName string        `json:"resource_name" yaml:"resource_name"`
+	Deployment   string        `json:"deployment" yaml:"deployment"`
+	APIVersion   string        `json:"api_version" yaml:"api_version"`
+	Model        string        `json:"model" yaml:"model"`
+	Timeout      time.Duration `json:"timeout" yaml:"timeout"`
+	MaxRetries   int           `json:"max_retries" yaml:"max_retries"`
+
+	// Endpoint overrides https://{resource_name}.openai.azure.com
+	Endpoint string `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+}
+
+// RouterConfig spreads requests across several backend sections. It is
+// used when default.backend is "router".
+type RouterConfig struct {
+	// Policy picks the backend for each request: cheapest, fastest,
+	// round-robin, or weighted
+	Policy string `json:"policy" yaml:"policy"`
+	// Backends names the sections to route between: openai, claude, azure,
+	// or mock. Each serves its section's model.
+	Backends []string `json:"backends" yaml:"backends"`
+	// Weights is each backend's relative share of traffic under the
+	// weighted policy
+	Weights map[string]int `json:"weights,omitempty" yaml:"weights,omitempty"`
 }
 
 // DefaultConfig holds default settings
 type DefaultConfig struct {
-	Backend     string  `json:"backend"`
-	Model       string  `json:"model"`
-	MaxTokens   int     `json:"max_tokens"`
-	Temperature float64 `json:"temperature"`
+	Backend     string  `json:"backend" yaml:"backend"`
+	Model       string  `json:"model" yaml:"model"`
+	MaxTokens   int     `json:"max_tokens" yaml:"max_tokens"`
+	Temperature float64 `json:"temperature" yaml:"temperature"`
+
+	// SystemPrompt starts every new conversation. It takes precedence over
+	// SystemPromptFile; the --system-prompt flag overrides both.
+	SystemPrompt string `json:"system_prompt,omitempty" yaml:"system_prompt,omitempty"`
+	// SystemPromptFile is read for the system prompt when SystemPrompt is
+	// empty. A relative path is resolved against the config file's
+	// directory.
+	SystemPromptFile string `json:"system_prompt_file,omitempty" yaml:"system_prompt_file,omitempty"`
 }
 
 // ControllerConfig holds chat controller configuration
 type ControllerConfig struct {
-	DefaultModel string  `json:"default_model"`
-	MaxTokens    int     `json:"max_tokens"`
-	Temperature  float64 `json:"temperature"`
+	DefaultModel string  `json:"default_model" yaml:"default_model"`
+	MaxTokens    int     `json:"max_tokens" yaml:"max_tokens"`
+	Temperature  float64 `json:"temperature" yaml:"temperature"`
+	SafeMode     bool    `json:"safe_mode" yaml:"safe_mode"`
+	UsageLogPath string  `json:"usage_log_path,omitempty" yaml:"usage_log_path,omitempty"`
+
+	// CompressPrompts strips redundant whitespace and repeated paragraphs
+	// from outbound prompts
+	CompressPrompts bool `json:"compress_prompts" yaml:"compress_prompts"`
+
+	// TrimRoleLabels strips echoed labels such as "Assistant:" from the
+	// start of responses
+	TrimRoleLabels bool `json:"trim_role_labels" yaml:"trim_role_labels"`
+
+	// MaxContextTokens drops the oldest messages before a send once the
+	// history's estimated size exceeds it. Zero disables trimming.
+	MaxContextTokens int `json:"max_context_tokens,omitempty" yaml:"max_context_tokens,omitempty"`
+
+	// MaxRetries is how many times transient backend failures are retried.
+	// Zero uses the active backend's max_retries.
+	MaxRetries int `json:"max_retries,omitempty" yaml:"max_retries,omitempty"`
+
+	// RetryBaseDelay is the backoff before the first retry, doubling after
+	// each attempt
+	RetryBaseDelay time.Duration `json:"retry_base_delay,omitempty" yaml:"retry_base_delay,omitempty"`
+
+	// AutoSummarizeAtTokens replaces older history with an AI-written
+	// summary once the conversation's estimated size reaches it. Zero
+	// disables automatic summarization.
+	AutoSummarizeAtTokens int `json:"auto_summarize_at_tokens,omitempty" yaml:"auto_summarize_at_tokens,omitempty"`
+
+	// FallbackModels are tried in order when the backend reports the
+	// configured model does not exist or is not accessible with the key
+	FallbackModels []string `json:"fallback_models,omitempty" yaml:"fallback_models,omitempty"`
+
+	// AvailabilityTTL is how long a backend availability check is reused.
+	// Zero uses the controller default; a negative value checks every time.
+	AvailabilityTTL time.Duration `json:"availability_ttl,omitempty" yaml:"availability_ttl,omitempty"`
+
+	// AutoSavePath receives a state archive of every conversation when the
+	// chat exits, including on Ctrl-C. Restore it with /restore.
+	AutoSavePath string `json:"auto_save_path,omitempty" yaml:"auto_save_path,omitempty"`
+
+	// StorePath is a SQLite file conversations are kept in, so they
+	// survive restarts. Empty keeps them in memory only; the --store flag
+	// overrides it.
+	StorePath string `json:"store_path,omitempty" yaml:"store_path,omitempty"`
+
+	// EmptyResponses decides what happens when the backend replies with
+	// no content: "store" keeps the blank reply, "retry" asks once more,
+	// and "error" reports it without storing. Empty means "store".
+	EmptyResponses string `json:"empty_responses,omitempty" yaml:"empty_responses,omitempty"`
+
+	// WelcomeBanner is a text/template shown when a conversation is started
+	// or resumed in the CLI. Empty uses the built-in banner.
+	WelcomeBanner string `json:"welcome_banner,omitempty" yaml:"welcome_banner,omitempty"`
 }
 
 // Manager handles configuration loading and saving
 type Manager struct {
 	configPath string
 	config     *Config
+	// base holds the settings as read from the config file, before
+	// profiles, environment variables and key files are applied, plus the
+	// changes meant to be saved. Save writes it.
+	base *Config
 }
 
 // NewManager creates a new configuration manager
@@ -64,12 +180,22 @@ func NewManager(configPath string) *Manager {
 			configPath = ".task-breaker-config.json"
 		} else {
 			configPath = filepath.Join(homeDir, ".task-breaker-config.json")
+
+			// Prefer a YAML config if the user has created one
+			for _, ext := range []string{".yaml", ".yml"} {
+				yamlPath := filepath.Join(homeDir, ".task-breaker-config"+ext)
+				if _, err := os.Stat(yamlPath); err == nil {
+					configPath = yamlPath
+					break
+				}
+			}
 		}
 	}
 
 	return &Manager{
 		configPath: configPath,
 		config:     getDefaultConfig(),
+		base:       getDefaultConfig(),
 	}
 }
 
@@ -85,17 +211,65 @@ func (m *Manager) Load() error {
 		return fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	if err := json.Unmarshal(data, m.config); err != nil {
+	if m.isYAML() {
+		err = yaml.Unmarshal(data, m.config)
+	} else {
+		err = json.Unmarshal(data, m.config)
+	}
+	if err != nil {
 		return fmt.Errorf("failed to parse config file: %w", err)
 	}
+	base := *m.config
+	m.base = &base
+
+	if m.config.ActiveProfile != "" {
+		return m.UseProfile(m.config.ActiveProfile)
+	}
 
 	// Load from environment variables if not set in config
 	m.loadFromEnv()
 
+	return m.loadKeyFiles()
+}
+
+// loadKeyFiles falls back to key files for keys that are still unset
+func (m *Manager) loadKeyFiles() error {
+	if m.config.OpenAI.APIKey == "" && m.config.OpenAI.APIKeyFile != "" {
+		key, err := readAPIKeyFile(m.config.OpenAI.APIKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load OpenAI API key: %w", err)
+		}
+		m.config.OpenAI.APIKey = key
+	}
+	if m.config.Claude.APIKey == "" && m.config.Claude.APIKeyFile != "" {
+		key, err := readAPIKeyFile(m.config.Claude.APIKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load Claude API key: %w", err)
+		}
+		m.config.Claude.APIKey = key
+	}
+
 	return nil
 }
 
-// Save writes the configuration to file
+// readAPIKeyFile returns the key stored in path, trimmed of surrounding
+// whitespace
+func readAPIKeyFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read api_key_file: %w", err)
+	}
+
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return "", fmt.Errorf("api_key_file %s is empty", path)
+	}
+	return key, nil
+}
+
+// Save writes the configuration to file. Only the settings read from the
+// file and changes made through the Manager are written; profile settings,
+// environment variables and keys from key files stay out of it.
 func (m *Manager) Save() error {
 	// Create directory if it doesn't exist
 	dir := filepath.Dir(m.configPath)
@@ -103,7 +277,15 @@ func (m *Manager) Save() error {
 		return fmt.Errorf("failed to create config directory: %w", err)
 	}
 
-	data, err := json.MarshalIndent(m.config, "", "  ")
+	config := *m.base
+
+	var data []byte
+	var err error
+	if m.isYAML() {
+		data, err = yaml.Marshal(&config)
+	} else {
+		data, err = json.MarshalIndent(&config, "", "  ")
+	}
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
@@ -115,7 +297,20 @@ func (m *Manager) Save() error {
 	return nil
 }
 
-// GetConfig returns the current configuration
+// isYAML reports whether the config file uses YAML, based on its extension.
+// Any other extension, or none, is treated as JSON.
+func (m *Manager) isYAML() bool {
+	switch strings.ToLower(filepath.Ext(m.configPath)) {
+	case ".yaml", ".yml":
+		return true
+	default:
+		return false
+	}
+}
+
+// GetConfig returns the current configuration. Changes made to it directly
+// apply to this process only; Set and the Set* methods also change what
+// Save writes.
 func (m *Manager) GetConfig() *Config {
 	return m.config
 }
@@ -123,16 +318,19 @@ func (m *Manager) GetConfig() *Config {
 // SetOpenAIAPIKey sets the OpenAI API key
 func (m *Manager) SetOpenAIAPIKey(apiKey string) {
 	m.config.OpenAI.APIKey = apiKey
+	m.base.OpenAI.APIKey = apiKey
 }
 
 // SetClaudeAPIKey sets the Claude API key
 func (m *Manager) SetClaudeAPIKey(apiKey string) {
 	m.config.Claude.APIKey = apiKey
+	m.base.Claude.APIKey = apiKey
 }
 
 // SetDefaultBackend sets the default backend
 func (m *Manager) SetDefaultBackend(backend string) {
 	m.config.Default.Backend = backend
+	m.base.Default.Backend = backend
 }
 
 // loadFromEnv loads configuration from environment variables
@@ -145,6 +343,10 @@ func (m *Manager) loadFromEnv() {
 		m.config.Claude.APIKey = apiKey
 	}
 
+	if apiKey := os.Getenv("AZURE_OPENAI_API_KEY"); apiKey != "" {
+		m.config.Azure.APIKey = apiKey
+	}
+
 	if baseURL := os.Getenv("OPENAI_BASE_URL"); baseURL != "" {
 		m.config.OpenAI.BaseURL = baseURL
 	}
@@ -160,6 +362,56 @@ func (m *Manager) loadFromEnv() {
 	if model := os.Getenv("DEFAULT_MODEL"); model != "" {
 		m.config.Default.Model = model
 	}
+
+	if model := os.Getenv("OPENAI_MODEL"); model != "" {
+		m.config.OpenAI.Model = model
+	}
+	envDuration("OPENAI_TIMEOUT", &m.config.OpenAI.Timeout)
+	envRetries("OPENAI_MAX_RETRIES", &m.config.OpenAI.MaxRetries)
+
+	if model := os.Getenv("CLAUDE_MODEL"); model != "" {
+		m.config.Claude.Model = model
+	}
+	envDuration("CLAUDE_TIMEOUT", &m.config.Claude.Timeout)
+	envRetries("CLAUDE_MAX_RETRIES", &m.config.Claude.MaxRetries)
+}
+
+// envDuration sets *target from a positive duration such as "45s" in the
+// named environment variable. Invalid values are logged and ignored.
+func envDuration(name string, target *time.Duration) {
+	value := os.Getenv(name)
+	if value == "" {
+		return
+	}
+
+	d, err := time.ParseDuration(value)
+	if err == nil && d <= 0 {
+		err = fmt.Errorf("must be greater than 0")
+	}
+	if err != nil {
+		slog.Warn("ignoring invalid environment variable", slog.String("name", name), slog.String("value", value), slog.String("error", err.Error()))
+		return
+	}
+	*target = d
+}
+
+// envRetries sets *target from a non-negative integer in the named
+// environment variable. Invalid values are logged and ignored.
+func envRetries(name string, target *int) {
+	value := os.Getenv(name)
+	if value == "" {
+		return
+	}
+
+	n, err := strconv.Atoi(value)
+	if err == nil && n < 0 {
+		err = fmt.Errorf("must be 0 or more")
+	}
+	if err != nil {
+		slog.Warn("ignoring invalid environment variable", slog.String("name", name), slog.String("value", value), slog.String("error", err.Error()))
+		return
+	}
+	*target = n
 }
 
 // getDefaultConfig returns the default configuration
@@ -177,6 +429,15 @@ func getDefaultConfig() *Config {
 			Timeout:    30 * time.Second,
 			MaxRetries: 3,
 		},
+		Azure: AzureConfig{
+			APIVersion: "2024-06-01",
+			Model:      "gpt-4o",
+			Timeout:    30 * time.Second,
+			MaxRetries: 3,
+		},
+		Router: RouterConfig{
+			Policy: "round-robin",
+		},
 		Default: DefaultConfig{
 			Backend:     "mock",
 			Model:       "gpt-4",
@@ -191,18 +452,40 @@ func getDefaultConfig() *Config {
 	}
 }
 
+// isReadableKeyFile reports whether path names a key file that can be read
+func isReadableKeyFile(path string) bool {
+	if path == "" {
+		return false
+	}
+	_, err := readAPIKeyFile(path)
+	return err == nil
+}
+
 // ValidateConfig checks if the configuration is valid
 func (m *Manager) ValidateConfig() error {
-	config := m.config
+	return m.Validate(m.config)
+}
 
+// Validate checks config the way ValidateConfig checks the loaded
+// configuration, e.g. a copy with session-only overrides applied. Relative
+// paths are resolved against the config file's directory.
+func (m *Manager) Validate(config *Config) error {
 	// Check if at least one backend is configured
 	hasValidBackend := false
 
-	if config.OpenAI.APIKey != "" {
+	if config.OpenAI.APIKey != "" || isReadableKeyFile(config.OpenAI.APIKeyFile) {
+		hasValidBackend = true
+	}
+
+	if config.Claude.APIKey != "" || isReadableKeyFile(config.Claude.APIKeyFile) {
+		hasValidBackend = true
+	}
+
+	if config.Default.Backend == "azure" && config.Azure.APIKey != "" {
 		hasValidBackend = true
 	}
 
-	if config.Claude.APIKey != "" {
+	if config.Default.Backend == "router" && slices.Contains(config.Router.Backends, "mock") {
 		hasValidBackend = true
 	}
 
@@ -225,9 +508,149 @@ func (m *Manager) ValidateConfig() error {
 		return fmt.Errorf("max_tokens must be greater than 0")
 	}
 
+	// The chat controller's defaults apply to every request
+	if config.ChatController.Temperature < 0.0 || config.ChatController.Temperature > 2.0 {
+		return fmt.Errorf("chat_controller.temperature must be between 0.0 and 2.0, got %v", config.ChatController.Temperature)
+	}
+	if config.ChatController.MaxTokens <= 0 {
+		return fmt.Errorf("chat_controller.max_tokens must be greater than 0, got %d", config.ChatController.MaxTokens)
+	}
+	switch config.ChatController.EmptyResponses {
+	case "", "store", "retry", "error":
+	default:
+		return fmt.Errorf("chat_controller.empty_responses must be store, retry, or error, got %q", config.ChatController.EmptyResponses)
+	}
+
+	// A configured prompt file must be readable, unless an inline prompt
+	// takes precedence over it
+	if config.Default.SystemPrompt == "" && config.Default.SystemPromptFile != "" {
+		if _, err := os.Stat(m.resolvePath(config.Default.SystemPromptFile)); err != nil {
+			return fmt.Errorf("default.system_prompt_file is not readable: %w", err)
+		}
+	}
+
+	if strings.TrimSpace(config.Default.Model) == "" {
+		return fmt.Errorf("default.model must not be empty")
+	}
+
+	if config.Default.Backend == "router" {
+		return validateRouterSection(config)
+	}
+	return validateBackend(config, config.Default.Backend)
+}
+
+// validateBackend checks the section of the named backend
+func validateBackend(config *Config, name string) error {
+	switch name {
+	case "openai":
+		o := config.OpenAI
+		return validateBackendSection("openai", o.Model, o.BaseURL, o.Timeout, o.MaxRetries)
+	case "claude":
+		c := config.Claude
+		return validateBackendSection("claude", c.Model, c.BaseURL, c.Timeout, c.MaxRetries)
+	case "azure":
+		return validateAzureSection(config.Azure)
+	case "mock":
+		return nil
+	default:
+		return fmt.Errorf("default.backend must be openai, claude, azure, router, or mock, got %q", name)
+	}
+}
+
+// validateRouterSection checks the router settings and the section of every
+// backend it routes between
+func validateRouterSection(config *Config) error {
+	switch config.Router.Policy {
+	case "cheapest", "fastest", "round-robin", "weighted":
+	default:
+		return fmt.Errorf("router.policy must be cheapest, fastest, round-robin, or weighted, got %q", config.Router.Policy)
+	}
+	if len(config.Router.Backends) == 0 {
+		return fmt.Errorf("router.backends must name at least one backend")
+	}
+
+	for _, name := range config.Router.Backends {
+		switch name {
+		case "openai", "claude", "azure", "mock":
+		default:
+			return fmt.Errorf("router.backends must list openai, claude, azure, or mock, got %q", name)
+		}
+		if err := validateBackend(config, name); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// validateBackendSection checks the settings shared by every backend
+// section. Errors name the offending field by its config key.
+func validateBackendSection(section, model, baseURL string, timeout time.Duration, maxRetries int) error {
+	if strings.TrimSpace(model) == "" {
+		return fmt.Errorf("%s.model must not be empty", section)
+	}
+
+	if timeout <= 0 {
+		return fmt.Errorf("%s.timeout must be greater than 0, got %s", section, timeout)
+	}
+
+	if maxRetries < 0 {
+		return fmt.Errorf("%s.max_retries must be 0 or more, got %d", section, maxRetries)
+	}
+
+	// An empty base URL falls back to the backend's default endpoint
+	if baseURL != "" {
+		parsed, err := url.Parse(baseURL)
+		if err != nil {
+			return fmt.Errorf("%s.base_url is invalid: %w", section, err)
+		}
+		if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("%s.base_url %q must be an absolute http or https URL", section, baseURL)
+		}
+	}
+
+	return nil
+}
+
+// validateAzureSection checks the Azure settings, which address a
+// deployment instead of a base URL
+func validateAzureSection(a AzureConfig) error {
+	if a.APIKey == "" {
+		return fmt.Errorf("azure.api_key must be set, or AZURE_OPENAI_API_KEY")
+	}
+	if strings.TrimSpace(a.Deployment) == "" {
+		return fmt.Errorf("azure.deployment must not be empty")
+	}
+	if strings.TrimSpace(a.APIVersion) == "" {
+		return fmt.Errorf("azure.api_version must not be empty")
+	}
+	if strings.TrimSpace(a.ResourceName) == "" && a.Endpoint == "" {
+		return fmt.Errorf("azure.resource_name or azure.endpoint must be set")
+	}
+	if a.Endpoint != "" {
+		parsed, err := url.Parse(a.Endpoint)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("azure.endpoint %q must be an absolute http or https URL", a.Endpoint)
+		}
+	}
+
+	return validateBackendSection("azure", a.Model, "", a.Timeout, a.MaxRetries)
+}
+
+// SystemPromptPath returns Default.SystemPromptFile resolved against the
+// config file's directory, or "" when no file is configured
+func (m *Manager) SystemPromptPath() string {
+	return m.resolvePath(m.config.Default.SystemPromptFile)
+}
+
+// resolvePath resolves a path from the config against the config file's
+// directory
+func (m *Manager) resolvePath(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(m.configPath), path)
+}
+
 // GetConfigPath returns the path to the configuration file
 func (m *Manager) GetConfigPath() string {
 	return m.configPath
@@ -243,13 +666,13 @@ func (m *Manager) InitializeConfig() error {
 	claudeKey := os.Getenv("CLAUDE_API_KEY")
 
 	if openAIKey != "" {
-		fmt.Println("✓ Found OPENAI_API_KEY in environment")
-		m.config.OpenAI.APIKey = openAIKey
+		fmt.Printf("✓ Found OPENAI_API_KEY in environment (%s)\n", RedactKey(openAIKey))
+		m.SetOpenAIAPIKey(openAIKey)
 	}
 
 	if claudeKey != "" {
-		fmt.Println("✓ Found CLAUDE_API_KEY in environment")
-		m.config.Claude.APIKey = claudeKey
+		fmt.Printf("✓ Found CLAUDE_API_KEY in environment (%s)\n", RedactKey(claudeKey))
+		m.SetClaudeAPIKey(claudeKey)
 	}
 
 	if openAIKey == "" && claudeKey == "" {
@@ -263,11 +686,13 @@ func (m *Manager) InitializeConfig() error {
 
 	// Set reasonable defaults
 	if openAIKey != "" {
-		m.config.Default.Backend = "openai"
+		m.SetDefaultBackend("openai")
 	} else if claudeKey != "" {
-		m.config.Default.Backend = "claude"
+		m.SetDefaultBackend("claude")
+		m.config.Default.Model = m.config.Claude.Model
+		m.base.Default.Model = m.base.Claude.Model
 	} else {
-		m.config.Default.Backend = "mock"
+		m.SetDefaultBackend("mock")
 		fmt.Println("Using mock backend for testing (no API costs)")
 	}
 
@@ -0,0 +1,317 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManager_YAMLRoundTrip(t *testing.T) {
+	for _, name := range []string{"config.yaml", "config.yml"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+
+			m := NewManager(path)
+			m.base.OpenAI.Timeout = 45 * time.Second
+			m.base.Default.Model = "gpt-4o"
+			if err := m.Save(); err != nil {
+				t.Fatalf("Save failed: %v", err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read saved config: %v", err)
+			}
+			if !strings.Contains(string(data), "timeout: 45s") {
+				t.Errorf("Expected durations written as strings, got:\n%s", data)
+			}
+			if strings.Contains(string(data), "{") {
+				t.Errorf("Expected YAML output, got:\n%s", data)
+			}
+
+			loaded := NewManager(path)
+			if err := loaded.Load(); err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			if loaded.config.OpenAI.Timeout != 45*time.Second {
+				t.Errorf("Expected timeout 45s, got %v", loaded.config.OpenAI.Timeout)
+			}
+			if loaded.config.Default.Model != "gpt-4o" {
+				t.Errorf("Expected model gpt-4o, got %q", loaded.config.Default.Model)
+			}
+		})
+	}
+}
+
+func TestManager_LoadHandWrittenYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := `claude:
+  model: claude-3-haiku-20240307
+  timeout: 1m30s
+default:
+  backend: mock
+  temperature: 0.3
+`
+	if err := os.WriteFile(path, []byte(yaml), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	m := NewManager(path)
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	cfg := m.GetConfig()
+	if cfg.Claude.Timeout != 90*time.Second {
+		t.Errorf("Expected timeout 1m30s, got %v", cfg.Claude.Timeout)
+	}
+	if cfg.Claude.Model != "claude-3-haiku-20240307" || cfg.Default.Temperature != 0.3 {
+		t.Errorf("Expected values from YAML, got %+v %+v", cfg.Claude, cfg.Default)
+	}
+	if cfg.OpenAI.Model != "gpt-4" {
+		t.Errorf("Expected unset fields to keep defaults, got %q", cfg.OpenAI.Model)
+	}
+}
+
+func TestManager_JSONByDefault(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+
+	if err := NewManager(path).Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read saved config: %v", err)
+	}
+	if !strings.HasPrefix(string(data), "{") {
+		t.Errorf("Expected JSON when the path has no extension, got:\n%s", data)
+	}
+}
+
+func TestManager_APIKeyFile(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "")
+	t.Setenv("CLAUDE_API_KEY", "")
+
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "openai.key")
+	if err := os.WriteFile(keyFile, []byte("  sk-from-file\n"), 0600); err != nil {
+		t.Fatalf("Failed to write key file: %v", err)
+	}
+
+	path := filepath.Join(dir, "config.json")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+	}
+
+	// The key file is used when no inline key is set
+	write(`{"openai": {"api_key_file": "` + keyFile + `"}, "default": {"backend": "openai"}}`)
+	m := NewManager(path)
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if m.GetConfig().OpenAI.APIKey != "sk-from-file" {
+		t.Errorf("Expected trimmed key from file, got %q", m.GetConfig().OpenAI.APIKey)
+	}
+	if err := m.ValidateConfig(); err != nil {
+		t.Errorf("Expected key file to count as a valid backend, got %v", err)
+	}
+
+	// Saving must not copy the key into the config file
+	if err := m.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "sk-from-file") {
+		t.Errorf("Key from file should not be written to config, got:\n%s", data)
+	}
+
+	// An inline key wins over the file
+	write(`{"openai": {"api_key": "sk-inline", "api_key_file": "` + keyFile + `"}}`)
+	m = NewManager(path)
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if m.GetConfig().OpenAI.APIKey != "sk-inline" {
+		t.Errorf("Expected inline key to take precedence, got %q", m.GetConfig().OpenAI.APIKey)
+	}
+
+	// The environment wins over both
+	t.Setenv("OPENAI_API_KEY", "sk-env")
+	m = NewManager(path)
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if m.GetConfig().OpenAI.APIKey != "sk-env" {
+		t.Errorf("Expected environment key to take precedence, got %q", m.GetConfig().OpenAI.APIKey)
+	}
+
+	// An unreadable key file is an error
+	write(`{"claude": {"api_key_file": "` + filepath.Join(dir, "missing.key") + `"}}`)
+	err := NewManager(path).Load()
+	if err == nil || !strings.Contains(err.Error(), "Claude API key") {
+		t.Errorf("Expected error for unreadable key file, got %v", err)
+	}
+}
+
+func TestManager_ValidateBackendSection(t *testing.T) {
+	tests := []struct {
+		name    string
+		backend string
+		modify  func(c *Config)
+		wantErr string
+	}{
+		{"valid openai", "openai", func(c *Config) {}, ""},
+		{"valid claude", "claude", func(c *Config) {}, ""},
+		{"empty base url uses default", "openai", func(c *Config) { c.OpenAI.BaseURL = "" }, ""},
+		{"empty claude model", "claude", func(c *Config) { c.Claude.Model = "" }, "claude.model"},
+		{"zero claude timeout", "claude", func(c *Config) { c.Claude.Timeout = 0 }, "claude.timeout"},
+		{"negative openai retries", "openai", func(c *Config) { c.OpenAI.MaxRetries = -1 }, "openai.max_retries"},
+		{"relative base url", "claude", func(c *Config) { c.Claude.BaseURL = "api.anthropic.com" }, "claude.base_url"},
+		{"unparseable base url", "openai", func(c *Config) { c.OpenAI.BaseURL = "http://[::1" }, "openai.base_url"},
+		{"other section ignored", "openai", func(c *Config) { c.Claude.Model = "" }, ""},
+		{"mock ignores sections", "mock", func(c *Config) { c.OpenAI.Timeout = 0 }, ""},
+		{"valid azure", "azure", func(c *Config) {}, ""},
+		{"azure endpoint instead of resource", "azure", func(c *Config) {
+			c.Azure.ResourceName = ""
+			c.Azure.Endpoint = "https://proxy.example.com"
+		}, ""},
+		{"missing azure deployment", "azure", func(c *Config) { c.Azure.Deployment = "" }, "azure.deployment"},
+		{"missing azure api version", "azure", func(c *Config) { c.Azure.APIVersion = " " }, "azure.api_version"},
+		{"missing azure resource", "azure", func(c *Config) { c.Azure.ResourceName = "" }, "azure.resource_name"},
+		{"relative azure endpoint", "azure", func(c *Config) { c.Azure.Endpoint = "contoso.openai.azure.com" }, "azure.endpoint"},
+		{"valid router", "router", func(c *Config) { c.Router.Backends = []string{"openai", "claude"} }, ""},
+		{"router without backends", "router", func(c *Config) {}, "router.backends"},
+		{"unknown router policy", "router", func(c *Config) {
+			c.Router.Backends = []string{"mock"}
+			c.Router.Policy = "random"
+		}, "router.policy"},
+		{"router checks its sections", "router", func(c *Config) {
+			c.Router.Backends = []string{"openai", "claude"}
+			c.Claude.Model = ""
+		}, "claude.model"},
+		{"router cannot nest", "router", func(c *Config) { c.Router.Backends = []string{"router"} }, "router.backends"},
+		{"empty response retry", "mock", func(c *Config) { c.ChatController.EmptyResponses = "retry" }, ""},
+		{"unknown empty response policy", "mock", func(c *Config) { c.ChatController.EmptyResponses = "ignore" }, "chat_controller.empty_responses"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := NewManager(filepath.Join(t.TempDir(), "config.json"))
+			config := m.GetConfig()
+			config.OpenAI.APIKey = "sk-test"
+			config.Claude.APIKey = "sk-test"
+			config.Azure.APIKey = "azure-test"
+			config.Azure.ResourceName = "contoso"
+			config.Azure.Deployment = "gpt-4o"
+			config.Default.Backend = test.backend
+			test.modify(config)
+
+			err := m.ValidateConfig()
+			if test.wantErr == "" {
+				if err != nil {
+					t.Errorf("Expected valid config, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("Expected error naming %s, got %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestManager_BackendEnvOverrides(t *testing.T) {
+	t.Setenv("OPENAI_MODEL", "gpt-4o")
+	t.Setenv("OPENAI_TIMEOUT", "45s")
+	t.Setenv("OPENAI_MAX_RETRIES", "0")
+	t.Setenv("CLAUDE_MODEL", "claude-3-haiku-20240307")
+	t.Setenv("CLAUDE_TIMEOUT", "soon")
+	t.Setenv("CLAUDE_MAX_RETRIES", "-2")
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"claude": {"timeout": 10000000000, "max_retries": 5}}`), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	m := NewManager(path)
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	config := m.GetConfig()
+
+	if config.OpenAI.Model != "gpt-4o" || config.OpenAI.Timeout != 45*time.Second || config.OpenAI.MaxRetries != 0 {
+		t.Errorf("Expected OpenAI overrides to apply, got %+v", config.OpenAI)
+	}
+	if config.Claude.Model != "claude-3-haiku-20240307" {
+		t.Errorf("Expected Claude model override, got %q", config.Claude.Model)
+	}
+	if config.Claude.Timeout != 10*time.Second || config.Claude.MaxRetries != 5 {
+		t.Errorf("Expected invalid values to keep the file settings, got timeout %s and retries %d",
+			config.Claude.Timeout, config.Claude.MaxRetries)
+	}
+}
+
+func TestManager_SystemPromptFile(t *testing.T) {
+	dir := t.TempDir()
+	m := NewManager(filepath.Join(dir, "config.json"))
+	config := m.GetConfig()
+	config.Default.SystemPromptFile = "prompts/assistant.txt"
+
+	want := filepath.Join(dir, "prompts", "assistant.txt")
+	if got := m.SystemPromptPath(); got != want {
+		t.Errorf("Expected path relative to the config file %s, got %s", want, got)
+	}
+
+	if err := m.ValidateConfig(); err == nil || !strings.Contains(err.Error(), "default.system_prompt_file") {
+		t.Errorf("Expected a missing prompt file to be rejected, got %v", err)
+	}
+
+	os.MkdirAll(filepath.Dir(want), 0755)
+	os.WriteFile(want, []byte("Be brief."), 0600)
+	if err := m.ValidateConfig(); err != nil {
+		t.Errorf("Expected a readable prompt file to be valid, got %v", err)
+	}
+
+	config.Default.SystemPromptFile = "/etc/prompt.txt"
+	if got := m.SystemPromptPath(); got != "/etc/prompt.txt" {
+		t.Errorf("Expected an absolute path to be kept, got %s", got)
+	}
+}
+
+func TestManager_Set(t *testing.T) {
+	m := NewManager(filepath.Join(t.TempDir(), "config.json"))
+	m.config.OpenAI.APIKey = "sk-test"
+
+	if err := m.Set("temperature", "1.5"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if m.config.ChatController.Temperature != 1.5 {
+		t.Errorf("Expected temperature 1.5, got %v", m.config.ChatController.Temperature)
+	}
+
+	for _, tt := range []struct{ key, value, wantErr string }{
+		{"temperature", "hot", "temperature must be a number"},
+		{"temperature", "2.5", "chat_controller.temperature must be between 0.0 and 2.0"},
+		{"max_tokens", "0", "chat_controller.max_tokens must be greater than 0"},
+		{"model", " ", "default.model must not be empty"},
+		{"backend", "bard", "default.backend must be openai, claude, azure, router, or mock"},
+		{"api_key", "sk-123", "editable: backend, model, temperature, max_tokens"},
+	} {
+		err := m.Set(tt.key, tt.value)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("Set(%q, %q): expected error containing %q, got %v", tt.key, tt.value, tt.wantErr, err)
+		}
+	}
+
+	// Rejected values leave the configuration as it was
+	if m.config.ChatController.Temperature != 1.5 || m.config.ChatController.MaxTokens != 500 ||
+		m.config.Default.Model != "gpt-4" || m.config.Default.Backend != "mock" {
+		t.Errorf("Expected rejected values to be rolled back, got %+v", m.config)
+	}
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// EditableKeys lists the settings Set can change, in display order
+var EditableKeys = []string{"backend", "model", "temperature", "max_tokens"}
+
+// setters apply a value to the config field behind each editable key.
+// model and backend are the defaults sent with each request; temperature
+// and max_tokens are the chat controller's defaults.
+var setters = map[string]func(c *Config, value string) error{
+	"backend": func(c *Config, value string) error {
+		c.Default.Backend = value
+		return nil
+	},
+	"model": func(c *Config, value string) error {
+		c.Default.Model = value
+		return nil
+	},
+	"temperature": func(c *Config, value string) error {
+		temperature, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("temperature must be a number, got %q", value)
+		}
+		c.ChatController.Temperature = temperature
+		return nil
+	},
+	"max_tokens": func(c *Config, value string) error {
+		maxTokens, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("max_tokens must be a whole number, got %q", value)
+		}
+		c.ChatController.MaxTokens = maxTokens
+		return nil
+	},
+}
+
+// Set changes one of EditableKeys in c without validating the result
+func (c *Config) Set(key, value string) error {
+	set, ok := setters[key]
+	if !ok {
+		return fmt.Errorf("unknown setting %q (editable: %s)", key, strings.Join(EditableKeys, ", "))
+	}
+	return set(c, strings.TrimSpace(value))
+}
+
+// Set changes one of EditableKeys and checks the result with
+// ValidateConfig. An invalid value leaves the configuration unchanged. The
+// change is made in memory; call Save to write it to the config file, which
+// gets only this key on top of the settings read from it.
+func (m *Manager) Set(key, value string) error {
+	updated := *m.config
+	if err := updated.Set(key, value); err != nil {
+		return err
+	}
+	if err := m.Validate(&updated); err != nil {
+		return err
+	}
+
+	*m.config = updated
+	return m.base.Set(key, value)
+}
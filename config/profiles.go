@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// UseProfile makes the named profile's settings active. A profile is an
+// overlay: every field it sets replaces the top-level setting, and fields
+// it leaves empty keep the top-level value. Environment variables and key
+// files still take precedence, as they do at Load. An empty name returns to
+// the top-level settings.
+//
+// While a profile is active, Save writes the top-level settings and all
+// profiles unchanged, recording only which profile is active, so edits made
+// directly to the active settings are not saved.
+func (m *Manager) UseProfile(name string) error {
+	effective := *m.base
+	if name != "" {
+		profile, ok := m.base.Profiles[name]
+		if !ok {
+			return fmt.Errorf("unknown profile %q (available: %s)", name, m.profileList())
+		}
+		overlay(reflect.ValueOf(&effective).Elem(), reflect.ValueOf(profile))
+	}
+	effective.ActiveProfile = name
+	m.base.ActiveProfile = name
+
+	*m.config = effective
+	m.loadFromEnv()
+	return m.loadKeyFiles()
+}
+
+// Profiles returns the names of the defined profiles in sorted order
+func (m *Manager) Profiles() []string {
+	names := make([]string, 0, len(m.base.Profiles))
+	for name := range m.base.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// profileList describes the defined profiles for error messages
+func (m *Manager) profileList() string {
+	names := m.Profiles()
+	if len(names) == 0 {
+		return "no profiles defined"
+	}
+	return strings.Join(names, ", ")
+}
+
+// overlay copies every non-zero field of src onto dst, recursing into
+// nested structs. Profile bookkeeping fields are skipped, so profiles do not
+// nest.
+func overlay(dst, src reflect.Value) {
+	for i := 0; i < src.NumField(); i++ {
+		switch src.Type().Field(i).Name {
+		case "Profiles", "ActiveProfile":
+			continue
+		}
+
+		field := src.Field(i)
+		if field.Kind() == reflect.Struct {
+			overlay(dst.Field(i), field)
+			continue
+		}
+		if !field.IsZero() {
+			dst.Field(i).Set(field)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const profilesConfig = `{
+  "openai": {"api_key": "sk-personal", "base_url": "https://api.openai.com/v1", "model": "gpt-4", "timeout": 30000000000, "max_retries": 3},
+  "default": {"backend": "openai", "model": "gpt-4", "max_tokens": 500, "temperature": 0.7},
+  "profiles": {
+    "work": {"openai": {"api_key": "sk-work", "base_url": "https://work.openai.azure.com/v1"}},
+    "local": {"openai": {"base_url": "http://localhost:11434/v1", "model": "llama3"}, "default": {"model": "llama3"}}
+  }
+}`
+
+func TestManager_UseProfile(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "")
+	t.Setenv("OPENAI_BASE_URL", "")
+	t.Setenv("OPENAI_MODEL", "")
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(profilesConfig), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	m := NewManager(path)
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	cfg := m.GetConfig()
+
+	if err := m.UseProfile("local"); err != nil {
+		t.Fatalf("UseProfile failed: %v", err)
+	}
+	if cfg.OpenAI.BaseURL != "http://localhost:11434/v1" || cfg.Default.Model != "llama3" {
+		t.Errorf("Expected local profile settings, got %+v %+v", cfg.OpenAI, cfg.Default)
+	}
+	if cfg.OpenAI.APIKey != "sk-personal" || cfg.Default.MaxTokens != 500 {
+		t.Errorf("Expected unset profile fields to keep top-level values, got %+v", cfg.OpenAI)
+	}
+
+	// Switching again starts from the top-level settings, not the last profile
+	if err := m.UseProfile("work"); err != nil {
+		t.Fatalf("UseProfile failed: %v", err)
+	}
+	if cfg.OpenAI.APIKey != "sk-work" || cfg.OpenAI.Model != "gpt-4" {
+		t.Errorf("Expected work profile over top-level settings, got %+v", cfg.OpenAI)
+	}
+
+	err := m.UseProfile("ollama")
+	if err == nil || !strings.Contains(err.Error(), "available: local, work") {
+		t.Errorf("Expected error listing available profiles, got %v", err)
+	}
+	if cfg.ActiveProfile != "work" {
+		t.Errorf("Expected a failed switch to keep the active profile, got %q", cfg.ActiveProfile)
+	}
+}
+
+func TestManager_SavePreservesProfiles(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "")
+	t.Setenv("OPENAI_BASE_URL", "")
+	t.Setenv("OPENAI_MODEL", "")
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(profilesConfig), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	m := NewManager(path)
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if err := m.UseProfile("work"); err != nil {
+		t.Fatalf("UseProfile failed: %v", err)
+	}
+	if err := m.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded := NewManager(path)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	cfg := loaded.GetConfig()
+
+	if cfg.ActiveProfile != "work" || cfg.OpenAI.APIKey != "sk-work" {
+		t.Errorf("Expected the active profile to be restored, got %q with key %q", cfg.ActiveProfile, cfg.OpenAI.APIKey)
+	}
+	if names := loaded.Profiles(); len(names) != 2 {
+		t.Errorf("Expected both profiles to be saved, got %v", names)
+	}
+
+	// Returning to the top level shows the settings were not overwritten
+	if err := loaded.UseProfile(""); err != nil {
+		t.Fatalf("UseProfile failed: %v", err)
+	}
+	if cfg.OpenAI.APIKey != "sk-personal" || cfg.OpenAI.BaseURL != "https://api.openai.com/v1" {
+		t.Errorf("Expected top-level settings to be preserved, got %+v", cfg.OpenAI)
+	}
+}
+
+func TestManager_UseProfileWithoutProfiles(t *testing.T) {
+	m := NewManager(filepath.Join(t.TempDir(), "config.json"))
+
+	err := m.UseProfile("work")
+	if err == nil || !strings.Contains(err.Error(), "no profiles defined") {
+		t.Errorf("Expected error for unknown profile, got %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// redactedPrefixChars and redactedKeyChars are how many characters
+// RedactKey keeps at the start and end of a key
+const (
+	redactedPrefixChars = 3
+	redactedKeyChars    = 4
+)
+
+// RedactKey masks an API key for display, keeping the first three and last
+// four characters, e.g. "sk-...abcd". Keys shorter than 21 characters, so
+// that more than a third would show, are masked completely. An empty key
+// stays empty.
+func RedactKey(key string) string {
+	if key == "" {
+		return ""
+	}
+	// Reveal at most a third of the key
+	if len(key) < 3*(redactedPrefixChars+redactedKeyChars) {
+		return "****"
+	}
+	return key[:redactedPrefixChars] + "..." + key[len(key)-redactedKeyChars:]
+}
+
+// Redacted returns a copy of the configuration with every API key masked by
+// RedactKey, including those in profiles. Use it for anything printed or
+// logged; Save writes the real keys.
+func (c Config) Redacted() Config {
+	c.OpenAI = c.OpenAI.Redacted()
+	c.Claude = c.Claude.Redacted()
+	c.Azure = c.Azure.Redacted()
+
+	if c.Profiles != nil {
+		profiles := make(map[string]Config, len(c.Profiles))
+		for name, profile := range c.Profiles {
+			profiles[name] = profile.Redacted()
+		}
+		c.Profiles = profiles
+	}
+	return c
+}
+
+// String formats the redacted configuration as JSON, so printing a Config
+// never shows its keys
+func (c Config) String() string {
+	data, err := json.MarshalIndent(c.Redacted(), "", "  ")
+	if err != nil {
+		return fmt.Sprintf("config: %v", err)
+	}
+	return string(data)
+}
+
+// GoString keeps %#v from bypassing String
+func (c Config) GoString() string {
+	return c.String()
+}
+
+// Redacted returns a copy with the API key masked
+func (o OpenAIConfig) Redacted() OpenAIConfig {
+	o.APIKey = RedactKey(o.APIKey)
+	return o
+}
+
+// String formats the settings with the API key masked
+func (o OpenAIConfig) String() string {
+	type plain OpenAIConfig
+	return fmt.Sprintf("%+v", plain(o.Redacted()))
+}
+
+// Redacted returns a copy with the API key masked
+func (c ClaudeConfig) Redacted() ClaudeConfig {
+	c.APIKey = RedactKey(c.APIKey)
+	return c
+}
+
+// String formats the settings with the API key masked
+func (c ClaudeConfig) String() string {
+	type plain ClaudeConfig
+	return fmt.Sprintf("%+v", plain(c.Redacted()))
+}
+
+// Redacted returns a copy with the API key masked
+func (a AzureConfig) Redacted() AzureConfig {
+	a.APIKey = RedactKey(a.APIKey)
+	return a
+}
+
+// String formats the settings with the API key masked
+func (a AzureConfig) String() string {
+	type plain AzureConfig
+	return fmt.Sprintf("%+v", plain(a.Redacted()))
+}
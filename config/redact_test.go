@@ -0,0 +1,84 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedactKey(t *testing.T) {
+	tests := []struct {
+		key, want string
+	}{
+		{"", ""},
+		{"sk-short", "****"},
+		// The prefix and suffix would overlap
+		{"sk-ab", "****"},
+		{"sk-0123456789abcdefg", "****"},
+		{"sk-0123456789abcdefgh", "sk-...efgh"},
+		{"sk-proj-0123456789abcdefabcd", "sk-...abcd"},
+	}
+
+	for _, tt := range tests {
+		if got := RedactKey(tt.key); got != tt.want {
+			t.Errorf("RedactKey(%q) = %q, expected %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestConfig_Redacted(t *testing.T) {
+	const (
+		openAIKey  = "sk-openai-0123456789abcdef"
+		claudeKey  = "sk-ant-REDACTED"
+		azureKey   = "azure0123456789abcdef0123"
+		profileKey = "sk-profile-0123456789abcdef"
+	)
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	m := NewManager(path)
+	m.config.OpenAI.APIKey = openAIKey
+	m.config.Claude.APIKey = claudeKey
+	m.config.Azure.APIKey = azureKey
+	m.config.Profiles = map[string]Config{"work": {OpenAI: OpenAIConfig{APIKey: profileKey}}}
+	*m.base = *m.config
+	cfg := m.GetConfig()
+
+	printed := []string{
+		fmt.Sprint(cfg),
+		fmt.Sprintf("%v", *cfg),
+		fmt.Sprintf("%+v", cfg),
+		fmt.Sprintf("%#v", *cfg),
+		fmt.Sprint(cfg.OpenAI),
+		fmt.Sprintf("%+v", cfg.Claude),
+		fmt.Sprint(cfg.Azure),
+	}
+	for _, output := range printed {
+		for _, key := range []string{openAIKey, claudeKey, azureKey, profileKey} {
+			if strings.Contains(output, key) {
+				t.Errorf("Expected %q to be redacted, got:\n%s", key, output)
+			}
+		}
+	}
+	if !strings.Contains(printed[0], "sk-...cdef") {
+		t.Errorf("Expected the redacted key form, got:\n%s", printed[0])
+	}
+
+	// Redaction works on copies, so the real keys are still saved
+	if cfg.OpenAI.APIKey != openAIKey {
+		t.Errorf("Expected the config to keep its key, got %q", cfg.OpenAI.APIKey)
+	}
+	if err := m.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read saved config: %v", err)
+	}
+	for _, key := range []string{openAIKey, claudeKey, azureKey, profileKey} {
+		if !strings.Contains(string(data), key) {
+			t.Errorf("Expected %q in the saved file", key)
+		}
+	}
+}
@@ -9,15 +9,17 @@ import (
 	"testing"
 	"time"
 
-	"github.com/jeanhaley32/go-openai-client"
-	"github.com/jeanhaley32/go-openai-client/chat"
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/backends/mock"
+	"github.com/jeanhaley/task-breaker/backends/openai"
+	"github.com/jeanhaley/task-breaker/chat"
 	"github.com/jeanhaley/task-breaker/config"
 )
 
 // TestIntegration_FullWorkflow tests the complete system workflow
 func TestIntegration_FullWorkflow(t *testing.T) {
 	// Test with mock backend to ensure no API costs
-	backend := openai.NewMockBackend()
+	backend := mock.NewMockBackend()
 
 	// Create chat controller
 	controller := chat.NewController(backend, &chat.ControllerConfig{
@@ -88,7 +90,7 @@ func TestIntegration_FullWorkflow(t *testing.T) {
 
 	// 6. Test backend switching
 	t.Log("Step 6: Testing backend switching...")
-	newBackend := openai.NewMockBackend()
+	newBackend := mock.NewMockBackend()
 	newBackend.Configure(map[string]interface{}{"name": "SecondMock"})
 
 	controller.SetBackend(newBackend)
@@ -223,14 +225,14 @@ func TestIntegration_MultipleBackends(t *testing.T) {
 
 	// 1. Create multiple backends
 	t.Log("Step 1: Creating multiple backends...")
-	mockBackend1 := openai.NewMockBackend()
+	mockBackend1 := mock.NewMockBackend()
 	mockBackend1.Configure(map[string]interface{}{"name": "Mock1"})
 
-	mockBackend2 := openai.NewMockBackend()
+	mockBackend2 := mock.NewMockBackend()
 	mockBackend2.Configure(map[string]interface{}{"name": "Mock2"})
 
 	// Test OpenAI backend only if API key is available
-	var openaiBackend openai.Backend
+	var openaiBackend ai.Backend
 	if apiKey := os.Getenv("OPENAI_API_KEY"); apiKey != "" {
 		t.Log("OpenAI API key found - including OpenAI backend in test")
 		openaiBackend = openai.NewClient(openai.Config{
@@ -242,7 +244,7 @@ func TestIntegration_MultipleBackends(t *testing.T) {
 	}
 
 	// 2. Test each backend
-	backends := []openai.Backend{mockBackend1, mockBackend2}
+	backends := []ai.Backend{mockBackend1, mockBackend2}
 	if openaiBackend != nil {
 		backends = append(backends, openaiBackend)
 	}
@@ -303,7 +305,7 @@ func TestIntegration_ContextLoading(t *testing.T) {
 
 	// 2. Create agent with context
 	t.Log("Step 2: Creating agent with context...")
-	backend := openai.NewMockBackend()
+	backend := mock.NewMockBackend()
 	agent := NewAgent("ContextTestAgent", backend)
 
 	err := agent.LoadContext(tempFile)
@@ -317,7 +319,7 @@ func TestIntegration_ContextLoading(t *testing.T) {
 
 	// 3. Test that context affects responses
 	t.Log("Step 3: Testing context-aware responses...")
-	response, err := agent.SendChatCompletion([]openai.Message{
+	response, err := agent.SendChatCompletion([]ai.Message{
 		{Role: "user", Content: "Help me with a Go function"},
 	})
 
@@ -374,7 +376,7 @@ func TestIntegration_ErrorHandling(t *testing.T) {
 
 	// 2. Test with cancelled context
 	t.Log("Step 2: Testing cancelled context...")
-	mockBackend := openai.NewMockBackend()
+	mockBackend := mock.NewMockBackend()
 	controller = chat.NewController(mockBackend, nil)
 
 	cancelledCtx, cancel := context.WithCancel(ctx)
@@ -445,7 +447,7 @@ func TestIntegration_ErrorHandling(t *testing.T) {
 // TestIntegration_ConcurrentOperations tests system under concurrent load
 func TestIntegration_ConcurrentOperations(t *testing.T) {
 	ctx := context.Background()
-	backend := openai.NewMockBackend()
+	backend := mock.NewMockBackend()
 	controller := chat.NewController(backend, nil)
 
 	const numGoroutines = 20
@@ -595,7 +597,7 @@ func TestIntegration_PerformanceBenchmark(t *testing.T) {
 		t.Skip("Skipping performance test in short mode")
 	}
 
-	backend := openai.NewMockBackend()
+	backend := mock.NewMockBackend()
 	controller := chat.NewController(backend, nil)
 	ctx := context.Background()
 
@@ -2,97 +2,428 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"strings"
 	"time"
 
-	"github.com/jeanhaley32/go-openai-client"
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/backends/mock"
 )
 
+// defaultTimeout bounds each backend call when Agent.Timeout is unset
+const defaultTimeout = 30 * time.Second
+
+// defaultMaxTokens caps each reply when Agent.MaxTokens is unset
+const defaultMaxTokens = 150
+
+// defaultContextWindow is the model context size assumed when
+// Agent.ContextWindow is unset. It matches the smallest common model.
+const defaultContextWindow = 8192
+
+// ErrContextTooLarge is returned when the system context and the latest
+// message alone do not fit in the context window
+var ErrContextTooLarge = errors.New("context too large")
+
 type Agent struct {
-	name      string
-	context   string
-	aiBackend openai.Backend
+	name    string
+	context string
+	// systemPrompt holds behavioral instructions, kept apart from the
+	// reference material in context
+	systemPrompt string
+	aiBackend    ai.Backend
+
+	// Timeout bounds each backend call. Zero uses defaultTimeout.
+	Timeout time.Duration
+
+	// MaxTokens caps each reply. Zero uses defaultMaxTokens.
+	MaxTokens int
+
+	// ContextWindow is the model's context size in tokens, shared by the
+	// prompt and the reply. Zero uses defaultContextWindow.
+	ContextWindow int
+
+	// Logger receives structured logs of each backend call
+	Logger *slog.Logger
 }
 
-func NewAgent(name string, backend openai.Backend) *Agent {
+func NewAgent(name string, backend ai.Backend) *Agent {
 	return &Agent{
 		name:      name,
 		aiBackend: backend,
+		Timeout:   defaultTimeout,
+		Logger:    slog.New(slog.DiscardHandler),
+	}
+}
+
+// WithSystemPrompt sets the instructions sent as the first system message,
+// ahead of any loaded context, and returns the agent for chaining
+func (a *Agent) WithSystemPrompt(prompt string) *Agent {
+	a.systemPrompt = prompt
+	return a
+}
+
+// WithLogger sets the logger and returns the agent for chaining
+func (a *Agent) WithLogger(logger *slog.Logger) *Agent {
+	a.Logger = logger
+	return a
+}
+
+// logger returns the logger to use, discarding logs when none is set
+func (a *Agent) logger() *slog.Logger {
+	if a.Logger == nil {
+		return slog.New(slog.DiscardHandler)
 	}
+	return a.Logger
+}
+
+// logCall logs the outcome of a backend call
+func (a *Agent) logCall(msg, model string, tokens int, start time.Time, err error) {
+	attrs := []slog.Attr{
+		slog.String("agent", a.name),
+		slog.String("model", model),
+		slog.Int("tokens", tokens),
+		slog.Int64("duration_ms", time.Since(start).Milliseconds()),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+		a.logger().LogAttrs(context.Background(), slog.LevelError, msg+" failed", attrs...)
+		return
+	}
+	a.logger().LogAttrs(context.Background(), slog.LevelInfo, msg, attrs...)
+}
+
+// WithTimeout sets the per-request timeout and returns the agent for chaining
+func (a *Agent) WithTimeout(timeout time.Duration) *Agent {
+	a.Timeout = timeout
+	return a
+}
+
+// requestTimeout returns the timeout to use for a backend call
+func (a *Agent) requestTimeout() time.Duration {
+	if a.Timeout <= 0 {
+		return defaultTimeout
+	}
+	return a.Timeout
+}
+
+// WithMaxTokens sets the reply token cap and returns the agent for chaining
+func (a *Agent) WithMaxTokens(maxTokens int) *Agent {
+	a.MaxTokens = maxTokens
+	return a
+}
+
+// WithContextWindow sets the model context size and returns the agent for
+// chaining
+func (a *Agent) WithContextWindow(tokens int) *Agent {
+	a.ContextWindow = tokens
+	return a
 }
 
+// maxTokens returns the reply token cap to request
+func (a *Agent) maxTokens() int {
+	if a.MaxTokens <= 0 {
+		return defaultMaxTokens
+	}
+	return a.MaxTokens
+}
+
+// contextWindow returns the context size to fit prompts into
+func (a *Agent) contextWindow() int {
+	if a.ContextWindow <= 0 {
+		return defaultContextWindow
+	}
+	return a.ContextWindow
+}
+
+// LoadContext replaces the agent's context with the contents of a file, or
+// of a document fetched over HTTP when filename is an http:// or https:// URL
 func (a *Agent) LoadContext(filename string) error {
+	content, err := a.readContext(filename)
+	if err != nil {
+		return err
+	}
+
+	a.context = content
+	return nil
+}
+
+// contextDelimiter separates the files combined by LoadContexts
+const contextDelimiter = "\n\n---\n\n"
+
+// LoadContexts reads each file in order and combines them into the agent's
+// context, each under a "# <filename>" header and separated by a horizontal
+// rule. Loading is all or nothing: if any file fails, the error names that
+// file and the existing context is left unchanged.
+func (a *Agent) LoadContexts(filenames ...string) error {
+	sections := make([]string, 0, len(filenames))
+	for _, filename := range filenames {
+		content, err := a.readContext(filename)
+		if err != nil {
+			return err
+		}
+		sections = append(sections, fmt.Sprintf("# %s\n\n%s", filename, content))
+	}
+
+	a.context = strings.Join(sections, contextDelimiter)
+	return nil
+}
+
+// maxContextBytes caps the size of a context document fetched over HTTP
+const maxContextBytes = 1 << 20
+
+// readContext reads context from a URL or a file
+func (a *Agent) readContext(source string) (string, error) {
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		return a.fetchContext(source)
+	}
+	return readContextFile(source)
+}
+
+// fetchContext downloads a context document, failing on non-200 responses
+// and on documents larger than maxContextBytes
+func (a *Agent) fetchContext(url string) (string, error) {
+	client := &http.Client{Timeout: a.requestTimeout()}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch context %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch context %s: unexpected status %d %s", url, resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	if resp.ContentLength > maxContextBytes {
+		return "", fmt.Errorf("context %s is too large: %d bytes (limit %d)", url, resp.ContentLength, maxContextBytes)
+	}
+
+	// Read one byte past the limit to detect oversized bodies without a
+	// Content-Length header
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxContextBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read context %s: %w", url, err)
+	}
+	if len(content) > maxContextBytes {
+		return "", fmt.Errorf("context %s is too large: exceeds %d bytes", url, maxContextBytes)
+	}
+
+	return string(content), nil
+}
+
+// readContextFile returns the contents of a context file
+func readContextFile(filename string) (string, error) {
 	file, err := os.Open(filename)
 	if err != nil {
-		return fmt.Errorf("failed to open context file %s: %w", filename, err)
+		return "", fmt.Errorf("failed to open context file %s: %w", filename, err)
 	}
 	defer file.Close()
 
 	content, err := io.ReadAll(file)
 	if err != nil {
-		return fmt.Errorf("failed to read context file %s: %w", filename, err)
+		return "", fmt.Errorf("failed to read context file %s: %w", filename, err)
 	}
 
-	a.context = string(content)
-	return nil
+	return string(content), nil
 }
 
 func (a *Agent) PrintContext() {
 	fmt.Printf("=== Agent: %s ===\n", a.name)
+	if a.systemPrompt != "" {
+		fmt.Printf("System prompt:\n%s\n", a.systemPrompt)
+	}
 	fmt.Printf("Context:\n%s\n", a.context)
 	fmt.Println("=================")
 }
 
-func (a *Agent) SendMessage(message string) (*openai.Response, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+func (a *Agent) SendMessage(message string) (*ai.Response, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), a.requestTimeout())
+	defer cancel()
+
+	req := a.legacyRequest(message)
+
+	start := time.Now()
+	response, err := a.aiBackend.SendMessage(ctx, req)
+	tokens, model := 0, req.Model
+	if response != nil {
+		tokens, model = response.TokensUsed, response.Model
+	}
+	a.logCall("message sent", model, tokens, start, err)
+	return response, err
+}
+
+// SendMessageStream sends a message like SendMessage, calling onChunk with
+// each piece of the reply as it arrives, and returns the aggregated
+// response. When the backend cannot stream, onChunk is called once with the
+// whole content.
+func (a *Agent) SendMessageStream(message string, onChunk func(string)) (*ai.Response, error) {
+	if onChunk == nil {
+		onChunk = func(string) {}
+	}
+
+	streamer, ok := a.aiBackend.(ai.StreamingBackend)
+	if !ok {
+		response, err := a.SendMessage(message)
+		if err == nil && response.Content != "" {
+			onChunk(response.Content)
+		}
+		return response, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.requestTimeout())
 	defer cancel()
 
-	// Create the request
-	req := openai.Request{
-		Messages: []openai.Message{
+	req := a.legacyRequest(message)
+	req.Stream = true
+
+	start := time.Now()
+	response, err := streamResponse(ctx, streamer, req, onChunk)
+	tokens, model := 0, req.Model
+	if response != nil {
+		tokens, model = response.TokensUsed, response.Model
+	}
+	a.logCall("message streamed", model, tokens, start, err)
+	return response, err
+}
+
+// legacyRequest builds the request SendMessage sends for a single message
+func (a *Agent) legacyRequest(message string) ai.Request {
+	return ai.Request{
+		Messages: []ai.Message{
 			{
 				Role:    "user",
 				Content: message,
 			},
 		},
-		MaxTokens:   &[]int{150}[0],
+		MaxTokens:   &[]int{a.maxTokens()}[0],
 		Temperature: &[]float64{0.7}[0],
 	}
-
-	return a.aiBackend.SendMessage(ctx, req)
 }
 
-func (a *Agent) SendChatCompletion(messages []openai.Message) (*openai.ChatCompletionResponse, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+// streamResponse streams a completion, passing each delta to onChunk, and
+// collects it into a legacy response, taking the model from the backend
+func streamResponse(ctx context.Context, streamer ai.StreamingBackend, req ai.Request, onChunk func(string)) (*ai.Response, error) {
+	chunks, err := streamer.ChatCompletionStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
 
-	// Add system message with context if available
-	allMessages := messages
-	if a.context != "" {
-		systemMessage := openai.Message{
-			Role:    "system",
-			Content: a.context,
+	var content strings.Builder
+	response := &ai.Response{Model: req.Model}
+	for chunk := range chunks {
+		if chunk.Err != nil {
+			return nil, chunk.Err
+		}
+		if chunk.Delta != "" {
+			content.WriteString(chunk.Delta)
+			onChunk(chunk.Delta)
+		}
+		if chunk.Usage != nil {
+			response.TokensUsed = chunk.Usage.TotalTokens
+		}
+		if chunk.Model != "" {
+			response.Model = chunk.Model
 		}
-		allMessages = append([]openai.Message{systemMessage}, messages...)
 	}
 
+	response.Content = content.String()
+	response.Timestamp = time.Now()
+	return response, nil
+}
+
+// SendChatCompletion sends messages after the system prompt and loaded
+// context. When the prompt would not leave room for the reply in the
+// context window, the oldest messages are dropped; the system context and
+// the latest message are always kept, and ErrContextTooLarge is returned
+// if they alone do not fit.
+func (a *Agent) SendChatCompletion(messages []ai.Message) (*ai.ChatCompletionResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), a.requestTimeout())
+	defer cancel()
+
 	// Create OpenAI Chat Completions request
-	req := openai.ChatCompletionRequest{
+	req := ai.ChatCompletionRequest{
 		Model:       "mock-model-v1",
-		Messages:    allMessages,
-		MaxTokens:   &[]int{150}[0],
+		MaxTokens:   &[]int{a.maxTokens()}[0],
 		Temperature: &[]float64{0.7}[0],
 	}
 
-	return a.aiBackend.ChatCompletion(ctx, req)
+	fitted, err := a.fitContext(req.Model, messages)
+	if err != nil {
+		return nil, err
+	}
+	req.Messages = fitted
+
+	start := time.Now()
+	response, err := a.aiBackend.ChatCompletion(ctx, req)
+	tokens := 0
+	if response != nil {
+		tokens = response.Usage.TotalTokens
+	}
+	a.logCall("chat completion sent", req.Model, tokens, start, err)
+	return response, err
+}
+
+// fitContext prepends the system messages and drops the oldest of messages
+// until the prompt leaves MaxTokens free in the context window
+func (a *Agent) fitContext(model string, messages []ai.Message) ([]ai.Message, error) {
+	budget := a.contextWindow() - a.maxTokens()
+	count := func(messages []ai.Message) int {
+		// On a tokenizer failure the heuristic count is still returned
+		tokens, _ := ai.CountTokens(model, a.withSystemMessages(messages))
+		return tokens
+	}
+
+	trimmed := 0
+	tokens := count(messages)
+	for tokens > budget && len(messages) > 1 {
+		// Tool results cannot outlive the call they answer
+		end := 1
+		for end < len(messages)-1 && messages[end].Role == "tool" {
+			end++
+		}
+		messages = messages[end:]
+		trimmed += end
+		tokens = count(messages)
+	}
+
+	if tokens > budget {
+		return nil, fmt.Errorf("%w: prompt needs %d tokens, %d over the %d left for it in a %d token window",
+			ErrContextTooLarge, tokens, tokens-budget, budget, a.contextWindow())
+	}
+	if trimmed > 0 {
+		a.logger().Warn("trimmed messages to fit the context window",
+			slog.String("agent", a.name),
+			slog.Int("trimmed", trimmed),
+			slog.Int("tokens", tokens),
+		)
+	}
+	return a.withSystemMessages(messages), nil
+}
+
+// withSystemMessages prepends the system prompt and the loaded context to
+// messages, each as its own system message, skipping whichever is empty
+func (a *Agent) withSystemMessages(messages []ai.Message) []ai.Message {
+	var system []ai.Message
+	if a.systemPrompt != "" {
+		system = append(system, ai.Message{Role: "system", Content: a.systemPrompt})
+	}
+	if a.context != "" {
+		system = append(system, ai.Message{Role: "system", Content: a.context})
+	}
+	if len(system) == 0 {
+		return messages
+	}
+	return append(system, messages...)
 }
 
 func main() {
 	// Initialize the mock backend
-	backend := openai.NewMockBackend()
+	backend := mock.NewMockBackend()
 
 	// Check if backend is available
 	ctx := context.Background()
@@ -133,7 +464,7 @@ func main() {
 	fmt.Println("\n=== Test 2: OpenAI Chat Completions ===")
 	fmt.Println("Sending conversation using OpenAI Chat Completions format...")
 
-	messages := []openai.Message{
+	messages := []ai.Message{
 		{Role: "user", Content: "Hello World"},
 		{Role: "assistant", Content: "Hello! How can I help you today?"},
 		{Role: "user", Content: "Can you tell me about task breaking?"},
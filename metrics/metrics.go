@@ -0,0 +1,133 @@
+// Package metrics collects request metrics from the chat controller and
+// exposes them in the Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jeanhaley/task-breaker/chat"
+)
+
+// DefaultBuckets are the request duration histogram bounds in seconds
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// requestKey identifies a series of taskbreaker_requests_total
+type requestKey struct {
+	backend string
+	model   string
+	status  string
+}
+
+// Metrics is a chat.RequestObserver that counts requests, request
+// durations, and tokens. It is safe for concurrent use.
+type Metrics struct {
+	mu       sync.Mutex
+	requests map[requestKey]uint64
+	buckets  []float64
+	counts   []uint64
+	sum      float64
+	count    uint64
+	tokens   map[string]uint64
+}
+
+// New creates an empty Metrics using DefaultBuckets
+func New() *Metrics {
+	return &Metrics{
+		requests: make(map[requestKey]uint64),
+		buckets:  DefaultBuckets,
+		counts:   make([]uint64, len(DefaultBuckets)),
+		tokens:   make(map[string]uint64),
+	}
+}
+
+// ObserveRequest records the outcome of a single send
+func (m *Metrics) ObserveRequest(record chat.RequestRecord) {
+	seconds := record.Duration.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestKey{record.Backend, record.Model, record.Status}]++
+
+	for i, bound := range m.buckets {
+		if seconds <= bound {
+			m.counts[i]++
+		}
+	}
+	m.sum += seconds
+	m.count++
+
+	m.tokens["prompt"] += uint64(record.Usage.PromptTokens)
+	m.tokens["completion"] += uint64(record.Usage.CompletionTokens)
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+
+	m.mu.Lock()
+
+	b.WriteString("# HELP taskbreaker_requests_total Chat requests by backend, model, and status.\n")
+	b.WriteString("# TYPE taskbreaker_requests_total counter\n")
+	keys := make([]requestKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].backend != keys[j].backend {
+			return keys[i].backend < keys[j].backend
+		}
+		if keys[i].model != keys[j].model {
+			return keys[i].model < keys[j].model
+		}
+		return keys[i].status < keys[j].status
+	})
+	for _, key := range keys {
+		fmt.Fprintf(&b, "taskbreaker_requests_total{backend=\"%s\",model=\"%s\",status=\"%s\"} %d\n",
+			escapeLabel(key.backend), escapeLabel(key.model), escapeLabel(key.status), m.requests[key])
+	}
+
+	b.WriteString("# HELP taskbreaker_request_duration_seconds Chat request latency in seconds.\n")
+	b.WriteString("# TYPE taskbreaker_request_duration_seconds histogram\n")
+	for i, bound := range m.buckets {
+		fmt.Fprintf(&b, "taskbreaker_request_duration_seconds_bucket{le=\"%s\"} %d\n", formatFloat(bound), m.counts[i])
+	}
+	fmt.Fprintf(&b, "taskbreaker_request_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.count)
+	fmt.Fprintf(&b, "taskbreaker_request_duration_seconds_sum %s\n", formatFloat(m.sum))
+	fmt.Fprintf(&b, "taskbreaker_request_duration_seconds_count %d\n", m.count)
+
+	b.WriteString("# HELP taskbreaker_tokens_total Tokens used by kind.\n")
+	b.WriteString("# TYPE taskbreaker_tokens_total counter\n")
+	for _, kind := range []string{"completion", "prompt"} {
+		fmt.Fprintf(&b, "taskbreaker_tokens_total{kind=\"%s\"} %d\n", kind, m.tokens[kind])
+	}
+
+	m.mu.Unlock()
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// escapeLabel escapes a label value for the text format
+func escapeLabel(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return strings.ReplaceAll(value, "\n", `\n`)
+}
+
+// formatFloat formats a sample value without trailing zeros
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/backends/mock"
+	"github.com/jeanhaley/task-breaker/chat"
+)
+
+func TestMetrics_ObserveRequest(t *testing.T) {
+	m := New()
+	m.ObserveRequest(chat.RequestRecord{
+		Backend:  "mock",
+		Model:    "mock-model",
+		Status:   chat.StatusOK,
+		Duration: 200 * time.Millisecond,
+		Usage:    ai.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+	})
+	m.ObserveRequest(chat.RequestRecord{
+		Backend:  "mock",
+		Model:    "mock-model",
+		Status:   chat.StatusError,
+		Duration: 2 * time.Second,
+	})
+
+	var b strings.Builder
+	if _, err := m.WriteTo(&b); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	output := b.String()
+
+	expected := []string{
+		`taskbreaker_requests_total{backend="mock",model="mock-model",status="error"} 1`,
+		`taskbreaker_requests_total{backend="mock",model="mock-model",status="ok"} 1`,
+		`taskbreaker_request_duration_seconds_bucket{le="0.1"} 0`,
+		`taskbreaker_request_duration_seconds_bucket{le="0.25"} 1`,
+		`taskbreaker_request_duration_seconds_bucket{le="2.5"} 2`,
+		`taskbreaker_request_duration_seconds_bucket{le="+Inf"} 2`,
+		`taskbreaker_request_duration_seconds_sum 2.2`,
+		`taskbreaker_request_duration_seconds_count 2`,
+		`taskbreaker_tokens_total{kind="completion"} 5`,
+		`taskbreaker_tokens_total{kind="prompt"} 10`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("Expected output to contain %q, got:\n%s", line, output)
+		}
+	}
+}
+
+func TestMetrics_EscapesLabels(t *testing.T) {
+	m := New()
+	m.ObserveRequest(chat.RequestRecord{Backend: `a"b`, Model: "c\\d", Status: chat.StatusOK})
+
+	var b strings.Builder
+	m.WriteTo(&b)
+
+	expected := `taskbreaker_requests_total{backend="a\"b",model="c\\d",status="ok"} 1`
+	if !strings.Contains(b.String(), expected) {
+		t.Errorf("Expected escaped labels %q, got:\n%s", expected, b.String())
+	}
+}
+
+func TestMetrics_ServeHTTP(t *testing.T) {
+	m := New()
+	recorder := httptest.NewRecorder()
+	m.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	if got := recorder.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+		t.Errorf("Expected Prometheus content type, got %q", got)
+	}
+	if !strings.Contains(recorder.Body.String(), "# TYPE taskbreaker_requests_total counter") {
+		t.Errorf("Expected metric metadata, got:\n%s", recorder.Body.String())
+	}
+}
+
+func TestMetrics_ControllerHook(t *testing.T) {
+	backend := mock.NewMockBackend()
+	backend.SetLatency(0)
+	m := New()
+
+	controller := chat.NewController(backend, &chat.ControllerConfig{
+		DefaultModel: "mock-model",
+		Observer:     m,
+	})
+	conversation := controller.CreateConversation("system")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			controller.SendMessage(context.Background(), chat.ChatRequest{
+				ConversationID: conversation.ID,
+				Message:        "hello",
+			})
+		}()
+	}
+	wg.Wait()
+
+	backend.InjectError(&ai.APIError{StatusCode: 400, Message: "bad"})
+	controller.SendMessage(context.Background(), chat.ChatRequest{
+		ConversationID: conversation.ID,
+		Message:        "fail",
+	})
+
+	var b strings.Builder
+	m.WriteTo(&b)
+	output := b.String()
+
+	for _, line := range []string{
+		`status="ok"} 5`,
+		`status="error"} 1`,
+		`taskbreaker_request_duration_seconds_count 6`,
+	} {
+		if !strings.Contains(output, line) {
+			t.Errorf("Expected output to contain %q, got:\n%s", line, output)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/backends/mock"
+	"github.com/jeanhaley/task-breaker/chat"
+)
+
+func TestServer_BodyLimit(t *testing.T) {
+	backend := mock.NewMockBackend()
+	backend.SetLatency(0)
+	controller := chat.NewController(backend, nil)
+	s := NewServer(controller)
+	s.SetMaxBodyBytes(64)
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	conversation := controller.CreateConversation("")
+	url := ts.URL + "/conversations/" + string(conversation.ID) + "/messages"
+	body := `{"message":"` + strings.Repeat("a", 100) + `"}`
+
+	var errResp errorResponse
+	if status := do(t, "POST", url, body, &errResp); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413, got %d (%s)", status, errResp.Error)
+	}
+
+	// Without a declared length the body is cut off while decoding
+	req, _ := http.NewRequest("POST", url, io.MultiReader(strings.NewReader(body)))
+	req.ContentLength = -1
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a chunked body, got %d", resp.StatusCode)
+	}
+
+	if status := do(t, "POST", url, `{"message":"hi"}`, nil); status != http.StatusOK {
+		t.Errorf("Expected a small body to be accepted, got %d", status)
+	}
+}
+
+func TestServer_GzipLargeExport(t *testing.T) {
+	ts, controller, _ := newTestServer(t)
+
+	conversation := &chat.Conversation{ID: "transcript"}
+	for i := 0; i < 50; i++ {
+		conversation.Messages = append(conversation.Messages, ai.Message{Role: "user", Content: strings.Repeat("a long transcript line ", 20)})
+	}
+	if err := controller.RegisterConversation(conversation); err != nil {
+		t.Fatalf("RegisterConversation failed: %v", err)
+	}
+
+	get := func(acceptEncoding string) *http.Response {
+		req, _ := http.NewRequest("GET", ts.URL+"/conversations/"+string(conversation.ID), nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		// Keep the transport from requesting and decoding gzip itself
+		resp, err := (&http.Transport{DisableCompression: true}).RoundTrip(req)
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	plain := get("")
+	if plain.Header.Get("Content-Encoding") != "" {
+		t.Errorf("Expected no encoding without Accept-Encoding, got %q", plain.Header.Get("Content-Encoding"))
+	}
+	plainBody, _ := io.ReadAll(plain.Body)
+
+	compressed := get("br, gzip")
+	if compressed.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected gzip encoding, got %q", compressed.Header.Get("Content-Encoding"))
+	}
+	compressedBody, _ := io.ReadAll(compressed.Body)
+	if len(compressedBody) >= len(plainBody)/2 {
+		t.Errorf("Expected the export to shrink, got %d bytes from %d", len(compressedBody), len(plainBody))
+	}
+
+	reader, err := gzip.NewReader(strings.NewReader(string(compressedBody)))
+	if err != nil {
+		t.Fatalf("Invalid gzip body: %v", err)
+	}
+	var exported chat.Conversation
+	if err := json.NewDecoder(reader).Decode(&exported); err != nil {
+		t.Fatalf("Failed to decode export: %v", err)
+	}
+	if len(exported.Messages) != 50 {
+		t.Errorf("Expected 50 messages, got %d", len(exported.Messages))
+	}
+
+	if refused := get("gzip;q=0"); refused.Header.Get("Content-Encoding") != "" {
+		t.Error("Expected gzip;q=0 to disable compression")
+	}
+}
+
+func TestServer_GzipSkipsEmptyResponses(t *testing.T) {
+	ts, controller, _ := newTestServer(t)
+	conversation := controller.CreateConversation("")
+
+	req, _ := http.NewRequest("DELETE", ts.URL+"/conversations/"+string(conversation.ID), nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := (&http.Transport{DisableCompression: true}).RoundTrip(req)
+	if err != nil {
+		t.Fatalf("DELETE failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusNoContent || len(body) != 0 || resp.Header.Get("Content-Encoding") != "" {
+		t.Errorf("Expected an empty uncompressed 204, got %d with %d bytes", resp.StatusCode, len(body))
+	}
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+)
+
+// proxy serves the OpenAI /v1/chat/completions API by forwarding requests to
+// an ai.Backend, so OpenAI clients can use any configured backend
+type proxy struct {
+	backend func() ai.Backend
+}
+
+// NewProxyHandler returns an OpenAI-compatible chat completions handler that
+// forwards every request to backend and returns its response unchanged.
+// Requests with "stream": true are answered with server-sent events when
+// the backend implements ai.StreamingBackend, and with 501 otherwise.
+func NewProxyHandler(backend ai.Backend) http.Handler {
+	return &proxy{backend: func() ai.Backend { return backend }}
+}
+
+// openAIError is the error body OpenAI clients expect
+type openAIError struct {
+	Error openAIErrorDetail `json:"error"`
+}
+
+type openAIErrorDetail struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+}
+
+// streamChunk is one "chat.completion.chunk" server-sent event
+type streamChunk struct {
+	ID      string         `json:"id"`
+	Object  string         `json:"object"`
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Choices []streamChoice `json:"choices"`
+	Usage   *ai.Usage      `json:"usage,omitempty"`
+}
+
+type streamChoice struct {
+	Index        int         `json:"index"`
+	Delta        streamDelta `json:"delta"`
+	FinishReason *string     `json:"finish_reason"`
+}
+
+type streamDelta struct {
+	Role      string           `json:"role,omitempty"`
+	Content   string           `json:"content,omitempty"`
+	ToolCalls []streamToolCall `json:"tool_calls,omitempty"`
+}
+
+// streamToolCall adds the index OpenAI uses to assemble streamed tool calls
+type streamToolCall struct {
+	Index int `json:"index"`
+	ai.ToolCall
+}
+
+// ServeHTTP implements http.Handler
+func (p *proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeOpenAIError(w, http.StatusMethodNotAllowed, "invalid_request_error", errors.New("method not allowed"))
+		return
+	}
+
+	var req ai.ChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		status := http.StatusBadRequest
+		if isBodyTooLarge(err) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		writeOpenAIError(w, status, "invalid_request_error", fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if err := ai.ValidateChatCompletionRequest(req); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", err)
+		return
+	}
+
+	backend := p.backend()
+	if req.Stream {
+		p.stream(w, r, backend, req)
+		return
+	}
+
+	response, err := backend.ChatCompletion(r.Context(), req)
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// stream relays a streamed completion as server-sent events
+func (p *proxy) stream(w http.ResponseWriter, r *http.Request, backend ai.Backend, req ai.ChatCompletionRequest) {
+	streaming, ok := backend.(ai.StreamingBackend)
+	if !ok {
+		writeOpenAIError(w, http.StatusNotImplemented, "not_implemented",
+			fmt.Errorf("backend %s does not support streaming", backend.Name()))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeOpenAIError(w, http.StatusNotImplemented, "not_implemented", errors.New("streaming is not supported by this connection"))
+		return
+	}
+
+	chunks, err := streaming.ChatCompletionStream(r.Context(), req)
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	id := fmt.Sprintf("chatcmpl-proxy-%d", time.Now().UnixNano())
+	created := time.Now().Unix()
+	first := true
+
+	for chunk := range chunks {
+		if chunk.Err != nil {
+			writeEvent(w, openAIError{Error: openAIErrorDetail{Message: chunk.Err.Error(), Type: "stream_error"}})
+			flusher.Flush()
+			// Drain so the backend can finish shutting down
+			for range chunks {
+			}
+			return
+		}
+
+		event := streamChunk{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   req.Model,
+			Choices: []streamChoice{{Delta: streamDelta{Content: chunk.Delta}}},
+			Usage:   chunk.Usage,
+		}
+		if first {
+			event.Choices[0].Delta.Role = "assistant"
+			first = false
+		}
+		for i, call := range chunk.ToolCalls {
+			event.Choices[0].Delta.ToolCalls = append(event.Choices[0].Delta.ToolCalls, streamToolCall{Index: i, ToolCall: call})
+		}
+		if chunk.FinishReason != "" {
+			finishReason := chunk.FinishReason
+			event.Choices[0].FinishReason = &finishReason
+		}
+
+		writeEvent(w, event)
+		flusher.Flush()
+	}
+
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	flusher.Flush()
+}
+
+// writeEvent writes v as a server-sent event
+func writeEvent(w http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "data: %s\n\n", data)
+}
+
+// writeBackendError reports a backend failure, passing through the
+// provider's status code when it is known
+func writeBackendError(w http.ResponseWriter, err error) {
+	var apiErr *ai.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode >= 400 {
+		writeOpenAIError(w, apiErr.StatusCode, "api_error", err)
+		return
+	}
+	writeOpenAIError(w, errorStatus(err, http.StatusBadGateway), "api_error", err)
+}
+
+// writeOpenAIError writes an error in the OpenAI error format
+func writeOpenAIError(w http.ResponseWriter, status int, errType string, err error) {
+	writeJSON(w, status, openAIError{Error: openAIErrorDetail{Message: err.Error(), Type: errType}})
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/backends/mock"
+)
+
+// plainBackend hides the mock's streaming support
+type plainBackend struct {
+	ai.Backend
+}
+
+const proxyRequest = `{"model":"gpt-4","messages":[{"role":"user","content":"Hello proxy"}]%s}`
+
+func TestProxy_ChatCompletion(t *testing.T) {
+	ts, _, _ := newTestServer(t)
+
+	var response ai.ChatCompletionResponse
+	status := do(t, "POST", ts.URL+"/v1/chat/completions", strings.Replace(proxyRequest, "%s", "", 1), &response)
+	if status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	if response.Object != "chat.completion" || response.Model != "gpt-4" {
+		t.Errorf("Expected backend response unchanged, got %+v", response)
+	}
+	if !strings.Contains(response.Choices[0].Message.Content, "received: 'Hello proxy'") {
+		t.Errorf("Expected mock reply, got %q", response.Choices[0].Message.Content)
+	}
+
+	var errResp openAIError
+	status = do(t, "POST", ts.URL+"/v1/chat/completions", `{"model":"gpt-4","messages":[]}`, &errResp)
+	if status != http.StatusBadRequest || errResp.Error.Type != "invalid_request_error" {
+		t.Errorf("Expected 400 invalid_request_error, got %d %+v", status, errResp)
+	}
+}
+
+func TestProxy_Stream(t *testing.T) {
+	ts, _, _ := newTestServer(t)
+
+	resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json",
+		strings.NewReader(strings.Replace(proxyRequest, "%s", `,"stream":true`, 1)))
+	if err != nil {
+		t.Fatalf("Post failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("Expected event stream, got %q", got)
+	}
+
+	var content strings.Builder
+	var events []streamChunk
+	done := false
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			done = true
+			break
+		}
+
+		var event streamChunk
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			t.Fatalf("Failed to decode event %q: %v", data, err)
+		}
+		events = append(events, event)
+		content.WriteString(event.Choices[0].Delta.Content)
+	}
+
+	if !done {
+		t.Error("Expected stream to end with [DONE]")
+	}
+	if len(events) < 2 || events[0].Choices[0].Delta.Role != "assistant" {
+		t.Fatalf("Expected several chunks starting with the assistant role, got %+v", events)
+	}
+	last := events[len(events)-1]
+	if last.Choices[0].FinishReason == nil || *last.Choices[0].FinishReason != "stop" || last.Usage == nil {
+		t.Errorf("Expected final chunk with finish reason and usage, got %+v", last)
+	}
+	if !strings.Contains(content.String(), "received: 'Hello proxy'") {
+		t.Errorf("Expected streamed mock reply, got %q", content.String())
+	}
+}
+
+func TestProxy_StreamUnsupported(t *testing.T) {
+	ts := httptest.NewServer(NewProxyHandler(plainBackend{mock.NewMockBackend()}))
+	defer ts.Close()
+
+	var errResp openAIError
+	status := do(t, "POST", ts.URL, strings.Replace(proxyRequest, "%s", `,"stream":true`, 1), &errResp)
+	if status != http.StatusNotImplemented {
+		t.Errorf("Expected 501, got %d", status)
+	}
+	if !strings.Contains(errResp.Error.Message, "does not support streaming") {
+		t.Errorf("Expected explanation, got %q", errResp.Error.Message)
+	}
+}
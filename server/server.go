@@ -0,0 +1,250 @@
+// Package server exposes a chat.Controller over a JSON HTTP API so
+// task-breaker can run as a backend service as well as a CLI.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/chat"
+)
+
+// healthCheckTimeout bounds the backend availability check behind /healthz
+const healthCheckTimeout = 5 * time.Second
+
+// Server serves the conversation API:
+//
+//	POST   /conversations               create a conversation; a repeated Idempotency-Key returns the first one
+//	GET    /conversations               list conversations
+//	GET    /conversations/{id}          get a conversation
+//	POST   /conversations/{id}/messages send a message and return the ChatResponse
+//	DELETE /conversations/{id}          delete a conversation (?confirm=true in safe mode)
+//	PATCH  /conversations/{id}/metadata set metadata keys; an empty value removes a key
+//	GET    /healthz                     report backend availability
+//	POST   /v1/chat/completions         OpenAI-compatible proxy to the active backend
+//	GET    /ws                          WebSocket chat with streamed replies
+type Server struct {
+	controller *chat.Controller
+	mux        *http.ServeMux
+	handler    http.Handler
+
+	maxBodyBytes atomic.Int64
+}
+
+// NewServer creates a server backed by controller
+func NewServer(controller *chat.Controller) *Server {
+	s := &Server{
+		controller: controller,
+		mux:        http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("POST /conversations", s.createConversation)
+	s.mux.HandleFunc("GET /conversations", s.listConversations)
+	s.mux.HandleFunc("GET /conversations/{id}", s.getConversation)
+	s.mux.HandleFunc("POST /conversations/{id}/messages", s.sendMessage)
+	s.mux.HandleFunc("DELETE /conversations/{id}", s.deleteConversation)
+	s.mux.HandleFunc("PATCH /conversations/{id}/metadata", s.updateMetadata)
+	s.mux.HandleFunc("GET /healthz", s.healthz)
+	s.mux.Handle("POST /v1/chat/completions", &proxy{backend: controller.GetBackend})
+	s.mux.HandleFunc("GET /ws", s.chatSocket)
+
+	s.maxBodyBytes.Store(DefaultMaxBodyBytes)
+	s.handler = gzipResponses(limitBody(s.mux, s.maxBodyBytes.Load))
+
+	return s
+}
+
+// SetMaxBodyBytes sets the largest request body accepted on every
+// endpoint. Larger requests are rejected with 413.
+func (s *Server) SetMaxBodyBytes(n int64) {
+	s.maxBodyBytes.Store(n)
+}
+
+// Handle registers an additional handler, such as a metrics endpoint, on
+// the server's mux
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// createConversationRequest is the optional body of POST /conversations
+type createConversationRequest struct {
+	SystemPrompt string `json:"system_prompt,omitempty"`
+}
+
+// errorResponse is the body of every error reply
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// healthResponse is the body of /healthz
+type healthResponse struct {
+	Status  string `json:"status"`
+	Backend string `json:"backend"`
+}
+
+func (s *Server) createConversation(w http.ResponseWriter, r *http.Request) {
+	var req createConversationRequest
+	if err := decodeBody(r, &req); err != nil {
+		writeError(w, errorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" {
+		writeJSON(w, http.StatusCreated, s.controller.CreateConversation(req.SystemPrompt))
+		return
+	}
+
+	conversation, created, err := s.controller.CreateConversationIdempotent(key, req.SystemPrompt)
+	if err != nil {
+		writeError(w, errorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, conversation)
+}
+
+func (s *Server) listConversations(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.controller.ListConversations())
+}
+
+func (s *Server) getConversation(w http.ResponseWriter, r *http.Request) {
+	conversation, err := s.controller.GetConversation(chat.ConversationID(r.PathValue("id")))
+	if err != nil {
+		writeError(w, errorStatus(err, http.StatusInternalServerError), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, conversation)
+}
+
+func (s *Server) sendMessage(w http.ResponseWriter, r *http.Request) {
+	var req chat.ChatRequest
+	if err := decodeBody(r, &req); err != nil {
+		writeError(w, errorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+	req.ConversationID = chat.ConversationID(r.PathValue("id"))
+
+	response, err := s.controller.SendMessage(r.Context(), req)
+	if err != nil {
+		// Anything not caused by the request itself is a backend failure
+		writeError(w, errorStatus(err, http.StatusBadGateway), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) deleteConversation(w http.ResponseWriter, r *http.Request) {
+	var confirm []chat.ConfirmationToken
+	if r.URL.Query().Get("confirm") == "true" {
+		confirm = append(confirm, chat.Confirm)
+	}
+
+	if err := s.controller.DeleteConversation(chat.ConversationID(r.PathValue("id")), confirm...); err != nil {
+		writeError(w, errorStatus(err, http.StatusInternalServerError), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) updateMetadata(w http.ResponseWriter, r *http.Request) {
+	var updates map[string]string
+	if err := decodeBody(r, &updates); err != nil {
+		writeError(w, errorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+
+	id := chat.ConversationID(r.PathValue("id"))
+	for key, value := range updates {
+		if err := s.controller.SetMetadata(id, key, value); err != nil {
+			writeError(w, errorStatus(err, http.StatusBadRequest), err)
+			return
+		}
+	}
+
+	metadata, err := s.controller.GetMetadata(id)
+	if err != nil {
+		writeError(w, errorStatus(err, http.StatusInternalServerError), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, metadata)
+}
+
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+
+	health := healthResponse{Status: "ok", Backend: s.controller.GetBackend().Name()}
+	if !s.controller.IsBackendAvailable(ctx) {
+		health.Status = "unavailable"
+		writeJSON(w, http.StatusServiceUnavailable, health)
+		return
+	}
+	writeJSON(w, http.StatusOK, health)
+}
+
+// statusClientClosedRequest is the nonstandard status logged when the
+// client went away before the response was ready
+const statusClientClosedRequest = 499
+
+// errorStatus maps controller errors to HTTP status codes, using fallback
+// for errors it does not recognize
+func errorStatus(err error, fallback int) int {
+	switch {
+	case errors.Is(err, chat.ErrConversationNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ai.ErrInvalidRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, chat.ErrConfirmationRequired):
+		return http.StatusPreconditionRequired
+	case errors.Is(err, ai.ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, ai.ErrContextCanceled):
+		return statusClientClosedRequest
+	case errors.Is(err, ai.ErrBackendUnavailable):
+		return http.StatusServiceUnavailable
+	case isBodyTooLarge(err):
+		return http.StatusRequestEntityTooLarge
+	default:
+		return fallback
+	}
+}
+
+// decodeBody decodes a JSON request body into v. An empty body leaves v
+// unchanged.
+func decodeBody(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+// writeJSON writes v as a JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes err as a JSON error response
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
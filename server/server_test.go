@@ -0,0 +1,228 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/backends/mock"
+	"github.com/jeanhaley/task-breaker/chat"
+)
+
+func newTestServer(t *testing.T) (*httptest.Server, *chat.Controller, *mock.MockBackend) {
+	t.Helper()
+
+	backend := mock.NewMockBackend()
+	backend.SetLatency(0)
+	controller := chat.NewController(backend, nil)
+	ts := httptest.NewServer(NewServer(controller))
+	t.Cleanup(ts.Close)
+
+	return ts, controller, backend
+}
+
+func do(t *testing.T, method, url, body string, v interface{}) int {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("Failed to decode %s %s response: %v", method, url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestServer_ConversationLifecycle(t *testing.T) {
+	ts, _, _ := newTestServer(t)
+
+	var created chat.Conversation
+	if status := do(t, "POST", ts.URL+"/conversations", `{"system_prompt":"Be brief."}`, &created); status != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", status)
+	}
+	if created.ID == "" || len(created.Messages) != 1 {
+		t.Fatalf("Expected conversation with system prompt, got %+v", created)
+	}
+	convURL := ts.URL + "/conversations/" + string(created.ID)
+
+	var response chat.ChatResponse
+	if status := do(t, "POST", convURL+"/messages", `{"message":"Hello"}`, &response); status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	if !strings.Contains(response.Message.Content, "received: 'Hello'") {
+		t.Errorf("Expected mock reply, got %q", response.Message.Content)
+	}
+
+	var fetched chat.Conversation
+	if status := do(t, "GET", convURL, "", &fetched); status != http.StatusOK || len(fetched.Messages) != 3 {
+		t.Errorf("Expected 200 with 3 messages, got %d with %d", status, len(fetched.Messages))
+	}
+
+	var listed []chat.Conversation
+	if status := do(t, "GET", ts.URL+"/conversations", "", &listed); status != http.StatusOK || len(listed) != 1 {
+		t.Errorf("Expected 200 with 1 conversation, got %d with %d", status, len(listed))
+	}
+
+	if status := do(t, "DELETE", convURL, "", nil); status != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", status)
+	}
+	if status := do(t, "GET", convURL, "", nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404 after delete, got %d", status)
+	}
+}
+
+func TestServer_CreateConversationIdempotent(t *testing.T) {
+	ts, controller, _ := newTestServer(t)
+
+	create := func(key string) (chat.Conversation, int) {
+		t.Helper()
+		req, err := http.NewRequest("POST", ts.URL+"/conversations", strings.NewReader(`{"system_prompt":"Be brief."}`))
+		if err != nil {
+			t.Fatalf("NewRequest failed: %v", err)
+		}
+		req.Header.Set("Idempotency-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST /conversations failed: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var conv chat.Conversation
+		if err := json.NewDecoder(resp.Body).Decode(&conv); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return conv, resp.StatusCode
+	}
+
+	first, status := create("retry-1")
+	if status != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", status)
+	}
+	again, status := create("retry-1")
+	if status != http.StatusOK {
+		t.Errorf("Expected 200 for a repeated key, got %d", status)
+	}
+	if again.ID != first.ID {
+		t.Errorf("Expected repeated key to return %s, got %s", first.ID, again.ID)
+	}
+	other, status := create("retry-2")
+	if status != http.StatusCreated || other.ID == first.ID {
+		t.Errorf("Expected a new conversation for another key, got %d with %s", status, other.ID)
+	}
+
+	if got := len(controller.ListConversations()); got != 2 {
+		t.Errorf("Expected 2 conversations, got %d", got)
+	}
+}
+
+func TestServer_Errors(t *testing.T) {
+	ts, controller, backend := newTestServer(t)
+	conv := controller.CreateConversation("")
+	convURL := ts.URL + "/conversations/" + string(conv.ID)
+
+	var errResp errorResponse
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		want   int
+	}{
+		{"unknown conversation", "POST", ts.URL + "/conversations/missing/messages", `{"message":"hi"}`, http.StatusNotFound},
+		{"empty message", "POST", convURL + "/messages", `{"message":""}`, http.StatusBadRequest},
+		{"malformed body", "POST", convURL + "/messages", `{`, http.StatusBadRequest},
+		{"delete unknown", "DELETE", ts.URL + "/conversations/missing", "", http.StatusNotFound},
+		{"metadata unknown", "PATCH", ts.URL + "/conversations/missing/metadata", `{"user":"u1"}`, http.StatusNotFound},
+		{"metadata empty key", "PATCH", convURL + "/metadata", `{"":"u1"}`, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		errResp = errorResponse{}
+		if status := do(t, test.method, test.url, test.body, &errResp); status != test.want {
+			t.Errorf("%s: expected %d, got %d", test.name, test.want, status)
+		}
+		if errResp.Error == "" {
+			t.Errorf("%s: expected an error message", test.name)
+		}
+	}
+
+	backend.InjectError(errors.New("backend exploded"))
+	if status := do(t, "POST", convURL+"/messages", `{"message":"hi"}`, &errResp); status != http.StatusBadGateway {
+		t.Errorf("Expected 502 for backend failure, got %d", status)
+	}
+
+	backend.InjectError(fmt.Errorf("%w: slow down", ai.ErrRateLimited))
+	if status := do(t, "POST", convURL+"/messages", `{"message":"hi"}`, &errResp); status != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 for rate limiting, got %d", status)
+	}
+
+	backend.InjectError(fmt.Errorf("%w: connection refused", ai.ErrBackendUnavailable))
+	if status := do(t, "POST", convURL+"/messages", `{"message":"hi"}`, &errResp); status != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 for unavailable backend, got %d", status)
+	}
+
+	controller.SetSafeMode(true)
+	if status := do(t, "DELETE", convURL, "", &errResp); status != http.StatusPreconditionRequired {
+		t.Errorf("Expected 428 without confirmation, got %d", status)
+	}
+	if status := do(t, "DELETE", convURL+"?confirm=true", "", nil); status != http.StatusNoContent {
+		t.Errorf("Expected 204 with confirmation, got %d", status)
+	}
+}
+
+func TestServer_Healthz(t *testing.T) {
+	ts, _, _ := newTestServer(t)
+
+	var health healthResponse
+	if status := do(t, "GET", ts.URL+"/healthz", "", &health); status != http.StatusOK {
+		t.Errorf("Expected 200, got %d", status)
+	}
+	if health.Status != "ok" || health.Backend != "MockAI" {
+		t.Errorf("Expected ok from MockAI, got %+v", health)
+	}
+}
+
+func TestServer_Handle(t *testing.T) {
+	s := NewServer(chat.NewController(mock.NewMockBackend(), nil))
+	s.Handle("GET /metrics", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("metrics"))
+	}))
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	if recorder.Body.String() != "metrics" {
+		t.Errorf("Expected registered handler to serve, got %q", recorder.Body.String())
+	}
+}
+
+func TestServer_UpdateMetadata(t *testing.T) {
+	ts, controller, _ := newTestServer(t)
+	conv := controller.CreateConversation("")
+	url := ts.URL + "/conversations/" + string(conv.ID) + "/metadata"
+
+	var metadata map[string]string
+	if status := do(t, "PATCH", url, `{"user_id":"u-42","project":"apollo"}`, &metadata); status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	metadata = nil
+	if status := do(t, "PATCH", url, `{"project":""}`, &metadata); status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	if len(metadata) != 1 || metadata["user_id"] != "u-42" {
+		t.Errorf("Expected only user_id=u-42, got %v", metadata)
+	}
+}
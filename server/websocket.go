@@ -0,0 +1,176 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/chat"
+)
+
+// wsWriteTimeout bounds each frame written to a socket, so a stalled
+// client cannot hold a stream open forever
+const wsWriteTimeout = 10 * time.Second
+
+// Frame types sent to WebSocket clients
+const (
+	frameToken = "token"
+	frameDone  = "done"
+	frameError = "error"
+)
+
+// upgrader accepts same-origin WebSocket connections only
+var upgrader = websocket.Upgrader{}
+
+// wsFrame is a frame sent to WebSocket clients. Token frames carry the
+// next piece of the reply, the done frame carries usage and the full
+// response, and error frames report a failed message without closing the
+// socket.
+type wsFrame struct {
+	Type           string              `json:"type"`
+	ConversationID chat.ConversationID `json:"conversation_id,omitempty"`
+	Delta          string              `json:"delta,omitempty"`
+	Usage          *ai.Usage           `json:"usage,omitempty"`
+	Response       *chat.ChatResponse  `json:"response,omitempty"`
+	Error          string              `json:"error,omitempty"`
+}
+
+// wsMessage is a frame read from the client, or the reason it could not be
+// read
+type wsMessage struct {
+	request chat.ChatRequest
+	err     error
+}
+
+// chatSocket serves a live chat over a WebSocket. The client sends
+// chat.ChatRequest frames such as {"conversation_id": "...", "message":
+// "..."} and each reply is streamed back as token frames followed by a done
+// frame. A frame without a conversation_id continues the socket's current
+// conversation, which is created on the first message. Messages on one
+// socket are answered in order; cancelling the request context closes the
+// socket.
+func (s *Server) chatSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already replied with an HTTP error
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	messages := make(chan wsMessage)
+	go readMessages(ctx, cancel, conn, messages)
+
+	var current chat.ConversationID
+	for {
+		select {
+		case <-ctx.Done():
+			deadline := time.Now().Add(wsWriteTimeout)
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), deadline)
+			return
+		case message := <-messages:
+			if message.err != nil {
+				writeFrame(conn, wsFrame{Type: frameError, Error: message.err.Error()})
+				continue
+			}
+
+			request := message.request
+			created := false
+			if request.ConversationID == "" {
+				if current == "" {
+					current = s.controller.CreateConversation(request.SystemPrompt).ID
+					created = true
+				}
+				request.ConversationID = current
+			}
+			current = request.ConversationID
+
+			events, err := s.controller.SendMessageStream(ctx, request)
+			if err != nil {
+				// A rejected first message leaves no conversation behind
+				if created {
+					s.controller.DeleteConversation(current, chat.Confirm)
+					current = ""
+					request.ConversationID = ""
+				}
+				if err := writeFrame(conn, wsFrame{Type: frameError, ConversationID: request.ConversationID, Error: err.Error()}); err != nil {
+					cancel()
+				}
+				continue
+			}
+			if err := streamReply(conn, request.ConversationID, events); err != nil {
+				cancel()
+			}
+		}
+	}
+}
+
+// readMessages decodes client frames until the socket fails or closes,
+// then cancels the connection
+func readMessages(ctx context.Context, cancel context.CancelFunc, conn *websocket.Conn, messages chan<- wsMessage) {
+	defer cancel()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var message wsMessage
+		if err := json.Unmarshal(data, &message.request); err != nil {
+			message.err = fmt.Errorf("invalid frame: %w", err)
+		}
+
+		select {
+		case messages <- message:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// streamReply streams the reply to one message to the client. A failed
+// reply is reported in an error frame; the returned error is reserved for a
+// socket that can no longer be written to.
+func streamReply(conn *websocket.Conn, id chat.ConversationID, events <-chan chat.StreamEvent) error {
+	// Keep reading after a write failure, since the stream must be drained
+	var writeErr error
+	for event := range events {
+		if writeErr != nil {
+			continue
+		}
+
+		frame := wsFrame{Type: frameToken, ConversationID: id, Delta: event.Delta}
+		switch {
+		case event.Err != nil:
+			if errors.Is(event.Err, context.Canceled) {
+				continue
+			}
+			frame = wsFrame{Type: frameError, ConversationID: id, Error: event.Err.Error()}
+		case event.Response != nil:
+			frame = wsFrame{Type: frameDone, ConversationID: id, Response: event.Response}
+			if event.Response.Response != nil {
+				frame.Usage = &event.Response.Response.Usage
+			}
+		case event.Delta == "":
+			continue
+		}
+		writeErr = writeFrame(conn, frame)
+	}
+	return writeErr
+}
+
+// writeFrame writes a single JSON frame
+func writeFrame(conn *websocket.Conn, frame wsFrame) error {
+	conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return conn.WriteJSON(frame)
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/jeanhaley/task-breaker/chat"
+)
+
+func dialSocket(t *testing.T, serverURL string) *websocket.Conn {
+	t.Helper()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(serverURL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readReply reads frames until the done or error frame that ends a reply
+func readReply(t *testing.T, conn *websocket.Conn) (string, wsFrame) {
+	t.Helper()
+
+	var content strings.Builder
+	for {
+		var frame wsFrame
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatalf("ReadJSON failed: %v", err)
+		}
+		if frame.Type != frameToken {
+			return content.String(), frame
+		}
+		content.WriteString(frame.Delta)
+	}
+}
+
+func TestServer_WebSocketChat(t *testing.T) {
+	ts, controller, backend := newTestServer(t)
+	backend.SetResponses([]string{"first reply", "second reply"})
+	conn := dialSocket(t, ts.URL)
+
+	conn.WriteJSON(chat.ChatRequest{Message: "hello"})
+	content, done := readReply(t, conn)
+	if done.Type != frameDone || content != "first reply" {
+		t.Fatalf("Expected streamed first reply, got %q and %+v", content, done)
+	}
+	if done.Usage == nil || done.ConversationID == "" {
+		t.Errorf("Expected done frame with usage and conversation, got %+v", done)
+	}
+
+	// Frames without an ID continue the socket's conversation
+	conn.WriteJSON(chat.ChatRequest{Message: "again"})
+	if content, _ := readReply(t, conn); content != "second reply" {
+		t.Errorf("Expected second reply, got %q", content)
+	}
+	conversation, err := controller.GetConversation(done.ConversationID)
+	if err != nil {
+		t.Fatalf("GetConversation failed: %v", err)
+	}
+	if len(conversation.Messages) != 4 {
+		t.Errorf("Expected 4 messages in one conversation, got %d", len(conversation.Messages))
+	}
+
+	conn.WriteJSON(chat.ChatRequest{ConversationID: "missing", Message: "hi"})
+	if _, frame := readReply(t, conn); frame.Type != frameError || !strings.Contains(frame.Error, "not found") {
+		t.Errorf("Expected not found error frame, got %+v", frame)
+	}
+
+	conn.WriteMessage(websocket.TextMessage, []byte("{not json"))
+	if _, frame := readReply(t, conn); frame.Type != frameError {
+		t.Errorf("Expected error frame for invalid JSON, got %+v", frame)
+	}
+}
+
+func TestServer_WebSocketConcurrentSockets(t *testing.T) {
+	ts, controller, _ := newTestServer(t)
+
+	var wg sync.WaitGroup
+	ids := make(chan chat.ConversationID, 5)
+	for i := 0; i < 5; i++ {
+		conn := dialSocket(t, ts.URL)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 3; j++ {
+				conn.WriteJSON(chat.ChatRequest{Message: "hello"})
+				var frame wsFrame
+				for frame.Type != frameDone && frame.Type != frameError {
+					frame = wsFrame{}
+					if err := conn.ReadJSON(&frame); err != nil {
+						t.Errorf("ReadJSON failed: %v", err)
+						return
+					}
+				}
+				if frame.Type == frameError {
+					t.Errorf("Unexpected error frame: %s", frame.Error)
+				}
+				if j == 0 {
+					ids <- frame.ConversationID
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	for id := range ids {
+		conversation, err := controller.GetConversation(id)
+		if err != nil {
+			t.Fatalf("GetConversation failed: %v", err)
+		}
+		if len(conversation.Messages) != 6 {
+			t.Errorf("Expected each socket to hold its own 6-message conversation, got %d", len(conversation.Messages))
+		}
+	}
+}
+
+func TestServer_WebSocketRejectedFirstMessage(t *testing.T) {
+	ts, controller, backend := newTestServer(t)
+	backend.SetResponses([]string{"reply"})
+	conn := dialSocket(t, ts.URL)
+
+	// An invalid first message leaves no conversation behind
+	conn.WriteJSON(chat.ChatRequest{Message: ""})
+	if _, frame := readReply(t, conn); frame.Type != frameError || frame.ConversationID != "" {
+		t.Errorf("Expected an error frame without a conversation, got %+v", frame)
+	}
+	if conversations := controller.ListConversations(); len(conversations) != 0 {
+		t.Errorf("Expected no conversations, got %d", len(conversations))
+	}
+
+	conn.WriteJSON(chat.ChatRequest{Message: "hello"})
+	if content, done := readReply(t, conn); done.Type != frameDone || content != "reply" {
+		t.Errorf("Expected a reply to the next message, got %q and %+v", content, done)
+	}
+	if conversations := controller.ListConversations(); len(conversations) != 1 {
+		t.Errorf("Expected one conversation, got %d", len(conversations))
+	}
+}
@@ -0,0 +1,340 @@
+// Package sqlite provides a chat.ConversationStore backed by a SQLite file,
+// so conversations survive restarts without running a database server. It
+// uses the pure Go modernc.org/sqlite driver and needs no cgo.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/chat"
+)
+
+// migrations create and upgrade the schema. Each entry moves the database
+// from the version at its index to the next one; the applied version is
+// kept in PRAGMA user_version. Append new migrations, never edit old ones.
+var migrations = []string{
+	`CREATE TABLE conversations (
+		id         TEXT PRIMARY KEY,
+		title      TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL,
+		data       TEXT NOT NULL
+	);
+	CREATE TABLE messages (
+		conversation_id TEXT NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+		position        INTEGER NOT NULL,
+		role            TEXT NOT NULL,
+		content         TEXT NOT NULL,
+		data            TEXT NOT NULL,
+		PRIMARY KEY (conversation_id, position)
+	);
+	CREATE INDEX conversations_created_at ON conversations(created_at);
+	CREATE INDEX conversations_updated_at ON conversations(updated_at);`,
+}
+
+// SortField selects the order List returns conversations in
+type SortField string
+
+const (
+	SortByCreated SortField = "created"
+	SortByUpdated SortField = "updated"
+	SortByTitle   SortField = "title"
+)
+
+// sortColumns maps sort fields to columns
+var sortColumns = map[SortField]string{
+	SortByCreated: "created_at",
+	SortByUpdated: "updated_at",
+	SortByTitle:   "title",
+}
+
+// ListOptions pages and orders the result of ListPage. The zero value lists
+// every conversation, oldest first.
+type ListOptions struct {
+	SortBy     SortField
+	Descending bool
+	// Limit caps the number of conversations returned. Zero means no limit.
+	Limit  int
+	Offset int
+}
+
+// Store is a chat.ConversationStore that keeps conversations in a SQLite
+// database. Conversations and their messages live in separate tables, and
+// fields without a column of their own are kept as JSON. It is safe for
+// concurrent use.
+type Store struct {
+	db *sql.DB
+}
+
+var _ chat.ConversationStore = (*Store)(nil)
+
+// Open opens or creates the database at path and migrates its schema to the
+// current version
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open conversation store: %w", err)
+	}
+	// SQLite allows one writer at a time; a single connection serializes
+	// access instead of failing with SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	if err := migrate(context.Background(), db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// migrate applies the migrations the database has not seen yet
+func migrate(ctx context.Context, db *sql.DB) error {
+	var version int
+	if err := db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("schema version %d is newer than supported version %d", version, len(migrations))
+	}
+
+	for ; version < len(migrations); version++ {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to migrate schema: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, migrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to migrate schema to version %d: %w", version+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to migrate schema to version %d: %w", version+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to migrate schema to version %d: %w", version+1, err)
+		}
+	}
+	return nil
+}
+
+// Get returns a conversation with its messages
+func (s *Store) Get(ctx context.Context, id chat.ConversationID) (*chat.Conversation, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, "SELECT data FROM conversations WHERE id = ?", string(id)).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("conversation %s %w", id, chat.ErrConversationNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read conversation %s: %w", id, err)
+	}
+
+	return s.load(ctx, data)
+}
+
+// Put creates or replaces a conversation. Messages already stored
+// unchanged at the same position are left alone.
+func (s *Store) Put(ctx context.Context, conversation *chat.Conversation) error {
+	if conversation == nil || conversation.ID == "" {
+		return fmt.Errorf("conversation ID is required")
+	}
+
+	// Messages are stored in their own table
+	header := *conversation
+	header.Messages = nil
+	data, err := json.Marshal(header)
+	if err != nil {
+		return fmt.Errorf("failed to encode conversation %s: %w", conversation.ID, err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to store conversation %s: %w", conversation.ID, err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO conversations (id, title, created_at, updated_at, data) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET title = excluded.title, created_at = excluded.created_at,
+			updated_at = excluded.updated_at, data = excluded.data`,
+		string(conversation.ID), conversation.Title,
+		conversation.CreatedAt.UnixNano(), conversation.UpdatedAt.UnixNano(), string(data))
+	if err != nil {
+		return fmt.Errorf("failed to store conversation %s: %w", conversation.ID, err)
+	}
+
+	stored, err := storedMessages(ctx, tx, conversation.ID)
+	if err != nil {
+		return err
+	}
+
+	// Only new or changed messages are written, so appending to a long
+	// conversation costs one insert
+	for i, msg := range conversation.Messages {
+		encoded, err := json.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("failed to encode message %d of conversation %s: %w", i, conversation.ID, err)
+		}
+		if i < len(stored) && stored[i] == string(encoded) {
+			continue
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO messages (conversation_id, position, role, content, data) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(conversation_id, position) DO UPDATE SET role = excluded.role,
+				content = excluded.content, data = excluded.data`,
+			string(conversation.ID), i, msg.Role, msg.Content, string(encoded))
+		if err != nil {
+			return fmt.Errorf("failed to store message %d of conversation %s: %w", i, conversation.ID, err)
+		}
+	}
+
+	// Drop messages removed since the last Put, as by compression
+	if len(stored) > len(conversation.Messages) {
+		_, err := tx.ExecContext(ctx, "DELETE FROM messages WHERE conversation_id = ? AND position >= ?",
+			string(conversation.ID), len(conversation.Messages))
+		if err != nil {
+			return fmt.Errorf("failed to store conversation %s: %w", conversation.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to store conversation %s: %w", conversation.ID, err)
+	}
+	return nil
+}
+
+// storedMessages returns the encoded messages stored for a conversation,
+// in order
+func storedMessages(ctx context.Context, tx *sql.Tx, id chat.ConversationID) ([]string, error) {
+	rows, err := tx.QueryContext(ctx,
+		"SELECT data FROM messages WHERE conversation_id = ? ORDER BY position", string(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read messages of conversation %s: %w", id, err)
+	}
+	defer rows.Close()
+
+	var stored []string
+	for rows.Next() {
+		var encoded string
+		if err := rows.Scan(&encoded); err != nil {
+			return nil, fmt.Errorf("failed to read messages of conversation %s: %w", id, err)
+		}
+		stored = append(stored, encoded)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read messages of conversation %s: %w", id, err)
+	}
+	return stored, nil
+}
+
+// Delete removes a conversation and its messages
+func (s *Store) Delete(ctx context.Context, id chat.ConversationID) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM conversations WHERE id = ?", string(id)); err != nil {
+		return fmt.Errorf("failed to delete conversation %s: %w", id, err)
+	}
+	return nil
+}
+
+// List returns every conversation, oldest first
+func (s *Store) List(ctx context.Context) ([]*chat.Conversation, error) {
+	return s.ListPage(ctx, ListOptions{})
+}
+
+// ListPage returns one page of conversations in the requested order. Ties
+// are broken by ID so pages do not overlap.
+func (s *Store) ListPage(ctx context.Context, options ListOptions) ([]*chat.Conversation, error) {
+	if options.SortBy == "" {
+		options.SortBy = SortByCreated
+	}
+	column, ok := sortColumns[options.SortBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort field %q", options.SortBy)
+	}
+	if options.Limit < 0 || options.Offset < 0 {
+		return nil, fmt.Errorf("limit and offset cannot be negative")
+	}
+
+	direction := "ASC"
+	if options.Descending {
+		direction = "DESC"
+	}
+	limit := options.Limit
+	if limit == 0 {
+		// SQLite treats a negative limit as no limit
+		limit = -1
+	}
+
+	query := fmt.Sprintf("SELECT data FROM conversations ORDER BY %s %s, id %s LIMIT ? OFFSET ?", column, direction, direction)
+	rows, err := s.db.QueryContext(ctx, query, limit, options.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conversations: %w", err)
+	}
+
+	// Read the page before loading messages, since the store has a single
+	// connection
+	var headers []string
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to list conversations: %w", err)
+		}
+		headers = append(headers, data)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list conversations: %w", err)
+	}
+
+	conversations := make([]*chat.Conversation, 0, len(headers))
+	for _, data := range headers {
+		conversation, err := s.load(ctx, data)
+		if err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, conversation)
+	}
+	return conversations, nil
+}
+
+// load decodes a conversation row and reads its messages in order
+func (s *Store) load(ctx context.Context, data string) (*chat.Conversation, error) {
+	var conversation chat.Conversation
+	if err := json.Unmarshal([]byte(data), &conversation); err != nil {
+		return nil, fmt.Errorf("failed to decode conversation: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT data FROM messages WHERE conversation_id = ? ORDER BY position", string(conversation.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read messages of conversation %s: %w", conversation.ID, err)
+	}
+	defer rows.Close()
+
+	conversation.Messages = make([]ai.Message, 0)
+	for rows.Next() {
+		var encoded string
+		if err := rows.Scan(&encoded); err != nil {
+			return nil, fmt.Errorf("failed to read messages of conversation %s: %w", conversation.ID, err)
+		}
+		var msg ai.Message
+		if err := json.Unmarshal([]byte(encoded), &msg); err != nil {
+			return nil, fmt.Errorf("failed to decode message of conversation %s: %w", conversation.ID, err)
+		}
+		conversation.Messages = append(conversation.Messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read messages of conversation %s: %w", conversation.ID, err)
+	}
+	return &conversation, nil
+}
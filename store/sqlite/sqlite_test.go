@@ -0,0 +1,230 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/ai"
+	"github.com/jeanhaley/task-breaker/backends/mock"
+	"github.com/jeanhaley/task-breaker/chat"
+)
+
+func openTestStore(t *testing.T, path string) *Store {
+	t.Helper()
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestStoreSurvivesReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "conversations.db")
+
+	store := openTestStore(t, path)
+	conversation := &chat.Conversation{
+		ID:        "conv_1",
+		Title:     "Trip",
+		Tags:      []string{"travel"},
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Metadata:  map[string]string{"user": "alice"},
+		Messages: []ai.Message{
+			{Role: "system", Content: "You are helpful."},
+			ai.NewMultipartMessage("user", ai.TextPart("Plan a trip"), ai.ImagePart("https://example.com/map.png")),
+			{Role: "assistant", Content: "Sure"},
+		},
+		Usage: ai.Usage{TotalTokens: 42},
+	}
+	if err := store.Put(ctx, conversation); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	store.Close()
+
+	reopened := openTestStore(t, path)
+	got, err := reopened.Get(ctx, "conv_1")
+	if err != nil {
+		t.Fatalf("Get after reopen failed: %v", err)
+	}
+	if got.Title != "Trip" || got.Metadata["user"] != "alice" || got.Usage.TotalTokens != 42 {
+		t.Errorf("Expected conversation fields to survive, got %+v", got)
+	}
+	if len(got.Messages) != 3 || got.Messages[2].Content != "Sure" {
+		t.Fatalf("Expected 3 messages in order, got %+v", got.Messages)
+	}
+	if len(got.Messages[1].ContentParts) != 2 {
+		t.Errorf("Expected multimodal content to survive, got %+v", got.Messages[1])
+	}
+	if !got.CreatedAt.Equal(conversation.CreatedAt) {
+		t.Errorf("Expected created time %v, got %v", conversation.CreatedAt, got.CreatedAt)
+	}
+}
+
+func TestStorePutReplacesMessages(t *testing.T) {
+	ctx := context.Background()
+	store := openTestStore(t, filepath.Join(t.TempDir(), "conversations.db"))
+
+	conversation := &chat.Conversation{ID: "conv_1", Messages: []ai.Message{
+		{Role: "user", Content: "one"}, {Role: "assistant", Content: "two"},
+	}}
+	if err := store.Put(ctx, conversation); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	conversation.Messages = conversation.Messages[:1]
+	if err := store.Put(ctx, conversation); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	got, err := store.Get(ctx, "conv_1")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if len(got.Messages) != 1 {
+		t.Errorf("Expected 1 message after replacing, got %d", len(got.Messages))
+	}
+
+	if err := store.Delete(ctx, "conv_1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := store.Get(ctx, "conv_1"); !errors.Is(err, chat.ErrConversationNotFound) {
+		t.Errorf("Expected ErrConversationNotFound after Delete, got %v", err)
+	}
+}
+
+func TestStoreListPage(t *testing.T) {
+	ctx := context.Background()
+	store := openTestStore(t, filepath.Join(t.TempDir(), "conversations.db"))
+
+	start := time.Now()
+	for i, title := range []string{"charlie", "alpha", "bravo"} {
+		at := start.Add(time.Duration(i) * time.Minute)
+		conversation := &chat.Conversation{
+			ID:        chat.ConversationID("conv_" + title),
+			Title:     title,
+			CreatedAt: at,
+			UpdatedAt: at.Add(time.Duration(-2*i) * time.Hour),
+		}
+		if err := store.Put(ctx, conversation); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		options ListOptions
+		want    []string
+	}{
+		{"default", ListOptions{}, []string{"charlie", "alpha", "bravo"}},
+		{"by title", ListOptions{SortBy: SortByTitle}, []string{"alpha", "bravo", "charlie"}},
+		{"recently updated", ListOptions{SortBy: SortByUpdated, Descending: true}, []string{"charlie", "alpha", "bravo"}},
+		{"page", ListOptions{SortBy: SortByTitle, Limit: 1, Offset: 1}, []string{"bravo"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conversations, err := store.ListPage(ctx, tt.options)
+			if err != nil {
+				t.Fatalf("ListPage failed: %v", err)
+			}
+			var titles []string
+			for _, conversation := range conversations {
+				titles = append(titles, conversation.Title)
+			}
+			if len(titles) != len(tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, titles)
+			}
+			for i := range titles {
+				if titles[i] != tt.want[i] {
+					t.Errorf("Expected %v, got %v", tt.want, titles)
+					break
+				}
+			}
+		})
+	}
+
+	if _, err := store.ListPage(ctx, ListOptions{SortBy: "size"}); err == nil {
+		t.Error("Expected an unknown sort field to fail")
+	}
+}
+
+func TestControllerWithStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conversations.db")
+
+	store := openTestStore(t, path)
+	controller := chat.NewController(mock.NewMockBackend(), &chat.ControllerConfig{DefaultModel: "gpt-4", Store: store})
+	conversation := controller.CreateConversation("You are helpful.")
+	if _, err := controller.SendMessage(context.Background(), chat.ChatRequest{ConversationID: conversation.ID, Message: "Hello"}); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	controller.Stop()
+	store.Close()
+
+	// A new controller on the reopened file picks up where the first left off
+	restarted := chat.NewController(mock.NewMockBackend(), &chat.ControllerConfig{DefaultModel: "gpt-4", Store: openTestStore(t, path)})
+	restored, err := restarted.GetConversation(conversation.ID)
+	if err != nil {
+		t.Fatalf("Expected conversation after restart: %v", err)
+	}
+	if len(restored.Messages) != 3 {
+		t.Errorf("Expected 3 messages after restart, got %d", len(restored.Messages))
+	}
+}
+
+func TestStorePutWritesOnlyChangedMessages(t *testing.T) {
+	ctx := context.Background()
+	store := openTestStore(t, filepath.Join(t.TempDir(), "conversations.db"))
+
+	conversation := &chat.Conversation{
+		ID: "conv_1",
+		Messages: []ai.Message{
+			{Role: "system", Content: "You are helpful."},
+			{Role: "user", Content: "Hello"},
+		},
+	}
+	if err := store.Put(ctx, conversation); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	var firstRow int64
+	if err := store.db.QueryRowContext(ctx, "SELECT rowid FROM messages WHERE position = 0").Scan(&firstRow); err != nil {
+		t.Fatalf("Failed to read message row: %v", err)
+	}
+
+	conversation.Messages = append(conversation.Messages, ai.Message{Role: "assistant", Content: "Hi"})
+	conversation.Messages[1].Content = "Hello there"
+	if err := store.Put(ctx, conversation); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	var row int64
+	if err := store.db.QueryRowContext(ctx, "SELECT rowid FROM messages WHERE position = 0").Scan(&row); err != nil {
+		t.Fatalf("Failed to read message row: %v", err)
+	}
+	if row != firstRow {
+		t.Errorf("Expected the unchanged message to keep its row, got rowid %d instead of %d", row, firstRow)
+	}
+
+	got, err := store.Get(ctx, "conv_1")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if len(got.Messages) != 3 || got.Messages[1].Content != "Hello there" || got.Messages[2].Content != "Hi" {
+		t.Errorf("Expected the changed and appended messages, got %+v", got.Messages)
+	}
+
+	// Shortening the history removes the dropped messages
+	conversation.Messages = conversation.Messages[:1]
+	if err := store.Put(ctx, conversation); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	got, err = store.Get(ctx, "conv_1")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if len(got.Messages) != 1 {
+		t.Errorf("Expected 1 message after shortening, got %d", len(got.Messages))
+	}
+}
@@ -0,0 +1,199 @@
+// Package tasks holds the task breakdown types produced when a goal is split
+// into subtasks, along with checks that a breakdown is sound to execute.
+package tasks
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Subtask is a single step of a task breakdown
+type Subtask struct {
+	// ID uniquely identifies the subtask within its breakdown
+	ID string `json:"id"`
+	// Description says what the subtask should accomplish
+	Description string `json:"description"`
+	// DependsOn lists the IDs of subtasks that must complete first
+	DependsOn []string `json:"depends_on,omitempty"`
+}
+
+// Problem categorizes why a dependency graph is invalid
+type Problem string
+
+const (
+	// ProblemEmptyID means a subtask has no ID
+	ProblemEmptyID Problem = "empty id"
+	// ProblemDuplicateID means several subtasks share an ID
+	ProblemDuplicateID Problem = "duplicate id"
+	// ProblemDanglingDependency means a subtask depends on an unknown ID
+	ProblemDanglingDependency Problem = "dangling dependency"
+	// ProblemCycle means subtasks depend on each other in a loop
+	ProblemCycle Problem = "dependency cycle"
+)
+
+// GraphError describes the first problem found in a dependency graph and
+// the nodes involved
+type GraphError struct {
+	Problem Problem
+	// Nodes lists the offending subtask IDs. For cycles they are in cycle
+	// order with the first node repeated at the end.
+	Nodes []string
+	// Detail adds context such as the missing dependency ID
+	Detail string
+}
+
+// Error implements the error interface
+func (e *GraphError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid task graph: %s", e.Problem)
+
+	separator := ", "
+	if e.Problem == ProblemCycle {
+		separator = " -> "
+	}
+	if len(e.Nodes) > 0 {
+		fmt.Fprintf(&b, ": %s", strings.Join(e.Nodes, separator))
+	}
+	if e.Detail != "" {
+		fmt.Fprintf(&b, " (%s)", e.Detail)
+	}
+	return b.String()
+}
+
+// ValidateGraph checks that a breakdown forms a sound dependency graph: every
+// subtask has a unique non-empty ID, every dependency refers to a known
+// subtask, and there are no cycles. It returns a *GraphError naming the
+// problem nodes, or nil when the graph is valid.
+func ValidateGraph(subtasks []Subtask) error {
+	index := make(map[string]int, len(subtasks))
+	var duplicates []string
+	for i, subtask := range subtasks {
+		if subtask.ID == "" {
+			return &GraphError{Problem: ProblemEmptyID, Detail: fmt.Sprintf("subtask at position %d", i+1)}
+		}
+		if _, seen := index[subtask.ID]; seen {
+			duplicates = append(duplicates, subtask.ID)
+			continue
+		}
+		index[subtask.ID] = i
+	}
+	if len(duplicates) > 0 {
+		return &GraphError{Problem: ProblemDuplicateID, Nodes: uniqueSorted(duplicates)}
+	}
+
+	for _, subtask := range subtasks {
+		for _, dep := range subtask.DependsOn {
+			if _, ok := index[dep]; !ok {
+				return &GraphError{
+					Problem: ProblemDanglingDependency,
+					Nodes:   []string{subtask.ID},
+					Detail:  fmt.Sprintf("depends on unknown subtask %q", dep),
+				}
+			}
+		}
+	}
+
+	if cycle := findCycle(subtasks, index); cycle != nil {
+		return &GraphError{Problem: ProblemCycle, Nodes: cycle}
+	}
+
+	return nil
+}
+
+// TopologicalOrder returns the subtasks ordered so each comes after all of
+// its dependencies. Whenever several subtasks are ready, the one listed
+// first goes next. It returns ValidateGraph's error if the graph is invalid.
+func TopologicalOrder(subtasks []Subtask) ([]Subtask, error) {
+	if err := ValidateGraph(subtasks); err != nil {
+		return nil, err
+	}
+
+	placed := make(map[string]bool, len(subtasks))
+	ordered := make([]Subtask, 0, len(subtasks))
+	for len(ordered) < len(subtasks) {
+		// An acyclic graph always has a ready subtask
+		for _, subtask := range subtasks {
+			if !placed[subtask.ID] && allPlaced(subtask.DependsOn, placed) {
+				placed[subtask.ID] = true
+				ordered = append(ordered, subtask)
+				break
+			}
+		}
+	}
+	return ordered, nil
+}
+
+// allPlaced reports whether every ID in ids is in placed
+func allPlaced(ids []string, placed map[string]bool) bool {
+	for _, id := range ids {
+		if !placed[id] {
+			return false
+		}
+	}
+	return true
+}
+
+// findCycle returns the IDs along the first dependency cycle found, with the
+// starting node repeated at the end, or nil if the graph is acyclic
+func findCycle(subtasks []Subtask, index map[string]int) []string {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+
+	state := make([]int, len(subtasks))
+	var path []string
+
+	var visit func(i int) []string
+	visit = func(i int) []string {
+		state[i] = visiting
+		path = append(path, subtasks[i].ID)
+
+		for _, dep := range subtasks[i].DependsOn {
+			j := index[dep]
+			switch state[j] {
+			case visiting:
+				// Found a back edge, slice the path from where the cycle starts
+				for k, id := range path {
+					if id == dep {
+						cycle := append([]string{}, path[k:]...)
+						return append(cycle, dep)
+					}
+				}
+			case unvisited:
+				if cycle := visit(j); cycle != nil {
+					return cycle
+				}
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[i] = done
+		return nil
+	}
+
+	for i := range subtasks {
+		if state[i] == unvisited {
+			if cycle := visit(i); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// uniqueSorted returns the distinct values of ids in sorted order
+func uniqueSorted(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	var unique []string
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
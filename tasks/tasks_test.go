@@ -0,0 +1,136 @@
+package tasks
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateGraph(t *testing.T) {
+	tests := []struct {
+		name     string
+		subtasks []Subtask
+		problem  Problem
+		nodes    []string
+	}{
+		{
+			name:     "empty breakdown",
+			subtasks: nil,
+		},
+		{
+			name: "valid diamond",
+			subtasks: []Subtask{
+				{ID: "1", Description: "design"},
+				{ID: "2", Description: "backend", DependsOn: []string{"1"}},
+				{ID: "3", Description: "frontend", DependsOn: []string{"1"}},
+				{ID: "4", Description: "ship", DependsOn: []string{"2", "3"}},
+			},
+		},
+		{
+			name: "empty id",
+			subtasks: []Subtask{
+				{ID: "1"},
+				{ID: ""},
+			},
+			problem: ProblemEmptyID,
+		},
+		{
+			name: "duplicate ids",
+			subtasks: []Subtask{
+				{ID: "b"},
+				{ID: "a"},
+				{ID: "b"},
+				{ID: "a"},
+				{ID: "b"},
+			},
+			problem: ProblemDuplicateID,
+			nodes:   []string{"a", "b"},
+		},
+		{
+			name: "dangling dependency",
+			subtasks: []Subtask{
+				{ID: "1"},
+				{ID: "2", DependsOn: []string{"1", "9"}},
+			},
+			problem: ProblemDanglingDependency,
+			nodes:   []string{"2"},
+		},
+		{
+			name: "self dependency",
+			subtasks: []Subtask{
+				{ID: "1", DependsOn: []string{"1"}},
+			},
+			problem: ProblemCycle,
+			nodes:   []string{"1", "1"},
+		},
+		{
+			name: "three node cycle behind a valid prefix",
+			subtasks: []Subtask{
+				{ID: "root"},
+				{ID: "a", DependsOn: []string{"root", "c"}},
+				{ID: "b", DependsOn: []string{"a"}},
+				{ID: "c", DependsOn: []string{"b"}},
+			},
+			problem: ProblemCycle,
+			nodes:   []string{"a", "c", "b", "a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateGraph(tt.subtasks)
+
+			if tt.problem == "" {
+				if err != nil {
+					t.Fatalf("Expected valid graph, got: %v", err)
+				}
+				return
+			}
+
+			var graphErr *GraphError
+			if !errors.As(err, &graphErr) {
+				t.Fatalf("Expected *GraphError, got %v", err)
+			}
+			if graphErr.Problem != tt.problem {
+				t.Errorf("Expected problem %q, got %q", tt.problem, graphErr.Problem)
+			}
+			if tt.nodes != nil && !reflect.DeepEqual(graphErr.Nodes, tt.nodes) {
+				t.Errorf("Expected nodes %v, got %v", tt.nodes, graphErr.Nodes)
+			}
+			for _, node := range tt.nodes {
+				if !strings.Contains(err.Error(), node) {
+					t.Errorf("Error message should name node %q: %v", node, err)
+				}
+			}
+		})
+	}
+}
+
+func TestTopologicalOrder(t *testing.T) {
+	subtasks := []Subtask{
+		{ID: "ship", DependsOn: []string{"backend", "frontend"}},
+		{ID: "frontend", DependsOn: []string{"design"}},
+		{ID: "design"},
+		{ID: "backend", DependsOn: []string{"design"}},
+		{ID: "docs"},
+	}
+
+	ordered, err := TopologicalOrder(subtasks)
+	if err != nil {
+		t.Fatalf("TopologicalOrder failed: %v", err)
+	}
+	var ids []string
+	for _, subtask := range ordered {
+		ids = append(ids, subtask.ID)
+	}
+	if want := []string{"design", "frontend", "backend", "ship", "docs"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("Expected order %v, got %v", want, ids)
+	}
+
+	_, err = TopologicalOrder([]Subtask{{ID: "a", DependsOn: []string{"b"}}, {ID: "b", DependsOn: []string{"a"}}})
+	var graphErr *GraphError
+	if !errors.As(err, &graphErr) || graphErr.Problem != ProblemCycle {
+		t.Errorf("Expected a cycle error, got %v", err)
+	}
+}
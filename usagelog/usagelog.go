@@ -0,0 +1,155 @@
+// Package usagelog appends per-request token usage to a CSV file so spend can
+// be tracked over time in a spreadsheet or loaded into a time-series database.
+package usagelog
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jeanhaley/task-breaker/chat"
+)
+
+// header is written once when the log file is empty
+var header = []string{
+	"timestamp",
+	"conversation_id",
+	"model",
+	"prompt_tokens",
+	"completion_tokens",
+	"total_tokens",
+	"estimated_cost_usd",
+}
+
+// defaultBufferSize is the number of records that can be queued before
+// RecordUsage starts dropping them
+const defaultBufferSize = 256
+
+// Log is a chat.UsageRecorder that writes records to a CSV file from a
+// background goroutine, so recording never blocks a chat request
+type Log struct {
+	file    *os.File
+	buf     *bufio.Writer
+	records chan chat.UsageRecord
+	done    chan struct{}
+
+	// closed is set by Close under mutex, so RecordUsage never sends on
+	// the closed queue
+	mutex  sync.RWMutex
+	closed bool
+
+	// writeErr is the first write failure, set by run and read by Close
+	// once run has exited
+	writeErr error
+
+	closeOnce sync.Once
+	closeErr  error
+	dropped   atomic.Int64
+}
+
+// Open opens or creates the usage log at path, appending to existing data
+func Open(path string) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open usage log %s: %w", path, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to stat usage log %s: %w", path, err)
+	}
+
+	l := &Log{
+		file:    file,
+		buf:     bufio.NewWriter(file),
+		records: make(chan chat.UsageRecord, defaultBufferSize),
+		done:    make(chan struct{}),
+	}
+
+	if info.Size() == 0 {
+		w := csv.NewWriter(l.buf)
+		if err := w.Write(header); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to write usage log header: %w", err)
+		}
+		w.Flush()
+	}
+
+	go l.run()
+	return l, nil
+}
+
+// RecordUsage queues a record for writing. If the queue is full, or the
+// log has been closed, the record is dropped and counted rather than
+// blocking the caller.
+func (l *Log) RecordUsage(record chat.UsageRecord) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	if l.closed {
+		l.dropped.Add(1)
+		return
+	}
+	select {
+	case l.records <- record:
+	default:
+		l.dropped.Add(1)
+	}
+}
+
+// Dropped returns the number of records discarded because the queue was
+// full or the log was closed
+func (l *Log) Dropped() int64 {
+	return l.dropped.Load()
+}
+
+// Close writes any queued records, flushes and closes the file. It returns
+// the first error met while writing records, if any. Records passed to
+// RecordUsage after Close are dropped.
+func (l *Log) Close() error {
+	l.closeOnce.Do(func() {
+		l.mutex.Lock()
+		l.closed = true
+		close(l.records)
+		l.mutex.Unlock()
+		<-l.done
+
+		l.closeErr = l.writeErr
+		if err := l.buf.Flush(); err != nil && l.closeErr == nil {
+			l.closeErr = fmt.Errorf("failed to flush usage log: %w", err)
+		}
+		if err := l.file.Close(); err != nil && l.closeErr == nil {
+			l.closeErr = fmt.Errorf("failed to close usage log: %w", err)
+		}
+	})
+	return l.closeErr
+}
+
+// run drains the record queue into the CSV writer. After a write fails the
+// remaining records are still drained, so the queue never blocks.
+func (l *Log) run() {
+	defer close(l.done)
+
+	w := csv.NewWriter(l.buf)
+	for record := range l.records {
+		w.Write([]string{
+			record.Timestamp.UTC().Format(time.RFC3339),
+			string(record.ConversationID),
+			record.Model,
+			strconv.Itoa(record.PromptTokens),
+			strconv.Itoa(record.CompletionTokens),
+			strconv.Itoa(record.TotalTokens),
+			strconv.FormatFloat(record.EstimatedCostUSD, 'f', 6, 64),
+		})
+		w.Flush()
+		if err := w.Error(); err != nil && l.writeErr == nil {
+			l.writeErr = fmt.Errorf("failed to write usage log: %w", err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package usagelog
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jeanhaley/task-breaker/backends/mock"
+	"github.com/jeanhaley/task-breaker/chat"
+)
+
+func readRecords(t *testing.T, path string) [][]string {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open usage log: %v", err)
+	}
+	defer file.Close()
+
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatalf("Usage log is not valid CSV: %v", err)
+	}
+	return rows
+}
+
+func TestLog_RecordsEverySend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.csv")
+	log, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	controller := chat.NewController(mock.NewMockBackend(), &chat.ControllerConfig{
+		DefaultModel:  "gpt-4",
+		MaxTokens:     100,
+		UsageRecorder: log,
+	})
+	conv := controller.CreateConversation("You are a test assistant.")
+
+	const sends = 5
+	for i := 0; i < sends; i++ {
+		if _, err := controller.SendMessage(context.Background(), chat.ChatRequest{
+			ConversationID: conv.ID,
+			Message:        "How much does this cost?",
+		}); err != nil {
+			t.Fatalf("SendMessage failed: %v", err)
+		}
+	}
+
+	if err := log.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	rows := readRecords(t, path)
+	if len(rows) != sends+1 {
+		t.Fatalf("Expected header plus %d records, got %d rows", sends, len(rows))
+	}
+
+	for i, row := range rows[1:] {
+		if len(row) != len(header) {
+			t.Fatalf("Record %d has %d fields, expected %d", i, len(row), len(header))
+		}
+		if row[1] != string(conv.ID) {
+			t.Errorf("Record %d has conversation ID %q, expected %q", i, row[1], conv.ID)
+		}
+		if row[2] != "gpt-4" {
+			t.Errorf("Record %d has model %q, expected gpt-4", i, row[2])
+		}
+
+		prompt, _ := strconv.Atoi(row[3])
+		completion, _ := strconv.Atoi(row[4])
+		total, _ := strconv.Atoi(row[5])
+		if total == 0 || prompt+completion != total {
+			t.Errorf("Record %d has inconsistent token counts: %v", i, row[3:6])
+		}
+
+		if cost, err := strconv.ParseFloat(row[6], 64); err != nil || cost <= 0 {
+			t.Errorf("Record %d should have a positive cost for gpt-4, got %q", i, row[6])
+		}
+	}
+}
+
+func TestLog_AppendsWithoutRepeatingHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.csv")
+
+	for i := 0; i < 2; i++ {
+		log, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		log.RecordUsage(chat.UsageRecord{ConversationID: "conv", Model: "mock", TotalTokens: 1})
+		if err := log.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+	}
+
+	rows := readRecords(t, path)
+	if len(rows) != 3 {
+		t.Fatalf("Expected header plus 2 records, got %d rows", len(rows))
+	}
+	if rows[0][0] != "timestamp" || rows[1][0] == "timestamp" || rows[2][0] == "timestamp" {
+		t.Errorf("Header should appear exactly once at the top, got %v", rows)
+	}
+}
+
+func TestLog_RecordAfterCloseIsDropped(t *testing.T) {
+	log, err := Open(filepath.Join(t.TempDir(), "usage.csv"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	log.RecordUsage(chat.UsageRecord{ConversationID: "conv", Model: "mock", TotalTokens: 1})
+	if log.Dropped() != 1 {
+		t.Errorf("Expected the late record to be dropped, got %d dropped", log.Dropped())
+	}
+}
+
+func TestLog_CloseReportsWriteErrors(t *testing.T) {
+	log, err := Open(filepath.Join(t.TempDir(), "usage.csv"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	// Writes fail once the file is gone, after the buffer fills up
+	log.file.Close()
+	for i := 0; i < 200; i++ {
+		log.RecordUsage(chat.UsageRecord{ConversationID: "conv", Model: "mock", TotalTokens: i})
+	}
+
+	if err := log.Close(); err == nil || !strings.Contains(err.Error(), "failed to write usage log") {
+		t.Errorf("Expected Close to report the failed writes, got %v", err)
+	}
+}